@@ -0,0 +1,429 @@
+// Package acme adalah client ACME (RFC 8555) minimal untuk ZiVPN API.
+//
+// Hanya alur yang dibutuhkan untuk satu sertifikat server yang didukung:
+// membuat akun, membuat order, menyelesaikan challenge http-01, finalize
+// dengan CSR, lalu mengunduh rantai sertifikat. Directory URL bisa diarahkan
+// ke Let's Encrypt atau ke server uji lokal seperti Pebble.
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LetsEncryptURL adalah directory ACME produksi Let's Encrypt.
+const LetsEncryptURL = "https://acme-v02.api.letsencrypt.org/directory"
+
+// PollInterval dipakai saat menunggu authorization dan order selesai.
+var PollInterval = 2 * time.Second
+
+// Solver memasang jawaban challenge http-01, yaitu menyajikan keyAuth di
+// http://<domain>/.well-known/acme-challenge/<token>.
+type Solver interface {
+	Present(token, keyAuth string) error
+	CleanUp(token string)
+}
+
+// Problem adalah error dari server ACME (RFC 7807).
+type Problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Status int    `json:"status"`
+}
+
+func (p *Problem) Error() string {
+	return fmt.Sprintf("acme: %s (%s)", p.Detail, p.Type)
+}
+
+// Client mengakses satu server ACME dengan satu akun.
+type Client struct {
+	DirectoryURL string
+	// Key adalah kunci akun ECDSA P-256. Simpan agar akun yang sama dipakai ulang.
+	Key        *ecdsa.PrivateKey
+	Email      string
+	HTTPClient *http.Client
+
+	dir   directory
+	kid   string
+	nonce string
+}
+
+type directory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+}
+
+type order struct {
+	Status         string   `json:"status"`
+	Authorizations []string `json:"authorizations"`
+	Finalize       string   `json:"finalize"`
+	Certificate    string   `json:"certificate"`
+	Error          *Problem `json:"error"`
+}
+
+type authorization struct {
+	Status     string `json:"status"`
+	Identifier struct {
+		Value string `json:"value"`
+	} `json:"identifier"`
+	Challenges []challenge `json:"challenges"`
+}
+
+type challenge struct {
+	Type   string   `json:"type"`
+	URL    string   `json:"url"`
+	Token  string   `json:"token"`
+	Status string   `json:"status"`
+	Error  *Problem `json:"error"`
+}
+
+// GenerateKey membuat kunci akun baru.
+func GenerateKey() (*ecdsa.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+// ObtainCertificate meminta sertifikat untuk domains dengan kunci certKey dan
+// mengembalikan rantai sertifikat dalam format PEM.
+func (c *Client) ObtainCertificate(ctx context.Context, domains []string, certKey crypto.Signer, solver Solver) ([]byte, error) {
+	if len(domains) == 0 {
+		return nil, errors.New("acme: domain kosong")
+	}
+	if err := c.register(ctx); err != nil {
+		return nil, err
+	}
+
+	ids := make([]map[string]string, 0, len(domains))
+	for _, d := range domains {
+		ids = append(ids, map[string]string{"type": "dns", "value": d})
+	}
+	var o order
+	resp, err := c.post(ctx, c.dir.NewOrder, map[string]interface{}{"identifiers": ids}, &o)
+	if err != nil {
+		return nil, err
+	}
+	orderURL := resp.Header.Get("Location")
+
+	for _, authzURL := range o.Authorizations {
+		if err := c.authorize(ctx, authzURL, solver); err != nil {
+			return nil, err
+		}
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domains[0]},
+		DNSNames: domains,
+	}, certKey)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.post(ctx, o.Finalize, map[string]string{"csr": b64(csr)}, &o); err != nil {
+		return nil, err
+	}
+	for o.Status != "valid" {
+		if o.Status == "invalid" {
+			if o.Error != nil {
+				return nil, o.Error
+			}
+			return nil, errors.New("acme: order invalid")
+		}
+		if err := sleep(ctx, PollInterval); err != nil {
+			return nil, err
+		}
+		if _, err := c.post(ctx, orderURL, nil, &o); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err = c.post(ctx, o.Certificate, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.body, nil
+}
+
+// register mengambil directory dan membuat (atau menemukan) akun
+func (c *Client) register(ctx context.Context) error {
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	if c.Key == nil {
+		return errors.New("acme: kunci akun belum diisi")
+	}
+	if c.kid != "" {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.DirectoryURL, nil)
+	if err != nil {
+		return err
+	}
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("acme: directory status %d", res.StatusCode)
+	}
+	if err := json.NewDecoder(res.Body).Decode(&c.dir); err != nil {
+		return fmt.Errorf("acme: directory tidak valid: %v", err)
+	}
+
+	account := map[string]interface{}{"termsOfServiceAgreed": true}
+	if c.Email != "" {
+		account["contact"] = []string{"mailto:" + c.Email}
+	}
+	resp, err := c.post(ctx, c.dir.NewAccount, account, nil)
+	if err != nil {
+		return err
+	}
+	c.kid = resp.Header.Get("Location")
+	if c.kid == "" {
+		return errors.New("acme: server tidak mengembalikan URL akun")
+	}
+	return nil
+}
+
+func (c *Client) authorize(ctx context.Context, authzURL string, solver Solver) error {
+	var authz authorization
+	if _, err := c.post(ctx, authzURL, nil, &authz); err != nil {
+		return err
+	}
+	if authz.Status == "valid" {
+		return nil
+	}
+
+	var chal *challenge
+	for i := range authz.Challenges {
+		if authz.Challenges[i].Type == "http-01" {
+			chal = &authz.Challenges[i]
+			break
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("acme: challenge http-01 tidak tersedia untuk %s", authz.Identifier.Value)
+	}
+
+	keyAuth, err := c.keyAuthorization(chal.Token)
+	if err != nil {
+		return err
+	}
+	if err := solver.Present(chal.Token, keyAuth); err != nil {
+		return err
+	}
+	defer solver.CleanUp(chal.Token)
+
+	if _, err := c.post(ctx, chal.URL, struct{}{}, nil); err != nil {
+		return err
+	}
+	for {
+		if err := sleep(ctx, PollInterval); err != nil {
+			return err
+		}
+		if _, err := c.post(ctx, authzURL, nil, &authz); err != nil {
+			return err
+		}
+		switch authz.Status {
+		case "valid":
+			return nil
+		case "pending", "processing":
+			continue
+		default:
+			for _, ch := range authz.Challenges {
+				if ch.Type == "http-01" && ch.Error != nil {
+					return ch.Error
+				}
+			}
+			return fmt.Errorf("acme: authorization %s untuk %s", authz.Status, authz.Identifier.Value)
+		}
+	}
+}
+
+// --- JWS ---
+
+type response struct {
+	Header http.Header
+	body   []byte
+}
+
+// post mengirim request JWS. payload nil berarti POST-as-GET.
+// Nonce yang ditolak (badNonce) dicoba ulang sekali.
+func (c *Client) post(ctx context.Context, url string, payload, out interface{}) (*response, error) {
+	var lastErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		resp, err := c.postOnce(ctx, url, payload)
+		if err != nil {
+			var p *Problem
+			if errors.As(err, &p) && p.Type == "urn:ietf:params:acme:error:badNonce" {
+				lastErr = err
+				continue
+			}
+			return nil, err
+		}
+		if out != nil {
+			if err := json.Unmarshal(resp.body, out); err != nil {
+				return nil, fmt.Errorf("acme: response tidak valid dari %s: %v", url, err)
+			}
+		}
+		return resp, nil
+	}
+	return nil, lastErr
+}
+
+func (c *Client) postOnce(ctx context.Context, url string, payload interface{}) (*response, error) {
+	nonce, err := c.fetchNonce(ctx)
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.sign(url, nonce, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/jose+json")
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	c.nonce = res.Header.Get("Replay-Nonce")
+
+	if res.StatusCode >= 400 {
+		p := &Problem{Status: res.StatusCode}
+		if json.Unmarshal(data, p) != nil || p.Type == "" {
+			p.Detail = strings.TrimSpace(string(data))
+			p.Type = "status " + strconv.Itoa(res.StatusCode)
+		}
+		return nil, p
+	}
+	return &response{Header: res.Header, body: data}, nil
+}
+
+func (c *Client) fetchNonce(ctx context.Context) (string, error) {
+	if c.nonce != "" {
+		n := c.nonce
+		c.nonce = ""
+		return n, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.dir.NewNonce, nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	res.Body.Close()
+	n := res.Header.Get("Replay-Nonce")
+	if n == "" {
+		return "", errors.New("acme: server tidak mengirim nonce")
+	}
+	return n, nil
+}
+
+func (c *Client) sign(url, nonce string, payload interface{}) ([]byte, error) {
+	protected := map[string]interface{}{
+		"alg":   "ES256",
+		"nonce": nonce,
+		"url":   url,
+	}
+	if c.kid != "" {
+		protected["kid"] = c.kid
+	} else {
+		protected["jwk"] = c.jwk()
+	}
+	header, err := json.Marshal(protected)
+	if err != nil {
+		return nil, err
+	}
+
+	encodedPayload := ""
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		encodedPayload = b64(data)
+	}
+
+	signingInput := b64(header) + "." + encodedPayload
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, c.Key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+
+	return json.Marshal(map[string]string{
+		"protected": b64(header),
+		"payload":   encodedPayload,
+		"signature": b64(sig),
+	})
+}
+
+func (c *Client) jwk() map[string]string {
+	return map[string]string{
+		"crv": "P-256",
+		"kty": "EC",
+		"x":   b64(pad32(c.Key.X)),
+		"y":   b64(pad32(c.Key.Y)),
+	}
+}
+
+// keyAuthorization = token + "." + thumbprint JWK akun (RFC 7638)
+func (c *Client) keyAuthorization(token string) (string, error) {
+	jwk := c.jwk()
+	// Urutan member harus leksikografis: crv, kty, x, y
+	canonical := fmt.Sprintf(`{"crv":"%s","kty":"%s","x":"%s","y":"%s"}`, jwk["crv"], jwk["kty"], jwk["x"], jwk["y"])
+	sum := sha256.Sum256([]byte(canonical))
+	return token + "." + b64(sum[:]), nil
+}
+
+func pad32(n *big.Int) []byte {
+	out := make([]byte, 32)
+	n.FillBytes(out)
+	return out
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,505 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubServer adalah server ACME minimal untuk test. Setiap request JWS
+// diverifikasi (nonce sekali pakai, url, tanda tangan ES256, jwk/kid) dan
+// challenge http-01 dianggap valid hanya jika solver menyajikan keyAuth
+// yang benar untuk thumbprint akun.
+type stubServer struct {
+	t   *testing.T
+	srv *httptest.Server
+
+	mu         sync.Mutex
+	nonces     map[string]bool
+	nonceSeq   int
+	accountKey *ecdsa.PublicKey
+	presented  map[string]string // token -> keyAuth, diisi oleh solver test
+	authz      map[string]*stubAuthz
+	order      *order
+	orderPolls int
+	certPEM    []byte
+
+	// badNonceOnce membuat request JWS pertama ditolak dengan badNonce
+	badNonceOnce bool
+	// failChallenge membuat authorization berakhir invalid
+	failChallenge bool
+
+	caKey  *ecdsa.PrivateKey
+	caCert *x509.Certificate
+}
+
+type stubAuthz struct {
+	domain    string
+	token     string
+	status    string
+	triggered bool
+	err       *Problem
+}
+
+func newStubServer(t *testing.T) *stubServer {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Stub ACME CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, _ := x509.ParseCertificate(der)
+
+	s := &stubServer{
+		t:         t,
+		nonces:    make(map[string]bool),
+		presented: make(map[string]string),
+		authz:     make(map[string]*stubAuthz),
+		caKey:     caKey,
+		caCert:    caCert,
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.srv.Close)
+
+	saved := PollInterval
+	PollInterval = 5 * time.Millisecond
+	t.Cleanup(func() { PollInterval = saved })
+	return s
+}
+
+func (s *stubServer) url(path string) string { return s.srv.URL + path }
+
+func (s *stubServer) newNonce() string {
+	s.nonceSeq++
+	n := fmt.Sprintf("nonce-%d", s.nonceSeq)
+	s.nonces[n] = true
+	return n
+}
+
+func (s *stubServer) problem(w http.ResponseWriter, status int, typ, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Problem{Type: typ, Detail: detail, Status: status})
+}
+
+func (s *stubServer) reply(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *stubServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Replay-Nonce", s.newNonce())
+
+	switch {
+	case r.URL.Path == "/directory":
+		s.reply(w, http.StatusOK, directory{
+			NewNonce:   s.url("/new-nonce"),
+			NewAccount: s.url("/new-account"),
+			NewOrder:   s.url("/new-order"),
+		})
+		return
+	case r.URL.Path == "/new-nonce":
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	payload, ok := s.verifyJWS(w, r)
+	if !ok {
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/new-account":
+		w.Header().Set("Location", s.url("/account/1"))
+		s.reply(w, http.StatusCreated, map[string]string{"status": "valid"})
+
+	case r.URL.Path == "/new-order":
+		var req struct {
+			Identifiers []struct {
+				Type  string `json:"type"`
+				Value string `json:"value"`
+			} `json:"identifiers"`
+		}
+		if err := json.Unmarshal(payload, &req); err != nil || len(req.Identifiers) == 0 {
+			s.problem(w, http.StatusBadRequest, "urn:ietf:params:acme:error:malformed", "identifier kosong")
+			return
+		}
+		s.order = &order{Status: "pending", Finalize: s.url("/order/1/finalize")}
+		for i, id := range req.Identifiers {
+			name := fmt.Sprintf("/authz/%d", i+1)
+			s.authz[name] = &stubAuthz{domain: id.Value, token: fmt.Sprintf("token-%d", i+1), status: "pending"}
+			s.order.Authorizations = append(s.order.Authorizations, s.url(name))
+		}
+		w.Header().Set("Location", s.url("/order/1"))
+		s.reply(w, http.StatusCreated, s.order)
+
+	case strings.HasPrefix(r.URL.Path, "/authz/"):
+		a := s.authz[r.URL.Path]
+		if a == nil {
+			s.problem(w, http.StatusNotFound, "urn:ietf:params:acme:error:malformed", "authz tidak ada")
+			return
+		}
+		if a.triggered && a.status == "pending" {
+			a.status = "valid"
+			if s.failChallenge {
+				a.status = "invalid"
+				a.err = &Problem{Type: "urn:ietf:params:acme:error:unauthorized", Detail: "keyAuth tidak cocok", Status: 403}
+			}
+		}
+		s.reply(w, http.StatusOK, s.authzJSON(r.URL.Path, a))
+
+	case strings.HasPrefix(r.URL.Path, "/chall/"):
+		name := "/authz/" + strings.TrimPrefix(r.URL.Path, "/chall/")
+		a := s.authz[name]
+		if a == nil {
+			s.problem(w, http.StatusNotFound, "urn:ietf:params:acme:error:malformed", "challenge tidak ada")
+			return
+		}
+		if got, want := s.presented[a.token], a.token+"."+s.thumbprint(); got != want {
+			s.failChallenge = true
+		}
+		a.triggered = true
+		s.reply(w, http.StatusOK, map[string]string{"type": "http-01", "status": "processing"})
+
+	case r.URL.Path == "/order/1/finalize":
+		for _, a := range s.authz {
+			if a.status != "valid" {
+				s.problem(w, http.StatusForbidden, "urn:ietf:params:acme:error:orderNotReady", "authz belum valid")
+				return
+			}
+		}
+		var req struct {
+			CSR string `json:"csr"`
+		}
+		json.Unmarshal(payload, &req)
+		der, err := base64.RawURLEncoding.DecodeString(req.CSR)
+		if err != nil {
+			s.problem(w, http.StatusBadRequest, "urn:ietf:params:acme:error:badCSR", err.Error())
+			return
+		}
+		csr, err := x509.ParseCertificateRequest(der)
+		if err != nil || csr.CheckSignature() != nil {
+			s.problem(w, http.StatusBadRequest, "urn:ietf:params:acme:error:badCSR", "CSR tidak valid")
+			return
+		}
+		leaf := &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      csr.Subject,
+			DNSNames:     csr.DNSNames,
+			NotBefore:    time.Now().Add(-time.Minute),
+			NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		}
+		certDER, err := x509.CreateCertificate(rand.Reader, leaf, s.caCert, csr.PublicKey, s.caKey)
+		if err != nil {
+			s.problem(w, http.StatusInternalServerError, "urn:ietf:params:acme:error:serverInternal", err.Error())
+			return
+		}
+		s.certPEM = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}),
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.caCert.Raw})...)
+		// Order baru valid setelah satu kali polling, seperti CA sungguhan
+		s.order.Status = "processing"
+		s.reply(w, http.StatusOK, s.order)
+
+	case r.URL.Path == "/order/1":
+		s.orderPolls++
+		if s.order.Status == "processing" {
+			s.order.Status = "valid"
+			s.order.Certificate = s.url("/cert/1")
+		}
+		s.reply(w, http.StatusOK, s.order)
+
+	case r.URL.Path == "/cert/1":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.Write(s.certPEM)
+
+	default:
+		s.problem(w, http.StatusNotFound, "urn:ietf:params:acme:error:malformed", "path tidak dikenal")
+	}
+}
+
+func (s *stubServer) authzJSON(name string, a *stubAuthz) map[string]interface{} {
+	chal := map[string]interface{}{
+		"type":   "http-01",
+		"url":    s.url("/chall/" + strings.TrimPrefix(name, "/authz/")),
+		"token":  a.token,
+		"status": a.status,
+	}
+	if a.err != nil {
+		chal["error"] = a.err
+	}
+	return map[string]interface{}{
+		"status":     a.status,
+		"identifier": map[string]string{"type": "dns", "value": a.domain},
+		"challenges": []interface{}{
+			map[string]string{"type": "dns-01", "url": s.url("/chall/dns"), "token": "dns-token", "status": "pending"},
+			chal,
+		},
+	}
+}
+
+// verifyJWS memeriksa request sesuai RFC 8555 bagian 6.2-6.5 dan
+// mengembalikan payload yang sudah di-decode.
+func (s *stubServer) verifyJWS(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/jose+json" {
+		s.problem(w, http.StatusBadRequest, "urn:ietf:params:acme:error:malformed", "harus POST application/jose+json")
+		return nil, false
+	}
+	body, _ := io.ReadAll(r.Body)
+	var jws struct {
+		Protected string `json:"protected"`
+		Payload   string `json:"payload"`
+		Signature string `json:"signature"`
+	}
+	if err := json.Unmarshal(body, &jws); err != nil {
+		s.problem(w, http.StatusBadRequest, "urn:ietf:params:acme:error:malformed", "JWS tidak valid")
+		return nil, false
+	}
+	headerJSON, _ := base64.RawURLEncoding.DecodeString(jws.Protected)
+	var header struct {
+		Alg   string            `json:"alg"`
+		Nonce string            `json:"nonce"`
+		URL   string            `json:"url"`
+		Kid   string            `json:"kid"`
+		JWK   map[string]string `json:"jwk"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil || header.Alg != "ES256" {
+		s.problem(w, http.StatusBadRequest, "urn:ietf:params:acme:error:badSignatureAlgorithm", "alg harus ES256")
+		return nil, false
+	}
+	if s.badNonceOnce {
+		s.badNonceOnce = false
+		delete(s.nonces, header.Nonce)
+		s.problem(w, http.StatusBadRequest, "urn:ietf:params:acme:error:badNonce", "nonce ditolak")
+		return nil, false
+	}
+	if !s.nonces[header.Nonce] {
+		s.problem(w, http.StatusBadRequest, "urn:ietf:params:acme:error:badNonce", "nonce tidak dikenal atau sudah dipakai")
+		return nil, false
+	}
+	delete(s.nonces, header.Nonce)
+	if header.URL != s.url(r.URL.Path) {
+		s.problem(w, http.StatusUnauthorized, "urn:ietf:params:acme:error:unauthorized", "url header tidak cocok")
+		return nil, false
+	}
+
+	var pub *ecdsa.PublicKey
+	switch {
+	case r.URL.Path == "/new-account":
+		if header.JWK == nil || header.Kid != "" {
+			s.problem(w, http.StatusBadRequest, "urn:ietf:params:acme:error:malformed", "newAccount harus memakai jwk")
+			return nil, false
+		}
+		x, _ := base64.RawURLEncoding.DecodeString(header.JWK["x"])
+		y, _ := base64.RawURLEncoding.DecodeString(header.JWK["y"])
+		pub = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		s.accountKey = pub
+	default:
+		if header.Kid != s.url("/account/1") || header.JWK != nil || s.accountKey == nil {
+			s.problem(w, http.StatusUnauthorized, "urn:ietf:params:acme:error:accountDoesNotExist", "kid tidak valid")
+			return nil, false
+		}
+		pub = s.accountKey
+	}
+
+	sig, _ := base64.RawURLEncoding.DecodeString(jws.Signature)
+	digest := sha256.Sum256([]byte(jws.Protected + "." + jws.Payload))
+	if len(sig) != 64 || !ecdsa.Verify(pub, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		s.problem(w, http.StatusUnauthorized, "urn:ietf:params:acme:error:unauthorized", "tanda tangan tidak valid")
+		return nil, false
+	}
+	payload, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+	return payload, true
+}
+
+// thumbprint dihitung terpisah dari implementasi client (RFC 7638)
+func (s *stubServer) thumbprint() string {
+	canonical, _ := json.Marshal(struct {
+		Crv string `json:"crv"`
+		Kty string `json:"kty"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}{"P-256", "EC", b64(pad32(s.accountKey.X)), b64(pad32(s.accountKey.Y))})
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// stubSolver menitipkan keyAuth ke stubServer, menggantikan listener http-01
+type stubSolver struct {
+	s        *stubServer
+	cleaned  []string
+	presents int
+}
+
+func (p *stubSolver) Present(token, keyAuth string) error {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+	p.s.presented[token] = keyAuth
+	p.presents++
+	return nil
+}
+
+func (p *stubSolver) CleanUp(token string) {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+	delete(p.s.presented, token)
+	p.cleaned = append(p.cleaned, token)
+}
+
+func newTestClient(t *testing.T, s *stubServer) *Client {
+	t.Helper()
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Client{DirectoryURL: s.url("/directory"), Key: key, Email: "admin@example.com", HTTPClient: s.srv.Client()}
+}
+
+func TestObtainCertificate(t *testing.T) {
+	s := newStubServer(t)
+	c := newTestClient(t, s)
+	solver := &stubSolver{s: s}
+	certKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	domains := []string{"vpn.example.com", "www.vpn.example.com"}
+	chain, err := c.ObtainCertificate(context.Background(), domains, certKey, solver)
+	if err != nil {
+		t.Fatalf("ObtainCertificate: %v", err)
+	}
+
+	block, rest := pem.Decode(chain)
+	if block == nil {
+		t.Fatal("rantai sertifikat bukan PEM")
+	}
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(leaf.DNSNames, ",") != strings.Join(domains, ",") {
+		t.Errorf("DNSNames = %v, want %v", leaf.DNSNames, domains)
+	}
+	if leaf.Subject.CommonName != domains[0] {
+		t.Errorf("CommonName = %q, want %q", leaf.Subject.CommonName, domains[0])
+	}
+	if !leaf.PublicKey.(*ecdsa.PublicKey).Equal(&certKey.PublicKey) {
+		t.Error("sertifikat tidak memakai kunci dari CSR")
+	}
+	if issuer, _ := pem.Decode(rest); issuer == nil {
+		t.Error("rantai tidak berisi sertifikat CA")
+	}
+	if solver.presents != len(domains) || len(solver.cleaned) != len(domains) {
+		t.Errorf("solver Present=%d CleanUp=%d, want %d", solver.presents, len(solver.cleaned), len(domains))
+	}
+	if s.orderPolls == 0 {
+		t.Error("client tidak menunggu order processing selesai")
+	}
+}
+
+func TestBadNonceIsRetried(t *testing.T) {
+	s := newStubServer(t)
+	s.badNonceOnce = true
+	c := newTestClient(t, s)
+	certKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if _, err := c.ObtainCertificate(context.Background(), []string{"vpn.example.com"}, certKey, &stubSolver{s: s}); err != nil {
+		t.Fatalf("ObtainCertificate setelah badNonce: %v", err)
+	}
+}
+
+func TestInvalidChallengeReturnsProblem(t *testing.T) {
+	s := newStubServer(t)
+	s.failChallenge = true
+	c := newTestClient(t, s)
+	certKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	solver := &stubSolver{s: s}
+
+	_, err := c.ObtainCertificate(context.Background(), []string{"vpn.example.com"}, certKey, solver)
+	var p *Problem
+	if !errors.As(err, &p) || p.Type != "urn:ietf:params:acme:error:unauthorized" {
+		t.Fatalf("err = %v, want Problem unauthorized", err)
+	}
+	if len(solver.cleaned) != 1 {
+		t.Errorf("CleanUp dipanggil %d kali, want 1", len(solver.cleaned))
+	}
+}
+
+func TestWrongKeyAuthorizationRejected(t *testing.T) {
+	s := newStubServer(t)
+	c := newTestClient(t, s)
+	certKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	_, err := c.ObtainCertificate(context.Background(), []string{"vpn.example.com"}, certKey, wrongSolver{s})
+	if err == nil {
+		t.Fatal("keyAuth yang salah harus membuat authorization invalid")
+	}
+}
+
+type wrongSolver struct{ s *stubServer }
+
+func (p wrongSolver) Present(token, keyAuth string) error {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+	p.s.presented[token] = token + ".salah"
+	return nil
+}
+
+func (p wrongSolver) CleanUp(token string) {}
+
+func TestContextCancelStopsPolling(t *testing.T) {
+	s := newStubServer(t)
+	PollInterval = time.Hour
+	c := newTestClient(t, s)
+	certKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := c.ObtainCertificate(ctx, []string{"vpn.example.com"}, certKey, &stubSolver{s: s})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestMissingKeyAndDomains(t *testing.T) {
+	s := newStubServer(t)
+	certKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	c := &Client{DirectoryURL: s.url("/directory")}
+	if _, err := c.ObtainCertificate(context.Background(), []string{"vpn.example.com"}, certKey, &stubSolver{s: s}); err == nil {
+		t.Error("client tanpa kunci akun harus gagal")
+	}
+	c = newTestClient(t, s)
+	if _, err := c.ObtainCertificate(context.Background(), nil, certKey, &stubSolver{s: s}); err == nil {
+		t.Error("domain kosong harus gagal")
+	}
+}
@@ -0,0 +1,1368 @@
+// Package client adalah client Go untuk ZiVPN API.
+//
+// Semua request dan response memakai struct bertipe sehingga pemanggil
+// tidak perlu melakukan type assertion pada map[string]interface{}.
+// Error dari API dikembalikan sebagai *APIError yang bisa dicek dengan
+// errors.Is terhadap ErrUnauthorized, ErrNotFound, ErrConflict, dll.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout dipakai jika context yang diberikan tidak punya deadline.
+const DefaultTimeout = 10 * time.Second
+
+// Kode error yang dikirim API pada field "code".
+const (
+	CodeBadRequest       = "bad_request"
+	CodeUnauthorized     = "unauthorized"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeInternal         = "internal_error"
+	// Kredit reseller tidak cukup untuk create/renew
+	CodeInsufficientCredit = "insufficient_credit"
+)
+
+var (
+	ErrBadRequest       = errors.New("zivpn: bad request")
+	ErrUnauthorized     = errors.New("zivpn: unauthorized")
+	ErrNotFound         = errors.New("zivpn: not found")
+	ErrMethodNotAllowed = errors.New("zivpn: method not allowed")
+	ErrConflict         = errors.New("zivpn: conflict")
+	ErrInternal         = errors.New("zivpn: internal error")
+
+	ErrInsufficientCredit = errors.New("zivpn: insufficient credit")
+)
+
+var codeErrors = map[string]error{
+	CodeBadRequest:       ErrBadRequest,
+	CodeUnauthorized:     ErrUnauthorized,
+	CodeNotFound:         ErrNotFound,
+	CodeMethodNotAllowed: ErrMethodNotAllowed,
+	CodeConflict:         ErrConflict,
+	CodeInternal:         ErrInternal,
+
+	CodeInsufficientCredit: ErrInsufficientCredit,
+}
+
+// APIError adalah response gagal (success=false) dari API.
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("API error %d (%s)", e.Status, e.Code)
+	}
+	return e.Message
+}
+
+// Is membuat errors.Is(err, client.ErrNotFound) bekerja berdasarkan kode error.
+func (e *APIError) Is(target error) bool {
+	sentinel, ok := codeErrors[e.Code]
+	return ok && sentinel == target
+}
+
+// Client mengakses ZiVPN API.
+type Client struct {
+	// BaseURL adalah alamat API tanpa path, contoh "http://127.0.0.1:8080".
+	BaseURL    string
+	APIKey     string
+	HTTPClient *http.Client
+	// ResellerTelegram, jika diisi, membuat request berjalan atas nama
+	// reseller dengan Telegram ID tersebut (hanya berlaku dengan master key).
+	ResellerTelegram int64
+	// Actor, jika diisi, dikirim sebagai header X-Actor dan dicatat sebagai
+	// pelaku di audit log API.
+	Actor string
+}
+
+// AsActor mengembalikan salinan Client yang mencatat actor sebagai pelaku
+// di audit log, contoh "telegram:123456".
+func (c *Client) AsActor(actor string) *Client {
+	cp := *c
+	cp.Actor = actor
+	return &cp
+}
+
+// AsReseller mengembalikan salinan Client yang bertindak atas nama reseller
+// dengan Telegram ID telegramID.
+func (c *Client) AsReseller(telegramID int64) *Client {
+	cp := *c
+	cp.ResellerTelegram = telegramID
+	return &cp
+}
+
+// New membuat Client baru.
+func New(baseURL, apiKey string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		APIKey:     apiKey,
+		HTTPClient: &http.Client{},
+	}
+}
+
+type response struct {
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Code    string          `json:"code"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// --- Types ---
+
+// Jika PlanID diisi, Days dan limit diambil dari plan.
+type CreateUserRequest struct {
+	Password   string `json:"password"`
+	Days       int    `json:"days,omitempty"`
+	LimitIP    int    `json:"limit_ip,omitempty"`
+	LimitQuota int    `json:"limit_quota,omitempty"`
+	PlanID     string `json:"plan_id,omitempty"`
+}
+
+type RenewUserRequest struct {
+	Password   string `json:"password"`
+	Days       int    `json:"days,omitempty"`
+	LimitIP    int    `json:"limit_ip,omitempty"`
+	LimitQuota int    `json:"limit_quota,omitempty"`
+	PlanID     string `json:"plan_id,omitempty"`
+}
+
+type DeleteUserRequest struct {
+	Password string `json:"password"`
+}
+
+type CreatedUser struct {
+	Password   string `json:"password"`
+	Expired    string `json:"expired"`
+	Domain     string `json:"domain"`
+	LimitIP    int    `json:"limit_ip"`
+	LimitQuota int    `json:"limit_quota"`
+	Plan       string `json:"plan,omitempty"`
+	StatusURL  string `json:"status_url,omitempty"`
+}
+
+// Profile adalah konfigurasi koneksi satu user. URI memakai format share
+// link Hysteria v1 dan bisa di-import langsung oleh aplikasi client.
+type Profile struct {
+	Password  string `json:"password"`
+	Server    string `json:"server"`
+	Port      int    `json:"port"`
+	PortRange string `json:"port_range,omitempty"`
+	Obfs      string `json:"obfs"`
+	SNI       string `json:"sni"`
+	Insecure  bool   `json:"insecure"`
+	Expired   string `json:"expired"`
+	URI       string `json:"uri"`
+}
+
+type RotatePasswordRequest struct {
+	NewPassword string `json:"new_password"`
+}
+
+type RotatedUser struct {
+	Password    string `json:"password"`
+	OldPassword string `json:"old_password"`
+	Expired     string `json:"expired"`
+	LimitIP     int    `json:"limit_ip"`
+	LimitQuota  int    `json:"limit_quota"`
+	StatusURL   string `json:"status_url,omitempty"`
+}
+
+// StatusLink adalah link halaman status publik satu user. Siapa pun yang
+// memegang token bisa melihat status akun tanpa API key.
+type StatusLink struct {
+	Token   string `json:"token"`
+	URL     string `json:"url"`
+	JSONURL string `json:"json_url"`
+}
+
+type RenewedUser struct {
+	Password   string `json:"password"`
+	Expired    string `json:"expired"`
+	Domain     string `json:"domain"`
+	LimitIP    int    `json:"limit_ip"`
+	LimitQuota int    `json:"limit_quota"`
+	Plan       string `json:"plan,omitempty"`
+	StatusURL  string `json:"status_url,omitempty"`
+}
+
+// Nilai User.Status
+const (
+	StatusActive    = "Active"
+	StatusExpired   = "Expired"
+	StatusSuspended = "Suspended"
+	StatusLocked    = "Locked"
+)
+
+type User struct {
+	Password       string `json:"password"`
+	Expired        string `json:"expired"`
+	Status         string `json:"status"`
+	LimitIP        int    `json:"limit_ip"`
+	LimitQuota     int    `json:"limit_quota"`
+	SuspendedUntil string `json:"suspended_until,omitempty"`
+	SuspendReason  string `json:"suspend_reason,omitempty"` // "ip_limit" atau "quota"
+	UploadBytes    int64  `json:"upload_bytes"`
+	DownloadBytes  int64  `json:"download_bytes"`
+	UsedBytes      int64  `json:"used_bytes"`
+	Owner          string `json:"owner,omitempty"` // ID reseller pemilik akun
+}
+
+type Usage struct {
+	UploadBytes   int64  `json:"upload_bytes"`
+	DownloadBytes int64  `json:"download_bytes"`
+	ResetAt       string `json:"reset_at"`
+	UpdatedAt     string `json:"updated_at"`
+}
+
+type QuotaTopUpRequest struct {
+	Password string `json:"password"`
+	GB       int    `json:"gb"`
+}
+
+type QuotaTopUp struct {
+	Password   string `json:"password"`
+	LimitQuota int    `json:"limit_quota"`
+	UsedBytes  int64  `json:"used_bytes"`
+}
+
+type SystemInfo struct {
+	Domain    string `json:"domain"`
+	PublicIP  string `json:"public_ip"`
+	PrivateIP string `json:"private_ip"`
+	Port      string `json:"port"`
+	Service   string `json:"service"`
+	// UdpgwStatus bernilai "not_installed" jika udpgw-only.sh belum dijalankan
+	UdpgwStatus string `json:"udpgw_status"`
+	UdpgwPort   string `json:"udpgw_port"`
+}
+
+type Session struct {
+	Password    string `json:"password"`
+	SourceIP    string `json:"source_ip"`
+	LastAddr    string `json:"last_addr"`
+	FirstSeen   string `json:"first_seen"`
+	LastSeen    string `json:"last_seen"`
+	Connections int    `json:"connections"`
+	TxBytes     int64  `json:"tx_bytes"`
+	RxBytes     int64  `json:"rx_bytes"`
+	Online      bool   `json:"online"`
+	EndedAt     string `json:"ended_at"`
+}
+
+type OnlineUser struct {
+	Password string    `json:"password"`
+	Devices  int       `json:"devices"`
+	Sessions []Session `json:"sessions"`
+}
+
+// Aksi IPLimitPolicy.Action
+const (
+	IPLimitWarn    = "warn"
+	IPLimitSuspend = "suspend"
+	IPLimitLock    = "lock"
+)
+
+type IPLimitPolicy struct {
+	Enabled        bool   `json:"enabled"`
+	Action         string `json:"action"`
+	SuspendMinutes int    `json:"suspend_minutes"`
+}
+
+// Violation juga menjadi Data pada event "iplimit.violation".
+type Violation struct {
+	Time     string   `json:"time"`
+	Password string   `json:"password"`
+	Limit    int      `json:"limit"`
+	Devices  int      `json:"devices"`
+	IPs      []string `json:"ips"`
+	Action   string   `json:"action"`
+	Until    string   `json:"until,omitempty"`
+}
+
+type PortHopConfig struct {
+	Enabled   bool   `json:"enabled"`
+	Start     int    `json:"start"`
+	End       int    `json:"end"`
+	Interface string `json:"interface,omitempty"`
+	Backend   string `json:"backend,omitempty"`
+}
+
+type PortHopStatus struct {
+	PortHopConfig
+	ActiveBackend   string `json:"active_backend"`
+	ActiveInterface string `json:"active_interface"`
+	TargetPort      string `json:"target_port"`
+	Applied         bool   `json:"applied"`
+	Error           string `json:"error"`
+}
+
+type CertConfig struct {
+	Mode            string `json:"mode"` // "self-signed" atau "acme"
+	RenewBeforeDays int    `json:"renew_before_days"`
+	ACMEDirectory   string `json:"acme_directory,omitempty"`
+	ACMEEmail       string `json:"acme_email,omitempty"`
+	ACMECAFile      string `json:"acme_ca_file,omitempty"`
+	ACMEHTTPPort    int    `json:"acme_http_port,omitempty"`
+}
+
+type CertStatus struct {
+	Config      CertConfig `json:"config"`
+	Path        string     `json:"path"`
+	Domain      string     `json:"domain"`
+	Subject     string     `json:"subject"`
+	Issuer      string     `json:"issuer"`
+	DNSNames    []string   `json:"dns_names"`
+	NotBefore   string     `json:"not_before"`
+	NotAfter    string     `json:"not_after"`
+	DaysLeft    int        `json:"days_left"`
+	SelfSigned  bool       `json:"self_signed"`
+	LastCheck   string     `json:"last_check"`
+	LastRenewal string     `json:"last_renewal"`
+	LastError   string     `json:"last_error"`
+	Renewing    bool       `json:"renewing"`
+}
+
+type Settings struct {
+	Domain     string `json:"domain"`
+	Obfs       string `json:"obfs"`
+	ListenPort int    `json:"listen_port"`
+}
+
+// SettingsUpdate hanya mengubah field yang tidak nil.
+type SettingsUpdate struct {
+	Domain     *string `json:"domain,omitempty"`
+	Obfs       *string `json:"obfs,omitempty"`
+	ListenPort *int    `json:"listen_port,omitempty"`
+}
+
+type AuditEntry struct {
+	Time   string          `json:"time"`
+	Action string          `json:"action"`
+	Source string          `json:"source"`
+	Actor  string          `json:"actor,omitempty"`
+	Detail json.RawMessage `json:"detail"`
+}
+
+type AuditRequest struct {
+	Action string      `json:"action"`
+	Detail interface{} `json:"detail,omitempty"`
+}
+
+type HistoryVersion struct {
+	Version    int    `json:"version"`
+	CreatedAt  string `json:"created_at"`
+	Trigger    string `json:"trigger"`
+	Users      int    `json:"users"`
+	RollbackOf int    `json:"rollback_of,omitempty"`
+}
+
+type ConfigHistory struct {
+	Retention int              `json:"retention"`
+	Versions  []HistoryVersion `json:"versions"`
+}
+
+type FileDiff struct {
+	File    string   `json:"file"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// ConfigDiff.To bernilai 0 jika dibandingkan dengan file saat ini
+type ConfigDiff struct {
+	From  int        `json:"from"`
+	To    int        `json:"to"`
+	Files []FileDiff `json:"files"`
+}
+
+// DryRunResult adalah perubahan yang akan terjadi jika request dijalankan
+type DryRunResult struct {
+	DryRun   bool       `json:"dry_run"`
+	Restart  bool       `json:"restart"`
+	Files    []FileDiff `json:"files"`
+	Replaced []string   `json:"replaced,omitempty"`
+}
+
+type UdpgwStatus struct {
+	Installed   bool   `json:"installed"`
+	Status      string `json:"status"`
+	LogLevel    string `json:"log_level,omitempty"`
+	Port        int    `json:"port,omitempty"`
+	DNSResolver string `json:"dns_resolver,omitempty"`
+}
+
+// UdpgwUpdate hanya mengubah field yang tidak nil.
+type UdpgwUpdate struct {
+	LogLevel    *string `json:"log_level,omitempty"`
+	Port        *int    `json:"port,omitempty"`
+	DNSResolver *string `json:"dns_resolver,omitempty"`
+}
+
+type Reseller struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	TelegramID  int64  `json:"telegram_id,omitempty"`
+	Credit      int64  `json:"credit"`
+	PricePerDay int64  `json:"price_per_day"`
+	Disabled    bool   `json:"disabled"`
+	CreatedAt   string `json:"created_at"`
+	Users       int    `json:"users,omitempty"`
+}
+
+type NewReseller struct {
+	Name        string `json:"name"`
+	TelegramID  int64  `json:"telegram_id,omitempty"`
+	PricePerDay int64  `json:"price_per_day"`
+	Credit      int64  `json:"credit,omitempty"`
+}
+
+// ResellerUpdate hanya mengubah field yang tidak nil.
+type ResellerUpdate struct {
+	Name        *string `json:"name,omitempty"`
+	TelegramID  *int64  `json:"telegram_id,omitempty"`
+	PricePerDay *int64  `json:"price_per_day,omitempty"`
+	Disabled    *bool   `json:"disabled,omitempty"`
+}
+
+// ResellerKey berisi API key reseller yang hanya dikirim sekali.
+type ResellerKey struct {
+	Reseller Reseller `json:"reseller"`
+	APIKey   string   `json:"api_key"`
+}
+
+type LedgerEntry struct {
+	ID       int64  `json:"id"`
+	Time     string `json:"time"`
+	Reseller string `json:"reseller"`
+	Type     string `json:"type"` // topup, create, renew, refund
+	Amount   int64  `json:"amount"`
+	Balance  int64  `json:"balance"`
+	Password string `json:"password,omitempty"`
+	Days     int    `json:"days,omitempty"`
+	Note     string `json:"note,omitempty"`
+}
+
+type ResellerProfile struct {
+	Reseller Reseller      `json:"reseller"`
+	Ledger   []LedgerEntry `json:"ledger"`
+}
+
+// Nilai Plan.Visibility
+const (
+	PlanPublic   = "public"
+	PlanReseller = "reseller"
+	PlanAdmin    = "admin"
+)
+
+type Plan struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Days       int    `json:"days"`
+	LimitIP    int    `json:"limit_ip"`
+	LimitQuota int    `json:"limit_quota"` // GB
+	Price      int64  `json:"price"`
+	Visibility string `json:"visibility"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// NewPlan membuat plan baru. ID kosong dibuat otomatis oleh server,
+// Visibility kosong berarti public.
+type NewPlan struct {
+	ID         string `json:"id,omitempty"`
+	Name       string `json:"name"`
+	Days       int    `json:"days"`
+	LimitIP    int    `json:"limit_ip"`
+	LimitQuota int    `json:"limit_quota"`
+	Price      int64  `json:"price"`
+	Visibility string `json:"visibility,omitempty"`
+}
+
+// PlanUpdate hanya mengubah field yang tidak nil.
+type PlanUpdate struct {
+	Name       *string `json:"name,omitempty"`
+	Days       *int    `json:"days,omitempty"`
+	LimitIP    *int    `json:"limit_ip,omitempty"`
+	LimitQuota *int    `json:"limit_quota,omitempty"`
+	Price      *int64  `json:"price,omitempty"`
+	Visibility *string `json:"visibility,omitempty"`
+}
+
+type Voucher struct {
+	Code        string              `json:"code"`
+	Batch       string              `json:"batch"`
+	Plan        string              `json:"plan"`
+	MaxUses     int                 `json:"max_uses"`
+	Uses        int                 `json:"uses"`
+	ExpiresAt   string              `json:"expires_at,omitempty"`
+	Revoked     bool                `json:"revoked,omitempty"`
+	Note        string              `json:"note,omitempty"`
+	CreatedAt   string              `json:"created_at"`
+	Redemptions []VoucherRedemption `json:"redemptions,omitempty"`
+}
+
+type VoucherRedemption struct {
+	Time       string `json:"time"`
+	Password   string `json:"password"`
+	Action     string `json:"action"`
+	TelegramID int64  `json:"telegram_id,omitempty"`
+}
+
+type VoucherBatch struct {
+	ID        string `json:"id"`
+	Plan      string `json:"plan"`
+	Count     int    `json:"count"`
+	Used      int    `json:"used"`
+	Exhausted int    `json:"exhausted"`
+	MaxUses   int    `json:"max_uses"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+	Note      string `json:"note,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+// GenerateVouchers membuat satu batch. MaxUses 0 berarti sekali pakai,
+// ExpiresAt (YYYY-MM-DD) kosong berarti tanpa batas.
+type GenerateVouchers struct {
+	PlanID    string `json:"plan_id"`
+	Count     int    `json:"count"`
+	MaxUses   int    `json:"max_uses,omitempty"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+	Prefix    string `json:"prefix,omitempty"`
+	Note      string `json:"note,omitempty"`
+}
+
+type GeneratedVouchers struct {
+	Batch VoucherBatch `json:"batch"`
+	Codes []string     `json:"codes"`
+}
+
+// RedeemVoucherRequest.Renew memperpanjang akun yang sudah ada; API
+// menolaknya jika akun tidak tercatat milik TelegramID.
+type RedeemVoucherRequest struct {
+	Code       string `json:"code"`
+	Password   string `json:"password"`
+	TelegramID int64  `json:"telegram_id,omitempty"`
+	Renew      bool   `json:"renew,omitempty"`
+}
+
+// RedeemedVoucher.Action bernilai "create" atau "renew".
+type RedeemedVoucher struct {
+	Action     string `json:"action"`
+	Password   string `json:"password"`
+	Expired    string `json:"expired"`
+	Domain     string `json:"domain"`
+	LimitIP    int    `json:"limit_ip"`
+	LimitQuota int    `json:"limit_quota"`
+	Plan       string `json:"plan"`
+	Code       string `json:"code"`
+	UsesLeft   int    `json:"uses_left"`
+}
+
+// Nilai Order.Status. OrderFailed berarti sudah dibayar tetapi akun gagal
+// dibuat; lihat Order.Error.
+const (
+	OrderPending   = "pending"
+	OrderPaid      = "paid"
+	OrderExpired   = "expired"
+	OrderCancelled = "cancelled"
+	OrderFailed    = "failed"
+)
+
+type Order struct {
+	ID             string `json:"id"`
+	Plan           string `json:"plan"`
+	Password       string `json:"password"`
+	Days           int    `json:"days"`
+	LimitIP        int    `json:"limit_ip"`
+	LimitQuota     int    `json:"limit_quota"`
+	Amount         int64  `json:"amount"`
+	Status         string `json:"status"`
+	Gateway        string `json:"gateway"`
+	Reference      string `json:"reference"`
+	PayURL         string `json:"pay_url,omitempty"`
+	Instructions   string `json:"instructions,omitempty"`
+	TelegramID     int64  `json:"telegram_id,omitempty"`
+	CreatedAt      string `json:"created_at"`
+	ExpiresAt      string `json:"expires_at"`
+	PaidAt         string `json:"paid_at,omitempty"`
+	PaidBy         string `json:"paid_by,omitempty"`
+	Action         string `json:"action,omitempty"`
+	AccountExpired string `json:"account_expired,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// NewOrder.Renew membuat order perpanjangan; API menolaknya jika akun
+// tidak tercatat milik TelegramID. Tanpa Renew, password yang sudah ada ditolak.
+type NewOrder struct {
+	PlanID     string `json:"plan_id"`
+	Password   string `json:"password"`
+	TelegramID int64  `json:"telegram_id,omitempty"`
+	Renew      bool   `json:"renew,omitempty"`
+}
+
+// OrderFilter membatasi hasil Orders; field kosong diabaikan.
+type OrderFilter struct {
+	ID         string
+	Status     string
+	TelegramID int64
+}
+
+type PaymentConfig struct {
+	Gateway       string `json:"gateway"`
+	WebhookSecret string `json:"webhook_secret"`
+	OrderTTL      int    `json:"order_ttl_minutes"`
+}
+
+// PaymentUpdate hanya mengubah field yang tidak nil.
+type PaymentUpdate struct {
+	Gateway      *string `json:"gateway,omitempty"`
+	OrderTTL     *int    `json:"order_ttl_minutes,omitempty"`
+	RotateSecret bool    `json:"rotate_secret,omitempty"`
+}
+
+type RestoreResult struct {
+	Version   int      `json:"version"`
+	CreatedAt string   `json:"created_at"`
+	Domain    string   `json:"domain"`
+	Files     []string `json:"files"`
+}
+
+// Event adalah satu event dari /api/events. Data dibiarkan mentah karena
+// isinya berbeda untuk setiap Type.
+// Event dengan Type "resync" tidak punya ID (0) dan menandakan client perlu
+// memuat ulang state penuh karena Last-Event-ID tidak dikenali API.
+type Event struct {
+	ID   int64           `json:"id"`
+	Type string          `json:"type"`
+	Time string          `json:"time"`
+	Data json.RawMessage `json:"data"`
+}
+
+// --- Endpoints ---
+
+func (c *Client) CreateUser(ctx context.Context, req CreateUserRequest) (*CreatedUser, error) {
+	var out CreatedUser
+	if err := c.do(ctx, http.MethodPost, "/api/user/create", req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeleteUser(ctx context.Context, password string) error {
+	return c.do(ctx, http.MethodPost, "/api/user/delete", DeleteUserRequest{Password: password}, nil)
+}
+
+func (c *Client) RenewUser(ctx context.Context, req RenewUserRequest) (*RenewedUser, error) {
+	var out RenewedUser
+	if err := c.do(ctx, http.MethodPost, "/api/user/renew", req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) ListUsers(ctx context.Context) ([]User, error) {
+	out := []User{}
+	if err := c.do(ctx, http.MethodGet, "/api/users", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *Client) Info(ctx context.Context) (*SystemInfo, error) {
+	var out SystemInfo
+	if err := c.do(ctx, http.MethodGet, "/api/info", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Sessions mengembalikan session live dan riwayat session milik satu user.
+func (c *Client) Sessions(ctx context.Context, password string) ([]Session, error) {
+	out := []Session{}
+	if err := c.do(ctx, http.MethodGet, "/api/users/"+url.PathEscape(password)+"/sessions", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UserProfile mengembalikan konfigurasi siap-import untuk aplikasi client.
+func (c *Client) UserProfile(ctx context.Context, password string) (*Profile, error) {
+	var out Profile
+	if err := c.do(ctx, http.MethodGet, "/api/users/"+url.PathEscape(password)+"/profile", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UserProfileQR mengembalikan QR code PNG dari share URI profil.
+func (c *Client) UserProfileQR(ctx context.Context, password string) ([]byte, error) {
+	return c.download(ctx, "/api/users/"+url.PathEscape(password)+"/profile?format=png")
+}
+
+// RotatePassword mengganti password akun; expired, limit dan pemakaian
+// kuota tetap. Link status lama tidak berlaku lagi.
+func (c *Client) RotatePassword(ctx context.Context, password, newPassword string) (*RotatedUser, error) {
+	var out RotatedUser
+	if err := c.do(ctx, http.MethodPost, "/api/users/"+url.PathEscape(password)+"/rotate", RotatePasswordRequest{NewPassword: newPassword}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// StatusLink mengembalikan link halaman status publik user, dibuat jika
+// belum ada.
+func (c *Client) StatusLink(ctx context.Context, password string) (*StatusLink, error) {
+	var out StatusLink
+	if err := c.do(ctx, http.MethodGet, "/api/users/"+url.PathEscape(password)+"/status-link", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RotateStatusLink mengganti token status user; link lama tidak berlaku lagi.
+func (c *Client) RotateStatusLink(ctx context.Context, password string) (*StatusLink, error) {
+	var out StatusLink
+	if err := c.do(ctx, http.MethodPost, "/api/users/"+url.PathEscape(password)+"/status-link", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) Online(ctx context.Context) ([]OnlineUser, error) {
+	out := []OnlineUser{}
+	if err := c.do(ctx, http.MethodGet, "/api/online", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UnlockUser membuka user yang disuspend atau dikunci karena limit IP.
+func (c *Client) UnlockUser(ctx context.Context, password string) error {
+	return c.do(ctx, http.MethodPost, "/api/user/unlock", DeleteUserRequest{Password: password}, nil)
+}
+
+// ResetQuota mengosongkan pemakaian kuota user dan membuka user yang
+// dikunci karena kuota habis.
+func (c *Client) ResetQuota(ctx context.Context, password string) (*Usage, error) {
+	var out Usage
+	if err := c.do(ctx, http.MethodPost, "/api/user/quota/reset", DeleteUserRequest{Password: password}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// TopUpQuota menambah limit kuota user sebesar gb.
+func (c *Client) TopUpQuota(ctx context.Context, password string, gb int) (*QuotaTopUp, error) {
+	var out QuotaTopUp
+	if err := c.do(ctx, http.MethodPost, "/api/user/quota/topup", QuotaTopUpRequest{Password: password, GB: gb}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) IPLimitPolicy(ctx context.Context) (*IPLimitPolicy, error) {
+	var out IPLimitPolicy
+	if err := c.do(ctx, http.MethodGet, "/api/iplimit", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) SetIPLimitPolicy(ctx context.Context, policy IPLimitPolicy) (*IPLimitPolicy, error) {
+	var out IPLimitPolicy
+	if err := c.do(ctx, http.MethodPost, "/api/iplimit", policy, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Violations mengembalikan catatan pelanggaran limit IP, terbaru di depan.
+// password kosong berarti semua user.
+func (c *Client) Violations(ctx context.Context, password string) ([]Violation, error) {
+	path := "/api/violations"
+	if password != "" {
+		path += "?password=" + url.QueryEscape(password)
+	}
+	out := []Violation{}
+	if err := c.do(ctx, http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *Client) PortHop(ctx context.Context) (*PortHopStatus, error) {
+	var out PortHopStatus
+	if err := c.do(ctx, http.MethodGet, "/api/network/porthop", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) SetPortHop(ctx context.Context, cfg PortHopConfig) (*PortHopStatus, error) {
+	var out PortHopStatus
+	if err := c.do(ctx, http.MethodPost, "/api/network/porthop", cfg, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) Settings(ctx context.Context) (*Settings, error) {
+	var out Settings
+	if err := c.do(ctx, http.MethodGet, "/api/settings", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) UpdateSettings(ctx context.Context, update SettingsUpdate) (*Settings, error) {
+	var out Settings
+	if err := c.do(ctx, http.MethodPost, "/api/settings", update, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Audit mengembalikan audit log, terbaru di depan. action kosong berarti semua.
+func (c *Client) Audit(ctx context.Context, action string) ([]AuditEntry, error) {
+	path := "/api/audit"
+	if action != "" {
+		path += "?action=" + url.QueryEscape(action)
+	}
+	out := []AuditEntry{}
+	if err := c.do(ctx, http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RecordAudit mencatat aksi dari luar API ke audit log. Pakai AsActor agar
+// pelakunya ikut tercatat.
+func (c *Client) RecordAudit(ctx context.Context, action string, detail interface{}) error {
+	return c.do(ctx, http.MethodPost, "/api/audit", AuditRequest{Action: action, Detail: detail}, nil)
+}
+
+// ConfigHistory mengembalikan snapshot config, terbaru di depan.
+func (c *Client) ConfigHistory(ctx context.Context) (*ConfigHistory, error) {
+	var out ConfigHistory
+	if err := c.do(ctx, http.MethodGet, "/api/config/history", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) SetHistoryRetention(ctx context.Context, retention int) error {
+	return c.do(ctx, http.MethodPost, "/api/config/history", map[string]int{"retention": retention}, nil)
+}
+
+// ConfigDiff membandingkan dua versi. to = 0 berarti file saat ini.
+func (c *Client) ConfigDiff(ctx context.Context, from, to int) (*ConfigDiff, error) {
+	path := fmt.Sprintf("/api/config/diff?from=%d", from)
+	if to != 0 {
+		path += fmt.Sprintf("&to=%d", to)
+	}
+	var out ConfigDiff
+	if err := c.do(ctx, http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RollbackConfig mengembalikan config.json dan users.db ke versi tertentu
+// dan mengembalikan perubahan yang diterapkan.
+func (c *Client) RollbackConfig(ctx context.Context, version int) (*ConfigDiff, error) {
+	var out ConfigDiff
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/config/rollback/%d", version), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) Udpgw(ctx context.Context) (*UdpgwStatus, error) {
+	var out UdpgwStatus
+	if err := c.do(ctx, http.MethodGet, "/api/udpgw", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) UpdateUdpgw(ctx context.Context, update UdpgwUpdate) (*UdpgwStatus, error) {
+	var out UdpgwStatus
+	if err := c.do(ctx, http.MethodPost, "/api/udpgw", update, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) RestartUdpgw(ctx context.Context) (*UdpgwStatus, error) {
+	var out UdpgwStatus
+	if err := c.do(ctx, http.MethodPost, "/api/udpgw/restart", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) Resellers(ctx context.Context) ([]Reseller, error) {
+	out := []Reseller{}
+	if err := c.do(ctx, http.MethodGet, "/api/resellers", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *Client) CreateReseller(ctx context.Context, req NewReseller) (*ResellerKey, error) {
+	var out ResellerKey
+	if err := c.do(ctx, http.MethodPost, "/api/reseller/create", req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) UpdateReseller(ctx context.Context, id string, update ResellerUpdate) (*Reseller, error) {
+	payload := struct {
+		ID string `json:"id"`
+		ResellerUpdate
+	}{id, update}
+	var out Reseller
+	if err := c.do(ctx, http.MethodPost, "/api/reseller/update", payload, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeleteReseller(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/api/reseller/delete", map[string]string{"id": id}, nil)
+}
+
+func (c *Client) TopUpReseller(ctx context.Context, id string, amount int64, note string) (*Reseller, error) {
+	payload := map[string]interface{}{"id": id, "amount": amount, "note": note}
+	var out Reseller
+	if err := c.do(ctx, http.MethodPost, "/api/reseller/topup", payload, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) RotateResellerKey(ctx context.Context, id string) (*ResellerKey, error) {
+	var out ResellerKey
+	if err := c.do(ctx, http.MethodPost, "/api/reseller/key", map[string]string{"id": id}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Ledger mengembalikan riwayat kredit terbaru di depan. id kosong berarti
+// semua reseller; limit 0 berarti tanpa batas.
+func (c *Client) Ledger(ctx context.Context, id string, limit int) ([]LedgerEntry, error) {
+	query := url.Values{}
+	if id != "" {
+		query.Set("id", id)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	path := "/api/reseller/ledger"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	out := []LedgerEntry{}
+	if err := c.do(ctx, http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ResellerMe mengembalikan profil reseller pemanggil. Gagal dengan
+// ErrNotFound jika pemanggil bukan reseller.
+func (c *Client) ResellerMe(ctx context.Context) (*ResellerProfile, error) {
+	var out ResellerProfile
+	if err := c.do(ctx, http.MethodGet, "/api/reseller/me", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Plans mengembalikan plan yang boleh dipakai pemanggil, termurah di depan.
+// visibility kosong berarti semua.
+func (c *Client) Plans(ctx context.Context, visibility string) ([]Plan, error) {
+	path := "/api/plans"
+	if visibility != "" {
+		path += "?visibility=" + url.QueryEscape(visibility)
+	}
+	out := []Plan{}
+	if err := c.do(ctx, http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *Client) CreatePlan(ctx context.Context, req NewPlan) (*Plan, error) {
+	var out Plan
+	if err := c.do(ctx, http.MethodPost, "/api/plan/create", req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) UpdatePlan(ctx context.Context, id string, update PlanUpdate) (*Plan, error) {
+	payload := struct {
+		ID string `json:"id"`
+		PlanUpdate
+	}{id, update}
+	var out Plan
+	if err := c.do(ctx, http.MethodPost, "/api/plan/update", payload, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeletePlan(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/api/plan/delete", map[string]string{"id": id}, nil)
+}
+
+// Vouchers mengembalikan voucher terbaru di depan; batch kosong berarti semua.
+func (c *Client) Vouchers(ctx context.Context, batch string) ([]Voucher, error) {
+	path := "/api/vouchers"
+	if batch != "" {
+		path += "?batch=" + url.QueryEscape(batch)
+	}
+	out := []Voucher{}
+	if err := c.do(ctx, http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ExportVouchers mengunduh voucher satu batch dalam format CSV.
+func (c *Client) ExportVouchers(ctx context.Context, batch string) ([]byte, error) {
+	return c.download(ctx, "/api/vouchers?format=csv&batch="+url.QueryEscape(batch))
+}
+
+func (c *Client) VoucherBatches(ctx context.Context) ([]VoucherBatch, error) {
+	out := []VoucherBatch{}
+	if err := c.do(ctx, http.MethodGet, "/api/voucher/batches", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *Client) GenerateVouchers(ctx context.Context, req GenerateVouchers) (*GeneratedVouchers, error) {
+	var out GeneratedVouchers
+	if err := c.do(ctx, http.MethodPost, "/api/voucher/generate", req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RevokeVoucher mencabut satu kode; RevokeVoucherBatch mencabut satu batch.
+// Keduanya mengembalikan jumlah voucher yang dicabut.
+func (c *Client) RevokeVoucher(ctx context.Context, code string) (int, error) {
+	return c.revokeVouchers(ctx, map[string]string{"code": code})
+}
+
+func (c *Client) RevokeVoucherBatch(ctx context.Context, batch string) (int, error) {
+	return c.revokeVouchers(ctx, map[string]string{"batch": batch})
+}
+
+func (c *Client) revokeVouchers(ctx context.Context, payload map[string]string) (int, error) {
+	var out struct {
+		Revoked int `json:"revoked"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/voucher/revoke", payload, &out); err != nil {
+		return 0, err
+	}
+	return out.Revoked, nil
+}
+
+// RedeemVoucher membuat akun baru, atau memperpanjang akun jika password
+// sudah ada. Voucher yang habis/dicabut/kadaluarsa gagal dengan ErrConflict.
+func (c *Client) RedeemVoucher(ctx context.Context, req RedeemVoucherRequest) (*RedeemedVoucher, error) {
+	var out RedeemedVoucher
+	if err := c.do(ctx, http.MethodPost, "/api/voucher/redeem", req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) PaymentConfig(ctx context.Context) (*PaymentConfig, error) {
+	var out PaymentConfig
+	if err := c.do(ctx, http.MethodGet, "/api/payment", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) UpdatePaymentConfig(ctx context.Context, update PaymentUpdate) (*PaymentConfig, error) {
+	var out PaymentConfig
+	if err := c.do(ctx, http.MethodPost, "/api/payment", update, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Orders mengembalikan order terbaru di depan.
+func (c *Client) Orders(ctx context.Context, filter OrderFilter) ([]Order, error) {
+	query := url.Values{}
+	if filter.ID != "" {
+		query.Set("id", filter.ID)
+	}
+	if filter.Status != "" {
+		query.Set("status", filter.Status)
+	}
+	if filter.TelegramID != 0 {
+		query.Set("telegram_id", strconv.FormatInt(filter.TelegramID, 10))
+	}
+	path := "/api/orders"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	out := []Order{}
+	if err := c.do(ctx, http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CreateOrder membuat tagihan; akun dibuat setelah order dibayar.
+func (c *Client) CreateOrder(ctx context.Context, req NewOrder) (*Order, error) {
+	var out Order
+	if err := c.do(ctx, http.MethodPost, "/api/order/create", req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// MarkOrderPaid menandai order lunas secara manual dan membuat akunnya.
+func (c *Client) MarkOrderPaid(ctx context.Context, id string) (*Order, error) {
+	var out Order
+	if err := c.do(ctx, http.MethodPost, "/api/order/paid", map[string]string{"id": id}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) CancelOrder(ctx context.Context, id string) (*Order, error) {
+	var out Order
+	if err := c.do(ctx, http.MethodPost, "/api/order/cancel", map[string]string{"id": id}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) Cert(ctx context.Context) (*CertStatus, error) {
+	var out CertStatus
+	if err := c.do(ctx, http.MethodGet, "/api/cert", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) SetCertConfig(ctx context.Context, cfg CertConfig) (*CertConfig, error) {
+	var out CertConfig
+	if err := c.do(ctx, http.MethodPost, "/api/cert", cfg, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RenewCert memulai penggantian sertifikat di background dan langsung
+// kembali dengan Renewing=true. Panggil Cert berkala sampai Renewing false,
+// lalu cek LastRenewal dan LastError.
+func (c *Client) RenewCert(ctx context.Context) (*CertStatus, error) {
+	var out CertStatus
+	if err := c.do(ctx, http.MethodPost, "/api/cert/renew", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Backup mengunduh arsip full state (tar.gz) dari /api/backup.
+func (c *Client) Backup(ctx context.Context) ([]byte, error) {
+	return c.download(ctx, "/api/backup")
+}
+
+// download mengambil response mentah (bukan JSON) dari endpoint GET
+func (c *Client) download(ctx context.Context, path string) ([]byte, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultTimeout)
+		defer cancel()
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, decodeError(resp)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Restore mengunggah arsip dari Backup ke /api/restore.
+func (c *Client) Restore(ctx context.Context, archive io.Reader) (*RestoreResult, error) {
+	var out RestoreResult
+	if err := c.send(ctx, http.MethodPost, "/api/restore", archive, "application/gzip", &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DryRun menjalankan request POST ke path (misalnya "/api/user/create")
+// dengan dry_run=true dan mengembalikan perubahan tanpa menulis apa pun.
+func (c *Client) DryRun(ctx context.Context, path string, payload interface{}) (*DryRunResult, error) {
+	var out DryRunResult
+	if err := c.do(ctx, http.MethodPost, path+"?dry_run=true", payload, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DryRunRestore memvalidasi arsip backup dan mengembalikan file yang akan berubah.
+func (c *Client) DryRunRestore(ctx context.Context, archive io.Reader) (*DryRunResult, error) {
+	var out DryRunResult
+	if err := c.send(ctx, http.MethodPost, "/api/restore?dry_run=true", archive, "application/gzip", &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Events membuka stream /api/events dan memanggil fn untuk setiap event
+// sampai ctx dibatalkan, koneksi putus, atau fn mengembalikan error.
+// lastID > 0 akan dikirim sebagai Last-Event-ID untuk resume.
+// Berbeda dengan endpoint lain, DefaultTimeout tidak diterapkan di sini.
+func (c *Client) Events(ctx context.Context, lastID int64, fn func(Event) error) error {
+	req, err := c.newRequest(ctx, http.MethodGet, "/api/events", nil, "")
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if lastID > 0 {
+		req.Header.Set("Last-Event-ID", strconv.FormatInt(lastID, 10))
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return decodeError(resp)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data.Len() == 0 {
+				continue
+			}
+			var ev Event
+			if err := json.Unmarshal([]byte(data.String()), &ev); err == nil {
+				if err := fn(ev); err != nil {
+					return err
+				}
+			}
+			data.Reset()
+		case strings.HasPrefix(line, "data:"):
+			data.WriteString(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// --- Transport ---
+
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader, contentType string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("X-API-Key", c.APIKey)
+	if c.ResellerTelegram != 0 {
+		req.Header.Set("X-Reseller-Telegram", strconv.FormatInt(c.ResellerTelegram, 10))
+	}
+	if c.Actor != "" {
+		req.Header.Set("X-Actor", c.Actor)
+	}
+	return req, nil
+}
+
+// do mengirim payload sebagai JSON dan men-decode field data ke out.
+func (c *Client) do(ctx context.Context, method, path string, payload, out interface{}) error {
+	if payload == nil {
+		return c.send(ctx, method, path, nil, "", out)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return c.send(ctx, method, path, bytes.NewReader(data), "application/json", out)
+}
+
+func (c *Client) send(ctx context.Context, method, path string, body io.Reader, contentType string, out interface{}) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultTimeout)
+		defer cancel()
+	}
+
+	req, err := c.newRequest(ctx, method, path, body, contentType)
+	if err != nil {
+		return err
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var res response
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return fmt.Errorf("gagal decode response API (status %d): %v", resp.StatusCode, err)
+	}
+	if !res.Success || resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &APIError{Status: resp.StatusCode, Code: res.Code, Message: res.Message}
+	}
+	if out != nil && len(res.Data) > 0 && string(res.Data) != "null" {
+		if err := json.Unmarshal(res.Data, out); err != nil {
+			return fmt.Errorf("format data response API tidak valid: %v", err)
+		}
+	}
+	return nil
+}
+
+func decodeError(resp *http.Response) error {
+	var res response
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return &APIError{Status: resp.StatusCode, Message: fmt.Sprintf("API returned status: %d", resp.StatusCode)}
+	}
+	return &APIError{Status: resp.StatusCode, Code: res.Code, Message: res.Message}
+}
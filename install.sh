@@ -65,11 +65,16 @@ fi
 run_silent "Updating system" "apt-get update -y"
 
 if ! command -v go &> /dev/null; then
-  run_silent "Installing dependencies" "apt-get install -y golang git wget curl ufw openssl"
+  run_silent "Installing dependencies" "apt-get install -y golang git wget curl ufw openssl nftables"
 else
   print_done "Dependencies ready"
 fi
 
+# nftables dipakai API untuk menghitung pemakaian kuota per user
+if ! command -v nft &> /dev/null; then
+  run_silent "Installing nftables" "apt-get install -y nftables"
+fi
+
 # =========================
 # DOMAIN
 # =========================
@@ -143,11 +148,16 @@ EOF
 # =========================
 # ✅ API SETUP
 # =========================
-mkdir -p /etc/zivpn/api
+mkdir -p /etc/zivpn/api/docs /etc/zivpn/api/acme /etc/zivpn/api/payment /etc/zivpn/api/qrcode
 
 run_silent "Setting up API" \
 "wget -q https://raw.githubusercontent.com/ramadhan144/UDP-PROJECT/main/zivpn-api.go -O /etc/zivpn/api/zivpn-api.go && \
- wget -q https://raw.githubusercontent.com/ramadhan144/UDP-PROJECT/main/go.mod -O /etc/zivpn/api/go.mod"
+ wget -q https://raw.githubusercontent.com/ramadhan144/UDP-PROJECT/main/go.mod -O /etc/zivpn/api/go.mod && \
+ wget -q https://raw.githubusercontent.com/ramadhan144/UDP-PROJECT/main/docs/openapi.json -O /etc/zivpn/api/docs/openapi.json && \
+ wget -q https://raw.githubusercontent.com/ramadhan144/UDP-PROJECT/main/docs/index.html -O /etc/zivpn/api/docs/index.html && \
+ wget -q https://raw.githubusercontent.com/ramadhan144/UDP-PROJECT/main/acme/acme.go -O /etc/zivpn/api/acme/acme.go && \
+ wget -q https://raw.githubusercontent.com/ramadhan144/UDP-PROJECT/main/payment/payment.go -O /etc/zivpn/api/payment/payment.go && \
+ wget -q https://raw.githubusercontent.com/ramadhan144/UDP-PROJECT/main/qrcode/qrcode.go -O /etc/zivpn/api/qrcode/qrcode.go"
 
 cd /etc/zivpn/api
 if go build -o zivpn-api zivpn-api.go &>/dev/null; then
@@ -184,8 +194,11 @@ read -p "Admin ID : " admin_id
 if [[ -n "$bot_token" && -n "$admin_id" ]]; then
   echo "{\"bot_token\":\"$bot_token\",\"admin_id\":$admin_id}" > /etc/zivpn/bot-config.json
 
+  mkdir -p /etc/zivpn/api/client
+
   run_silent "Downloading Bot" \
-  "wget -q https://raw.githubusercontent.com/ramadhan144/UDP-PROJECT/main/zivpn-bot.go -O /etc/zivpn/api/zivpn-bot.go"
+  "wget -q https://raw.githubusercontent.com/ramadhan144/UDP-PROJECT/main/zivpn-bot.go -O /etc/zivpn/api/zivpn-bot.go && \
+   wget -q https://raw.githubusercontent.com/ramadhan144/UDP-PROJECT/main/client/client.go -O /etc/zivpn/api/client/client.go"
 
   cd /etc/zivpn/api
   go get github.com/go-telegram-bot-api/telegram-bot-api/v5 &>/dev/null
@@ -222,8 +235,8 @@ fi
 run_silent "Starting Services" \
 "systemctl daemon-reload && systemctl enable zivpn && systemctl enable zivpn-api && systemctl restart zivpn && systemctl restart zivpn-api"
 
-iface=$(ip route | awk '/default/ {print $5}')
-iptables -t nat -A PREROUTING -i "$iface" -p udp --dport 6000:19999 -j DNAT --to :5667
+# Rule DNAT port hopping (6000-19999 -> port listen core) dipasang dan
+# dijaga oleh zivpn-api, lihat /api/network/porthop
 ufw allow 6000:19999/udp
 ufw allow 5667/udp
 ufw allow 8080/tcp
@@ -0,0 +1,143 @@
+// Package payment mendefinisikan gateway pembayaran untuk order ZiVPN API.
+//
+// API hanya bergantung pada interface Gateway: membuat tagihan untuk satu
+// order, lalu memverifikasi webhook yang dikirim gateway saat tagihan
+// dibayar. Mock adalah implementasi lokal tanpa pihak ketiga untuk uji coba;
+// webhook-nya ditandatangani HMAC-SHA256 sehingga bisa disimulasikan dengan
+// curl atau lewat Mock.Notify.
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Nilai Notification.Status
+const (
+	StatusPaid    = "paid"
+	StatusFailed  = "failed"
+	StatusExpired = "expired"
+)
+
+// MaxWebhookBody membatasi ukuran body webhook yang dibaca.
+const MaxWebhookBody = 64 << 10
+
+// ErrInvalidSignature dikembalikan ParseWebhook jika tanda tangan webhook
+// tidak cocok. API membalas 401 agar gateway tidak menganggapnya sukses.
+var ErrInvalidSignature = errors.New("payment: signature webhook tidak valid")
+
+// Invoice adalah tagihan untuk satu order.
+type Invoice struct {
+	OrderID     string
+	Amount      int64
+	Description string
+	ExpiresAt   time.Time
+}
+
+// Checkout adalah hasil pembuatan tagihan di gateway.
+type Checkout struct {
+	// Reference adalah ID transaksi di gateway, dipakai untuk mencocokkan webhook.
+	Reference string
+	// PayURL adalah halaman pembayaran, kosong jika gateway tidak menyediakannya.
+	PayURL string
+	// Instructions adalah teks cara membayar untuk ditampilkan ke pembeli.
+	Instructions string
+}
+
+// Notification adalah isi webhook yang sudah diverifikasi.
+type Notification struct {
+	Reference string `json:"reference"`
+	OrderID   string `json:"order_id"`
+	Status    string `json:"status"`
+	Amount    int64  `json:"amount"`
+}
+
+// Gateway adalah penyedia pembayaran. Implementasi harus aman dipakai dari
+// beberapa goroutine.
+type Gateway interface {
+	Name() string
+	CreateInvoice(ctx context.Context, inv Invoice) (*Checkout, error)
+	// ParseWebhook membaca dan memverifikasi request webhook dari gateway.
+	ParseWebhook(r *http.Request) (*Notification, error)
+}
+
+// Mock adalah gateway lokal untuk uji coba. Tagihan tidak pernah dibayar
+// sendiri; kirim webhook bertanda tangan ke API untuk mensimulasikannya.
+type Mock struct {
+	Secret string
+}
+
+// MockSignatureHeader berisi hex HMAC-SHA256 body webhook dengan Secret.
+const MockSignatureHeader = "X-Mock-Signature"
+
+func NewMock(secret string) *Mock {
+	return &Mock{Secret: secret}
+}
+
+func (m *Mock) Name() string {
+	return "mock"
+}
+
+func (m *Mock) CreateInvoice(ctx context.Context, inv Invoice) (*Checkout, error) {
+	if inv.Amount <= 0 {
+		return nil, fmt.Errorf("payment: jumlah tagihan tidak valid: %d", inv.Amount)
+	}
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	ref := "MOCK-" + strings.ToUpper(hex.EncodeToString(b))
+	return &Checkout{
+		Reference:    ref,
+		Instructions: fmt.Sprintf("Gateway mock: kirim webhook status %q dengan reference %s untuk mensimulasikan pembayaran.", StatusPaid, ref),
+	}, nil
+}
+
+func (m *Mock) ParseWebhook(r *http.Request) (*Notification, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, MaxWebhookBody))
+	if err != nil {
+		return nil, err
+	}
+	got, err := hex.DecodeString(r.Header.Get(MockSignatureHeader))
+	if err != nil || !hmac.Equal(got, m.mac(body)) {
+		return nil, ErrInvalidSignature
+	}
+	var n Notification
+	if err := json.Unmarshal(body, &n); err != nil {
+		return nil, fmt.Errorf("payment: body webhook tidak valid: %w", err)
+	}
+	if n.Reference == "" {
+		return nil, errors.New("payment: reference kosong")
+	}
+	return &n, nil
+}
+
+// Sign mengembalikan nilai header MockSignatureHeader untuk body.
+func (m *Mock) Sign(body []byte) string {
+	return hex.EncodeToString(m.mac(body))
+}
+
+// Notify membuat body dan signature webhook untuk mensimulasikan gateway.
+func (m *Mock) Notify(n Notification) ([]byte, string, error) {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return nil, "", err
+	}
+	return body, m.Sign(body), nil
+}
+
+func (m *Mock) mac(body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(m.Secret))
+	h.Write(body)
+	return h.Sum(nil)
+}
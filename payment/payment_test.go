@@ -0,0 +1,105 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMockSign(t *testing.T) {
+	m := NewMock("rahasia")
+	body := []byte(`{"reference":"MOCK-1","status":"paid"}`)
+
+	sig := m.Sign(body)
+	if len(sig) != 64 {
+		t.Fatalf("signature %q bukan hex SHA-256", sig)
+	}
+	if m.Sign(body) != sig {
+		t.Error("signature tidak deterministik")
+	}
+	if m.Sign(append(body, ' ')) == sig {
+		t.Error("signature tidak berubah saat body berubah")
+	}
+	if NewMock("lain").Sign(body) == sig {
+		t.Error("signature tidak bergantung pada secret")
+	}
+}
+
+func TestMockParseWebhook(t *testing.T) {
+	m := NewMock("rahasia")
+	body, sig, err := m.Notify(Notification{Reference: "MOCK-1", OrderID: "o1", Status: StatusPaid, Amount: 15000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	noRef, noRefSig, _ := m.Notify(Notification{Status: StatusPaid})
+
+	tests := []struct {
+		name    string
+		body    []byte
+		sig     string
+		want    *Notification
+		wantErr error // ErrInvalidSignature, atau nil jika cukup error lain
+	}{
+		{
+			name: "valid",
+			body: body, sig: sig,
+			want: &Notification{Reference: "MOCK-1", OrderID: "o1", Status: StatusPaid, Amount: 15000},
+		},
+		{
+			name: "signature huruf besar",
+			body: body, sig: strings.ToUpper(sig),
+			want: &Notification{Reference: "MOCK-1", OrderID: "o1", Status: StatusPaid, Amount: 15000},
+		},
+		{name: "tanpa signature", body: body, wantErr: ErrInvalidSignature},
+		{name: "signature bukan hex", body: body, sig: "xyz", wantErr: ErrInvalidSignature},
+		{name: "secret lain", body: body, sig: NewMock("lain").Sign(body), wantErr: ErrInvalidSignature},
+		{name: "body diubah", body: bytes.Replace(body, []byte("15000"), []byte("1"), 1), sig: sig, wantErr: ErrInvalidSignature},
+		{name: "body bukan JSON", body: []byte("bukan json"), sig: m.Sign([]byte("bukan json"))},
+		{name: "reference kosong", body: noRef, sig: noRefSig},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/payment/webhook", bytes.NewReader(tt.body))
+			if tt.sig != "" {
+				r.Header.Set(MockSignatureHeader, tt.sig)
+			}
+			got, err := m.ParseWebhook(r)
+			if tt.want != nil {
+				if err != nil {
+					t.Fatalf("error: %v", err)
+				}
+				if *got != *tt.want {
+					t.Errorf("notification = %+v, ingin %+v", *got, *tt.want)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("webhook diterima: %+v", got)
+			}
+			if isSig := errors.Is(err, ErrInvalidSignature); isSig != (tt.wantErr == ErrInvalidSignature) {
+				t.Errorf("error = %v, ingin ErrInvalidSignature = %v", err, tt.wantErr == ErrInvalidSignature)
+			}
+		})
+	}
+}
+
+func TestMockCreateInvoice(t *testing.T) {
+	m := NewMock("rahasia")
+	a, err := m.CreateInvoice(context.Background(), Invoice{OrderID: "o1", Amount: 15000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := m.CreateInvoice(context.Background(), Invoice{OrderID: "o2", Amount: 15000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(a.Reference, "MOCK-") || a.Reference == b.Reference {
+		t.Errorf("reference tidak unik: %q, %q", a.Reference, b.Reference)
+	}
+	if _, err := m.CreateInvoice(context.Background(), Invoice{OrderID: "o3"}); err == nil {
+		t.Error("tagihan tanpa jumlah diterima")
+	}
+}
@@ -0,0 +1,487 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Golden di testdata/ dibuat dengan encoder lain (github.com/skip2/go-qrcode)
+// lalu disimpan sebagai baris '#' (gelap) dan '.' (terang). Encoder ini hanya
+// membuat level M, jadi semua golden level M; versinya mencakup satu blok,
+// beberapa blok, dan dua grup blok. Pemilihan mask tidak baku antar encoder,
+// jadi matriks dibandingkan dengan mask yang dipakai golden.
+var goldens = []struct {
+	file    string
+	input   string
+	version int
+}{
+	{"v01.txt", "hello", 1},
+	{"v03.txt", "zivpn://user@vpn.example.com", 3},
+	{"v05.txt", "hysteria://password@vpn.example.com:5667?obfs=zivpn&insecure=1#user", 5},
+	{"v07.txt", strings.Repeat("zivpn profile ", 8), 7},
+	{"v10.txt", strings.Repeat("abcdefghij", 20), 10},
+	{"v15.txt", strings.Repeat("the quick brown fox jumps over the lazy dog ", 9), 15},
+	{"v20.txt", strings.Repeat("zivpn-", 111), 20},
+}
+
+func TestGoldenMatrices(t *testing.T) {
+	for _, g := range goldens {
+		t.Run(g.file, func(t *testing.T) {
+			want := readGolden(t, g.file)
+			ref, err := decode(want)
+			if err != nil {
+				t.Fatalf("golden tidak bisa di-decode: %v", err)
+			}
+			if string(ref.data) != g.input || ref.version != g.version {
+				t.Fatalf("golden berisi versi %d %q", ref.version, ref.data)
+			}
+
+			got, err := Encode([]byte(g.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Version != g.version {
+				t.Fatalf("versi = %d, mau %d", got.Version, g.version)
+			}
+			forced := encodeWithMask([]byte(g.input), got.Version, ref.mask)
+			if x, y, ok := firstDiff(forced.Modules, want); !ok {
+				t.Fatalf("mask %d: modul (%d,%d) berbeda dari golden", ref.mask, x, y)
+			}
+		})
+	}
+}
+
+// TestDecodeRoundTrip meng-encode data acak di batas kapasitas setiap versi
+// lalu membacanya kembali dengan decoder independen di bawah.
+func TestDecodeRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	masks := map[int]bool{}
+	for v := 1; v <= MaxVersion; v++ {
+		limit := capacity(v)
+		for _, n := range []int{limit, limit - 1, capacity(v-1) + 1} {
+			if n <= 0 || n > limit {
+				continue
+			}
+			data := make([]byte, n)
+			rng.Read(data)
+			c, err := Encode(data)
+			if err != nil {
+				t.Fatalf("v%d %d byte: %v", v, n, err)
+			}
+			if c.Version != v {
+				t.Fatalf("%d byte: versi = %d, mau %d", n, c.Version, v)
+			}
+			got, err := decode(c.Modules)
+			if err != nil {
+				t.Fatalf("v%d %d byte: %v", v, n, err)
+			}
+			if got.level != levelM {
+				t.Fatalf("v%d: level format = %02b, mau M", v, got.level)
+			}
+			if !bytes.Equal(got.data, data) {
+				t.Fatalf("v%d %d byte: data hasil decode berbeda", v, n)
+			}
+			masks[got.mask] = true
+		}
+	}
+	if len(masks) < 4 {
+		t.Errorf("hanya mask %v yang terpilih; penalty kemungkinan salah", masks)
+	}
+}
+
+// Semua mask harus bisa dibaca, bukan hanya yang dipilih penalty
+func TestEveryMaskDecodes(t *testing.T) {
+	data := []byte("hysteria://secret@vpn.example.com:5667?obfs=zivpn")
+	c, err := Encode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for mask := 0; mask < 8; mask++ {
+		got, err := decode(encodeWithMask(data, c.Version, mask).Modules)
+		if err != nil {
+			t.Fatalf("mask %d: %v", mask, err)
+		}
+		if got.mask != mask || !bytes.Equal(got.data, data) {
+			t.Fatalf("mask %d: terbaca mask %d data %q", mask, got.mask, got.data)
+		}
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	if _, err := Encode(make([]byte, capacity(MaxVersion))); err != nil {
+		t.Fatalf("kapasitas penuh: %v", err)
+	}
+	if _, err := Encode(make([]byte, capacity(MaxVersion)+1)); err != ErrTooLong {
+		t.Fatalf("err = %v, mau ErrTooLong", err)
+	}
+}
+
+func encodeWithMask(data []byte, version, mask int) *Code {
+	c := newCode(version)
+	c.drawFunctionPatterns()
+	c.drawCodewords(interleave(version, encodeData(version, data)))
+	c.applyMask(mask)
+	c.drawFormatBits(mask)
+	return c
+}
+
+// capacity adalah jumlah byte maksimal untuk versi v (0 untuk v < 1)
+func capacity(v int) int {
+	if v < 1 {
+		return 0
+	}
+	header := 4 + 8
+	if v >= 10 {
+		header = 4 + 16
+	}
+	return (specs[v].dataCodewords()*8 - header) / 8
+}
+
+func readGolden(t *testing.T, name string) [][]bool {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m [][]bool
+	for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+		row := make([]bool, len(line))
+		for i, ch := range line {
+			row[i] = ch == '#'
+		}
+		m = append(m, row)
+	}
+	return m
+}
+
+func firstDiff(got, want [][]bool) (int, int, bool) {
+	if len(got) != len(want) {
+		return -1, -1, false
+	}
+	for y := range want {
+		if len(got[y]) != len(want[y]) {
+			return -1, y, false
+		}
+		for x := range want[y] {
+			if got[y][x] != want[y][x] {
+				return x, y, false
+			}
+		}
+	}
+	return 0, 0, true
+}
+
+// --- Decoder untuk test ---
+//
+// Ditulis terpisah dari encoder: posisi alignment dihitung dengan rumus,
+// format/version info dicocokkan ke tabel ISO/IEC 18004 Annex C/D, dan
+// Reed-Solomon dicek lewat syndrome, bukan dengan menghitung ulang EC.
+
+const levelM = 0 // bit level di format info: L=01, M=00, Q=11, H=10
+
+// Format info yang sudah di-XOR 0x5412, indeks level<<3 | mask
+var formatTable = [32]int{
+	0x5412, 0x5125, 0x5E7C, 0x5B4B, 0x45F9, 0x40CE, 0x4F97, 0x4AA0, // M
+	0x77C4, 0x72F3, 0x7DAA, 0x789D, 0x662F, 0x6318, 0x6C41, 0x6976, // L
+	0x1689, 0x13BE, 0x1CE7, 0x19D0, 0x0762, 0x0255, 0x0D0C, 0x083B, // H
+	0x355F, 0x3068, 0x3F31, 0x3A06, 0x24B4, 0x2183, 0x2EDA, 0x2BED, // Q
+}
+
+// Version info versi 7-20
+var versionTable = map[int]int{
+	7: 0x07C94, 8: 0x085BC, 9: 0x09A99, 10: 0x0A4D3, 11: 0x0BBF6, 12: 0x0C762, 13: 0x0D847,
+	14: 0x0E60D, 15: 0x0F928, 16: 0x10B78, 17: 0x1145D, 18: 0x12A17, 19: 0x13532, 20: 0x149A6,
+}
+
+type decoded struct {
+	version int
+	level   int
+	mask    int
+	data    []byte
+}
+
+func decode(m [][]bool) (*decoded, error) {
+	size := len(m)
+	if size < 21 || (size-17)%4 != 0 {
+		return nil, fmt.Errorf("ukuran %d tidak valid", size)
+	}
+	d := &decoded{version: (size - 17) / 4}
+	if d.version > MaxVersion {
+		return nil, fmt.Errorf("versi %d di luar jangkauan test", d.version)
+	}
+	dark := func(x, y int) int {
+		if m[y][x] {
+			return 1
+		}
+		return 0
+	}
+
+	// Dua salinan format info harus sama dan tepat satu entri tabel
+	var first, second int
+	for i := 0; i < 15; i++ {
+		var x, y int
+		switch {
+		case i < 6:
+			x, y = 8, i
+		case i < 8:
+			x, y = 8, i+1
+		case i == 8:
+			x, y = 7, 8
+		default:
+			x, y = 14-i, 8
+		}
+		first |= dark(x, y) << i
+		if i < 8 {
+			second |= dark(size-1-i, 8) << i
+		} else {
+			second |= dark(8, size-15+i) << i
+		}
+	}
+	if first != second {
+		return nil, fmt.Errorf("format info berbeda: %015b vs %015b", first, second)
+	}
+	format := -1
+	for i, f := range formatTable {
+		if f == first {
+			format = i
+		}
+	}
+	if format < 0 {
+		return nil, fmt.Errorf("format info %015b tidak dikenal", first)
+	}
+	d.level, d.mask = format>>3, format&7
+	if d.level != levelM {
+		return nil, errors.New("hanya level M yang bisa di-decode")
+	}
+	if dark(8, size-8) != 1 {
+		return nil, errors.New("dark module tidak ada")
+	}
+
+	if d.version >= 7 {
+		var a, b int
+		for i := 0; i < 18; i++ {
+			a |= dark(size-11+i%3, i/3) << i
+			b |= dark(i/3, size-11+i%3) << i
+		}
+		if a != versionTable[d.version] || b != a {
+			return nil, fmt.Errorf("version info %05x/%05x tidak cocok untuk versi %d", a, b, d.version)
+		}
+	}
+
+	function := functionModules(d.version)
+	var raw []byte
+	n := 0
+	upward := true
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // kolom timing dilewati
+		}
+		for vert := 0; vert < size; vert++ {
+			y := vert
+			if upward {
+				y = size - 1 - vert
+			}
+			for x := right; x >= right-1; x-- {
+				if function[y][x] {
+					continue
+				}
+				bit := m[y][x] != maskBit(d.mask, x, y)
+				if n%8 == 0 {
+					raw = append(raw, 0)
+				}
+				if bit {
+					raw[len(raw)-1] |= 0x80 >> uint(n%8)
+				}
+				n++
+			}
+		}
+		upward = !upward
+	}
+	raw = raw[:n/8] // sisa bit (remainder) dibuang
+
+	spec := specs[d.version]
+	blocks := spec.blocks1 + spec.blocks2
+	if len(raw) != spec.dataCodewords()+blocks*spec.ecPerBlock {
+		return nil, fmt.Errorf("jumlah codeword %d tidak sesuai tabel blok", len(raw))
+	}
+	// De-interleave: data per kolom, blok grup 2 satu codeword lebih panjang
+	sizes := make([]int, blocks)
+	for i := range sizes {
+		sizes[i] = spec.data1
+		if i >= spec.blocks1 {
+			sizes[i] = spec.data2
+		}
+	}
+	full := make([][]byte, blocks)
+	pos := 0
+	for col := 0; pos < spec.dataCodewords(); col++ {
+		for i := range full {
+			if col < sizes[i] {
+				full[i] = append(full[i], raw[pos])
+				pos++
+			}
+		}
+	}
+	for col := 0; col < spec.ecPerBlock; col++ {
+		for i := range full {
+			full[i] = append(full[i], raw[pos])
+			pos++
+		}
+	}
+	var data []byte
+	for i, block := range full {
+		if !syndromesZero(block, spec.ecPerBlock) {
+			return nil, fmt.Errorf("blok %d gagal cek Reed-Solomon", i)
+		}
+		data = append(data, block[:sizes[i]]...)
+	}
+
+	var err error
+	if d.data, err = parseByteMode(data, d.version); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func maskBit(mask, j, i int) bool {
+	switch mask {
+	case 0:
+		return (i+j)%2 == 0
+	case 1:
+		return i%2 == 0
+	case 2:
+		return j%3 == 0
+	case 3:
+		return (i+j)%3 == 0
+	case 4:
+		return (i/2+j/3)%2 == 0
+	case 5:
+		return (i*j)%2+(i*j)%3 == 0
+	case 6:
+		return ((i*j)%2+(i*j)%3)%2 == 0
+	default:
+		return ((i+j)%2+(i*j)%3)%2 == 0
+	}
+}
+
+// functionModules menandai finder, separator, format, timing, alignment dan
+// version info untuk satu versi.
+func functionModules(version int) [][]bool {
+	size := version*4 + 17
+	f := make([][]bool, size)
+	for y := range f {
+		f[y] = make([]bool, size)
+		for x := range f[y] {
+			f[y][x] = x == 6 || y == 6 ||
+				(x < 9 && y < 9) || (x >= size-8 && y < 9) || (x < 9 && y >= size-8)
+			if version >= 7 && ((x >= size-11 && x < size-8 && y < 6) || (y >= size-11 && y < size-8 && x < 6)) {
+				f[y][x] = true
+			}
+		}
+	}
+	var centers []int
+	if version > 1 {
+		num := version/7 + 2
+		step := (version*4 + num*2 + 1) / (num*2 - 2) * 2
+		centers = []int{6}
+		for i := num - 2; i >= 0; i-- {
+			centers = append(centers, size-7-i*step)
+		}
+	}
+	for _, cy := range centers {
+		for _, cx := range centers {
+			last := size - 7
+			if (cx == 6 && cy == 6) || (cx == 6 && cy == last) || (cx == last && cy == 6) {
+				continue // bertumpuk dengan finder
+			}
+			for y := cy - 2; y <= cy+2; y++ {
+				for x := cx - 2; x <= cx+2; x++ {
+					f[y][x] = true
+				}
+			}
+		}
+	}
+	return f
+}
+
+var gfExp, gfLog = func() (exp [512]byte, log [256]int) {
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		log[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+	for i := 255; i < 512; i++ {
+		exp[i] = exp[i-255]
+	}
+	return
+}()
+
+// syndromesZero mengecek block(α^k) = 0 untuk k = 0..ec-1
+func syndromesZero(block []byte, ec int) bool {
+	n := len(block)
+	for k := 0; k < ec; k++ {
+		var s byte
+		for j, c := range block {
+			if c != 0 {
+				s ^= gfExp[(gfLog[c]+k*(n-1-j))%255]
+			}
+		}
+		if s != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func parseByteMode(data []byte, version int) ([]byte, error) {
+	pos := 0
+	read := func(n int) int {
+		v := 0
+		for i := 0; i < n; i++ {
+			v <<= 1
+			if pos < len(data)*8 && data[pos/8]&(0x80>>uint(pos%8)) != 0 {
+				v |= 1
+			}
+			pos++
+		}
+		return v
+	}
+	if mode := read(4); mode != 0x4 {
+		return nil, fmt.Errorf("mode %04b bukan byte mode", mode)
+	}
+	countBits := 8
+	if version >= 10 {
+		countBits = 16
+	}
+	count := read(countBits)
+	if 4+countBits+count*8 > len(data)*8 {
+		return nil, fmt.Errorf("panjang %d melebihi kapasitas", count)
+	}
+	out := make([]byte, count)
+	for i := range out {
+		out[i] = byte(read(8))
+	}
+	// Terminator (maks 4 bit) dan bit sampai batas byte harus nol, lalu pad
+	// byte 0xEC/0x11 bergantian
+	for i := 0; (i < 4 && pos < len(data)*8) || pos%8 != 0; i++ {
+		if read(1) != 0 {
+			return nil, errors.New("terminator/padding bit bukan nol")
+		}
+	}
+	for i, b := range data[pos/8:] {
+		if want := []byte{0xEC, 0x11}[i%2]; b != want {
+			return nil, fmt.Errorf("pad byte %d = %#x, mau %#x", i, b, want)
+		}
+	}
+	return out, nil
+}
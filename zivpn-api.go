@@ -1,28 +1,169 @@
 package main
 
 import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"embed"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"html/template"
+	"io"
 	"io/ioutil"
 	"log"
+	"math/big"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
+
+	"zivpn/acme"
+	"zivpn/payment"
+	"zivpn/qrcode"
 )
 
 const (
+	Port = ":8080"
+	// Jumlah event terakhir yang disimpan untuk resume via Last-Event-ID
+	EventBufferSize = 256
+	// Interval pengecekan status service zivpn untuk event health
+	HealthCheckInterval = 30 * time.Second
+	// Interval komentar keep-alive pada stream SSE
+	EventKeepAlive = 15 * time.Second
+	// Batas ukuran body request (1 MB)
+	MaxBodySize = 1 << 20
+	// Waktu maksimal menunggu request yang sedang berjalan saat shutdown
+	ShutdownTimeout = 30 * time.Second
+	// Format arsip /api/backup, naikkan jika struktur arsip berubah
+	BackupFormatVersion = 1
+	BackupManifestName  = "manifest.json"
+	// Batas ukuran arsip yang diterima /api/restore (50 MB)
+	MaxRestoreSize = 50 << 20
+	// Session tanpa aktivitas selama ini dianggap offline
+	SessionIdleTimeout = 5 * time.Minute
+	// Session tanpa koneksi aktif tetap dianggap online selama ini (reconnect)
+	SessionGracePeriod   = 1 * time.Minute
+	SessionSweepInterval = 30 * time.Second
+	// Jumlah session lama yang disimpan per user
+	SessionHistorySize   = 50
+	CoreLogRetryInterval = 10 * time.Second
+	// Pelanggaran user yang sama tidak diproses ulang selama ini
+	ViolationCooldown = 10 * time.Minute
+	MaxViolations     = 500
+	// Table nftables untuk counter kuota per IP
+	AcctTable         = "zivpn_acct"
+	QuotaSyncInterval = 1 * time.Minute
+	// Port hopping: rentang port UDP yang di-DNAT ke port listen core
+	PortHopTable         = "zivpn_porthop"
+	PortHopTag           = "zivpn-porthop"
+	PortHopCheckInterval = 1 * time.Minute
+	// Sertifikat TLS core
+	CertCheckInterval  = 12 * time.Hour
+	SelfSignedValidity = 365 * 24 * time.Hour
+	ACMETimeout        = 5 * time.Minute
+	// Catatan perubahan yang dilakukan lewat API
+	MaxAuditEntries = 1000
+	MaxActorLength  = 64
+	// Jumlah snapshot config.json + users.db yang disimpan
+	DefaultHistoryRetention = 50
+	MaxHistoryRetention     = 500
+	// UDPGW yang dipasang oleh udpgw-only.sh
+	UdpgwService = "udpgw.service"
+	// Batas jumlah voucher per batch
+	MaxVoucherBatch = 500
+	// Order pembayaran
+	DefaultOrderTTL    = 60 // menit
+	OrderCheckInterval = 1 * time.Minute
+	// Order yang sudah selesai dihapus paling lama jika melebihi batas ini
+	MaxOrders = 2000
+)
+
+// Lokasi file state. Berupa var agar test bisa mengarahkannya ke direktori
+// sementara; di luar test nilainya tidak pernah diubah.
+var (
+	StateDir   = "/etc/zivpn"
 	ConfigFile = "/etc/zivpn/config.json"
 	UserDB     = "/etc/zivpn/users.db"
 	DomainFile = "/etc/zivpn/domain"
 	ApiKeyFile = "/etc/zivpn/apikey"
-	Port       = ":8080"
+	// Journal restore yang sedang berjalan, diselesaikan saat API start
+	RestoreJournalFile = "/etc/zivpn/.restore-journal.json"
+	// Kebijakan limit device, user yang disuspend, dan catatan pelanggaran
+	IPLimitFile    = "/etc/zivpn/iplimit.json"
+	SuspendedFile  = "/etc/zivpn/suspended.json"
+	ViolationsFile = "/etc/zivpn/violations.json"
+	// Pemakaian kuota per user
+	UsageFile = "/etc/zivpn/usage.json"
+	// Rentang port hopping
+	PortHopFile = "/etc/zivpn/porthop.json"
+	// Sertifikat TLS core
+	CertConfigFile     = "/etc/zivpn/cert.json"
+	ACMEAccountKeyFile = "/etc/zivpn/acme-account.key"
+	// Catatan perubahan yang dilakukan lewat API
+	AuditFile = "/etc/zivpn/audit.json"
+	// Snapshot config.json + users.db untuk rollback
+	HistoryDir  = "/etc/zivpn/history"
+	HistoryFile = "/etc/zivpn/history.json"
+	// UDPGW yang dipasang oleh udpgw-only.sh
+	UdpgwConfigFile = "/etc/udpgw/udpgw.json"
+	// Reseller, ledger kredit, dan pemilik tiap akun (password -> ID reseller)
+	ResellerFile = "/etc/zivpn/resellers.json"
+	LedgerFile   = "/etc/zivpn/ledger.json"
+	OwnerFile    = "/etc/zivpn/owners.json"
+	// Pemilik akun Telegram (password -> Telegram ID), ditulis oleh bot
+	TelegramOwnerFile = "/etc/zivpn/telegram_owners.json"
+	// Katalog plan (paket durasi + limit) untuk create/renew
+	PlanFile = "/etc/zivpn/plans.json"
+	// Voucher prabayar (kode -> voucher)
+	VoucherFile = "/etc/zivpn/vouchers.json"
+	// Order pembayaran dan konfigurasi gateway
+	OrderFile         = "/etc/zivpn/orders.json"
+	PaymentConfigFile = "/etc/zivpn/payment.json"
+	// Token halaman status publik per user (password -> token)
+	StatusTokenFile = "/etc/zivpn/status_tokens.json"
 )
 
 var AuthToken = "AutoFtBot-agskjgdvsbdreiWG1234512SDKrqw"
 
+// Nomor port API dari Port, dipakai untuk menolak port lain yang bentrok
+var apiPort, _ = strconv.Atoi(strings.TrimPrefix(Port, ":"))
+
+// Dokumen OpenAPI dan halaman docs dibundel ke dalam binary.
+// Setiap route baru WAJIB punya entri di docs/openapi.json,
+// jika tidak API akan menolak start (lihat verifyApiSpec) dan
+// TestEveryRouteDocumented di zivpn-api_test.go gagal.
+//
+//go:embed docs/openapi.json docs/index.html
+var docsFS embed.FS
+
+// Daftar pattern route yang terdaftar, diisi oleh handle()
+var registeredRoutes []string
+
+var router = http.NewServeMux()
+
 type Config struct {
 	Listen string `json:"listen"`
 	Cert   string `json:"cert"`
@@ -35,31 +176,183 @@ type Config struct {
 }
 
 type UserRequest struct {
-	Password string `json:"password"`
-	Days     int    `json:"days"`
+	Password   string `json:"password"`
+	Days       int    `json:"days"`
+	LimitIP    int    `json:"limit_ip"`
+	LimitQuota int    `json:"limit_quota"` // GB
+	// Jika diisi, days dan limit diambil dari plan
+	PlanID string `json:"plan_id,omitempty"`
+}
+
+// UserRecord adalah satu baris users.db dengan format
+// "password | expired | limit_ip | limit_quota".
+// Kolom limit opsional agar baris lama "password | expired" tetap terbaca.
+type UserRecord struct {
+	Password   string
+	Expired    string
+	LimitIP    int
+	LimitQuota int
 }
 
 type Response struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
+	Code    string `json:"code,omitempty"` // Kode error yang stabil untuk client, hanya jika success=false
 	Data    interface{} `json:"data,omitempty"`
 }
 
 var mutex = &sync.Mutex{}
 
 func main() {
+	// Selesaikan restore yang terputus sebelum state lain dibaca
+	recoverRestore()
+
 	if keyBytes, err := ioutil.ReadFile(ApiKeyFile); err == nil {
 		AuthToken = strings.TrimSpace(string(keyBytes))
 	}
 
-	http.HandleFunc("/api/user/create", authMiddleware(createUser))
-	http.HandleFunc("/api/user/delete", authMiddleware(deleteUser))
-	http.HandleFunc("/api/user/renew", authMiddleware(renewUser))
-	http.HandleFunc("/api/users", authMiddleware(listUsers))
-	http.HandleFunc("/api/info", authMiddleware(getSystemInfo))
+	registerRoutes()
+	if err := verifyApiSpec(); err != nil {
+		log.Fatal(err)
+	}
+
+	go watchServiceHealth()
+	go tailCoreLogs()
+	go expireSessions()
+	go enforceDeviceLimits()
+	go accountTraffic()
+	go watchPortHop()
+	go watchCertificate()
+	go expireOrders()
+
+	srv := &http.Server{
+		Addr:              Port,
+		Handler:           router,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      60 * time.Second,
+		IdleTimeout:       120 * time.Second,
+	}
+	// Stream SSE tidak akan selesai sendiri, tutup saat shutdown
+	srv.RegisterOnShutdown(events.closeAll)
+
+	drained := make(chan struct{})
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT)
+		<-sig
+		log.Println("Menerima sinyal stop, menunggu request yang sedang berjalan...")
+		ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("Shutdown tidak bersih: %v", err)
+		}
+		close(drained)
+	}()
 
 	fmt.Printf("ZiVPN API berjalan di port %s\n", Port)
-	log.Fatal(http.ListenAndServe(Port, nil))
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-drained
+
+	// Simpan pemakaian kuota yang belum tersinkron
+	syncUsage()
+
+	// Pastikan tidak ada penulisan config/users yang terpotong
+	mutex.Lock()
+	log.Println("ZiVPN API berhenti")
+}
+
+// registerRoutes mendaftarkan semua endpoint ke router. Dipisah dari main
+// agar tabel route bisa diperiksa test tanpa menjalankan server.
+func registerRoutes() {
+	handle("/api/user/create", resellerMiddleware(createUser))
+	handle("/api/user/delete", resellerMiddleware(deleteUser))
+	handle("/api/user/renew", resellerMiddleware(renewUser))
+	handle("/api/user/unlock", authMiddleware(unlockUser))
+	handle("/api/user/quota/reset", authMiddleware(resetQuota))
+	handle("/api/user/quota/topup", authMiddleware(topUpQuota))
+	handle("/api/users", resellerMiddleware(listUsers))
+	handle("/api/users/", authMiddleware(userSubresource))
+	handle("/api/online", authMiddleware(listOnline))
+	handle("/api/iplimit", authMiddleware(ipLimitPolicyHandler))
+	handle("/api/violations", authMiddleware(listViolations))
+	handle("/api/network/porthop", authMiddleware(portHopHandler))
+	handle("/api/settings", authMiddleware(settingsHandler))
+	handle("/api/audit", authMiddleware(auditHandler))
+	handle("/api/config/history", authMiddleware(configHistoryHandler))
+	handle("/api/config/diff", authMiddleware(configDiff))
+	handle("/api/config/rollback/", authMiddleware(rollbackConfig))
+	handle("/api/udpgw", authMiddleware(udpgwHandler))
+	handle("/api/udpgw/restart", authMiddleware(restartUdpgwHandler))
+	handle("/api/cert", authMiddleware(certHandler))
+	handle("/api/cert/renew", authMiddleware(renewCertHandler))
+	handle("/api/info", resellerMiddleware(getSystemInfo))
+	handle("/api/resellers", authMiddleware(listResellers))
+	handle("/api/reseller/create", authMiddleware(createReseller))
+	handle("/api/reseller/update", authMiddleware(updateReseller))
+	handle("/api/reseller/delete", authMiddleware(deleteReseller))
+	handle("/api/reseller/topup", authMiddleware(topUpReseller))
+	handle("/api/reseller/key", authMiddleware(rotateResellerKey))
+	handle("/api/reseller/ledger", resellerMiddleware(listLedger))
+	handle("/api/reseller/me", resellerMiddleware(resellerProfile))
+	handle("/api/plans", resellerMiddleware(listPlans))
+	handle("/api/plan/create", authMiddleware(createPlan))
+	handle("/api/plan/update", authMiddleware(updatePlan))
+	handle("/api/plan/delete", authMiddleware(deletePlan))
+	handle("/api/vouchers", authMiddleware(listVouchers))
+	handle("/api/voucher/batches", authMiddleware(listVoucherBatches))
+	handle("/api/voucher/generate", authMiddleware(generateVouchers))
+	handle("/api/voucher/revoke", authMiddleware(revokeVouchers))
+	handle("/api/voucher/redeem", authMiddleware(redeemVoucher))
+	handle("/api/payment", authMiddleware(paymentHandler))
+	handle("/api/payment/webhook", paymentWebhook)
+	handle("/api/orders", authMiddleware(listOrders))
+	handle("/api/order/create", authMiddleware(createOrder))
+	handle("/api/order/paid", authMiddleware(markOrderPaid))
+	handle("/api/order/cancel", authMiddleware(cancelOrder))
+	handle("/api/events", authMiddleware(streamEvents))
+	handle("/api/backup", authMiddleware(backupState))
+	handleWithLimit("/api/restore", authMiddleware(restoreState), MaxRestoreSize)
+	handle("/api/status/", accountStatusJSON)
+	handle("/status/", accountStatusPage)
+	handle("/api/openapi.json", serveOpenAPI)
+	handle("/api/docs", serveDocs)
+}
+
+func handle(pattern string, handler http.HandlerFunc) {
+	handleWithLimit(pattern, handler, MaxBodySize)
+}
+
+func handleWithLimit(pattern string, handler http.HandlerFunc, maxBody int64) {
+	registeredRoutes = append(registeredRoutes, pattern)
+	router.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+		handler(w, r)
+	})
+}
+
+// decodeJSON membaca body request secara ketat: field yang tidak dikenal
+// dan data tambahan setelah objek JSON ditolak. Jika gagal, response error
+// sudah dikirim dan fungsi mengembalikan false.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err == nil && dec.Decode(&struct{}{}) != io.EOF {
+		err = errors.New("body berisi lebih dari satu objek JSON")
+	}
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			jsonResponse(w, http.StatusRequestEntityTooLarge, false, "Request body terlalu besar", nil)
+			return false
+		}
+		jsonResponse(w, http.StatusBadRequest, false, "Invalid request body: "+err.Error(), nil)
+		return false
+	}
+	return true
 }
 
 func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
@@ -76,11 +369,35 @@ func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 func jsonResponse(w http.ResponseWriter, status int, success bool, message string, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(Response{
+	resp := Response{
 		Success: success,
 		Message: message,
 		Data:    data,
-	})
+	}
+	if !success {
+		resp.Code = errorCode(status)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// errorCode memetakan HTTP status ke kode error yang dipakai client/client.go
+func errorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge:
+		return "bad_request"
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return "unauthorized"
+	case http.StatusNotFound:
+		return "not_found"
+	case http.StatusMethodNotAllowed:
+		return "method_not_allowed"
+	case http.StatusConflict:
+		return "conflict"
+	case http.StatusPaymentRequired:
+		return "insufficient_credit"
+	default:
+		return "internal_error"
+	}
 }
 
 func createUser(w http.ResponseWriter, r *http.Request) {
@@ -90,15 +407,21 @@ func createUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req UserRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		jsonResponse(w, http.StatusBadRequest, false, "Invalid request body", nil)
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if !applyPlan(w, r, &req) {
 		return
 	}
 
-	if req.Password == "" || req.Days <= 0 {
+	if req.Password == "" || req.Days <= 0 || req.LimitIP < 0 || req.LimitQuota < 0 {
 		jsonResponse(w, http.StatusBadRequest, false, "Password dan days harus valid", nil)
 		return
 	}
+	if strings.Contains(req.Password, "|") {
+		jsonResponse(w, http.StatusBadRequest, false, "Password tidak boleh mengandung karakter '|'", nil)
+		return
+	}
 
 	mutex.Lock()
 	defer mutex.Unlock()
@@ -116,25 +439,69 @@ func createUser(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	config.Auth.Config = append(config.Auth.Config, req.Password)
-	if err := saveConfig(config); err != nil {
-		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan config", nil)
+	users, err := loadUsers()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca database user", nil)
 		return
 	}
+	// User yang sedang disuspend tidak ada di config tapi masih ada di users.db
+	for _, line := range users {
+		if rec, ok := parseUserLine(line); ok && rec.Password == req.Password {
+			jsonResponse(w, http.StatusConflict, false, "User sudah ada", nil)
+			return
+		}
+	}
 
+	config.Auth.Config = append(config.Auth.Config, req.Password)
 	expDate := time.Now().Add(time.Duration(req.Days) * 24 * time.Hour).Format("2006-01-02")
-	entry := fmt.Sprintf("%s | %s\n", req.Password, expDate)
-	
-	f, err := os.OpenFile(UserDB, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membuka database user", nil)
+	entry := UserRecord{
+		Password:   req.Password,
+		Expired:    expDate,
+		LimitIP:    req.LimitIP,
+		LimitQuota: req.LimitQuota,
+	}
+	users = append(users, entry.String())
+
+	reseller := resellerFrom(r)
+	if reseller != nil {
+		if _, err := debitReseller(reseller.ID, req.Days, "create", req.Password, true); err != nil {
+			creditError(w, err)
+			return
+		}
+	}
+
+	if isDryRun(r) {
+		dryRunResponse(w, &config, users, nil)
+		return
+	}
+
+	// Kredit dipotong lebih dulu dan dikembalikan jika penulisan gagal
+	undo := func() {}
+	if reseller != nil {
+		if undo, err = debitReseller(reseller.ID, req.Days, "create", req.Password, false); err != nil {
+			creditError(w, err)
+			return
+		}
+	}
+
+	if err := saveConfig(config); err != nil {
+		undo()
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan config", nil)
 		return
 	}
-	defer f.Close()
-	if _, err := f.WriteString(entry); err != nil {
+
+	if err := saveUsers(users); err != nil {
+		undo()
 		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menulis database user", nil)
 		return
 	}
+	snapshotChange("user.create")
+
+	if reseller != nil {
+		if err := setOwner(req.Password, reseller.ID); err != nil {
+			log.Printf("Gagal mencatat pemilik %s: %v", req.Password, err)
+		}
+	}
 
 	if err := restartService(); err != nil {
 		jsonResponse(w, http.StatusInternalServerError, false, "Gagal merestart service", nil)
@@ -146,10 +513,23 @@ func createUser(w http.ResponseWriter, r *http.Request) {
 		domain = strings.TrimSpace(string(domainBytes))
 	}
 
-	jsonResponse(w, http.StatusOK, true, "User berhasil dibuat", map[string]string{
+	created := map[string]string{
 		"password": req.Password,
 		"expired":  expDate,
-		"domain":   domain,
+	}
+	if req.PlanID != "" {
+		created["plan"] = req.PlanID
+	}
+	events.publish("user.created", created)
+
+	jsonResponse(w, http.StatusOK, true, "User berhasil dibuat", map[string]interface{}{
+		"password":    req.Password,
+		"expired":     expDate,
+		"domain":      domain,
+		"limit_ip":    req.LimitIP,
+		"limit_quota": req.LimitQuota,
+		"plan":        req.PlanID,
+		"status_url":  statusLink(req.Password),
 	})
 }
 
@@ -160,14 +540,18 @@ func deleteUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req UserRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		jsonResponse(w, http.StatusBadRequest, false, "Invalid request body", nil)
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
 	mutex.Lock()
 	defer mutex.Unlock()
 
+	if !ownsUser(r, req.Password) {
+		jsonResponse(w, http.StatusNotFound, false, "User tidak ditemukan", nil)
+		return
+	}
+
 	config, err := loadConfig()
 	if err != nil {
 		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca config", nil)
@@ -184,17 +568,6 @@ func deleteUser(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if !found {
-		jsonResponse(w, http.StatusNotFound, false, "User tidak ditemukan", nil)
-		return
-	}
-
-	config.Auth.Config = newConfigAuth
-	if err := saveConfig(config); err != nil {
-		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan config", nil)
-		return
-	}
-
 	users, err := loadUsers()
 	if err != nil {
 		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca database user", nil)
@@ -205,21 +578,71 @@ func deleteUser(w http.ResponseWriter, r *http.Request) {
 	for _, line := range users {
 		parts := strings.Split(line, "|")
 		if len(parts) > 0 && strings.TrimSpace(parts[0]) == req.Password {
+			// User yang disuspend hanya ada di users.db
+			found = true
 			continue
 		}
 		newUsers = append(newUsers, line)
 	}
 
+	if !found {
+		jsonResponse(w, http.StatusNotFound, false, "User tidak ditemukan", nil)
+		return
+	}
+
+	config.Auth.Config = newConfigAuth
+	if isDryRun(r) {
+		dryRunResponse(w, &config, newUsers, nil)
+		return
+	}
+
+	if err := saveConfig(config); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan config", nil)
+		return
+	}
+
 	if err := saveUsers(newUsers); err != nil {
 		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan database user", nil)
 		return
 	}
+	snapshotChange("user.delete")
+
+	if usage, err := loadUsage(); err == nil {
+		if _, ok := usage[req.Password]; ok {
+			delete(usage, req.Password)
+			if err := saveJSONFile(UsageFile, usage); err != nil {
+				log.Printf("Gagal menghapus pemakaian kuota %s: %v", req.Password, err)
+			}
+		}
+	}
+
+	if suspended, err := loadSuspensions(); err == nil {
+		if _, ok := suspended[req.Password]; ok {
+			delete(suspended, req.Password)
+			if err := saveSuspensions(suspended); err != nil {
+				log.Printf("Gagal menghapus status suspend %s: %v", req.Password, err)
+			}
+		}
+	}
+
+	if err := setOwner(req.Password, ""); err != nil {
+		log.Printf("Gagal menghapus pemilik %s: %v", req.Password, err)
+	}
+
+	// Password yang dibuat ulang nanti tidak boleh terbaca lewat link lama
+	if err := removeStatusToken(req.Password); err != nil {
+		log.Printf("Gagal menghapus token status %s: %v", req.Password, err)
+	}
 
 	if err := restartService(); err != nil {
 		jsonResponse(w, http.StatusInternalServerError, false, "Gagal merestart service", nil)
 		return
 	}
 
+	events.publish("user.deleted", map[string]string{
+		"password": req.Password,
+	})
+
 	jsonResponse(w, http.StatusOK, true, "User berhasil dihapus", nil)
 }
 
@@ -230,14 +653,27 @@ func renewUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req UserRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		jsonResponse(w, http.StatusBadRequest, false, "Invalid request body", nil)
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if !applyPlan(w, r, &req) {
+		return
+	}
+
+	reseller := resellerFrom(r)
+	if req.Days < 0 || (reseller != nil && req.Days == 0) {
+		jsonResponse(w, http.StatusBadRequest, false, "Days harus valid", nil)
 		return
 	}
 
 	mutex.Lock()
 	defer mutex.Unlock()
 
+	if !ownsUser(r, req.Password) {
+		jsonResponse(w, http.StatusNotFound, false, "User tidak ditemukan di database", nil)
+		return
+	}
+
 	users, err := loadUsers()
 	if err != nil {
 		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca database user", nil)
@@ -247,26 +683,23 @@ func renewUser(w http.ResponseWriter, r *http.Request) {
 	found := false
 	newUsers := []string{}
 	var newExpDate string
+	var renewed UserRecord
 
 	for _, line := range users {
-		parts := strings.Split(line, "|")
-		if len(parts) >= 2 && strings.TrimSpace(parts[0]) == req.Password {
+		rec, ok := parseUserLine(line)
+		if ok && rec.Password == req.Password {
 			found = true
-			currentExpStr := strings.TrimSpace(parts[1])
-			currentExp, err := time.Parse("2006-01-02", currentExpStr)
-			if err != nil {
-				// Jika format tanggal salah, anggap hari ini
-				currentExp = time.Now()
+			newExpDate = extendExpiry(rec.Expired, req.Days)
+			rec.Expired = newExpDate
+			// Limit hanya diubah jika dikirim; plan selalu menimpa limit
+			if req.LimitIP > 0 || req.PlanID != "" {
+				rec.LimitIP = req.LimitIP
 			}
-			
-			// Jika sudah expired, mulai dari hari ini. Jika belum, tambah dari tanggal expired.
-			if currentExp.Before(time.Now()) {
-				currentExp = time.Now()
+			if req.LimitQuota > 0 || req.PlanID != "" {
+				rec.LimitQuota = req.LimitQuota
 			}
-
-			newExp := currentExp.Add(time.Duration(req.Days) * 24 * time.Hour)
-			newExpDate = newExp.Format("2006-01-02")
-			newUsers = append(newUsers, fmt.Sprintf("%s | %s", req.Password, newExpDate))
+			renewed = rec
+			newUsers = append(newUsers, rec.String())
 		} else {
 			newUsers = append(newUsers, line)
 		}
@@ -277,10 +710,32 @@ func renewUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if reseller != nil {
+		if _, err := debitReseller(reseller.ID, req.Days, "renew", req.Password, true); err != nil {
+			creditError(w, err)
+			return
+		}
+	}
+
+	if isDryRun(r) {
+		dryRunResponse(w, nil, newUsers, nil)
+		return
+	}
+
+	undo := func() {}
+	if reseller != nil {
+		if undo, err = debitReseller(reseller.ID, req.Days, "renew", req.Password, false); err != nil {
+			creditError(w, err)
+			return
+		}
+	}
+
 	if err := saveUsers(newUsers); err != nil {
+		undo()
 		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan database user", nil)
 		return
 	}
+	snapshotChange("user.renew")
 
 	// Restart service mungkin tidak diperlukan untuk renew, tapi bagus untuk memastikan konsistensi
 	if err := restartService(); err != nil {
@@ -288,9 +743,22 @@ func renewUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jsonResponse(w, http.StatusOK, true, "User berhasil diperpanjang", map[string]string{
+	renewedEvent := map[string]string{
 		"password": req.Password,
 		"expired":  newExpDate,
+	}
+	if req.PlanID != "" {
+		renewedEvent["plan"] = req.PlanID
+	}
+	events.publish("user.renewed", renewedEvent)
+
+	jsonResponse(w, http.StatusOK, true, "User berhasil diperpanjang", map[string]interface{}{
+		"password":    req.Password,
+		"expired":     newExpDate,
+		"limit_ip":    renewed.LimitIP,
+		"limit_quota": renewed.LimitQuota,
+		"plan":        req.PlanID,
+		"status_url":  statusLink(req.Password),
 	})
 }
 
@@ -307,27 +775,62 @@ func listUsers(w http.ResponseWriter, r *http.Request) {
 	}
 
 	type UserInfo struct {
-		Password string `json:"password"`
-		Expired  string `json:"expired"`
-		Status   string `json:"status"`
+		Password   string `json:"password"`
+		Expired    string `json:"expired"`
+		Status     string `json:"status"`
+		LimitIP    int    `json:"limit_ip"`
+		LimitQuota int    `json:"limit_quota"`
+		// Hanya terisi jika status Suspended/Locked
+		SuspendedUntil string `json:"suspended_until,omitempty"`
+		SuspendReason  string `json:"suspend_reason,omitempty"`
+		UploadBytes    int64  `json:"upload_bytes"`
+		DownloadBytes  int64  `json:"download_bytes"`
+		UsedBytes      int64  `json:"used_bytes"`
+		// ID reseller pemilik akun, kosong jika dibuat admin
+		Owner string `json:"owner,omitempty"`
+	}
+
+	suspended, err := loadSuspensions()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data suspend", nil)
+		return
+	}
+	usage, err := loadUsage()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca pemakaian kuota", nil)
+		return
+	}
+
+	owners, err := loadOwners()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data reseller", nil)
+		return
 	}
+	reseller := resellerFrom(r)
 
 	userList := []UserInfo{}
 	today := time.Now().Format("2006-01-02")
 
 	for _, line := range users {
-		parts := strings.Split(line, "|")
-		if len(parts) >= 2 {
-			pass := strings.TrimSpace(parts[0])
-			exp := strings.TrimSpace(parts[1])
-			status := "Active"
-			if exp < today {
-				status = "Expired"
-			}
+		rec, ok := parseUserLine(line)
+		if ok && reseller != nil && owners[rec.Password] != reseller.ID {
+			continue
+		}
+		if ok {
+			status, susp := userStatus(rec, suspended, today)
+			used := usage[rec.Password]
 			userList = append(userList, UserInfo{
-				Password: pass,
-				Expired:  exp,
-				Status:   status,
+				Password:       rec.Password,
+				Expired:        rec.Expired,
+				Status:         status,
+				LimitIP:        rec.LimitIP,
+				LimitQuota:     rec.LimitQuota,
+				SuspendedUntil: susp.Until,
+				SuspendReason:  susp.Reason,
+				UploadBytes:    used.UploadBytes,
+				DownloadBytes:  used.DownloadBytes,
+				UsedBytes:      used.total(),
+				Owner:          owners[rec.Password],
 			})
 		}
 	}
@@ -335,6 +838,21 @@ func listUsers(w http.ResponseWriter, r *http.Request) {
 	jsonResponse(w, http.StatusOK, true, "Daftar user", userList)
 }
 
+// userStatus mengembalikan Active, Expired, Suspended, atau Locked beserta
+// data suspend-nya (kosong jika tidak disuspend).
+func userStatus(rec UserRecord, suspended map[string]Suspension, today string) (string, Suspension) {
+	if rec.Expired < today {
+		return "Expired", Suspension{}
+	}
+	if susp, ok := suspended[rec.Password]; ok {
+		if susp.Until == "" {
+			return "Locked", susp
+		}
+		return "Suspended", susp
+	}
+	return "Active", Suspension{}
+}
+
 func getSystemInfo(w http.ResponseWriter, r *http.Request) {
 	cmd := exec.Command("curl", "-s", "ifconfig.me")
 	ipPub, _ := cmd.Output()
@@ -348,16 +866,86 @@ func getSystemInfo(w http.ResponseWriter, r *http.Request) {
 	}
 
 	info := map[string]string{
-		"domain":     domain,
-		"public_ip":  strings.TrimSpace(string(ipPub)),
-		"private_ip": strings.Fields(string(ipPriv))[0],
-		"port":       "5667",
-		"service":    "zivpn",
+		"domain":       domain,
+		"public_ip":    strings.TrimSpace(string(ipPub)),
+		"private_ip":   strings.Fields(string(ipPriv))[0],
+		"port":         listenPort(),
+		"service":      "zivpn",
+		"udpgw_status": "not_installed",
+		"udpgw_port":   "",
+	}
+	if cfg, _, err := loadUdpgwConfig(); err == nil {
+		info["udpgw_status"] = serviceStatus(UdpgwService)
+		info["udpgw_port"] = strconv.Itoa(cfg.UdpgwPort)
 	}
 
 	jsonResponse(w, http.StatusOK, true, "System Info", info)
 }
 
+// --- API Docs ---
+
+func serveOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	data, err := docsFS.ReadFile("docs/openapi.json")
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca spesifikasi API", nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func serveDocs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	data, err := docsFS.ReadFile("docs/index.html")
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca halaman docs", nil)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(data)
+}
+
+// verifyApiSpec memastikan setiap route yang didaftarkan lewat handle()
+// terdokumentasi di docs/openapi.json. Pattern yang diakhiri "/" (subtree)
+// cukup dicover oleh minimal satu path dengan prefix yang sama.
+func verifyApiSpec() error {
+	data, err := docsFS.ReadFile("docs/openapi.json")
+	if err != nil {
+		return fmt.Errorf("gagal membaca spesifikasi API: %v", err)
+	}
+	var spec struct {
+		Paths map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return fmt.Errorf("spesifikasi API tidak valid: %v", err)
+	}
+
+	var missing []string
+	for _, route := range registeredRoutes {
+		covered := false
+		for path := range spec.Paths {
+			if path == route || (strings.HasSuffix(route, "/") && strings.HasPrefix(path, route)) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			missing = append(missing, route)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("route tanpa spesifikasi OpenAPI: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
 // --- Helper Functions ---
 
 func loadConfig() (Config, error) {
@@ -370,12 +958,16 @@ func loadConfig() (Config, error) {
 	return config, err
 }
 
+func encodeConfig(config Config) ([]byte, error) {
+	return json.MarshalIndent(config, "", "  ")
+}
+
 func saveConfig(config Config) error {
-	data, err := json.MarshalIndent(config, "", "  ")
+	data, err := encodeConfig(config)
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(ConfigFile, data, 0644)
+	return writeVersioned(ConfigFile, data)
 }
 
 func loadUsers() ([]string, error) {
@@ -396,12 +988,6736 @@ func loadUsers() ([]string, error) {
 	return result, nil
 }
 
+func encodeUsers(lines []string) []byte {
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
 func saveUsers(lines []string) error {
-	data := strings.Join(lines, "\n") + "\n"
-	return ioutil.WriteFile(UserDB, []byte(data), 0644)
+	return writeVersioned(UserDB, encodeUsers(lines))
+}
+
+func parseUserLine(line string) (UserRecord, bool) {
+	parts := strings.Split(line, "|")
+	if len(parts) < 2 {
+		return UserRecord{}, false
+	}
+	rec := UserRecord{
+		Password: strings.TrimSpace(parts[0]),
+		Expired:  strings.TrimSpace(parts[1]),
+	}
+	if len(parts) >= 4 {
+		rec.LimitIP, _ = strconv.Atoi(strings.TrimSpace(parts[2]))
+		rec.LimitQuota, _ = strconv.Atoi(strings.TrimSpace(parts[3]))
+	}
+	return rec, true
+}
+
+func (u UserRecord) String() string {
+	if u.LimitIP == 0 && u.LimitQuota == 0 {
+		return fmt.Sprintf("%s | %s", u.Password, u.Expired)
+	}
+	return fmt.Sprintf("%s | %s | %d | %d", u.Password, u.Expired, u.LimitIP, u.LimitQuota)
+}
+
+// extendExpiry menambah days ke tanggal expired. Jika sudah expired (atau
+// format tanggal salah), perpanjangan dihitung dari hari ini.
+func extendExpiry(expired string, days int) string {
+	currentExp, err := time.Parse("2006-01-02", expired)
+	if err != nil || currentExp.Before(time.Now()) {
+		currentExp = time.Now()
+	}
+	return currentExp.Add(time.Duration(days) * 24 * time.Hour).Format("2006-01-02")
+}
+
+// writeFileAtomic menulis ke file sementara lalu rename, sehingga file
+// tujuan tidak pernah setengah tertulis jika proses mati di tengah jalan.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// listenPort mengembalikan port UDP core dari Config.Listen (default 5667)
+func listenPort() string {
+	if config, err := loadConfig(); err == nil {
+		if _, p, err := net.SplitHostPort(config.Listen); err == nil && p != "" {
+			return p
+		}
+	}
+	return "5667"
 }
 
 func restartService() error {
 	cmd := exec.Command("systemctl", "restart", "zivpn.service")
-	return cmd.Run()
+	if err := cmd.Run(); err != nil {
+		events.publish("service.restart_failed", map[string]string{
+			"service": "zivpn",
+			"error":   err.Error(),
+		})
+		return err
+	}
+	events.publish("service.restarted", map[string]string{
+		"service": "zivpn",
+	})
+	return nil
+}
+
+// --- Event Stream (SSE) ---
+
+type Event struct {
+	ID   int64       `json:"id"`
+	Type string      `json:"type"`
+	Time string      `json:"time"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// eventHub menyimpan event terakhir dalam ring buffer dan meneruskannya
+// ke semua client SSE yang sedang terhubung.
+type eventHub struct {
+	mu      sync.Mutex
+	epoch   int64
+	lastID  int64
+	buffer  []Event
+	clients map[chan Event]struct{}
+}
+
+var events = newEventHub()
+
+// newEventHub memulai ID event dari waktu start (milidetik x 1000) sehingga
+// ID setelah API restart selalu lebih besar dari ID proses sebelumnya dan
+// Last-Event-ID lama bisa dikenali sebagai milik proses lain.
+func newEventHub() *eventHub {
+	epoch := time.Now().UnixMilli() * 1000
+	return &eventHub{
+		epoch:   epoch,
+		lastID:  epoch,
+		clients: make(map[chan Event]struct{}),
+	}
+}
+
+func (h *eventHub) publish(eventType string, data interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastID++
+	ev := Event{
+		ID:   h.lastID,
+		Type: eventType,
+		Time: time.Now().Format(time.RFC3339),
+		Data: data,
+	}
+
+	h.buffer = append(h.buffer, ev)
+	if len(h.buffer) > EventBufferSize {
+		h.buffer = h.buffer[len(h.buffer)-EventBufferSize:]
+	}
+
+	for ch := range h.clients {
+		select {
+		case ch <- ev:
+		default:
+			// Client terlalu lambat, putuskan agar reconnect dengan Last-Event-ID
+			delete(h.clients, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe mendaftarkan client baru dan mengembalikan event yang terlewat
+// setelah lastID. Jika lastID tidak dikenal (dari proses sebelum restart,
+// lebih baru dari event terakhir, atau sudah keluar dari buffer), resync
+// bernilai true dan seluruh isi buffer dikirim ulang.
+func (h *eventHub) subscribe(lastID int64) (ch chan Event, backlog []Event, resync bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if lastID > 0 {
+		oldest := h.lastID
+		if len(h.buffer) > 0 {
+			oldest = h.buffer[0].ID - 1
+		}
+		if lastID < h.epoch || lastID > h.lastID || lastID < oldest {
+			resync = true
+			lastID = 0
+		}
+		for _, ev := range h.buffer {
+			if ev.ID > lastID {
+				backlog = append(backlog, ev)
+			}
+		}
+	}
+
+	ch = make(chan Event, EventBufferSize)
+	h.clients[ch] = struct{}{}
+	return ch, backlog, resync
+}
+
+func (h *eventHub) unsubscribe(ch chan Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[ch]; ok {
+		delete(h.clients, ch)
+		close(ch)
+	}
+}
+
+// closeAll memutus semua client SSE, dipanggil saat server shutdown
+func (h *eventHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.clients {
+		delete(h.clients, ch)
+		close(ch)
+	}
+}
+
+func streamEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		jsonResponse(w, http.StatusInternalServerError, false, "Streaming tidak didukung", nil)
+		return
+	}
+
+	lastIDStr := r.Header.Get("Last-Event-ID")
+	if lastIDStr == "" {
+		lastIDStr = r.URL.Query().Get("last_event_id")
+	}
+	lastID, _ := strconv.ParseInt(lastIDStr, 10, 64)
+
+	// Stream berjalan lama, jangan kena WriteTimeout server
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	ch, backlog, resync := events.subscribe(lastID)
+	defer events.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	// Posisi client tidak dikenal, minta client memuat ulang state penuh
+	// sebelum memproses backlog. Event ini tidak punya id agar tidak
+	// menggeser Last-Event-ID milik client.
+	if resync {
+		data, _ := json.Marshal(Event{
+			Type: "resync",
+			Time: time.Now().Format(time.RFC3339),
+			Data: map[string]int64{"last_event_id": lastID},
+		})
+		fmt.Fprintf(w, "event: resync\ndata: %s\n\n", data)
+	}
+	for _, ev := range backlog {
+		writeEvent(w, ev)
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(EventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			writeEvent(w, ev)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, ev Event) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+}
+
+// watchServiceHealth memantau status service zivpn dan mengirim event
+// "health" setiap kali statusnya berubah.
+func watchServiceHealth() {
+	lastStatus := ""
+	check := func() {
+		out, _ := exec.Command("systemctl", "is-active", "zivpn.service").Output()
+		status := strings.TrimSpace(string(out))
+		if status == "" {
+			status = "unknown"
+		}
+		if status != lastStatus {
+			events.publish("health", map[string]string{
+				"service": "zivpn",
+				"status":  status,
+			})
+			lastStatus = status
+		}
+	}
+
+	check()
+	ticker := time.NewTicker(HealthCheckInterval)
+	for range ticker.C {
+		check()
+	}
+}
+
+// --- Backup & Restore ---
+
+// BackupManifest disimpan sebagai manifest.json di dalam arsip backup
+type BackupManifest struct {
+	Version   int          `json:"version"`
+	CreatedAt string       `json:"created_at"`
+	Domain    string       `json:"domain"`
+	Files     []BackupFile `json:"files"`
+}
+
+type BackupFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	Mode   uint32 `json:"mode"`
+	SHA256 string `json:"sha256"`
+}
+
+// listStateFiles mengembalikan semua file biasa di level teratas StateDir.
+// Subfolder (api, backups, dll) dan file sementara (diawali ".") dilewati.
+func listStateFiles() ([]os.FileInfo, error) {
+	entries, err := ioutil.ReadDir(StateDir)
+	if err != nil {
+		return nil, err
+	}
+	var files []os.FileInfo
+	for _, fi := range entries {
+		if !fi.Mode().IsRegular() || strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		files = append(files, fi)
+	}
+	return files, nil
+}
+
+func backupState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+
+	mutex.Lock()
+	files, err := listStateFiles()
+	if err != nil {
+		mutex.Unlock()
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca direktori state", nil)
+		return
+	}
+
+	manifest := BackupManifest{
+		Version:   BackupFormatVersion,
+		CreatedAt: time.Now().Format(time.RFC3339),
+		Domain:    "Tidak diatur",
+	}
+	if domainBytes, err := ioutil.ReadFile(DomainFile); err == nil {
+		manifest.Domain = strings.TrimSpace(string(domainBytes))
+	}
+
+	contents := make(map[string][]byte)
+	for _, fi := range files {
+		data, err := ioutil.ReadFile(filepath.Join(StateDir, fi.Name()))
+		if err != nil {
+			mutex.Unlock()
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca "+fi.Name(), nil)
+			return
+		}
+		sum := sha256.Sum256(data)
+		contents[fi.Name()] = data
+		manifest.Files = append(manifest.Files, BackupFile{
+			Name:   fi.Name(),
+			Size:   int64(len(data)),
+			Mode:   uint32(fi.Mode().Perm()),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+	}
+	mutex.Unlock()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	manifestData, _ := json.MarshalIndent(manifest, "", "  ")
+	writeTarFile(tw, BackupManifestName, manifestData, 0600)
+	for _, f := range manifest.Files {
+		writeTarFile(tw, f.Name, contents[f.Name], os.FileMode(f.Mode))
+	}
+	if err := tw.Close(); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membuat arsip backup", nil)
+		return
+	}
+	if err := gz.Close(); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membuat arsip backup", nil)
+		return
+	}
+
+	filename := fmt.Sprintf("zivpn-backup-%s.tar.gz", time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Write(buf.Bytes())
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte, mode os.FileMode) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    int64(mode),
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// readBackupArchive membaca dan memvalidasi arsip: manifest wajib ada,
+// versi didukung, nama file aman, checksum cocok, dan config.json valid.
+func readBackupArchive(rd io.Reader) (*BackupManifest, map[string][]byte, error) {
+	gz, err := gzip.NewReader(rd)
+	if err != nil {
+		return nil, nil, fmt.Errorf("arsip bukan gzip yang valid: %v", err)
+	}
+	defer gz.Close()
+
+	contents := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("arsip tar rusak: %v", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil, nil, fmt.Errorf("entri %q bukan file biasa", hdr.Name)
+		}
+		if hdr.Name != filepath.Base(hdr.Name) || strings.HasPrefix(hdr.Name, ".") {
+			return nil, nil, fmt.Errorf("nama file %q tidak diizinkan", hdr.Name)
+		}
+		if _, dup := contents[hdr.Name]; dup {
+			return nil, nil, fmt.Errorf("file %q muncul lebih dari sekali", hdr.Name)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("gagal membaca %q: %v", hdr.Name, err)
+		}
+		contents[hdr.Name] = data
+	}
+
+	manifestData, ok := contents[BackupManifestName]
+	if !ok {
+		return nil, nil, fmt.Errorf("%s tidak ditemukan di arsip", BackupManifestName)
+	}
+	delete(contents, BackupManifestName)
+
+	var manifest BackupManifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("%s tidak valid: %v", BackupManifestName, err)
+	}
+	if manifest.Version < 1 || manifest.Version > BackupFormatVersion {
+		return nil, nil, fmt.Errorf("versi backup %d tidak didukung", manifest.Version)
+	}
+
+	listed := make(map[string]bool)
+	for _, f := range manifest.Files {
+		data, ok := contents[f.Name]
+		if !ok {
+			return nil, nil, fmt.Errorf("file %q ada di manifest tapi tidak ada di arsip", f.Name)
+		}
+		sum := sha256.Sum256(data)
+		if int64(len(data)) != f.Size || hex.EncodeToString(sum[:]) != f.SHA256 {
+			return nil, nil, fmt.Errorf("checksum %q tidak cocok", f.Name)
+		}
+		listed[f.Name] = true
+	}
+	for name := range contents {
+		if !listed[name] {
+			return nil, nil, fmt.Errorf("file %q tidak tercantum di manifest", name)
+		}
+	}
+
+	configData, ok := contents[filepath.Base(ConfigFile)]
+	if !ok {
+		return nil, nil, fmt.Errorf("arsip tidak berisi %s", filepath.Base(ConfigFile))
+	}
+	var cfg Config
+	if err := json.Unmarshal(configData, &cfg); err != nil {
+		return nil, nil, fmt.Errorf("%s di arsip tidak valid: %v", filepath.Base(ConfigFile), err)
+	}
+
+	return &manifest, contents, nil
+}
+
+// RestoreJournal dicatat di RestoreJournalFile sebelum file state diganti.
+// Jika API mati di tengah swap, recoverRestore menjalankan ulang journal saat
+// start sehingga config.json dan users.db tidak pernah berasal dari versi
+// yang berbeda.
+type RestoreJournal struct {
+	// "apply": pindahkan file staging ke StateDir (roll forward).
+	// "rollback": kembalikan file lama dari .previous.
+	State   string                `json:"state"`
+	Staging string                `json:"staging"`
+	Files   []RestoreJournalEntry `json:"files"`
+}
+
+type RestoreJournalEntry struct {
+	Name    string `json:"name"`
+	HadPrev bool   `json:"had_prev"`
+	// File tidak ada di arsip dan dihapus saat apply
+	Remove bool `json:"remove,omitempty"`
+}
+
+// restoreStateFiles adalah file state yang dikenal API. File yang tidak ada
+// di arsip dihapus saat restore agar state sama dengan saat backup dibuat.
+// apikey dan audit log sengaja tidak ikut dihapus.
+var restoreStateFiles = []string{
+	filepath.Base(UserDB), filepath.Base(DomainFile), filepath.Base(IPLimitFile),
+	filepath.Base(SuspendedFile), filepath.Base(ViolationsFile), filepath.Base(UsageFile),
+	filepath.Base(PortHopFile), filepath.Base(CertConfigFile), filepath.Base(HistoryFile),
+	filepath.Base(ResellerFile), filepath.Base(LedgerFile), filepath.Base(OwnerFile),
+	filepath.Base(TelegramOwnerFile), filepath.Base(PlanFile), filepath.Base(VoucherFile),
+	filepath.Base(OrderFile), filepath.Base(PaymentConfigFile), filepath.Base(StatusTokenFile),
+}
+
+// restoreRemovals mengembalikan file state yang ada sekarang tetapi tidak
+// ada di arsip
+func restoreRemovals(contents map[string][]byte) []string {
+	removed := []string{}
+	for _, name := range restoreStateFiles {
+		if _, ok := contents[name]; ok {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(StateDir, name)); err == nil {
+			removed = append(removed, name)
+		}
+	}
+	return removed
+}
+
+func saveRestoreJournal(j RestoreJournal) error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(RestoreJournalFile, data, 0600)
+}
+
+// replayRestoreJournal menjalankan journal sampai selesai lalu menghapus
+// journal dan folder staging. Setiap langkah aman diulang, jadi journal
+// yang terpotong di tengah cukup dijalankan lagi.
+func replayRestoreJournal(j RestoreJournal) error {
+	stagingDir := filepath.Join(StateDir, j.Staging)
+	for _, f := range j.Files {
+		target := filepath.Join(StateDir, f.Name)
+		switch j.State {
+		case "apply":
+			if f.Remove {
+				if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+					return fmt.Errorf("gagal menghapus %s: %v", f.Name, err)
+				}
+				continue
+			}
+			staged := filepath.Join(stagingDir, f.Name)
+			if _, err := os.Stat(staged); os.IsNotExist(err) {
+				continue
+			}
+			if err := os.Rename(staged, target); err != nil {
+				return fmt.Errorf("gagal mengganti %s: %v", f.Name, err)
+			}
+		case "rollback":
+			if !f.HadPrev {
+				if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+					return fmt.Errorf("gagal menghapus %s: %v", f.Name, err)
+				}
+				continue
+			}
+			prev := filepath.Join(stagingDir, ".previous", f.Name)
+			if _, err := os.Stat(prev); os.IsNotExist(err) {
+				continue
+			}
+			if err := os.Rename(prev, target); err != nil {
+				return fmt.Errorf("gagal mengembalikan %s: %v", f.Name, err)
+			}
+		default:
+			return fmt.Errorf("state journal %q tidak dikenal", j.State)
+		}
+	}
+	if err := os.Remove(RestoreJournalFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	os.RemoveAll(stagingDir)
+	return nil
+}
+
+// recoverRestore dipanggil saat API start: menyelesaikan restore yang
+// terputus dan membersihkan folder staging yang tidak punya journal.
+func recoverRestore() {
+	if data, err := ioutil.ReadFile(RestoreJournalFile); err == nil {
+		var j RestoreJournal
+		if err := json.Unmarshal(data, &j); err != nil || j.Staging != filepath.Base(j.Staging) || !strings.HasPrefix(j.Staging, ".restore-") {
+			log.Fatalf("Journal restore %s rusak, periksa manual: %v", RestoreJournalFile, err)
+		}
+		if err := replayRestoreJournal(j); err != nil {
+			log.Fatalf("Gagal menyelesaikan restore yang terputus: %v", err)
+		}
+		log.Printf("Restore yang terputus diselesaikan (%s %d file)", j.State, len(j.Files))
+	}
+
+	leftovers, _ := filepath.Glob(filepath.Join(StateDir, ".restore-*"))
+	for _, dir := range leftovers {
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			os.RemoveAll(dir)
+		}
+	}
+}
+
+func restoreState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+
+	manifest, contents, err := readBackupArchive(r.Body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			jsonResponse(w, http.StatusRequestEntityTooLarge, false, "Arsip backup terlalu besar", nil)
+			return
+		}
+		jsonResponse(w, http.StatusBadRequest, false, "Backup tidak valid: "+err.Error(), nil)
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if isDryRun(r) {
+		result, err := planChanges(contents)
+		if err != nil {
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca direktori state", nil)
+			return
+		}
+		result.Removed = restoreRemovals(contents)
+		jsonResponse(w, http.StatusOK, true, "Dry run: tidak ada file yang ditulis", result)
+		return
+	}
+
+	// 1. Stage: tulis semua file ke folder sementara di filesystem yang sama,
+	// dan hard link versi lama ke .previous untuk rollback
+	stagingDir, err := ioutil.TempDir(StateDir, ".restore-")
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membuat folder staging", nil)
+		return
+	}
+	if err := os.Mkdir(filepath.Join(stagingDir, ".previous"), 0700); err != nil {
+		os.RemoveAll(stagingDir)
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membuat folder staging", nil)
+		return
+	}
+
+	journal := RestoreJournal{State: "apply", Staging: filepath.Base(stagingDir)}
+	for _, f := range manifest.Files {
+		if err := writeFileAtomic(filepath.Join(stagingDir, f.Name), contents[f.Name], os.FileMode(f.Mode)&0777); err != nil {
+			os.RemoveAll(stagingDir)
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal menulis file staging", nil)
+			return
+		}
+		entry := RestoreJournalEntry{Name: f.Name}
+		if err := os.Link(filepath.Join(StateDir, f.Name), filepath.Join(stagingDir, ".previous", f.Name)); err == nil {
+			entry.HadPrev = true
+		} else if !os.IsNotExist(err) {
+			os.RemoveAll(stagingDir)
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan "+f.Name+" lama", nil)
+			return
+		}
+		journal.Files = append(journal.Files, entry)
+	}
+	// File state yang tidak ada di arsip dihapus, versi lama tetap di
+	// .previous agar bisa dikembalikan seperti file lain
+	removed := restoreRemovals(contents)
+	for _, name := range removed {
+		if err := os.Link(filepath.Join(StateDir, name), filepath.Join(stagingDir, ".previous", name)); err != nil {
+			os.RemoveAll(stagingDir)
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan "+name+" lama", nil)
+			return
+		}
+		journal.Files = append(journal.Files, RestoreJournalEntry{Name: name, HadPrev: true, Remove: true})
+	}
+
+	if _, err := snapshotState("external", 0); err != nil {
+		log.Printf("Gagal menyimpan snapshot config: %v", err)
+	}
+
+	// 2. Commit: setelah journal tertulis, restore dianggap terjadi dan
+	// akan diselesaikan saat API start jika proses mati di tengah swap.
+	if err := saveRestoreJournal(journal); err != nil {
+		os.RemoveAll(stagingDir)
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menulis journal restore", nil)
+		return
+	}
+
+	// 3. Swap: jika ada rename yang gagal, semua file dikembalikan
+	if err := replayRestoreJournal(journal); err != nil {
+		log.Printf("Restore gagal, rollback: %v", err)
+		journal.State = "rollback"
+		if err := saveRestoreJournal(journal); err != nil {
+			log.Printf("Gagal menulis journal rollback: %v", err)
+		}
+		if err := replayRestoreJournal(journal); err != nil {
+			log.Printf("Rollback restore gagal, akan diulang saat API start: %v", err)
+		}
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal mengganti file state, restore dibatalkan", nil)
+		return
+	}
+
+	if _, err := snapshotState("restore", 0); err != nil {
+		log.Printf("Gagal menyimpan snapshot config: %v", err)
+	}
+
+	// API Key bisa ikut berubah
+	if keyBytes, err := ioutil.ReadFile(ApiKeyFile); err == nil {
+		AuthToken = strings.TrimSpace(string(keyBytes))
+	}
+
+	restored := make([]string, 0, len(manifest.Files))
+	for _, f := range manifest.Files {
+		restored = append(restored, f.Name)
+	}
+	events.publish("state.restored", map[string]interface{}{
+		"created_at": manifest.CreatedAt,
+		"files":      restored,
+		"removed":    removed,
+	})
+
+	if err := restartService(); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Restore berhasil tetapi gagal merestart service", nil)
+		return
+	}
+
+	// Bot membaca API Key & konfigurasi hanya saat start. Restart setelah
+	// response terkirim karena pemanggil bisa jadi bot itu sendiri.
+	go func() {
+		time.Sleep(2 * time.Second)
+		exec.Command("systemctl", "try-restart", "zivpn-bot.service").Run()
+	}()
+
+	jsonResponse(w, http.StatusOK, true, "Restore berhasil", map[string]interface{}{
+		"version":    manifest.Version,
+		"created_at": manifest.CreatedAt,
+		"domain":     manifest.Domain,
+		"files":      restored,
+		"removed":    removed,
+	})
+}
+
+// --- Connection Tracking (Core Logs) ---
+
+// Session adalah aktivitas satu user dari satu source IP. Koneksi dari IP
+// yang sama (beda port) digabung ke session yang sama.
+type Session struct {
+	Password    string `json:"password"`
+	SourceIP    string `json:"source_ip"`
+	LastAddr    string `json:"last_addr"`
+	FirstSeen   string `json:"first_seen"`
+	LastSeen    string `json:"last_seen"`
+	Connections int    `json:"connections"`
+	TxBytes     int64  `json:"tx_bytes,omitempty"`
+	RxBytes     int64  `json:"rx_bytes,omitempty"`
+	Online      bool   `json:"online"`
+	EndedAt     string `json:"ended_at,omitempty"`
+
+	firstSeen time.Time
+	lastSeen  time.Time
+	active    map[string]bool // addr ip:port yang sedang terhubung
+}
+
+// coreLogLine adalah hasil parsing satu baris log core zivpn, contoh:
+//   2024-01-01T10:00:00Z  INFO  client connected  {"addr": "1.2.3.4:5678", "id": "user123"}
+//   ERROR TCP error {"addr": "140.213.1.2:41234", "id": "user123", "error": "..."}
+type coreLogLine struct {
+	Message string
+	Fields  map[string]interface{}
+}
+
+type sessionTracker struct {
+	mu       sync.Mutex
+	live     map[string]map[string]*Session // password -> source IP -> session
+	history  map[string][]Session           // session yang sudah berakhir per user
+	addrUser map[string]string              // addr ip:port -> password, untuk log tanpa field id
+}
+
+var sessions = &sessionTracker{
+	live:     make(map[string]map[string]*Session),
+	history:  make(map[string][]Session),
+	addrUser: make(map[string]string),
+}
+
+func parseCoreLogLine(line string) (coreLogLine, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return coreLogLine{}, false
+	}
+	parsed := coreLogLine{Fields: map[string]interface{}{}}
+	text := line
+	if i := strings.Index(line, "{"); i >= 0 {
+		if err := json.Unmarshal([]byte(line[i:]), &parsed.Fields); err == nil {
+			text = line[:i]
+		}
+	}
+	// Buang timestamp dan level log di depan pesan
+	var words []string
+	levelSeen := false
+	for _, w := range strings.Fields(text) {
+		upper := strings.ToUpper(w)
+		if !levelSeen && (upper == "DEBUG" || upper == "INFO" || upper == "WARN" || upper == "ERROR" || upper == "FATAL") {
+			levelSeen = true
+			continue
+		}
+		if len(w) >= 10 && w[4] == '-' && w[7] == '-' {
+			continue
+		}
+		if strings.Count(w, ":") >= 2 && strings.IndexFunc(w, func(r rune) bool { return r >= 'a' && r <= 'z' }) < 0 {
+			continue
+		}
+		words = append(words, w)
+	}
+	parsed.Message = strings.ToLower(strings.Join(words, " "))
+	return parsed, parsed.Message != ""
+}
+
+func (l coreLogLine) str(keys ...string) string {
+	for _, k := range keys {
+		if v, ok := l.Fields[k].(string); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (l coreLogLine) num(keys ...string) int64 {
+	for _, k := range keys {
+		if v, ok := l.Fields[k].(float64); ok {
+			return int64(v)
+		}
+	}
+	return 0
+}
+
+// ingest memproses satu baris log core
+func (t *sessionTracker) ingest(line string, now time.Time) {
+	entry, ok := parseCoreLogLine(line)
+	if !ok {
+		return
+	}
+	addr := entry.str("addr", "src", "remote")
+	if addr == "" {
+		return
+	}
+	ip := addr
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		ip = host
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	password := entry.str("id", "auth", "user", "password")
+	if password == "" {
+		password = t.addrUser[addr]
+	}
+
+	switch {
+	case strings.Contains(entry.Message, "authentication failed") || strings.Contains(entry.Message, "auth failed"):
+		events.publish("auth.failed", map[string]string{"addr": addr, "password": password})
+	case strings.Contains(entry.Message, "disconnected"):
+		if password == "" {
+			return
+		}
+		delete(t.addrUser, addr)
+		if s := t.live[password][ip]; s != nil {
+			delete(s.active, addr)
+			s.touch(now, entry.num("tx"), entry.num("rx"))
+		}
+	case strings.Contains(entry.Message, "connected"):
+		if password == "" {
+			return
+		}
+		t.addrUser[addr] = password
+		s := t.session(password, ip, now)
+		s.active[addr] = true
+		s.Connections++
+		s.LastAddr = addr
+		s.touch(now, entry.num("tx"), entry.num("rx"))
+	default:
+		// TCP/UDP request & error: tanda user masih aktif
+		if password == "" {
+			return
+		}
+		s := t.session(password, ip, now)
+		s.LastAddr = addr
+		s.touch(now, entry.num("tx"), entry.num("rx"))
+	}
+}
+
+// session mengambil atau membuat session live; harus dipanggil dengan t.mu terkunci
+func (t *sessionTracker) session(password, ip string, now time.Time) *Session {
+	if t.live[password] == nil {
+		t.live[password] = make(map[string]*Session)
+	}
+	s := t.live[password][ip]
+	if s == nil {
+		s = &Session{
+			Password:  password,
+			SourceIP:  ip,
+			firstSeen: now,
+			active:    make(map[string]bool),
+		}
+		t.live[password][ip] = s
+		events.publish("session.started", map[string]string{
+			"password":  password,
+			"source_ip": ip,
+		})
+		// Device baru, cek limit IP tanpa menahan t.mu
+		select {
+		case deviceChecks <- password:
+		default:
+		}
+	}
+	return s
+}
+
+func (s *Session) touch(now time.Time, tx, rx int64) {
+	s.lastSeen = now
+	// Counter di log core bersifat kumulatif per koneksi, simpan yang terbesar
+	if tx > s.TxBytes {
+		s.TxBytes = tx
+	}
+	if rx > s.RxBytes {
+		s.RxBytes = rx
+	}
+}
+
+// snapshot mengisi field JSON dari waktu internal
+func (s *Session) snapshot() Session {
+	out := *s
+	out.FirstSeen = s.firstSeen.Format(time.RFC3339)
+	out.LastSeen = s.lastSeen.Format(time.RFC3339)
+	out.Online = s.EndedAt == ""
+	out.active = nil
+	return out
+}
+
+// expire menutup session yang tidak punya koneksi aktif dan tidak ada
+// aktivitas lebih dari SessionIdleTimeout. Log disconnect dari core tidak
+// selalu muncul (misal client hilang sinyal), jadi idle timeout tetap dipakai.
+func (t *sessionTracker) expire(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for password, byIP := range t.live {
+		for ip, s := range byIP {
+			idle := now.Sub(s.lastSeen) > SessionIdleTimeout
+			if len(s.active) > 0 && !idle {
+				continue
+			}
+			if len(s.active) == 0 && now.Sub(s.lastSeen) < SessionGracePeriod {
+				continue
+			}
+			for addr := range s.active {
+				delete(t.addrUser, addr)
+			}
+			s.EndedAt = now.Format(time.RFC3339)
+			ended := s.snapshot()
+			ended.Online = false
+			hist := append(t.history[password], ended)
+			if len(hist) > SessionHistorySize {
+				hist = hist[len(hist)-SessionHistorySize:]
+			}
+			t.history[password] = hist
+			delete(byIP, ip)
+			events.publish("session.ended", map[string]string{
+				"password":  password,
+				"source_ip": ip,
+			})
+		}
+		if len(byIP) == 0 {
+			delete(t.live, password)
+		}
+	}
+}
+
+// deviceIPs mengembalikan source IP yang sedang online untuk satu user
+func (t *sessionTracker) deviceIPs(password string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ips := []string{}
+	for ip := range t.live[password] {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+// endUser menutup semua session live milik user, dipakai saat user
+// disuspend agar session lama tidak ikut terhitung setelah dibuka kembali.
+func (t *sessionTracker) endUser(password string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for ip, s := range t.live[password] {
+		for addr := range s.active {
+			delete(t.addrUser, addr)
+		}
+		s.EndedAt = now.Format(time.RFC3339)
+		ended := s.snapshot()
+		ended.Online = false
+		hist := append(t.history[password], ended)
+		if len(hist) > SessionHistorySize {
+			hist = hist[len(hist)-SessionHistorySize:]
+		}
+		t.history[password] = hist
+		events.publish("session.ended", map[string]string{
+			"password":  password,
+			"source_ip": ip,
+		})
+	}
+	delete(t.live, password)
+}
+
+func (t *sessionTracker) userSessions(password string) []Session {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := []Session{}
+	for _, s := range t.live[password] {
+		out = append(out, s.snapshot())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastSeen > out[j].LastSeen })
+	for i := len(t.history[password]) - 1; i >= 0; i-- {
+		out = append(out, t.history[password][i])
+	}
+	return out
+}
+
+func (t *sessionTracker) online() map[string][]Session {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[string][]Session)
+	for password, byIP := range t.live {
+		for _, s := range byIP {
+			out[password] = append(out[password], s.snapshot())
+		}
+	}
+	return out
+}
+
+// tailCoreLogs membaca log core zivpn dari journald (stdout service) dan
+// menjalankan ulang pembaca jika prosesnya berhenti.
+func tailCoreLogs() {
+	for {
+		cmd := exec.Command("journalctl", "-u", "zivpn.service", "-f", "-n", "0", "-o", "cat")
+		stdout, err := cmd.StdoutPipe()
+		if err == nil {
+			err = cmd.Start()
+		}
+		if err != nil {
+			log.Printf("Gagal membaca log core: %v", err)
+			time.Sleep(CoreLogRetryInterval)
+			continue
+		}
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			sessions.ingest(scanner.Text(), time.Now())
+		}
+		cmd.Wait()
+		time.Sleep(CoreLogRetryInterval)
+	}
+}
+
+func expireSessions() {
+	ticker := time.NewTicker(SessionSweepInterval)
+	for range ticker.C {
+		sessions.expire(time.Now())
+	}
+}
+
+// userSubresource menangani /api/users/{password}/...
+func userSubresource(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.EscapedPath(), "/api/users/")
+	parts := strings.Split(rest, "/")
+	if len(parts) != 2 || parts[0] == "" {
+		jsonResponse(w, http.StatusNotFound, false, "Endpoint tidak ditemukan", nil)
+		return
+	}
+	password, err := url.PathUnescape(parts[0])
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, false, "Password tidak valid", nil)
+		return
+	}
+
+	switch parts[1] {
+	case "sessions":
+		userSessionsHandler(w, r, password)
+	case "profile":
+		userProfileHandler(w, r, password)
+	case "status-link":
+		statusLinkHandler(w, r, password)
+	case "rotate":
+		rotatePasswordHandler(w, r, password)
+	default:
+		jsonResponse(w, http.StatusNotFound, false, "Endpoint tidak ditemukan", nil)
+	}
+}
+
+func userSessionsHandler(w http.ResponseWriter, r *http.Request, password string) {
+	if r.Method != http.MethodGet {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	jsonResponse(w, http.StatusOK, true, "Daftar session", sessions.userSessions(password))
+}
+
+// --- Ganti Password ---
+
+type RotatePasswordRequest struct {
+	NewPassword string `json:"new_password"`
+}
+
+// rotatePasswordHandler mengganti password akun tanpa mengubah masa aktif
+// dan limit. Pemakaian kuota, status suspend dan pemilik reseller ikut
+// dipindah; link status lama tidak berlaku lagi.
+func rotatePasswordHandler(w http.ResponseWriter, r *http.Request, password string) {
+	if r.Method != http.MethodPost {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	var req RotatePasswordRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.NewPassword == "" || req.NewPassword == password {
+		jsonResponse(w, http.StatusBadRequest, false, "new_password harus diisi dan berbeda dari password lama", nil)
+		return
+	}
+	if strings.Contains(req.NewPassword, "|") {
+		jsonResponse(w, http.StatusBadRequest, false, "Password tidak boleh mengandung karakter '|'", nil)
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	config, err := loadConfig()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca config", nil)
+		return
+	}
+	users, err := loadUsers()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca database user", nil)
+		return
+	}
+	var rec UserRecord
+	found := false
+	for i, line := range users {
+		entry, ok := parseUserLine(line)
+		if !ok {
+			continue
+		}
+		if entry.Password == req.NewPassword {
+			jsonResponse(w, http.StatusConflict, false, "User sudah ada", nil)
+			return
+		}
+		if entry.Password == password {
+			found = true
+			rec = entry
+			entry.Password = req.NewPassword
+			users[i] = entry.String()
+		}
+	}
+	if !found {
+		jsonResponse(w, http.StatusNotFound, false, "User tidak ditemukan", nil)
+		return
+	}
+	// User yang disuspend tidak ada di config
+	for i, p := range config.Auth.Config {
+		if p == req.NewPassword {
+			jsonResponse(w, http.StatusConflict, false, "User sudah ada", nil)
+			return
+		}
+		if p == password {
+			config.Auth.Config[i] = req.NewPassword
+		}
+	}
+
+	if isDryRun(r) {
+		dryRunResponse(w, &config, users, nil)
+		return
+	}
+
+	if err := saveConfig(config); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan config", nil)
+		return
+	}
+	if err := saveUsers(users); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan database user", nil)
+		return
+	}
+	snapshotChange("user.rotate")
+
+	if usage, err := loadUsage(); err == nil {
+		if u, ok := usage[password]; ok {
+			usage[req.NewPassword] = u
+			delete(usage, password)
+			if err := saveJSONFile(UsageFile, usage); err != nil {
+				log.Printf("Gagal memindah pemakaian kuota %s: %v", password, err)
+			}
+		}
+	}
+	if suspended, err := loadSuspensions(); err == nil {
+		if susp, ok := suspended[password]; ok {
+			suspended[req.NewPassword] = susp
+			delete(suspended, password)
+			if err := saveSuspensions(suspended); err != nil {
+				log.Printf("Gagal memindah status suspend %s: %v", password, err)
+			}
+		}
+	}
+	if owners, err := loadOwners(); err == nil {
+		if owner := owners[password]; owner != "" {
+			if err := setOwner(req.NewPassword, owner); err != nil {
+				log.Printf("Gagal memindah pemilik %s: %v", password, err)
+			} else if err := setOwner(password, ""); err != nil {
+				log.Printf("Gagal menghapus pemilik %s: %v", password, err)
+			}
+		}
+	}
+	if err := removeStatusToken(password); err != nil {
+		log.Printf("Gagal menghapus token status %s: %v", password, err)
+	}
+
+	// Restart memutus koneksi yang masih memakai password lama
+	if err := restartService(); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal merestart service", nil)
+		return
+	}
+
+	recordAudit(r, "user.rotate", map[string]string{"password": password, "new_password": req.NewPassword})
+	events.publish("user.rotated", map[string]string{
+		"password":     password,
+		"new_password": req.NewPassword,
+	})
+
+	jsonResponse(w, http.StatusOK, true, "Password berhasil diganti", map[string]interface{}{
+		"password":     req.NewPassword,
+		"old_password": password,
+		"expired":      rec.Expired,
+		"limit_ip":     rec.LimitIP,
+		"limit_quota":  rec.LimitQuota,
+		"status_url":   statusLink(req.NewPassword),
+	})
+}
+
+// --- Profil Koneksi ---
+
+// Profile adalah konfigurasi siap-import untuk aplikasi client. URI memakai
+// format share link Hysteria v1 yang menjadi dasar ZiVPN.
+type Profile struct {
+	Password  string `json:"password"`
+	Server    string `json:"server"`
+	Port      int    `json:"port"`
+	PortRange string `json:"port_range,omitempty"` // rentang port hopping, contoh 6000-19999
+	Obfs      string `json:"obfs"`
+	SNI       string `json:"sni"`
+	// Insecure true jika sertifikat self-signed sehingga client harus
+	// melewati verifikasi TLS
+	Insecure bool   `json:"insecure"`
+	Expired  string `json:"expired"`
+	URI      string `json:"uri"`
+}
+
+func buildProfile(rec UserRecord) (Profile, error) {
+	server := readDomain()
+	if server == "" {
+		return Profile{}, errors.New("domain server belum diatur")
+	}
+	config, err := loadConfig()
+	if err != nil {
+		return Profile{}, err
+	}
+	port, _ := strconv.Atoi(listenPort())
+	profile := Profile{
+		Password: rec.Password,
+		Server:   server,
+		Port:     port,
+		Obfs:     config.Obfs,
+		SNI:      server,
+		Expired:  rec.Expired,
+	}
+	if hop, err := loadPortHopConfig(); err == nil && hop.Enabled {
+		profile.PortRange = fmt.Sprintf("%d-%d", hop.Start, hop.End)
+	}
+	certPath, _ := certPaths()
+	if cert, err := readCertificate(certPath); err != nil || isSelfSigned(cert) {
+		profile.Insecure = true
+	}
+
+	query := url.Values{}
+	query.Set("protocol", "udp")
+	query.Set("auth", profile.Password)
+	query.Set("peer", profile.SNI)
+	if profile.Obfs != "" {
+		query.Set("obfs", "xplus")
+		query.Set("obfsParam", profile.Obfs)
+	}
+	if profile.Insecure {
+		query.Set("insecure", "1")
+	}
+	if profile.PortRange != "" {
+		query.Set("mport", profile.PortRange)
+	}
+	profile.URI = (&url.URL{
+		Scheme:   "hysteria",
+		Host:     net.JoinHostPort(server, strconv.Itoa(port)),
+		RawQuery: query.Encode(),
+		Fragment: "zivpn-" + profile.Password,
+	}).String()
+	return profile, nil
+}
+
+// userProfileHandler mengembalikan profil sebagai JSON (default), share URI
+// (?format=uri), atau QR code PNG (?format=png&scale=8).
+func userProfileHandler(w http.ResponseWriter, r *http.Request, password string) {
+	if r.Method != http.MethodGet {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	rec, ok, err := findUser(password)
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca database user", nil)
+		return
+	}
+	if !ok {
+		jsonResponse(w, http.StatusNotFound, false, "User tidak ditemukan", nil)
+		return
+	}
+	profile, err := buildProfile(rec)
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membuat profil: "+err.Error(), nil)
+		return
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		jsonResponse(w, http.StatusOK, true, "Profil koneksi", profile)
+	case "uri":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(profile.URI))
+	case "png":
+		scale := 8
+		if v := r.URL.Query().Get("scale"); v != "" {
+			scale, err = strconv.Atoi(v)
+			if err != nil || scale < 1 || scale > 20 {
+				jsonResponse(w, http.StatusBadRequest, false, "scale harus 1-20", nil)
+				return
+			}
+		}
+		code, err := qrcode.Encode([]byte(profile.URI))
+		if err != nil {
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal membuat QR code: "+err.Error(), nil)
+			return
+		}
+		data, err := code.PNG(scale)
+		if err != nil {
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal membuat QR code", nil)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", "zivpn-"+profile.Password+".png"))
+		w.Write(data)
+	default:
+		jsonResponse(w, http.StatusBadRequest, false, "format harus json, uri, atau png", nil)
+	}
+}
+
+// --- Halaman Status Akun ---
+
+// AccountStatus adalah data yang boleh dilihat customer lewat link status.
+// Password hanya ditampilkan tersamar.
+type AccountStatus struct {
+	Password      string `json:"password"`
+	Server        string `json:"server"`
+	Status        string `json:"status"`
+	Expired       string `json:"expired"`
+	DaysLeft      int    `json:"days_left"`
+	LimitIP       int    `json:"limit_ip"`
+	LimitQuota    int    `json:"limit_quota"`
+	UploadBytes   int64  `json:"upload_bytes"`
+	DownloadBytes int64  `json:"download_bytes"`
+	UsedBytes     int64  `json:"used_bytes"`
+	Devices       int    `json:"devices"`
+}
+
+type StatusLink struct {
+	Token   string `json:"token"`
+	URL     string `json:"url"`
+	JSONURL string `json:"json_url"`
+}
+
+var statusTokenMutex sync.Mutex
+
+func loadStatusTokens() (map[string]string, error) {
+	tokens := map[string]string{}
+	if err := loadJSONFile(StatusTokenFile, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// statusToken mengembalikan token status user, dibuat jika belum ada.
+// rotate membuat token baru sehingga link lama tidak berlaku.
+func statusToken(password string, rotate bool) (string, error) {
+	statusTokenMutex.Lock()
+	defer statusTokenMutex.Unlock()
+	tokens, err := loadStatusTokens()
+	if err != nil {
+		return "", err
+	}
+	if token, ok := tokens[password]; ok && !rotate {
+		return token, nil
+	}
+	token := randomHex(16)
+	tokens[password] = token
+	if err := saveJSONFile(StatusTokenFile, tokens); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func removeStatusToken(password string) error {
+	statusTokenMutex.Lock()
+	defer statusTokenMutex.Unlock()
+	tokens, err := loadStatusTokens()
+	if err != nil {
+		return err
+	}
+	if _, ok := tokens[password]; !ok {
+		return nil
+	}
+	delete(tokens, password)
+	return saveJSONFile(StatusTokenFile, tokens)
+}
+
+func passwordForToken(token string) (string, bool, error) {
+	tokens, err := loadStatusTokens()
+	if err != nil {
+		return "", false, err
+	}
+	for password, t := range tokens {
+		if t == token {
+			return password, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// newStatusLink menyusun URL publik dari domain dan port API
+func newStatusLink(token string) StatusLink {
+	base := "http://" + readDomain() + Port
+	return StatusLink{
+		Token:   token,
+		URL:     base + "/status/" + token,
+		JSONURL: base + "/api/status/" + token,
+	}
+}
+
+// statusLink dipakai di response create/renew; kosong jika token gagal dibuat
+func statusLink(password string) string {
+	token, err := statusToken(password, false)
+	if err != nil {
+		log.Printf("Gagal membuat token status %s: %v", password, err)
+		return ""
+	}
+	return newStatusLink(token).URL
+}
+
+// statusLinkHandler: GET mengembalikan link status (dibuat jika belum ada),
+// POST mengganti token sehingga link lama tidak berlaku.
+func statusLinkHandler(w http.ResponseWriter, r *http.Request, password string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	rotate := r.Method == http.MethodPost
+	if rotate {
+		// Rotate mengubah state dan menulis audit log, sama seperti handler
+		// lain yang mengubah user
+		mutex.Lock()
+		defer mutex.Unlock()
+	}
+	if _, ok, err := findUser(password); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca database user", nil)
+		return
+	} else if !ok {
+		jsonResponse(w, http.StatusNotFound, false, "User tidak ditemukan", nil)
+		return
+	}
+	if rotate && isDryRun(r) {
+		statusTokenMutex.Lock()
+		tokens, err := loadStatusTokens()
+		statusTokenMutex.Unlock()
+		if err != nil {
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca token status", nil)
+			return
+		}
+		tokens[password] = randomHex(16)
+		dryRunState(w, false, nil, nil, map[string]interface{}{StatusTokenFile: tokens})
+		return
+	}
+	token, err := statusToken(password, rotate)
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan token status", nil)
+		return
+	}
+	if rotate {
+		recordAudit(r, "status.rotate", map[string]string{"password": password})
+		jsonResponse(w, http.StatusOK, true, "Link status diganti", newStatusLink(token))
+		return
+	}
+	jsonResponse(w, http.StatusOK, true, "Link status", newStatusLink(token))
+}
+
+func maskPassword(password string) string {
+	if len(password) <= 2 {
+		return strings.Repeat("*", len(password))
+	}
+	return password[:2] + strings.Repeat("*", len(password)-2)
+}
+
+// accountStatusFor membaca status akun dari token pada path request. Jika
+// gagal, response error sudah dikirim dan fungsi mengembalikan false.
+func accountStatusFor(w http.ResponseWriter, r *http.Request, prefix string) (AccountStatus, bool) {
+	if r.Method != http.MethodGet {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return AccountStatus{}, false
+	}
+	token := strings.TrimPrefix(r.URL.Path, prefix)
+	var password string
+	var ok bool
+	var err error
+	if token != "" && !strings.Contains(token, "/") {
+		password, ok, err = passwordForToken(token)
+	}
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca token status", nil)
+		return AccountStatus{}, false
+	}
+	var rec UserRecord
+	if ok {
+		rec, ok, err = findUser(password)
+	}
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca database user", nil)
+		return AccountStatus{}, false
+	}
+	if !ok {
+		jsonResponse(w, http.StatusNotFound, false, "Link status tidak valid", nil)
+		return AccountStatus{}, false
+	}
+
+	suspended, _ := loadSuspensions()
+	usage, _ := loadUsage()
+	now := time.Now()
+	status, _ := userStatus(rec, suspended, now.Format("2006-01-02"))
+	used := usage[rec.Password]
+	daysLeft := 0
+	if exp, err := time.ParseInLocation("2006-01-02", rec.Expired, time.Local); err == nil {
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+		if d := int(exp.Sub(today).Hours() / 24); d > 0 {
+			daysLeft = d
+		}
+	}
+	return AccountStatus{
+		Password:      maskPassword(rec.Password),
+		Server:        readDomain(),
+		Status:        status,
+		Expired:       rec.Expired,
+		DaysLeft:      daysLeft,
+		LimitIP:       rec.LimitIP,
+		LimitQuota:    rec.LimitQuota,
+		UploadBytes:   used.UploadBytes,
+		DownloadBytes: used.DownloadBytes,
+		UsedBytes:     used.total(),
+		Devices:       len(sessions.online()[rec.Password]),
+	}, true
+}
+
+// accountStatusJSON adalah endpoint publik tanpa API key; aksesnya hanya
+// lewat token yang tidak bisa ditebak.
+func accountStatusJSON(w http.ResponseWriter, r *http.Request) {
+	status, ok := accountStatusFor(w, r, "/api/status/")
+	if !ok {
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	jsonResponse(w, http.StatusOK, true, "Status akun", status)
+}
+
+var statusPageTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"gb": func(b int64) string { return fmt.Sprintf("%.2f GB", float64(b)/(1<<30)) },
+}).Parse(`<!DOCTYPE html>
+<html lang="id">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Status Akun ZiVPN</title>
+<style>
+body{font-family:system-ui,sans-serif;background:#f4f5f7;margin:0;padding:24px;color:#222}
+.card{max-width:420px;margin:auto;background:#fff;border-radius:12px;padding:20px 24px;box-shadow:0 2px 8px rgba(0,0,0,.08)}
+h1{font-size:20px;margin:0 0 16px}
+table{width:100%;border-collapse:collapse}
+td{padding:8px 0;border-bottom:1px solid #eee}
+td:last-child{text-align:right;font-weight:600}
+.Active{color:#1a7f37}.Expired,.Locked{color:#cf222e}.Suspended{color:#bf8700}
+</style>
+</head>
+<body>
+<div class="card">
+<h1>Status Akun</h1>
+<table>
+<tr><td>Password</td><td>{{.Password}}</td></tr>
+<tr><td>Server</td><td>{{.Server}}</td></tr>
+<tr><td>Status</td><td class="{{.Status}}">{{.Status}}</td></tr>
+<tr><td>Expired</td><td>{{.Expired}}</td></tr>
+<tr><td>Sisa Hari</td><td>{{.DaysLeft}} hari</td></tr>
+<tr><td>Limit IP</td><td>{{if .LimitIP}}{{.LimitIP}} device{{else}}Tanpa batas{{end}}</td></tr>
+<tr><td>Device Online</td><td>{{.Devices}}</td></tr>
+<tr><td>Kuota</td><td>{{if .LimitQuota}}{{gb .UsedBytes}} / {{.LimitQuota}} GB{{else if .UsedBytes}}{{gb .UsedBytes}} (tanpa batas){{else}}Tanpa batas{{end}}</td></tr>
+</table>
+</div>
+</body>
+</html>
+`))
+
+func accountStatusPage(w http.ResponseWriter, r *http.Request) {
+	status, ok := accountStatusFor(w, r, "/status/")
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := statusPageTemplate.Execute(w, status); err != nil {
+		log.Printf("Gagal merender halaman status: %v", err)
+	}
+}
+
+func listOnline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+
+	type OnlineUser struct {
+		Password string    `json:"password"`
+		Devices  int       `json:"devices"`
+		Sessions []Session `json:"sessions"`
+	}
+
+	online := sessions.online()
+	list := []OnlineUser{}
+	for password, s := range online {
+		list = append(list, OnlineUser{
+			Password: password,
+			Devices:  len(s),
+			Sessions: s,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Password < list[j].Password })
+
+	jsonResponse(w, http.StatusOK, true, "User online", list)
+}
+
+// --- Device Limit (Limit IP) ---
+
+// Aksi yang diambil saat jumlah device user melebihi limit_ip
+const (
+	IPLimitWarn    = "warn"    // hanya dicatat dan dilaporkan
+	IPLimitSuspend = "suspend" // disuspend selama SuspendMinutes
+	IPLimitLock    = "lock"    // dikunci sampai dibuka admin via /api/user/unlock
+)
+
+type IPLimitPolicy struct {
+	Enabled        bool   `json:"enabled"`
+	Action         string `json:"action"`
+	SuspendMinutes int    `json:"suspend_minutes"`
+}
+
+// Suspension adalah status user yang sementara dikeluarkan dari config.json
+// tanpa menghapus datanya di users.db.
+type Suspension struct {
+	Reason string `json:"reason"`
+	Since  string `json:"since"`
+	Until  string `json:"until,omitempty"` // kosong berarti terkunci
+}
+
+type Violation struct {
+	Time     string   `json:"time"`
+	Password string   `json:"password"`
+	Limit    int      `json:"limit"`
+	Devices  int      `json:"devices"`
+	IPs      []string `json:"ips"`
+	Action   string   `json:"action"`
+	Until    string   `json:"until,omitempty"`
+}
+
+// deviceChecks diisi sessionTracker setiap ada device (source IP) baru
+var deviceChecks = make(chan string, 64)
+
+// Waktu pelanggaran terakhir per user, dilindungi mutex
+var lastViolation = make(map[string]time.Time)
+
+func defaultIPLimitPolicy() IPLimitPolicy {
+	return IPLimitPolicy{Enabled: true, Action: IPLimitWarn, SuspendMinutes: 30}
+}
+
+func (p IPLimitPolicy) validate() error {
+	switch p.Action {
+	case IPLimitWarn, IPLimitLock:
+	case IPLimitSuspend:
+		if p.SuspendMinutes <= 0 {
+			return errors.New("suspend_minutes harus lebih dari 0")
+		}
+	default:
+		return errors.New("action harus warn, suspend, atau lock")
+	}
+	return nil
+}
+
+func loadIPLimitPolicy() IPLimitPolicy {
+	policy := defaultIPLimitPolicy()
+	if err := loadJSONFile(IPLimitFile, &policy); err != nil {
+		log.Printf("Gagal membaca %s, memakai kebijakan default: %v", IPLimitFile, err)
+		return defaultIPLimitPolicy()
+	}
+	return policy
+}
+
+func loadSuspensions() (map[string]Suspension, error) {
+	suspended := make(map[string]Suspension)
+	if err := loadJSONFile(SuspendedFile, &suspended); err != nil {
+		return nil, err
+	}
+	return suspended, nil
+}
+
+func saveSuspensions(suspended map[string]Suspension) error {
+	return saveJSONFile(SuspendedFile, suspended)
+}
+
+func loadViolations() ([]Violation, error) {
+	list := []Violation{}
+	if err := loadJSONFile(ViolationsFile, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// loadJSONFile membaca file JSON state ke v. File yang belum ada bukan error.
+func loadJSONFile(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func saveJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+func findUser(password string) (UserRecord, bool, error) {
+	users, err := loadUsers()
+	if err != nil {
+		return UserRecord{}, false, err
+	}
+	for _, line := range users {
+		if rec, ok := parseUserLine(line); ok && rec.Password == password {
+			return rec, true, nil
+		}
+	}
+	return UserRecord{}, false, nil
+}
+
+// suspendUser mengeluarkan password dari config.json dan mencatatnya di
+// suspended.json. until kosong berarti terkunci. Harus dipanggil dengan mutex terkunci.
+func suspendUser(password, reason string, until time.Time) error {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	auth := []string{}
+	for _, p := range config.Auth.Config {
+		if p != password {
+			auth = append(auth, p)
+		}
+	}
+	config.Auth.Config = auth
+	if err := saveConfig(config); err != nil {
+		return err
+	}
+	snapshotChange("user.suspend")
+
+	suspended, err := loadSuspensions()
+	if err != nil {
+		return err
+	}
+	entry := Suspension{Reason: reason, Since: time.Now().Format(time.RFC3339)}
+	if !until.IsZero() {
+		entry.Until = until.Format(time.RFC3339)
+	}
+	suspended[password] = entry
+	if err := saveSuspensions(suspended); err != nil {
+		return err
+	}
+
+	sessions.endUser(password, time.Now())
+	events.publish("user.suspended", map[string]string{
+		"password": password,
+		"reason":   reason,
+		"until":    entry.Until,
+	})
+	return restartService()
+}
+
+// planUnsuspend menyusun isi config dan daftar suspend setelah user dibuka
+// tanpa menulis apa pun. config nil berarti config.json tidak berubah.
+func planUnsuspend(password string) (*Config, map[string]Suspension, bool, error) {
+	suspended, err := loadSuspensions()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if _, ok := suspended[password]; !ok {
+		return nil, nil, false, nil
+	}
+	delete(suspended, password)
+
+	// User yang sudah dihapus dari users.db tidak dikembalikan ke config
+	_, exists, err := findUser(password)
+	if err != nil || !exists {
+		return nil, suspended, true, err
+	}
+	config, err := loadConfig()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	for _, p := range config.Auth.Config {
+		if p == password {
+			return nil, suspended, true, nil
+		}
+	}
+	config.Auth.Config = append(config.Auth.Config, password)
+	return &config, suspended, true, nil
+}
+
+// unsuspendUser mengembalikan password ke config.json. Mengembalikan false
+// jika user tidak sedang disuspend. Harus dipanggil dengan mutex terkunci.
+func unsuspendUser(password string) (bool, error) {
+	config, suspended, ok, err := planUnsuspend(password)
+	if err != nil || !ok {
+		return false, err
+	}
+	if config != nil {
+		if err := saveConfig(*config); err != nil {
+			return false, err
+		}
+		snapshotChange("user.unsuspend")
+	}
+	if err := saveSuspensions(suspended); err != nil {
+		return false, err
+	}
+	delete(lastViolation, password)
+
+	events.publish("user.unsuspended", map[string]string{
+		"password": password,
+	})
+	return true, restartService()
+}
+
+// enforceDeviceLimits memeriksa limit IP setiap ada device baru dan secara
+// berkala untuk semua user online, serta membuka suspend yang sudah habis.
+func enforceDeviceLimits() {
+	ticker := time.NewTicker(SessionSweepInterval)
+	for {
+		select {
+		case password := <-deviceChecks:
+			checkDeviceLimit(password, sessions.deviceIPs(password))
+		case <-ticker.C:
+			for password, list := range sessions.online() {
+				ips := make([]string, 0, len(list))
+				for _, s := range list {
+					ips = append(ips, s.SourceIP)
+				}
+				sort.Strings(ips)
+				checkDeviceLimit(password, ips)
+			}
+			liftExpiredSuspensions(time.Now())
+		}
+	}
+}
+
+func checkDeviceLimit(password string, ips []string) {
+	// limit_ip minimal 1, jadi 1 device tidak pernah melanggar
+	if len(ips) <= 1 {
+		return
+	}
+	policy := loadIPLimitPolicy()
+	if !policy.Enabled {
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	rec, ok, err := findUser(password)
+	if err != nil || !ok || rec.LimitIP <= 0 || len(ips) <= rec.LimitIP {
+		return
+	}
+	suspended, err := loadSuspensions()
+	if err != nil {
+		log.Printf("Gagal membaca data suspend: %v", err)
+		return
+	}
+	if _, ok := suspended[password]; ok {
+		return
+	}
+	now := time.Now()
+	if last, ok := lastViolation[password]; ok && now.Sub(last) < ViolationCooldown {
+		return
+	}
+	lastViolation[password] = now
+
+	v := Violation{
+		Time:     now.Format(time.RFC3339),
+		Password: password,
+		Limit:    rec.LimitIP,
+		Devices:  len(ips),
+		IPs:      ips,
+		Action:   policy.Action,
+	}
+	switch policy.Action {
+	case IPLimitSuspend:
+		until := now.Add(time.Duration(policy.SuspendMinutes) * time.Minute)
+		v.Until = until.Format(time.RFC3339)
+		err = suspendUser(password, "ip_limit", until)
+	case IPLimitLock:
+		err = suspendUser(password, "ip_limit", time.Time{})
+	}
+	if err != nil {
+		log.Printf("Gagal menjalankan aksi %s untuk %s: %v", policy.Action, password, err)
+	}
+
+	if err := recordViolation(v); err != nil {
+		log.Printf("Gagal mencatat pelanggaran limit IP %s: %v", password, err)
+	}
+	events.publish("iplimit.violation", v)
+}
+
+// recordViolation menambah catatan pelanggaran; harus dipanggil dengan mutex terkunci
+func recordViolation(v Violation) error {
+	list, err := loadViolations()
+	if err != nil {
+		return err
+	}
+	list = append(list, v)
+	if len(list) > MaxViolations {
+		list = list[len(list)-MaxViolations:]
+	}
+	return saveJSONFile(ViolationsFile, list)
+}
+
+func liftExpiredSuspensions(now time.Time) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	suspended, err := loadSuspensions()
+	if err != nil {
+		log.Printf("Gagal membaca data suspend: %v", err)
+		return
+	}
+	for password, s := range suspended {
+		if s.Until == "" {
+			continue
+		}
+		until, err := time.Parse(time.RFC3339, s.Until)
+		if err != nil || now.Before(until) {
+			continue
+		}
+		if _, err := unsuspendUser(password); err != nil {
+			log.Printf("Gagal membuka suspend %s: %v", password, err)
+		}
+	}
+}
+
+func ipLimitPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		jsonResponse(w, http.StatusOK, true, "Kebijakan limit IP", loadIPLimitPolicy())
+	case http.MethodPost:
+		var policy IPLimitPolicy
+		if !decodeJSON(w, r, &policy) {
+			return
+		}
+		if err := policy.validate(); err != nil {
+			jsonResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+			return
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		if isDryRun(r) {
+			dryRunState(w, false, nil, nil, map[string]interface{}{IPLimitFile: policy})
+			return
+		}
+		if err := saveJSONFile(IPLimitFile, policy); err != nil {
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan kebijakan limit IP", nil)
+			return
+		}
+		jsonResponse(w, http.StatusOK, true, "Kebijakan limit IP disimpan", policy)
+	default:
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+	}
+}
+
+func listViolations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+
+	mutex.Lock()
+	list, err := loadViolations()
+	mutex.Unlock()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca catatan pelanggaran", nil)
+		return
+	}
+
+	// Terbaru di depan, bisa difilter dengan ?password=
+	password := r.URL.Query().Get("password")
+	out := []Violation{}
+	for i := len(list) - 1; i >= 0; i-- {
+		if password == "" || list[i].Password == password {
+			out = append(out, list[i])
+		}
+	}
+	jsonResponse(w, http.StatusOK, true, "Catatan pelanggaran", out)
+}
+
+func unlockUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+
+	var req UserRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if isDryRun(r) {
+		config, suspended, ok, err := planUnsuspend(req.Password)
+		if err != nil {
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data suspend", nil)
+			return
+		}
+		if !ok {
+			jsonResponse(w, http.StatusNotFound, false, "User tidak sedang disuspend", nil)
+			return
+		}
+		dryRunState(w, true, config, nil, map[string]interface{}{SuspendedFile: suspended})
+		return
+	}
+
+	ok, err := unsuspendUser(req.Password)
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membuka user", nil)
+		return
+	}
+	if !ok {
+		jsonResponse(w, http.StatusNotFound, false, "User tidak sedang disuspend", nil)
+		return
+	}
+	jsonResponse(w, http.StatusOK, true, "User berhasil dibuka", nil)
+}
+
+// --- Quota (Pemakaian Traffic) ---
+
+// Usage adalah pemakaian traffic satu user sejak reset terakhir.
+// Upload = dari client ke server, Download = dari server ke client.
+type Usage struct {
+	UploadBytes   int64  `json:"upload_bytes"`
+	DownloadBytes int64  `json:"download_bytes"`
+	ResetAt       string `json:"reset_at,omitempty"`
+	UpdatedAt     string `json:"updated_at,omitempty"`
+}
+
+func (u Usage) total() int64 {
+	return u.UploadBytes + u.DownloadBytes
+}
+
+type QuotaRequest struct {
+	Password string `json:"password"`
+	GB       int    `json:"gb"` // hanya untuk top-up
+}
+
+// trafficMeter memegang counter nftables per source IP. Core zivpn tidak
+// mencatat byte per user, jadi setiap IP client diberi rule counter sendiri
+// di table AcctTable lalu byte-nya dibagikan ke user pemilik IP tersebut
+// menurut sessionTracker (log auth core).
+type trafficMeter struct {
+	ready  bool
+	warned bool // error setup hanya dilog sekali
+	port   string
+	last   map[string]int64    // comment rule ("in:IP"/"out:IP") -> byte terakhir
+	owners map[string][]string // IP -> password yang terakhir memakai IP tersebut
+}
+
+var meter = &trafficMeter{
+	last:   make(map[string]int64),
+	owners: make(map[string][]string),
+}
+
+type nftRule struct {
+	Handle int
+	Bytes  int64
+}
+
+func loadUsage() (map[string]Usage, error) {
+	usage := make(map[string]Usage)
+	if err := loadJSONFile(UsageFile, &usage); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+func nft(args ...string) ([]byte, error) {
+	out, err := exec.Command("nft", args...).CombinedOutput()
+	if err != nil {
+		return out, fmt.Errorf("nft %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return out, nil
+}
+
+// setup membuat ulang table accounting. Counter lama dibuang karena
+// byte-nya sudah (atau tidak bisa lagi) dihitung ke usage.json.
+func (m *trafficMeter) setup() error {
+	port := listenPort()
+	nft("delete", "table", "inet", AcctTable)
+	if _, err := nft("add", "table", "inet", AcctTable); err != nil {
+		return err
+	}
+	for _, chain := range []string{"input", "output"} {
+		spec := fmt.Sprintf("{ type filter hook %s priority -150 ; policy accept ; }", chain)
+		if _, err := nft("add", "chain", "inet", AcctTable, chain, spec); err != nil {
+			return err
+		}
+	}
+	m.port = port
+	m.last = make(map[string]int64)
+	m.ready = true
+	return nil
+}
+
+// rules membaca semua rule counter beserta handle-nya, key = comment
+func (m *trafficMeter) rules() (map[string]nftRule, error) {
+	out, err := nft("-j", "list", "table", "inet", AcctTable)
+	if err != nil {
+		return nil, err
+	}
+	return parseNftRules(out)
+}
+
+func parseNftRules(data []byte) (map[string]nftRule, error) {
+	var list struct {
+		Nftables []struct {
+			Rule *struct {
+				Handle  int    `json:"handle"`
+				Comment string `json:"comment"`
+				Expr    []struct {
+					Counter *struct {
+						Bytes int64 `json:"bytes"`
+					} `json:"counter"`
+				} `json:"expr"`
+			} `json:"rule"`
+		} `json:"nftables"`
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	rules := make(map[string]nftRule)
+	for _, item := range list.Nftables {
+		if item.Rule == nil || item.Rule.Comment == "" {
+			continue
+		}
+		r := nftRule{Handle: item.Rule.Handle}
+		for _, e := range item.Rule.Expr {
+			if e.Counter != nil {
+				r.Bytes = e.Counter.Bytes
+			}
+		}
+		rules[item.Rule.Comment] = r
+	}
+	return rules, nil
+}
+
+func (m *trafficMeter) addIP(ip string) error {
+	family := "ip"
+	if strings.Contains(ip, ":") {
+		family = "ip6"
+	}
+	if _, err := nft("add", "rule", "inet", AcctTable, "input",
+		family, "saddr", ip, "udp", "dport", m.port, "counter", "comment", `"in:`+ip+`"`); err != nil {
+		return err
+	}
+	_, err := nft("add", "rule", "inet", AcctTable, "output",
+		family, "daddr", ip, "udp", "sport", m.port, "counter", "comment", `"out:`+ip+`"`)
+	return err
+}
+
+func (m *trafficMeter) deleteRule(comment string, handle int) {
+	chain := "input"
+	if strings.HasPrefix(comment, "out:") {
+		chain = "output"
+	}
+	if _, err := nft("delete", "rule", "inet", AcctTable, chain, "handle", strconv.Itoa(handle)); err != nil {
+		log.Printf("Gagal menghapus counter %s: %v", comment, err)
+	}
+}
+
+func accountTraffic() {
+	ticker := time.NewTicker(QuotaSyncInterval)
+	for range ticker.C {
+		syncUsage()
+	}
+}
+
+// syncUsage memindahkan selisih counter nftables ke usage.json, memasang
+// counter untuk IP yang baru online, lalu mengecek kuota setiap user.
+func syncUsage() {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if !meter.ready {
+		if err := meter.setup(); err != nil {
+			if !meter.warned {
+				log.Printf("Accounting kuota tidak aktif: %v", err)
+				meter.warned = true
+			}
+			return
+		}
+	}
+
+	// IP -> password yang sedang online dari IP tersebut
+	owners := make(map[string][]string)
+	for password, list := range sessions.online() {
+		for _, s := range list {
+			owners[s.SourceIP] = append(owners[s.SourceIP], password)
+		}
+	}
+
+	rules, err := meter.rules()
+	if err != nil {
+		log.Printf("Gagal membaca counter kuota: %v", err)
+		meter.ready = false
+		return
+	}
+	usage, err := loadUsage()
+	if err != nil {
+		log.Printf("Gagal membaca pemakaian kuota: %v", err)
+		return
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	changed := false
+	for comment, r := range rules {
+		parts := strings.SplitN(comment, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		ip := parts[1]
+		delta := r.Bytes - meter.last[comment]
+		if delta < 0 {
+			delta = r.Bytes
+		}
+		meter.last[comment] = r.Bytes
+
+		users := owners[ip]
+		if len(users) == 0 {
+			users = meter.owners[ip]
+		}
+		// Beberapa user di balik IP yang sama (NAT) dibagi rata
+		if delta > 0 && len(users) > 0 {
+			share := delta / int64(len(users))
+			for _, password := range users {
+				u := usage[password]
+				if parts[0] == "in" {
+					u.UploadBytes += share
+				} else {
+					u.DownloadBytes += share
+				}
+				u.UpdatedAt = now
+				usage[password] = u
+			}
+			changed = true
+		}
+
+		// IP yang sudah offline: byte terakhir sudah dihitung, hapus counternya
+		if len(owners[ip]) == 0 {
+			meter.deleteRule(comment, r.Handle)
+			delete(meter.last, comment)
+		}
+	}
+	for ip := range meter.owners {
+		if len(owners[ip]) == 0 {
+			delete(meter.owners, ip)
+		}
+	}
+	for ip, users := range owners {
+		if _, ok := rules["in:"+ip]; !ok {
+			if err := meter.addIP(ip); err != nil {
+				log.Printf("Gagal memasang counter untuk %s: %v", ip, err)
+				continue
+			}
+		}
+		meter.owners[ip] = users
+	}
+
+	if changed {
+		if err := saveJSONFile(UsageFile, usage); err != nil {
+			log.Printf("Gagal menyimpan pemakaian kuota: %v", err)
+			return
+		}
+	}
+	enforceQuotas(usage)
+}
+
+// enforceQuotas mengunci user yang pemakaiannya mencapai limit_quota.
+// Harus dipanggil dengan mutex terkunci.
+func enforceQuotas(usage map[string]Usage) {
+	users, err := loadUsers()
+	if err != nil {
+		return
+	}
+	suspended, err := loadSuspensions()
+	if err != nil {
+		return
+	}
+	for _, line := range users {
+		rec, ok := parseUserLine(line)
+		if !ok || rec.LimitQuota <= 0 {
+			continue
+		}
+		if _, ok := suspended[rec.Password]; ok {
+			continue
+		}
+		used := usage[rec.Password].total()
+		if used < int64(rec.LimitQuota)<<30 {
+			continue
+		}
+		if err := suspendUser(rec.Password, "quota", time.Time{}); err != nil {
+			log.Printf("Gagal mengunci %s (kuota habis): %v", rec.Password, err)
+		}
+		events.publish("quota.exceeded", map[string]interface{}{
+			"password":    rec.Password,
+			"limit_quota": rec.LimitQuota,
+			"used_bytes":  used,
+		})
+	}
+}
+
+// liftQuotaSuspension membuka user yang dikunci karena kuota jika
+// pemakaiannya sudah di bawah limit. Harus dipanggil dengan mutex terkunci.
+func liftQuotaSuspension(rec UserRecord, used int64) error {
+	if lift, err := quotaLiftable(rec, used); err != nil || !lift {
+		return err
+	}
+	_, err := unsuspendUser(rec.Password)
+	return err
+}
+
+// quotaLiftable bernilai true jika user disuspend karena kuota dan
+// pemakaiannya sekarang sudah di bawah limit
+func quotaLiftable(rec UserRecord, used int64) (bool, error) {
+	suspended, err := loadSuspensions()
+	if err != nil {
+		return false, err
+	}
+	if s, ok := suspended[rec.Password]; !ok || s.Reason != "quota" {
+		return false, nil
+	}
+	return rec.LimitQuota == 0 || used < int64(rec.LimitQuota)<<30, nil
+}
+
+// dryRunQuota mengirim perubahan reset/top-up kuota, termasuk pembukaan
+// suspend kuota jika akan terjadi
+func dryRunQuota(w http.ResponseWriter, rec UserRecord, used int64, users []string, files map[string]interface{}) {
+	lift, err := quotaLiftable(rec, used)
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data suspend", nil)
+		return
+	}
+	var config *Config
+	if lift {
+		var suspended map[string]Suspension
+		if config, suspended, _, err = planUnsuspend(rec.Password); err != nil {
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data suspend", nil)
+			return
+		}
+		files[SuspendedFile] = suspended
+	}
+	dryRunState(w, lift, config, users, files)
+}
+
+func resetQuota(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+
+	var req QuotaRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	rec, ok, err := findUser(req.Password)
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca database user", nil)
+		return
+	}
+	if !ok {
+		jsonResponse(w, http.StatusNotFound, false, "User tidak ditemukan di database", nil)
+		return
+	}
+
+	usage, err := loadUsage()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca pemakaian kuota", nil)
+		return
+	}
+	usage[req.Password] = Usage{ResetAt: time.Now().Format(time.RFC3339)}
+	if isDryRun(r) {
+		dryRunQuota(w, rec, 0, nil, map[string]interface{}{UsageFile: usage})
+		return
+	}
+	if err := saveJSONFile(UsageFile, usage); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan pemakaian kuota", nil)
+		return
+	}
+	if err := liftQuotaSuspension(rec, 0); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membuka user", nil)
+		return
+	}
+
+	events.publish("quota.reset", map[string]string{"password": req.Password})
+	jsonResponse(w, http.StatusOK, true, "Kuota user berhasil direset", usage[req.Password])
+}
+
+func topUpQuota(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+
+	var req QuotaRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.GB <= 0 {
+		jsonResponse(w, http.StatusBadRequest, false, "gb harus lebih dari 0", nil)
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	users, err := loadUsers()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca database user", nil)
+		return
+	}
+	var updated UserRecord
+	found := false
+	for i, line := range users {
+		rec, ok := parseUserLine(line)
+		if ok && rec.Password == req.Password {
+			// Tanpa limit (0) tetap tanpa limit, top-up tidak diperlukan
+			if rec.LimitQuota > 0 {
+				rec.LimitQuota += req.GB
+			}
+			users[i] = rec.String()
+			updated = rec
+			found = true
+			break
+		}
+	}
+	if !found {
+		jsonResponse(w, http.StatusNotFound, false, "User tidak ditemukan di database", nil)
+		return
+	}
+	usage, err := loadUsage()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca pemakaian kuota", nil)
+		return
+	}
+	used := usage[req.Password].total()
+	if isDryRun(r) {
+		dryRunQuota(w, updated, used, users, map[string]interface{}{})
+		return
+	}
+	if err := saveUsers(users); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan database user", nil)
+		return
+	}
+	snapshotChange("quota.topup")
+	if err := liftQuotaSuspension(updated, used); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membuka user", nil)
+		return
+	}
+
+	events.publish("quota.topup", map[string]interface{}{
+		"password":    req.Password,
+		"gb":          req.GB,
+		"limit_quota": updated.LimitQuota,
+	})
+	jsonResponse(w, http.StatusOK, true, "Kuota user berhasil ditambah", map[string]interface{}{
+		"password":    req.Password,
+		"limit_quota": updated.LimitQuota,
+		"used_bytes":  used,
+	})
+}
+
+// --- Port Hopping (NAT) ---
+
+// PortHopConfig disimpan di porthop.json. Rule DNAT dirender dari sini dan
+// dari Config.Listen, jadi tidak ada port atau interface yang di-hardcode.
+type PortHopConfig struct {
+	Enabled   bool   `json:"enabled"`
+	Start     int    `json:"start"`
+	End       int    `json:"end"`
+	Interface string `json:"interface,omitempty"` // kosong = interface default route
+	Backend   string `json:"backend,omitempty"`   // auto, iptables, nftables
+}
+
+type PortHopStatus struct {
+	PortHopConfig
+	ActiveBackend   string `json:"active_backend"`
+	ActiveInterface string `json:"active_interface"`
+	TargetPort      string `json:"target_port"`
+	Applied         bool   `json:"applied"`
+	Error           string `json:"error,omitempty"`
+}
+
+// portHopRule adalah rule yang sudah dirender dan siap dipasang
+type portHopRule struct {
+	Backend   string
+	Interface string
+	Target    string
+	Start     int
+	End       int
+}
+
+// Rule lama dari install.sh / zivpn-iptables-fix.sh (tanpa comment)
+const legacyPortHopRule = "--dport 6000:19999 -j DNAT --to-destination :5667"
+
+var portHopMutex sync.Mutex
+
+func defaultPortHopConfig() PortHopConfig {
+	return PortHopConfig{Enabled: true, Start: 6000, End: 19999, Backend: "auto"}
+}
+
+func loadPortHopConfig() (PortHopConfig, error) {
+	cfg := defaultPortHopConfig()
+	if err := loadJSONFile(PortHopFile, &cfg); err != nil {
+		return defaultPortHopConfig(), err
+	}
+	if cfg.Backend == "" {
+		cfg.Backend = "auto"
+	}
+	return cfg, nil
+}
+
+func (c PortHopConfig) validate() error {
+	if c.Start < 1 || c.End > 65535 || c.Start > c.End {
+		return errors.New("rentang port harus 1-65535 dan start <= end")
+	}
+	switch c.Backend {
+	case "", "auto", "iptables", "nftables":
+	default:
+		return errors.New("backend harus auto, iptables, atau nftables")
+	}
+	if c.Interface != "" {
+		if _, err := net.InterfaceByName(c.Interface); err != nil {
+			return fmt.Errorf("interface %s tidak ditemukan", c.Interface)
+		}
+	}
+	// Rentang yang mencakup port listen core akan ikut men-DNAT trafik core
+	// sendiri. Port API (TCP) tidak perlu dicek karena rule hanya -p udp,
+	// dan rentang default installer 6000-19999 memang mencakup 8080.
+	corePort, _ := strconv.Atoi(listenPort())
+	if corePort >= c.Start && corePort <= c.End {
+		return fmt.Errorf("rentang port %d-%d mencakup port listen core (%d)", c.Start, c.End, corePort)
+	}
+	return nil
+}
+
+// defaultInterface membaca interface default route dari /proc/net/route
+func defaultInterface() (string, error) {
+	data, err := ioutil.ReadFile("/proc/net/route")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) > 2 && fields[1] == "00000000" {
+			return fields[0], nil
+		}
+	}
+	return "", errors.New("default route tidak ditemukan")
+}
+
+func resolvePortHopBackend(pref string) (string, error) {
+	if pref == "iptables" || pref == "nftables" {
+		return pref, nil
+	}
+	if _, err := exec.LookPath("iptables"); err == nil {
+		return "iptables", nil
+	}
+	if _, err := exec.LookPath("nft"); err == nil {
+		return "nftables", nil
+	}
+	return "", errors.New("iptables maupun nft tidak ditemukan")
+}
+
+func planPortHop(cfg PortHopConfig) (portHopRule, error) {
+	rule := portHopRule{Start: cfg.Start, End: cfg.End, Interface: cfg.Interface, Target: listenPort()}
+	if rule.Interface == "" {
+		iface, err := defaultInterface()
+		if err != nil {
+			return rule, err
+		}
+		rule.Interface = iface
+	}
+	backend, err := resolvePortHopBackend(cfg.Backend)
+	if err != nil {
+		return rule, err
+	}
+	rule.Backend = backend
+	return rule, nil
+}
+
+func (p portHopRule) iptablesArgs() []string {
+	return []string{"PREROUTING", "-i", p.Interface, "-p", "udp",
+		"--dport", fmt.Sprintf("%d:%d", p.Start, p.End),
+		"-m", "comment", "--comment", PortHopTag,
+		"-j", "DNAT", "--to-destination", ":" + p.Target}
+}
+
+func (p portHopRule) nftScript() string {
+	return fmt.Sprintf(`table inet %[1]s
+delete table inet %[1]s
+table inet %[1]s {
+	chain prerouting {
+		type nat hook prerouting priority dstnat; policy accept;
+		iifname "%[2]s" udp dport %[3]d-%[4]d counter redirect to :%[5]s comment "%[6]s"
+	}
+}
+`, PortHopTable, p.Interface, p.Start, p.End, p.Target, PortHopTag)
+}
+
+func iptablesNat(args ...string) ([]byte, error) {
+	out, err := exec.Command("iptables", append([]string{"-t", "nat"}, args...)...).CombinedOutput()
+	if err != nil {
+		return out, fmt.Errorf("iptables %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return out, nil
+}
+
+// iptablesPortHopRules mengembalikan rule milik port hopping (bertanda
+// PortHopTag atau rule lama dari installer) dalam format -S
+func iptablesPortHopRules() ([]string, error) {
+	out, err := iptablesNat("-S", "PREROUTING")
+	if err != nil {
+		return nil, err
+	}
+	var rules []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.Contains(line, PortHopTag) || strings.Contains(line, legacyPortHopRule) {
+			rules = append(rules, line)
+		}
+	}
+	return rules, nil
+}
+
+// installed mengecek apakah rule terpasang persis satu kali
+func (p portHopRule) installed() (bool, error) {
+	switch p.Backend {
+	case "iptables":
+		rules, err := iptablesPortHopRules()
+		if err != nil {
+			return false, err
+		}
+		if len(rules) != 1 {
+			return false, nil
+		}
+		_, err = iptablesNat(append([]string{"-C"}, p.iptablesArgs()...)...)
+		return err == nil, nil
+	default:
+		out, err := exec.Command("nft", "list", "table", "inet", PortHopTable).CombinedOutput()
+		if err != nil {
+			return false, nil
+		}
+		text := string(out)
+		return strings.Contains(text, fmt.Sprintf(`iifname "%s"`, p.Interface)) &&
+			strings.Contains(text, fmt.Sprintf("udp dport %d-%d", p.Start, p.End)) &&
+			strings.Contains(text, "redirect to :"+p.Target), nil
+	}
+}
+
+// clearPortHop menghapus rule port hopping dari backend yang diberikan
+func clearPortHop(backend string) {
+	switch backend {
+	case "iptables":
+		if _, err := exec.LookPath("iptables"); err != nil {
+			return
+		}
+		rules, err := iptablesPortHopRules()
+		if err != nil {
+			return
+		}
+		for _, line := range rules {
+			fields := strings.Fields(line)
+			if len(fields) < 2 || fields[0] != "-A" {
+				continue
+			}
+			if _, err := iptablesNat(append([]string{"-D"}, fields[1:]...)...); err != nil {
+				log.Printf("Gagal menghapus rule port hopping lama: %v", err)
+			}
+		}
+	case "nftables":
+		if _, err := exec.LookPath("nft"); err != nil {
+			return
+		}
+		exec.Command("nft", "delete", "table", "inet", PortHopTable).Run()
+	}
+}
+
+func (p portHopRule) apply() error {
+	// Rule di backend lain (misal setelah pindah backend) dibersihkan dulu
+	for _, b := range []string{"iptables", "nftables"} {
+		if b != p.Backend {
+			clearPortHop(b)
+		}
+	}
+	switch p.Backend {
+	case "iptables":
+		clearPortHop("iptables")
+		_, err := iptablesNat(append([]string{"-A"}, p.iptablesArgs()...)...)
+		return err
+	default:
+		cmd := exec.Command("nft", "-f", "-")
+		cmd.Stdin = strings.NewReader(p.nftScript())
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("nft -f: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+}
+
+// ensurePortHop memasang ulang rule jika hilang atau berbeda dari config.
+// Mengembalikan true jika rule dipasang ulang.
+func ensurePortHop(cfg PortHopConfig) (bool, error) {
+	portHopMutex.Lock()
+	defer portHopMutex.Unlock()
+
+	if !cfg.Enabled {
+		clearPortHop("iptables")
+		clearPortHop("nftables")
+		return false, nil
+	}
+	rule, err := planPortHop(cfg)
+	if err != nil {
+		return false, err
+	}
+	ok, err := rule.installed()
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		return false, nil
+	}
+	return true, rule.apply()
+}
+
+func watchPortHop() {
+	lastErr := ""
+	for {
+		cfg, err := loadPortHopConfig()
+		if err != nil {
+			log.Printf("Gagal membaca %s: %v", PortHopFile, err)
+		} else if repaired, err := ensurePortHop(cfg); err != nil {
+			// Error yang sama tidak dilog ulang setiap menit
+			if err.Error() != lastErr {
+				log.Printf("Gagal memasang rule port hopping: %v", err)
+				lastErr = err.Error()
+			}
+			time.Sleep(PortHopCheckInterval)
+			continue
+		} else if repaired {
+			log.Printf("Rule port hopping %d-%d dipasang ulang", cfg.Start, cfg.End)
+			events.publish("porthop.repaired", map[string]int{"start": cfg.Start, "end": cfg.End})
+		}
+		lastErr = ""
+		time.Sleep(PortHopCheckInterval)
+	}
+}
+
+func portHopStatus(cfg PortHopConfig) PortHopStatus {
+	status := PortHopStatus{PortHopConfig: cfg, TargetPort: listenPort()}
+	if !cfg.Enabled {
+		return status
+	}
+	rule, err := planPortHop(cfg)
+	status.ActiveBackend = rule.Backend
+	status.ActiveInterface = rule.Interface
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	portHopMutex.Lock()
+	status.Applied, err = rule.installed()
+	portHopMutex.Unlock()
+	if err != nil {
+		status.Error = err.Error()
+	}
+	return status
+}
+
+func portHopHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := loadPortHopConfig()
+		if err != nil {
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca konfigurasi port hopping", nil)
+			return
+		}
+		jsonResponse(w, http.StatusOK, true, "Port hopping", portHopStatus(cfg))
+	case http.MethodPost:
+		var cfg PortHopConfig
+		if !decodeJSON(w, r, &cfg) {
+			return
+		}
+		if cfg.Backend == "" {
+			cfg.Backend = "auto"
+		}
+		if err := cfg.validate(); err != nil {
+			jsonResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+			return
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if isDryRun(r) {
+			// Rule NAT tidak disentuh, cukup pastikan backend tersedia
+			if cfg.Enabled {
+				if _, err := planPortHop(cfg); err != nil {
+					jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyusun rule port hopping: "+err.Error(), nil)
+					return
+				}
+			}
+			dryRunState(w, false, nil, nil, map[string]interface{}{PortHopFile: cfg})
+			return
+		}
+
+		old, _ := loadPortHopConfig()
+		if _, err := ensurePortHop(cfg); err != nil {
+			// Kembalikan rule lama agar port hopping tidak mati
+			ensurePortHop(old)
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal memasang rule port hopping: "+err.Error(), nil)
+			return
+		}
+		if err := saveJSONFile(PortHopFile, cfg); err != nil {
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan konfigurasi port hopping", nil)
+			return
+		}
+		events.publish("porthop.updated", cfg)
+		jsonResponse(w, http.StatusOK, true, "Port hopping diperbarui", portHopStatus(cfg))
+	default:
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+	}
+}
+
+// --- Sertifikat TLS ---
+
+const (
+	CertModeSelfSigned = "self-signed"
+	CertModeACME       = "acme"
+)
+
+// CertConfig disimpan di cert.json
+type CertConfig struct {
+	Mode            string `json:"mode"`
+	RenewBeforeDays int    `json:"renew_before_days"`
+	ACMEDirectory   string `json:"acme_directory,omitempty"`
+	ACMEEmail       string `json:"acme_email,omitempty"`
+	// CA tambahan untuk memverifikasi HTTPS directory ACME (misal Pebble)
+	ACMECAFile string `json:"acme_ca_file,omitempty"`
+	// Port listener challenge http-01, default 80
+	ACMEHTTPPort int `json:"acme_http_port,omitempty"`
+}
+
+type CertStatus struct {
+	Config      CertConfig `json:"config"`
+	Path        string     `json:"path"`
+	Domain      string     `json:"domain"`
+	Subject     string     `json:"subject,omitempty"`
+	Issuer      string     `json:"issuer,omitempty"`
+	DNSNames    []string   `json:"dns_names,omitempty"`
+	NotBefore   string     `json:"not_before,omitempty"`
+	NotAfter    string     `json:"not_after,omitempty"`
+	DaysLeft    int        `json:"days_left"`
+	SelfSigned  bool       `json:"self_signed"`
+	LastCheck   string     `json:"last_check,omitempty"`
+	LastRenewal string     `json:"last_renewal,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	// true selama penggantian sertifikat berjalan di background
+	Renewing bool `json:"renewing"`
+}
+
+// certState menyimpan hasil pengecekan terakhir, dilindungi certStateMutex
+// agar status tetap bisa dibaca selama proses ACME berjalan.
+var certState struct {
+	lastCheck   time.Time
+	lastRenewal time.Time
+	lastError   string
+	running     bool
+	// renew manual yang sudah diterima tetapi belum selesai
+	pending int
+}
+
+var (
+	// certMutex memastikan hanya satu penggantian sertifikat berjalan
+	certMutex      sync.Mutex
+	certStateMutex sync.Mutex
+)
+
+func defaultCertConfig() CertConfig {
+	return CertConfig{
+		Mode:            CertModeSelfSigned,
+		RenewBeforeDays: 30,
+		ACMEDirectory:   acme.LetsEncryptURL,
+		ACMEHTTPPort:    80,
+	}
+}
+
+func loadCertConfig() (CertConfig, error) {
+	cfg := defaultCertConfig()
+	if err := loadJSONFile(CertConfigFile, &cfg); err != nil {
+		return defaultCertConfig(), err
+	}
+	return cfg, nil
+}
+
+func (c CertConfig) validate() error {
+	switch c.Mode {
+	case CertModeSelfSigned:
+	case CertModeACME:
+		u, err := url.Parse(c.ACMEDirectory)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return errors.New("acme_directory harus URL http(s) yang valid")
+		}
+		if c.ACMECAFile != "" {
+			if _, err := os.Stat(c.ACMECAFile); err != nil {
+				return errors.New("acme_ca_file tidak ditemukan")
+			}
+		}
+	default:
+		return errors.New("mode harus self-signed atau acme")
+	}
+	if c.RenewBeforeDays < 1 || c.RenewBeforeDays > 90 {
+		return errors.New("renew_before_days harus 1-90")
+	}
+	if c.ACMEHTTPPort < 0 || c.ACMEHTTPPort > 65535 {
+		return errors.New("acme_http_port tidak valid")
+	}
+	return nil
+}
+
+func readDomain() string {
+	if domainBytes, err := ioutil.ReadFile(DomainFile); err == nil {
+		return strings.TrimSpace(string(domainBytes))
+	}
+	return ""
+}
+
+// certPaths mengembalikan lokasi cert dan key yang dipakai core
+func certPaths() (string, string) {
+	certPath, keyPath := StateDir+"/zivpn.crt", StateDir+"/zivpn.key"
+	if config, err := loadConfig(); err == nil {
+		if config.Cert != "" {
+			certPath = config.Cert
+		}
+		if config.Key != "" {
+			keyPath = config.Key
+		}
+	}
+	return certPath, keyPath
+}
+
+func readCertificate(path string) (*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("file sertifikat bukan PEM CERTIFICATE")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// isSelfSigned tidak memakai CheckSignatureFrom karena cert self-signed
+// buatan installer bukan CA
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) &&
+		cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+// certRenewalReason mengembalikan alasan sertifikat perlu diganti, atau "" jika masih baik
+func certRenewalReason(cert *x509.Certificate, err error, cfg CertConfig, domain string, now time.Time) string {
+	if err != nil {
+		return "sertifikat tidak terbaca: " + err.Error()
+	}
+	if now.Add(time.Duration(cfg.RenewBeforeDays) * 24 * time.Hour).After(cert.NotAfter) {
+		return "sertifikat habis pada " + cert.NotAfter.Format("2006-01-02")
+	}
+	if domain != "" && cert.VerifyHostname(domain) != nil && cert.Subject.CommonName != domain {
+		return "domain berubah menjadi " + domain
+	}
+	if cfg.Mode == CertModeACME && isSelfSigned(cert) {
+		return "mode acme tapi sertifikat masih self-signed"
+	}
+	return ""
+}
+
+func generateSelfSigned(domain string) (certPEM, keyPEM []byte, err error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Country:            []string{"ID"},
+			Province:           []string{"JawaBarat"},
+			Locality:           []string{"Bandung"},
+			Organization:       []string{"Ris-Project"},
+			OrganizationalUnit: []string{"IT"},
+			CommonName:         domain,
+		},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(SelfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	if ip := net.ParseIP(domain); ip != nil {
+		tmpl.IPAddresses = []net.IP{ip}
+	} else if domain != "" {
+		tmpl.DNSNames = []string{domain}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return certPEM, keyPEM, nil
+}
+
+// http01Solver menyajikan jawaban challenge http-01 pada port sementara
+type http01Solver struct {
+	port   int
+	mu     sync.Mutex
+	tokens map[string]string
+	srv    *http.Server
+}
+
+func (s *http01Solver) Present(token, keyAuth string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tokens == nil {
+		s.tokens = make(map[string]string)
+	}
+	s.tokens[token] = keyAuth
+	if s.srv != nil {
+		return nil
+	}
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+	if err != nil {
+		return fmt.Errorf("gagal membuka port %d untuk challenge ACME: %v", s.port, err)
+	}
+	s.srv = &http.Server{
+		ReadHeaderTimeout: 10 * time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := strings.TrimPrefix(r.URL.Path, "/.well-known/acme-challenge/")
+			s.mu.Lock()
+			keyAuth, ok := s.tokens[token]
+			s.mu.Unlock()
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain")
+			io.WriteString(w, keyAuth)
+		}),
+	}
+	go s.srv.Serve(ln)
+	return nil
+}
+
+func (s *http01Solver) CleanUp(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, token)
+}
+
+func (s *http01Solver) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.srv != nil {
+		s.srv.Close()
+		s.srv = nil
+	}
+}
+
+func loadACMEAccountKey() (*ecdsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(ACMEAccountKeyFile)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("kunci akun ACME tidak valid")
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	key, err := acme.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(ACMEAccountKeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func obtainACMECertificate(cfg CertConfig, domain string) (certPEM, keyPEM []byte, err error) {
+	if domain == "" || net.ParseIP(domain) != nil {
+		return nil, nil, errors.New("ACME membutuhkan domain (bukan IP) di " + DomainFile)
+	}
+	accountKey, err := loadACMEAccountKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	if cfg.ACMECAFile != "" {
+		pemData, err := ioutil.ReadFile(cfg.ACMECAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pemData) {
+			return nil, nil, errors.New("acme_ca_file tidak berisi sertifikat PEM")
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+		httpClient.Transport = transport
+	}
+
+	certKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+	port := cfg.ACMEHTTPPort
+	if port == 0 {
+		port = 80
+	}
+	solver := &http01Solver{port: port}
+	defer solver.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), ACMETimeout)
+	defer cancel()
+	ac := &acme.Client{
+		DirectoryURL: cfg.ACMEDirectory,
+		Key:          accountKey,
+		Email:        cfg.ACMEEmail,
+		HTTPClient:   httpClient,
+	}
+	certPEM, err = ac.ObtainCertificate(ctx, []string{domain}, certKey, solver)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(certKey)})
+	return certPEM, keyPEM, nil
+}
+
+// renewCertificate mengganti sertifikat jika perlu (atau jika force) lalu
+// merestart core satu kali. Mengembalikan true jika sertifikat diganti.
+func renewCertificate(force bool) (bool, error) {
+	certMutex.Lock()
+	defer certMutex.Unlock()
+
+	now := time.Now()
+	certStateMutex.Lock()
+	certState.running = true
+	certStateMutex.Unlock()
+
+	renewed, err := replaceCertificate(force, now)
+
+	certStateMutex.Lock()
+	certState.running = false
+	certState.lastCheck = now
+	if renewed {
+		certState.lastRenewal = now
+	}
+	certState.lastError = ""
+	if err != nil {
+		certState.lastError = err.Error()
+	}
+	certStateMutex.Unlock()
+	return renewed, err
+}
+
+// replaceCertificate berisi langkah renewCertificate, dipanggil dengan
+// certMutex terkunci.
+func replaceCertificate(force bool, now time.Time) (bool, error) {
+	cfg, err := loadCertConfig()
+	if err != nil {
+		return false, err
+	}
+	domain := readDomain()
+	certPath, keyPath := certPaths()
+	current, readErr := readCertificate(certPath)
+	reason := certRenewalReason(current, readErr, cfg, domain, now)
+	if force && reason == "" {
+		reason = "diminta manual"
+	}
+	if reason == "" {
+		return false, nil
+	}
+	log.Printf("Mengganti sertifikat (%s): %s", cfg.Mode, reason)
+
+	var certPEM, keyPEM []byte
+	mode := cfg.Mode
+	if cfg.Mode == CertModeACME {
+		certPEM, keyPEM, err = obtainACMECertificate(cfg, domain)
+		if err != nil {
+			log.Printf("ACME gagal: %v", err)
+			events.publish("cert.renew_failed", map[string]string{"mode": mode, "error": err.Error()})
+			// Sertifikat lama yang masih berlaku tetap dipakai, hanya
+			// sertifikat rusak/kadaluarsa yang diganti self-signed
+			if readErr == nil && now.Before(current.NotAfter) {
+				return false, err
+			}
+			mode = CertModeSelfSigned
+		}
+	}
+	if mode == CertModeSelfSigned {
+		if certPEM, keyPEM, err = generateSelfSigned(domain); err != nil {
+			return false, err
+		}
+	}
+
+	// Key ditulis dulu; core baru membaca keduanya saat restart
+	if err := writeFileAtomic(keyPath, keyPEM, 0600); err != nil {
+		return false, err
+	}
+	if err := writeFileAtomic(certPath, certPEM, 0644); err != nil {
+		return false, err
+	}
+
+	renewed, _ := readCertificate(certPath)
+	notAfter := ""
+	if renewed != nil {
+		notAfter = renewed.NotAfter.Format(time.RFC3339)
+	}
+	events.publish("cert.renewed", map[string]string{
+		"mode":      mode,
+		"domain":    domain,
+		"not_after": notAfter,
+		"reason":    reason,
+	})
+	if err := restartService(); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+func watchCertificate() {
+	for {
+		if _, err := renewCertificate(false); err != nil {
+			log.Printf("Gagal memperbarui sertifikat: %v", err)
+		}
+		time.Sleep(CertCheckInterval)
+	}
+}
+
+func certStatus() CertStatus {
+	cfg, _ := loadCertConfig()
+	certPath, _ := certPaths()
+	status := CertStatus{Config: cfg, Path: certPath, Domain: readDomain()}
+
+	certStateMutex.Lock()
+	if !certState.lastCheck.IsZero() {
+		status.LastCheck = certState.lastCheck.Format(time.RFC3339)
+	}
+	if !certState.lastRenewal.IsZero() {
+		status.LastRenewal = certState.lastRenewal.Format(time.RFC3339)
+	}
+	status.LastError = certState.lastError
+	status.Renewing = certState.running || certState.pending > 0
+	certStateMutex.Unlock()
+
+	cert, err := readCertificate(certPath)
+	if err != nil {
+		if status.LastError == "" {
+			status.LastError = err.Error()
+		}
+		return status
+	}
+	status.Subject = cert.Subject.CommonName
+	status.Issuer = cert.Issuer.CommonName
+	status.DNSNames = cert.DNSNames
+	status.NotBefore = cert.NotBefore.Format(time.RFC3339)
+	status.NotAfter = cert.NotAfter.Format(time.RFC3339)
+	status.DaysLeft = int(time.Until(cert.NotAfter).Hours() / 24)
+	status.SelfSigned = isSelfSigned(cert)
+	return status
+}
+
+func certHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		jsonResponse(w, http.StatusOK, true, "Status sertifikat", certStatus())
+	case http.MethodPost:
+		cfg := defaultCertConfig()
+		if !decodeJSON(w, r, &cfg) {
+			return
+		}
+		if err := cfg.validate(); err != nil {
+			jsonResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+			return
+		}
+		if isDryRun(r) {
+			certPath, _ := certPaths()
+			current, readErr := readCertificate(certPath)
+			reason := certRenewalReason(current, readErr, cfg, readDomain(), time.Now())
+			dryRunCert(w, reason != "", map[string]interface{}{CertConfigFile: cfg})
+			return
+		}
+		if err := saveJSONFile(CertConfigFile, cfg); err != nil {
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan konfigurasi sertifikat", nil)
+			return
+		}
+		// Pindah mode (misal ke acme) langsung diproses di background
+		go func() {
+			if _, err := renewCertificate(false); err != nil {
+				log.Printf("Gagal memperbarui sertifikat: %v", err)
+			}
+		}()
+		jsonResponse(w, http.StatusOK, true, "Konfigurasi sertifikat disimpan", cfg)
+	default:
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+	}
+}
+
+func renewCertHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	if isDryRun(r) {
+		dryRunCert(w, true, nil)
+		return
+	}
+
+	// ACME bisa lebih lama dari WriteTimeout server, jadi renew berjalan di
+	// background. Client memantau GET /api/cert sampai renewing=false lalu
+	// membaca last_renewal dan last_error.
+	certStateMutex.Lock()
+	if certState.pending > 0 {
+		certStateMutex.Unlock()
+		jsonResponse(w, http.StatusAccepted, true, "Renew sertifikat sudah berjalan", certStatus())
+		return
+	}
+	certState.pending++
+	certStateMutex.Unlock()
+
+	go func() {
+		if _, err := renewCertificate(true); err != nil {
+			log.Printf("Gagal memperbarui sertifikat: %v", err)
+		}
+		certStateMutex.Lock()
+		certState.pending--
+		certStateMutex.Unlock()
+	}()
+	jsonResponse(w, http.StatusAccepted, true, "Renew sertifikat dimulai, pantau GET /api/cert", certStatus())
+}
+
+// --- Settings ---
+
+type Settings struct {
+	Domain     string `json:"domain"`
+	Obfs       string `json:"obfs"`
+	ListenPort int    `json:"listen_port"`
+}
+
+// SettingsRequest memakai pointer agar field yang tidak dikirim tidak diubah
+type SettingsRequest struct {
+	Domain     *string `json:"domain"`
+	Obfs       *string `json:"obfs"`
+	ListenPort *int    `json:"listen_port"`
+}
+
+type AuditEntry struct {
+	Time   string      `json:"time"`
+	Action string      `json:"action"`
+	Source string      `json:"source"`
+	Actor  string      `json:"actor,omitempty"` // dari header X-Actor, misal "telegram:123456"
+	Detail interface{} `json:"detail,omitempty"`
+}
+
+// AuditRequest dipakai tool lain (misal bot) untuk mencatat aksinya sendiri.
+type AuditRequest struct {
+	Action string      `json:"action"`
+	Detail interface{} `json:"detail"`
+}
+
+type settingChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+func currentSettings() (Settings, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return Settings{}, err
+	}
+	port, _ := strconv.Atoi(listenPort())
+	return Settings{Domain: readDomain(), Obfs: config.Obfs, ListenPort: port}, nil
+}
+
+func validDomain(domain string) bool {
+	if net.ParseIP(domain) != nil {
+		return true
+	}
+	if len(domain) == 0 || len(domain) > 253 || !strings.Contains(domain, ".") {
+		return false
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (req SettingsRequest) validate() error {
+	if req.Domain != nil && !validDomain(strings.TrimSpace(*req.Domain)) {
+		return errors.New("domain tidak valid")
+	}
+	if req.Obfs != nil {
+		if *req.Obfs == "" || len(*req.Obfs) > 64 || strings.IndexFunc(*req.Obfs, func(r rune) bool { return r <= ' ' || r > '~' }) >= 0 {
+			return errors.New("obfs harus 1-64 karakter ASCII tanpa spasi")
+		}
+	}
+	if req.ListenPort != nil {
+		if *req.ListenPort < 1 || *req.ListenPort > 65535 || *req.ListenPort == apiPort {
+			return errors.New("listen_port harus 1-65535 dan bukan port API")
+		}
+	}
+	return nil
+}
+
+// recordAudit mencatat perubahan; harus dipanggil dengan mutex terkunci
+func recordAudit(r *http.Request, action string, detail interface{}) {
+	list := []AuditEntry{}
+	if err := loadJSONFile(AuditFile, &list); err != nil {
+		log.Printf("Gagal membaca audit log: %v", err)
+	}
+	source := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		source = host
+	}
+	// Actor hanya label dari client yang sudah memegang API key, bukan
+	// identitas yang diverifikasi
+	actor := strings.TrimSpace(r.Header.Get("X-Actor"))
+	if len(actor) > MaxActorLength {
+		actor = actor[:MaxActorLength]
+	}
+	list = append(list, AuditEntry{
+		Time:   time.Now().Format(time.RFC3339),
+		Action: action,
+		Source: source,
+		Actor:  actor,
+		Detail: detail,
+	})
+	if len(list) > MaxAuditEntries {
+		list = list[len(list)-MaxAuditEntries:]
+	}
+	if err := saveJSONFile(AuditFile, list); err != nil {
+		log.Printf("Gagal menulis audit log: %v", err)
+	}
+}
+
+func settingsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		settings, err := currentSettings()
+		if err != nil {
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca config", nil)
+			return
+		}
+		jsonResponse(w, http.StatusOK, true, "Settings", settings)
+	case http.MethodPost:
+		updateSettings(w, r)
+	default:
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+	}
+}
+
+func updateSettings(w http.ResponseWriter, r *http.Request) {
+	var req SettingsRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if err := req.validate(); err != nil {
+		jsonResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	before, err := currentSettings()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca config", nil)
+		return
+	}
+	config, err := loadConfig()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca config", nil)
+		return
+	}
+
+	changes := map[string]settingChange{}
+	if req.Domain != nil && strings.TrimSpace(*req.Domain) != before.Domain {
+		domain := strings.TrimSpace(*req.Domain)
+		changes["domain"] = settingChange{before.Domain, domain}
+	}
+	if req.Obfs != nil && *req.Obfs != before.Obfs {
+		changes["obfs"] = settingChange{before.Obfs, *req.Obfs}
+		config.Obfs = *req.Obfs
+	}
+	if req.ListenPort != nil && *req.ListenPort != before.ListenPort {
+		if hop, err := loadPortHopConfig(); err == nil && hop.Enabled && *req.ListenPort >= hop.Start && *req.ListenPort <= hop.End {
+			jsonResponse(w, http.StatusBadRequest, false, fmt.Sprintf("listen_port berada di rentang port hopping %d-%d", hop.Start, hop.End), nil)
+			return
+		}
+		changes["listen_port"] = settingChange{before.ListenPort, *req.ListenPort}
+		host, _, _ := net.SplitHostPort(config.Listen)
+		config.Listen = net.JoinHostPort(host, strconv.Itoa(*req.ListenPort))
+	}
+	if len(changes) == 0 {
+		jsonResponse(w, http.StatusOK, true, "Tidak ada perubahan", before)
+		return
+	}
+
+	_, obfsChanged := changes["obfs"]
+	_, portChanged := changes["listen_port"]
+	if isDryRun(r) {
+		extra := map[string][]byte{}
+		if _, ok := changes["domain"]; ok {
+			extra[filepath.Base(DomainFile)] = []byte(strings.TrimSpace(*req.Domain) + "\n")
+		}
+		var newConfig *Config
+		if obfsChanged || portChanged {
+			newConfig = &config
+		}
+		dryRunResponse(w, newConfig, nil, extra)
+		return
+	}
+
+	if _, ok := changes["domain"]; ok {
+		if err := writeFileAtomic(DomainFile, []byte(strings.TrimSpace(*req.Domain)+"\n"), 0644); err != nil {
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan domain", nil)
+			return
+		}
+	}
+	if obfsChanged || portChanged {
+		if err := saveConfig(config); err != nil {
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan config", nil)
+			return
+		}
+		snapshotChange("settings.update")
+	}
+	recordAudit(r, "settings.update", changes)
+
+	if portChanged {
+		// Target DNAT dan counter kuota mengikuti port listen yang baru
+		if cfg, err := loadPortHopConfig(); err == nil {
+			if _, err := ensurePortHop(cfg); err != nil {
+				log.Printf("Gagal memperbarui rule port hopping: %v", err)
+			}
+		}
+		meter.ready = false
+	}
+
+	// Domain baru butuh sertifikat baru. renewCertificate sudah merestart
+	// core, jadi restart di bawah hanya dilakukan jika belum terjadi.
+	restarted := false
+	if _, ok := changes["domain"]; ok {
+		if cfg, _ := loadCertConfig(); cfg.Mode == CertModeACME {
+			// ACME bisa lebih lama dari timeout request
+			go func() {
+				if _, err := renewCertificate(false); err != nil {
+					log.Printf("Gagal memperbarui sertifikat: %v", err)
+				}
+			}()
+		} else {
+			renewed, err := renewCertificate(false)
+			if err != nil && !renewed {
+				jsonResponse(w, http.StatusInternalServerError, false, "Gagal membuat sertifikat untuk domain baru", nil)
+				return
+			}
+			if err != nil {
+				jsonResponse(w, http.StatusInternalServerError, false, "Gagal merestart service", nil)
+				return
+			}
+			restarted = renewed
+		}
+	}
+	if (obfsChanged || portChanged) && !restarted {
+		if err := restartService(); err != nil {
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal merestart service", nil)
+			return
+		}
+	}
+
+	after, _ := currentSettings()
+	events.publish("settings.updated", changes)
+	jsonResponse(w, http.StatusOK, true, "Settings berhasil diperbarui", after)
+}
+
+func auditHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		listAudit(w, r)
+	case http.MethodPost:
+		appendAudit(w, r)
+	default:
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+	}
+}
+
+// appendAudit mencatat aksi dari luar API, misal aksi admin di bot.
+func appendAudit(w http.ResponseWriter, r *http.Request) {
+	var req AuditRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Action) == "" {
+		jsonResponse(w, http.StatusBadRequest, false, "action harus diisi", nil)
+		return
+	}
+	mutex.Lock()
+	recordAudit(r, req.Action, req.Detail)
+	mutex.Unlock()
+	jsonResponse(w, http.StatusOK, true, "Audit dicatat", nil)
+}
+
+func listAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+
+	mutex.Lock()
+	list := []AuditEntry{}
+	err := loadJSONFile(AuditFile, &list)
+	mutex.Unlock()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca audit log", nil)
+		return
+	}
+
+	// Terbaru di depan, bisa difilter dengan ?action=
+	action := r.URL.Query().Get("action")
+	out := []AuditEntry{}
+	for i := len(list) - 1; i >= 0; i-- {
+		if action == "" || list[i].Action == action {
+			out = append(out, list[i])
+		}
+	}
+	jsonResponse(w, http.StatusOK, true, "Audit log", out)
+}
+
+// --- Config History ---
+
+// Setiap penulisan config.json / users.db menyimpan snapshot kedua file
+// sekaligus di HistoryDir/<versi>, sehingga rollback selalu konsisten.
+type HistoryVersion struct {
+	Version    int    `json:"version"`
+	CreatedAt  string `json:"created_at"`
+	Trigger    string `json:"trigger"`
+	Users      int    `json:"users"`
+	RollbackOf int    `json:"rollback_of,omitempty"`
+}
+
+type HistoryPolicy struct {
+	Retention int `json:"retention"`
+}
+
+type ConfigHistory struct {
+	Retention int              `json:"retention"`
+	Versions  []HistoryVersion `json:"versions"`
+}
+
+type FileDiff struct {
+	File    string   `json:"file"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// ConfigDiff membandingkan dua versi; versi 0 berarti file saat ini
+type ConfigDiff struct {
+	From  int        `json:"from"`
+	To    int        `json:"to"`
+	Files []FileDiff `json:"files"`
+}
+
+var historyMutex = &sync.Mutex{}
+
+var historyFiles = []string{filepath.Base(ConfigFile), filepath.Base(UserDB)}
+
+func loadHistoryPolicy() HistoryPolicy {
+	policy := HistoryPolicy{Retention: DefaultHistoryRetention}
+	if err := loadJSONFile(HistoryFile, &policy); err != nil {
+		log.Printf("Gagal membaca %s: %v", HistoryFile, err)
+	}
+	return policy
+}
+
+func (p HistoryPolicy) validate() error {
+	if p.Retention < 1 || p.Retention > MaxHistoryRetention {
+		return fmt.Errorf("retention harus 1-%d", MaxHistoryRetention)
+	}
+	return nil
+}
+
+// historyVersions mengembalikan semua snapshot, terlama di depan
+func historyVersions() ([]HistoryVersion, error) {
+	entries, err := ioutil.ReadDir(HistoryDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []HistoryVersion{}, nil
+		}
+		return nil, err
+	}
+	versions := []HistoryVersion{}
+	for _, fi := range entries {
+		n, err := strconv.Atoi(fi.Name())
+		if err != nil || !fi.IsDir() {
+			continue
+		}
+		v := HistoryVersion{Version: n}
+		if err := loadJSONFile(filepath.Join(HistoryDir, fi.Name(), "meta.json"), &v); err != nil {
+			log.Printf("Meta snapshot %d rusak: %v", n, err)
+		}
+		v.Version = n
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	return versions, nil
+}
+
+// readSnapshot membaca isi config.json dan users.db dari satu versi.
+// Versi 0 membaca file yang sedang dipakai.
+func readSnapshot(version int) (map[string][]byte, error) {
+	dir := StateDir
+	if version != 0 {
+		dir = filepath.Join(HistoryDir, strconv.Itoa(version))
+		if _, err := os.Stat(dir); err != nil {
+			return nil, err
+		}
+	}
+	files := make(map[string][]byte)
+	for _, name := range historyFiles {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		files[name] = data
+	}
+	return files, nil
+}
+
+// snapshotState menyimpan kondisi config.json dan users.db saat ini sebagai
+// versi baru, kecuali isinya sama dengan versi terakhir. Mengembalikan
+// nomor versi baru, atau 0 jika tidak ada perubahan.
+func snapshotState(trigger string, rollbackOf int) (int, error) {
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+
+	current, err := readSnapshot(0)
+	if err != nil {
+		return 0, err
+	}
+	versions, err := historyVersions()
+	if err != nil {
+		return 0, err
+	}
+	next := 1
+	if len(versions) > 0 {
+		latest := versions[len(versions)-1].Version
+		if prev, err := readSnapshot(latest); err == nil {
+			same := true
+			for _, name := range historyFiles {
+				if !bytes.Equal(prev[name], current[name]) {
+					same = false
+				}
+			}
+			if same {
+				return 0, nil
+			}
+		}
+		next = latest + 1
+	} else {
+		trigger = "baseline"
+	}
+
+	if err := os.MkdirAll(HistoryDir, 0700); err != nil {
+		return 0, err
+	}
+	staging, err := ioutil.TempDir(HistoryDir, ".snapshot-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(staging)
+	for _, name := range historyFiles {
+		if err := ioutil.WriteFile(filepath.Join(staging, name), current[name], 0600); err != nil {
+			return 0, err
+		}
+	}
+	users := 0
+	for _, line := range strings.Split(string(current[filepath.Base(UserDB)]), "\n") {
+		if strings.TrimSpace(line) != "" {
+			users++
+		}
+	}
+	meta := HistoryVersion{
+		Version:    next,
+		CreatedAt:  time.Now().Format(time.RFC3339),
+		Trigger:    trigger,
+		Users:      users,
+		RollbackOf: rollbackOf,
+	}
+	if err := saveJSONFile(filepath.Join(staging, "meta.json"), meta); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(staging, filepath.Join(HistoryDir, strconv.Itoa(next))); err != nil {
+		return 0, err
+	}
+
+	versions = append(versions, meta)
+	if retention := loadHistoryPolicy().Retention; len(versions) > retention {
+		for _, v := range versions[:len(versions)-retention] {
+			os.RemoveAll(filepath.Join(HistoryDir, strconv.Itoa(v.Version)))
+		}
+	}
+	return next, nil
+}
+
+// writeVersioned menulis file state yang diversikan. Perubahan di luar API
+// (edit manual, script installer) disimpan dulu sebagai versi tersendiri
+// agar tetap bisa dikembalikan. Versi hasil perubahan dicatat pemanggil
+// lewat snapshotChange setelah semua file ditulis.
+func writeVersioned(path string, data []byte) error {
+	if _, err := snapshotState("external", 0); err != nil {
+		log.Printf("Gagal menyimpan snapshot config: %v", err)
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+// snapshotChange menyimpan satu versi untuk satu perubahan utuh, agar
+// config.json dan users.db di setiap versi selalu konsisten
+func snapshotChange(trigger string) {
+	if _, err := snapshotState(trigger, 0); err != nil {
+		log.Printf("Gagal menyimpan snapshot config: %v", err)
+	}
+}
+
+// diffLines membandingkan baris tanpa memperhatikan urutan; baris yang
+// sama di kedua sisi (termasuk duplikat) saling meniadakan.
+func diffLines(name string, before, after []byte) FileDiff {
+	diff := FileDiff{File: name, Added: []string{}, Removed: []string{}}
+	count := make(map[string]int)
+	for _, line := range strings.Split(string(before), "\n") {
+		if strings.TrimSpace(line) != "" {
+			count[line]++
+		}
+	}
+	for _, line := range strings.Split(string(after), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if count[line] > 0 {
+			count[line]--
+			continue
+		}
+		diff.Added = append(diff.Added, line)
+	}
+	for _, line := range strings.Split(string(before), "\n") {
+		if count[line] > 0 {
+			count[line]--
+			diff.Removed = append(diff.Removed, line)
+		}
+	}
+	return diff
+}
+
+func diffSnapshots(from, to int) (ConfigDiff, error) {
+	before, err := readSnapshot(from)
+	if err != nil {
+		return ConfigDiff{}, err
+	}
+	after, err := readSnapshot(to)
+	if err != nil {
+		return ConfigDiff{}, err
+	}
+	diff := ConfigDiff{From: from, To: to, Files: []FileDiff{}}
+	for _, name := range historyFiles {
+		diff.Files = append(diff.Files, diffLines(name, before[name], after[name]))
+	}
+	return diff, nil
+}
+
+func configHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		historyMutex.Lock()
+		versions, err := historyVersions()
+		historyMutex.Unlock()
+		if err != nil {
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca riwayat config", nil)
+			return
+		}
+		// Terbaru di depan
+		for i, j := 0, len(versions)-1; i < j; i, j = i+1, j-1 {
+			versions[i], versions[j] = versions[j], versions[i]
+		}
+		jsonResponse(w, http.StatusOK, true, "Riwayat config", ConfigHistory{
+			Retention: loadHistoryPolicy().Retention,
+			Versions:  versions,
+		})
+	case http.MethodPost:
+		var policy HistoryPolicy
+		if !decodeJSON(w, r, &policy) {
+			return
+		}
+		if err := policy.validate(); err != nil {
+			jsonResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+			return
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		old := loadHistoryPolicy()
+		if err := saveJSONFile(HistoryFile, policy); err != nil {
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan retention", nil)
+			return
+		}
+		recordAudit(r, "history.retention", settingChange{old.Retention, policy.Retention})
+		jsonResponse(w, http.StatusOK, true, "Retention riwayat config disimpan", policy)
+	default:
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+	}
+}
+
+// configDiff menangani /api/config/diff?from=N&to=M, to kosong = file saat ini
+func configDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	query := r.URL.Query()
+	from, err := strconv.Atoi(query.Get("from"))
+	if err != nil || from < 1 {
+		jsonResponse(w, http.StatusBadRequest, false, "Parameter from harus nomor versi", nil)
+		return
+	}
+	to := 0
+	if s := query.Get("to"); s != "" {
+		if to, err = strconv.Atoi(s); err != nil || to < 0 {
+			jsonResponse(w, http.StatusBadRequest, false, "Parameter to harus nomor versi", nil)
+			return
+		}
+	}
+
+	historyMutex.Lock()
+	diff, err := diffSnapshots(from, to)
+	historyMutex.Unlock()
+	if err != nil {
+		if os.IsNotExist(err) {
+			jsonResponse(w, http.StatusNotFound, false, "Versi tidak ditemukan", nil)
+			return
+		}
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca snapshot", nil)
+		return
+	}
+	jsonResponse(w, http.StatusOK, true, "Perbedaan config", diff)
+}
+
+// rollbackConfig menangani /api/config/rollback/{version}
+func rollbackConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	version, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/config/rollback/"))
+	if err != nil || version < 1 {
+		jsonResponse(w, http.StatusNotFound, false, "Versi tidak ditemukan", nil)
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	historyMutex.Lock()
+	target, err := readSnapshot(version)
+	historyMutex.Unlock()
+	if err != nil {
+		if os.IsNotExist(err) {
+			jsonResponse(w, http.StatusNotFound, false, "Versi tidak ditemukan", nil)
+			return
+		}
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca snapshot", nil)
+		return
+	}
+	var cfg Config
+	if err := json.Unmarshal(target[filepath.Base(ConfigFile)], &cfg); err != nil {
+		jsonResponse(w, http.StatusConflict, false, "Snapshot config tidak valid", nil)
+		return
+	}
+
+	oldPort := listenPort()
+	historyMutex.Lock()
+	diff, err := diffSnapshots(0, version)
+	historyMutex.Unlock()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca snapshot", nil)
+		return
+	}
+	changed := false
+	for _, f := range diff.Files {
+		if len(f.Added) > 0 || len(f.Removed) > 0 {
+			changed = true
+		}
+	}
+	if !changed {
+		jsonResponse(w, http.StatusOK, true, "Config sudah sama dengan versi tersebut", diff)
+		return
+	}
+	if isDryRun(r) {
+		jsonResponse(w, http.StatusOK, true, "Dry run: tidak ada file yang ditulis", DryRunResult{
+			DryRun:  true,
+			Restart: true,
+			Files:   diff.Files,
+		})
+		return
+	}
+
+	previous, err := readSnapshot(0)
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca config", nil)
+		return
+	}
+	// Simpan dulu kondisi sekarang agar rollback sendiri bisa dibatalkan
+	if _, err := snapshotState("external", 0); err != nil {
+		log.Printf("Gagal menyimpan snapshot config: %v", err)
+	}
+	for i, name := range historyFiles {
+		if err := writeFileAtomic(filepath.Join(StateDir, name), target[name], 0644); err != nil {
+			// Kembalikan file yang sudah terlanjur ditulis
+			for _, done := range historyFiles[:i] {
+				writeFileAtomic(filepath.Join(StateDir, done), previous[done], 0644)
+			}
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal menulis "+name+", rollback dibatalkan", nil)
+			return
+		}
+	}
+	newVersion, err := snapshotState("rollback", version)
+	if err != nil {
+		log.Printf("Gagal menyimpan snapshot config: %v", err)
+	}
+	recordAudit(r, "config.rollback", map[string]int{"version": version, "new_version": newVersion})
+
+	if listenPort() != oldPort {
+		if cfg, err := loadPortHopConfig(); err == nil {
+			if _, err := ensurePortHop(cfg); err != nil {
+				log.Printf("Gagal memperbarui rule port hopping: %v", err)
+			}
+		}
+		meter.ready = false
+	}
+	events.publish("config.rolled_back", map[string]int{"version": version, "new_version": newVersion})
+
+	if err := restartService(); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Rollback berhasil tetapi gagal merestart service", diff)
+		return
+	}
+	jsonResponse(w, http.StatusOK, true, fmt.Sprintf("Config dikembalikan ke versi %d", version), diff)
+}
+
+// --- Dry Run ---
+
+// Semua handler yang mengubah state menerima ?dry_run=true: validasi tetap
+// dijalankan, tetapi yang dikembalikan hanya perubahan yang akan terjadi.
+type DryRunResult struct {
+	DryRun  bool       `json:"dry_run"`
+	Restart bool       `json:"restart"`
+	Files   []FileDiff `json:"files"`
+	// File lain yang akan ditimpa (isi tidak ditampilkan, misalnya key)
+	Replaced []string `json:"replaced,omitempty"`
+	// File state yang akan dihapus (restore dari arsip tanpa file tersebut)
+	Removed []string `json:"removed,omitempty"`
+}
+
+func isDryRun(r *http.Request) bool {
+	dry, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	return dry
+}
+
+// planChanges membandingkan isi baru (nama file di StateDir -> isi) dengan
+// file saat ini. Diff baris hanya untuk file teks state, file lain cukup
+// dicantumkan di Replaced jika isinya berbeda.
+func planChanges(files map[string][]byte) (DryRunResult, error) {
+	result := DryRunResult{DryRun: true, Restart: true, Files: []FileDiff{}}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		current, err := ioutil.ReadFile(filepath.Join(StateDir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return result, err
+		}
+		switch name {
+		case filepath.Base(ConfigFile), filepath.Base(UserDB), filepath.Base(DomainFile):
+			result.Files = append(result.Files, diffLines(name, current, files[name]))
+		default:
+			if !bytes.Equal(current, files[name]) {
+				result.Replaced = append(result.Replaced, name)
+			}
+		}
+	}
+	return result, nil
+}
+
+// dryRunResponse mengirim diff config.json dan/atau users.db yang akan
+// ditulis. Argumen nil berarti file tersebut tidak berubah.
+func dryRunResponse(w http.ResponseWriter, config *Config, users []string, extra map[string][]byte) {
+	files := map[string][]byte{}
+	for name, data := range extra {
+		files[name] = data
+	}
+	if config != nil {
+		data, err := encodeConfig(*config)
+		if err != nil {
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyusun config", nil)
+			return
+		}
+		files[filepath.Base(ConfigFile)] = data
+	}
+	if users != nil {
+		files[filepath.Base(UserDB)] = encodeUsers(users)
+	}
+	result, err := planChanges(files)
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca state", nil)
+		return
+	}
+	jsonResponse(w, http.StatusOK, true, "Dry run: tidak ada file yang ditulis", result)
+}
+
+// dryRunState seperti dryRunResponse, ditambah file JSON state (path ->
+// nilai baru yang akan ditulis saveJSONFile). restart menandai apakah
+// service zivpn akan direstart.
+func dryRunState(w http.ResponseWriter, restart bool, config *Config, users []string, files map[string]interface{}) {
+	result, err := planState(config, users, files)
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyusun dry run: "+err.Error(), nil)
+		return
+	}
+	result.Restart = restart
+	jsonResponse(w, http.StatusOK, true, "Dry run: tidak ada file yang ditulis", result)
+}
+
+// dryRunCert seperti dryRunState untuk perubahan sertifikat. Jika renew akan
+// terjadi, file cert dan key ikut tercantum di Replaced.
+func dryRunCert(w http.ResponseWriter, renew bool, files map[string]interface{}) {
+	result, err := planState(nil, nil, files)
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyusun dry run: "+err.Error(), nil)
+		return
+	}
+	result.Restart = renew
+	if renew {
+		certPath, keyPath := certPaths()
+		result.Replaced = append(result.Replaced, certPath, keyPath)
+	}
+	jsonResponse(w, http.StatusOK, true, "Dry run: tidak ada file yang ditulis", result)
+}
+
+func planState(config *Config, users []string, files map[string]interface{}) (DryRunResult, error) {
+	planned := map[string][]byte{}
+	if config != nil {
+		data, err := encodeConfig(*config)
+		if err != nil {
+			return DryRunResult{}, err
+		}
+		planned[filepath.Base(ConfigFile)] = data
+	}
+	if users != nil {
+		planned[filepath.Base(UserDB)] = encodeUsers(users)
+	}
+	result, err := planChanges(planned)
+	if err != nil {
+		return result, err
+	}
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		data, err := json.MarshalIndent(files[path], "", "  ")
+		if err != nil {
+			return result, err
+		}
+		current, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return result, err
+		}
+		result.Files = append(result.Files, diffLines(filepath.Base(path), current, data))
+	}
+	return result, nil
+}
+
+// --- UDPGW ---
+
+// UdpgwConfig mengikuti format /etc/udpgw/udpgw.json dari udpgw-only.sh
+type UdpgwConfig struct {
+	LogLevel             string `json:"LogLevel"`
+	UdpgwPort            int    `json:"UdpgwPort"`
+	DNSResolverIPAddress string `json:"DNSResolverIPAddress"`
+}
+
+type UdpgwStatus struct {
+	Installed   bool   `json:"installed"`
+	Status      string `json:"status"`
+	LogLevel    string `json:"log_level,omitempty"`
+	Port        int    `json:"port,omitempty"`
+	DNSResolver string `json:"dns_resolver,omitempty"`
+}
+
+// UdpgwRequest memakai pointer agar field yang tidak dikirim tidak diubah
+type UdpgwRequest struct {
+	LogLevel    *string `json:"log_level"`
+	Port        *int    `json:"port"`
+	DNSResolver *string `json:"dns_resolver"`
+}
+
+var udpgwLogLevels = []string{"debug", "info", "warn", "error"}
+
+// loadUdpgwConfig juga mengembalikan isi mentah file agar key lain yang
+// tidak dikenal API tetap dipertahankan saat disimpan ulang.
+func loadUdpgwConfig() (UdpgwConfig, map[string]interface{}, error) {
+	var cfg UdpgwConfig
+	data, err := ioutil.ReadFile(UdpgwConfigFile)
+	if err != nil {
+		return cfg, nil, err
+	}
+	raw := map[string]interface{}{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return cfg, nil, err
+	}
+	err = json.Unmarshal(data, &cfg)
+	return cfg, raw, err
+}
+
+func encodeUdpgwConfig(cfg UdpgwConfig, raw map[string]interface{}) ([]byte, error) {
+	raw["LogLevel"] = cfg.LogLevel
+	raw["UdpgwPort"] = cfg.UdpgwPort
+	raw["DNSResolverIPAddress"] = cfg.DNSResolverIPAddress
+	data, err := json.MarshalIndent(raw, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func serviceStatus(service string) string {
+	out, _ := exec.Command("systemctl", "is-active", service).Output()
+	if status := strings.TrimSpace(string(out)); status != "" {
+		return status
+	}
+	return "unknown"
+}
+
+func (req UdpgwRequest) validate() error {
+	if req.LogLevel != nil {
+		valid := false
+		for _, level := range udpgwLogLevels {
+			if *req.LogLevel == level {
+				valid = true
+			}
+		}
+		if !valid {
+			return fmt.Errorf("log_level harus salah satu dari %s", strings.Join(udpgwLogLevels, ", "))
+		}
+	}
+	if req.Port != nil {
+		if *req.Port < 1 || *req.Port > 65535 || *req.Port == apiPort {
+			return errors.New("port harus 1-65535 dan bukan port API")
+		}
+		if strconv.Itoa(*req.Port) == listenPort() {
+			return errors.New("port sudah dipakai oleh core zivpn")
+		}
+	}
+	if req.DNSResolver != nil && net.ParseIP(*req.DNSResolver) == nil {
+		return errors.New("dns_resolver harus berupa alamat IP")
+	}
+	return nil
+}
+
+func udpgwStatus() UdpgwStatus {
+	cfg, _, err := loadUdpgwConfig()
+	if err != nil {
+		return UdpgwStatus{Status: "not_installed"}
+	}
+	return UdpgwStatus{
+		Installed:   true,
+		Status:      serviceStatus(UdpgwService),
+		LogLevel:    cfg.LogLevel,
+		Port:        cfg.UdpgwPort,
+		DNSResolver: cfg.DNSResolverIPAddress,
+	}
+}
+
+// allowUdpgwPort membuka port baru di firewall seperti udpgw-only.sh.
+// Rule port lama dibiarkan, gagal di sini hanya dicatat.
+func allowUdpgwPort(port int) {
+	p := strconv.Itoa(port)
+	if _, err := exec.LookPath("iptables"); err == nil {
+		if exec.Command("iptables", "-C", "INPUT", "-p", "udp", "--dport", p, "-j", "ACCEPT").Run() != nil {
+			if out, err := exec.Command("iptables", "-A", "INPUT", "-p", "udp", "--dport", p, "-j", "ACCEPT").CombinedOutput(); err != nil {
+				log.Printf("Gagal membuka port UDPGW %s: %v: %s", p, err, strings.TrimSpace(string(out)))
+			}
+		}
+		exec.Command("netfilter-persistent", "save").Run()
+	}
+	if _, err := exec.LookPath("ufw"); err == nil {
+		exec.Command("ufw", "allow", p+"/udp").Run()
+	}
+}
+
+func restartUdpgw() error {
+	if err := exec.Command("systemctl", "restart", UdpgwService).Run(); err != nil {
+		events.publish("service.restart_failed", map[string]string{
+			"service": "udpgw",
+			"error":   err.Error(),
+		})
+		return err
+	}
+	events.publish("service.restarted", map[string]string{
+		"service": "udpgw",
+	})
+	return nil
+}
+
+func udpgwHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		jsonResponse(w, http.StatusOK, true, "Status UDPGW", udpgwStatus())
+	case http.MethodPost:
+		updateUdpgw(w, r)
+	default:
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+	}
+}
+
+func updateUdpgw(w http.ResponseWriter, r *http.Request) {
+	var req UdpgwRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if err := req.validate(); err != nil {
+		jsonResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	cfg, raw, err := loadUdpgwConfig()
+	if err != nil {
+		if os.IsNotExist(err) {
+			jsonResponse(w, http.StatusNotFound, false, "UDPGW belum terpasang, jalankan udpgw-only.sh", nil)
+			return
+		}
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca config UDPGW", nil)
+		return
+	}
+
+	changes := map[string]settingChange{}
+	if req.LogLevel != nil && *req.LogLevel != cfg.LogLevel {
+		changes["log_level"] = settingChange{cfg.LogLevel, *req.LogLevel}
+		cfg.LogLevel = *req.LogLevel
+	}
+	if req.Port != nil && *req.Port != cfg.UdpgwPort {
+		changes["port"] = settingChange{cfg.UdpgwPort, *req.Port}
+		cfg.UdpgwPort = *req.Port
+	}
+	if req.DNSResolver != nil && *req.DNSResolver != cfg.DNSResolverIPAddress {
+		changes["dns_resolver"] = settingChange{cfg.DNSResolverIPAddress, *req.DNSResolver}
+		cfg.DNSResolverIPAddress = *req.DNSResolver
+	}
+	if len(changes) == 0 {
+		jsonResponse(w, http.StatusOK, true, "Tidak ada perubahan", udpgwStatus())
+		return
+	}
+
+	data, err := encodeUdpgwConfig(cfg, raw)
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyusun config UDPGW", nil)
+		return
+	}
+	if isDryRun(r) {
+		current, _ := ioutil.ReadFile(UdpgwConfigFile)
+		jsonResponse(w, http.StatusOK, true, "Dry run: tidak ada file yang ditulis", DryRunResult{
+			DryRun:  true,
+			Restart: true,
+			Files:   []FileDiff{diffLines(filepath.Base(UdpgwConfigFile), current, data)},
+		})
+		return
+	}
+	if err := writeFileAtomic(UdpgwConfigFile, data, 0644); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan config UDPGW", nil)
+		return
+	}
+	recordAudit(r, "udpgw.update", changes)
+	if _, ok := changes["port"]; ok {
+		allowUdpgwPort(cfg.UdpgwPort)
+	}
+	events.publish("udpgw.updated", changes)
+
+	if err := restartUdpgw(); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Config tersimpan tetapi gagal merestart UDPGW", udpgwStatus())
+		return
+	}
+	jsonResponse(w, http.StatusOK, true, "Config UDPGW diperbarui", udpgwStatus())
+}
+
+func restartUdpgwHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	if _, err := os.Stat(UdpgwConfigFile); err != nil {
+		jsonResponse(w, http.StatusNotFound, false, "UDPGW belum terpasang, jalankan udpgw-only.sh", nil)
+		return
+	}
+	if isDryRun(r) {
+		jsonResponse(w, http.StatusOK, true, "Dry run: UDPGW tidak direstart", DryRunResult{DryRun: true, Restart: true, Files: []FileDiff{}})
+		return
+	}
+	if err := restartUdpgw(); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal merestart UDPGW", udpgwStatus())
+		return
+	}
+	jsonResponse(w, http.StatusOK, true, "UDPGW direstart", udpgwStatus())
+}
+
+// --- Reseller ---
+
+// Reseller memakai API key sendiri, atau bot (dengan master key) bertindak
+// atas namanya lewat header X-Reseller-Telegram. Setiap create/renew
+// memotong Credit sebesar PricePerDay x hari.
+type Reseller struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	TelegramID  int64  `json:"telegram_id,omitempty"`
+	KeyHash     string `json:"key_hash,omitempty"` // SHA-256 API key, tidak pernah dikirim ke client
+	Credit      int64  `json:"credit"`
+	PricePerDay int64  `json:"price_per_day"`
+	Disabled    bool   `json:"disabled"`
+	CreatedAt   string `json:"created_at"`
+	Users       int    `json:"users,omitempty"`
+}
+
+type LedgerEntry struct {
+	ID       int64  `json:"id"`
+	Time     string `json:"time"`
+	Reseller string `json:"reseller"`
+	Type     string `json:"type"` // topup, create, renew, refund
+	Amount   int64  `json:"amount"`
+	Balance  int64  `json:"balance"`
+	Password string `json:"password,omitempty"`
+	Days     int    `json:"days,omitempty"`
+	Note     string `json:"note,omitempty"`
+}
+
+type ResellerRequest struct {
+	ID          string  `json:"id"`
+	Name        *string `json:"name"`
+	TelegramID  *int64  `json:"telegram_id"`
+	PricePerDay *int64  `json:"price_per_day"`
+	Credit      int64   `json:"credit"` // hanya untuk create
+	Disabled    *bool   `json:"disabled"`
+}
+
+type TopUpRequest struct {
+	ID     string `json:"id"`
+	Amount int64  `json:"amount"`
+	Note   string `json:"note"`
+}
+
+type ResellerKey struct {
+	Reseller Reseller `json:"reseller"`
+	APIKey   string   `json:"api_key"`
+}
+
+type ResellerProfile struct {
+	Reseller Reseller      `json:"reseller"`
+	Ledger   []LedgerEntry `json:"ledger"`
+}
+
+type ctxKey int
+
+const resellerCtxKey ctxKey = 0
+
+var errInsufficientCredit = errors.New("kredit tidak cukup")
+
+func loadResellers() (map[string]Reseller, error) {
+	resellers := map[string]Reseller{}
+	if err := loadJSONFile(ResellerFile, &resellers); err != nil {
+		return nil, err
+	}
+	return resellers, nil
+}
+
+func loadLedger() ([]LedgerEntry, error) {
+	ledger := []LedgerEntry{}
+	if err := loadJSONFile(LedgerFile, &ledger); err != nil {
+		return nil, err
+	}
+	return ledger, nil
+}
+
+func loadOwners() (map[string]string, error) {
+	owners := map[string]string{}
+	if err := loadJSONFile(OwnerFile, &owners); err != nil {
+		return nil, err
+	}
+	return owners, nil
+}
+
+// setOwner mencatat pemilik akun; resellerID kosong menghapus catatan
+func setOwner(password, resellerID string) error {
+	owners, err := loadOwners()
+	if err != nil {
+		return err
+	}
+	if owners[password] == resellerID {
+		return nil
+	}
+	if resellerID == "" {
+		delete(owners, password)
+	} else {
+		owners[password] = resellerID
+	}
+	return saveJSONFile(OwnerFile, owners)
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// public mengembalikan salinan tanpa hash API key
+func (res Reseller) public() Reseller {
+	res.KeyHash = ""
+	return res
+}
+
+func (res Reseller) cost(days int) int64 {
+	return int64(days) * res.PricePerDay
+}
+
+// resellerMiddleware menerima master key dan API key reseller. Request atas
+// nama reseller membawa *Reseller di context dan dibatasi ke akun miliknya.
+func resellerMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("X-API-Key")
+		if token == AuthToken {
+			tg := r.Header.Get("X-Reseller-Telegram")
+			if tg == "" {
+				next(w, r)
+				return
+			}
+			id, err := strconv.ParseInt(tg, 10, 64)
+			if err != nil {
+				jsonResponse(w, http.StatusBadRequest, false, "X-Reseller-Telegram tidak valid", nil)
+				return
+			}
+			serveAsReseller(w, r, next, func(res Reseller) bool { return res.TelegramID == id })
+			return
+		}
+		if token == "" {
+			jsonResponse(w, http.StatusUnauthorized, false, "Unauthorized", nil)
+			return
+		}
+		hash := hashAPIKey(token)
+		serveAsReseller(w, r, next, func(res Reseller) bool { return res.KeyHash == hash })
+	}
+}
+
+func serveAsReseller(w http.ResponseWriter, r *http.Request, next http.HandlerFunc, match func(Reseller) bool) {
+	resellers, err := loadResellers()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data reseller", nil)
+		return
+	}
+	for _, res := range resellers {
+		if !match(res) {
+			continue
+		}
+		if res.Disabled {
+			jsonResponse(w, http.StatusForbidden, false, "Reseller dinonaktifkan", nil)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), resellerCtxKey, &res)))
+		return
+	}
+	jsonResponse(w, http.StatusUnauthorized, false, "Unauthorized", nil)
+}
+
+// resellerFrom mengembalikan reseller pemanggil, nil untuk admin
+func resellerFrom(r *http.Request) *Reseller {
+	res, _ := r.Context().Value(resellerCtxKey).(*Reseller)
+	return res
+}
+
+// ownsUser selalu true untuk admin; harus dipanggil dengan mutex terkunci
+func ownsUser(r *http.Request, password string) bool {
+	res := resellerFrom(r)
+	if res == nil {
+		return true
+	}
+	owners, err := loadOwners()
+	return err == nil && owners[password] == res.ID
+}
+
+// appendLedger menambah entri ledger dan mengembalikan ID-nya
+func appendLedger(entry LedgerEntry) (int64, error) {
+	ledger, err := planLedger(entry)
+	if err != nil {
+		return 0, err
+	}
+	if err := saveJSONFile(LedgerFile, ledger); err != nil {
+		return 0, err
+	}
+	return ledger[len(ledger)-1].ID, nil
+}
+
+// planLedger mengembalikan isi ledger setelah entry ditambahkan, tanpa menulis
+func planLedger(entry LedgerEntry) ([]LedgerEntry, error) {
+	ledger, err := loadLedger()
+	if err != nil {
+		return nil, err
+	}
+	entry.ID = 1
+	if len(ledger) > 0 {
+		entry.ID = ledger[len(ledger)-1].ID + 1
+	}
+	entry.Time = time.Now().Format(time.RFC3339)
+	return append(ledger, entry), nil
+}
+
+// dryRunResellers mengirim perubahan resellers.json, dan ledger jika entry
+// tidak nil. Harus dipanggil dengan mutex terkunci.
+func dryRunResellers(w http.ResponseWriter, resellers map[string]Reseller, entry *LedgerEntry, extra map[string]interface{}) {
+	files := map[string]interface{}{ResellerFile: resellers}
+	for path, v := range extra {
+		files[path] = v
+	}
+	if entry != nil {
+		ledger, err := planLedger(*entry)
+		if err != nil {
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca ledger reseller", nil)
+			return
+		}
+		files[LedgerFile] = ledger
+	}
+	dryRunState(w, false, nil, nil, files)
+}
+
+// debitReseller memotong kredit untuk create/renew dan mencatatnya di
+// ledger. Dengan check=true hanya saldo yang diperiksa. Fungsi undo
+// mengembalikan kredit (dicatat sebagai refund) jika langkah berikutnya
+// gagal. Harus dipanggil dengan mutex terkunci.
+func debitReseller(id string, days int, kind, password string, check bool) (func(), error) {
+	resellers, err := loadResellers()
+	if err != nil {
+		return nil, err
+	}
+	res, ok := resellers[id]
+	if !ok {
+		return nil, errors.New("reseller tidak ditemukan")
+	}
+	cost := res.cost(days)
+	if res.Credit < cost {
+		return nil, fmt.Errorf("%w: butuh %d, saldo %d", errInsufficientCredit, cost, res.Credit)
+	}
+	if check {
+		return func() {}, nil
+	}
+
+	res.Credit -= cost
+	resellers[id] = res
+	if err := saveJSONFile(ResellerFile, resellers); err != nil {
+		return nil, err
+	}
+	if _, err := appendLedger(LedgerEntry{
+		Reseller: id, Type: kind, Amount: -cost, Balance: res.Credit, Password: password, Days: days,
+	}); err != nil {
+		log.Printf("Gagal mencatat ledger reseller %s: %v", id, err)
+	}
+	return func() {
+		resellers, err := loadResellers()
+		if err != nil {
+			log.Printf("Gagal mengembalikan kredit reseller %s: %v", id, err)
+			return
+		}
+		res := resellers[id]
+		res.Credit += cost
+		resellers[id] = res
+		if err := saveJSONFile(ResellerFile, resellers); err != nil {
+			log.Printf("Gagal mengembalikan kredit reseller %s: %v", id, err)
+			return
+		}
+		appendLedger(LedgerEntry{
+			Reseller: id, Type: "refund", Amount: cost, Balance: res.Credit, Password: password, Days: days,
+			Note: kind + " gagal",
+		})
+	}, nil
+}
+
+func creditError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errInsufficientCredit) {
+		jsonResponse(w, http.StatusPaymentRequired, false, "Kredit tidak cukup ("+strings.TrimPrefix(err.Error(), errInsufficientCredit.Error()+": ")+")", nil)
+		return
+	}
+	jsonResponse(w, http.StatusInternalServerError, false, "Gagal memproses kredit reseller", nil)
+}
+
+func listResellers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+
+	mutex.Lock()
+	resellers, err := loadResellers()
+	owners, err2 := loadOwners()
+	mutex.Unlock()
+	if err != nil || err2 != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data reseller", nil)
+		return
+	}
+
+	count := map[string]int{}
+	for _, id := range owners {
+		count[id]++
+	}
+	list := []Reseller{}
+	for _, res := range resellers {
+		res.Users = count[res.ID]
+		list = append(list, res.public())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt < list[j].CreatedAt })
+	jsonResponse(w, http.StatusOK, true, "Daftar reseller", list)
+}
+
+func (req ResellerRequest) validate(resellers map[string]Reseller) error {
+	if req.Name != nil && strings.TrimSpace(*req.Name) == "" {
+		return errors.New("nama reseller tidak boleh kosong")
+	}
+	if req.PricePerDay != nil && *req.PricePerDay < 0 {
+		return errors.New("price_per_day tidak boleh negatif")
+	}
+	if req.Credit < 0 {
+		return errors.New("credit tidak boleh negatif")
+	}
+	if req.TelegramID != nil && *req.TelegramID != 0 {
+		for _, res := range resellers {
+			if res.ID != req.ID && res.TelegramID == *req.TelegramID {
+				return fmt.Errorf("telegram_id sudah dipakai reseller %s", res.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func createReseller(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	var req ResellerRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.ID = ""
+	if req.Name == nil || req.PricePerDay == nil {
+		jsonResponse(w, http.StatusBadRequest, false, "name dan price_per_day wajib diisi", nil)
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	resellers, err := loadResellers()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data reseller", nil)
+		return
+	}
+	if err := req.validate(resellers); err != nil {
+		jsonResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+
+	key := "rs_" + randomHex(16)
+	res := Reseller{
+		ID:          "r" + randomHex(4),
+		Name:        strings.TrimSpace(*req.Name),
+		KeyHash:     hashAPIKey(key),
+		Credit:      req.Credit,
+		PricePerDay: *req.PricePerDay,
+		CreatedAt:   time.Now().Format(time.RFC3339),
+	}
+	if req.TelegramID != nil {
+		res.TelegramID = *req.TelegramID
+	}
+	resellers[res.ID] = res
+	if isDryRun(r) {
+		// API key tidak ditampilkan karena tidak pernah disimpan
+		var entry *LedgerEntry
+		if res.Credit > 0 {
+			entry = &LedgerEntry{Reseller: res.ID, Type: "topup", Amount: res.Credit, Balance: res.Credit, Note: "saldo awal"}
+		}
+		dryRunResellers(w, resellers, entry, nil)
+		return
+	}
+	if err := saveJSONFile(ResellerFile, resellers); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan reseller", nil)
+		return
+	}
+	if res.Credit > 0 {
+		if _, err := appendLedger(LedgerEntry{Reseller: res.ID, Type: "topup", Amount: res.Credit, Balance: res.Credit, Note: "saldo awal"}); err != nil {
+			log.Printf("Gagal mencatat ledger reseller %s: %v", res.ID, err)
+		}
+	}
+	recordAudit(r, "reseller.create", res.public())
+
+	// API key hanya ditampilkan sekali
+	jsonResponse(w, http.StatusOK, true, "Reseller berhasil dibuat", ResellerKey{Reseller: res.public(), APIKey: key})
+}
+
+func updateReseller(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	var req ResellerRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	resellers, err := loadResellers()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data reseller", nil)
+		return
+	}
+	res, ok := resellers[req.ID]
+	if !ok {
+		jsonResponse(w, http.StatusNotFound, false, "Reseller tidak ditemukan", nil)
+		return
+	}
+	if err := req.validate(resellers); err != nil {
+		jsonResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+
+	before := res.public()
+	if req.Name != nil {
+		res.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.TelegramID != nil {
+		res.TelegramID = *req.TelegramID
+	}
+	if req.PricePerDay != nil {
+		res.PricePerDay = *req.PricePerDay
+	}
+	if req.Disabled != nil {
+		res.Disabled = *req.Disabled
+	}
+	resellers[res.ID] = res
+	if isDryRun(r) {
+		dryRunResellers(w, resellers, nil, nil)
+		return
+	}
+	if err := saveJSONFile(ResellerFile, resellers); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan reseller", nil)
+		return
+	}
+	recordAudit(r, "reseller.update", settingChange{before, res.public()})
+	jsonResponse(w, http.StatusOK, true, "Reseller diperbarui", res.public())
+}
+
+// deleteReseller menghapus reseller; akun miliknya tetap ada dan menjadi
+// milik admin. Ledger tetap disimpan.
+func deleteReseller(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	var req ResellerRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	resellers, err := loadResellers()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data reseller", nil)
+		return
+	}
+	res, ok := resellers[req.ID]
+	if !ok {
+		jsonResponse(w, http.StatusNotFound, false, "Reseller tidak ditemukan", nil)
+		return
+	}
+	delete(resellers, req.ID)
+	owners, ownersErr := loadOwners()
+	if ownersErr == nil {
+		for password, id := range owners {
+			if id == req.ID {
+				delete(owners, password)
+			}
+		}
+	}
+	if isDryRun(r) {
+		extra := map[string]interface{}{}
+		if ownersErr == nil {
+			extra[OwnerFile] = owners
+		}
+		dryRunResellers(w, resellers, nil, extra)
+		return
+	}
+	if err := saveJSONFile(ResellerFile, resellers); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan reseller", nil)
+		return
+	}
+	if ownersErr == nil {
+		if err := saveJSONFile(OwnerFile, owners); err != nil {
+			log.Printf("Gagal memperbarui pemilik akun: %v", err)
+		}
+	}
+	recordAudit(r, "reseller.delete", res.public())
+	jsonResponse(w, http.StatusOK, true, "Reseller dihapus", nil)
+}
+
+func topUpReseller(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	var req TopUpRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Amount <= 0 {
+		jsonResponse(w, http.StatusBadRequest, false, "amount harus lebih dari 0", nil)
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	resellers, err := loadResellers()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data reseller", nil)
+		return
+	}
+	res, ok := resellers[req.ID]
+	if !ok {
+		jsonResponse(w, http.StatusNotFound, false, "Reseller tidak ditemukan", nil)
+		return
+	}
+	res.Credit += req.Amount
+	resellers[res.ID] = res
+	entry := LedgerEntry{Reseller: res.ID, Type: "topup", Amount: req.Amount, Balance: res.Credit, Note: req.Note}
+	if isDryRun(r) {
+		dryRunResellers(w, resellers, &entry, nil)
+		return
+	}
+	if err := saveJSONFile(ResellerFile, resellers); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan reseller", nil)
+		return
+	}
+	if entry.ID, err = appendLedger(entry); err != nil {
+		log.Printf("Gagal mencatat ledger reseller %s: %v", res.ID, err)
+	}
+	recordAudit(r, "reseller.topup", entry)
+	events.publish("reseller.topup", map[string]interface{}{
+		"reseller":    res.ID,
+		"name":        res.Name,
+		"telegram_id": res.TelegramID,
+		"amount":      req.Amount,
+		"balance":     res.Credit,
+	})
+	jsonResponse(w, http.StatusOK, true, "Kredit reseller ditambahkan", res.public())
+}
+
+func rotateResellerKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	var req ResellerRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	resellers, err := loadResellers()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data reseller", nil)
+		return
+	}
+	res, ok := resellers[req.ID]
+	if !ok {
+		jsonResponse(w, http.StatusNotFound, false, "Reseller tidak ditemukan", nil)
+		return
+	}
+	key := "rs_" + randomHex(16)
+	res.KeyHash = hashAPIKey(key)
+	resellers[res.ID] = res
+	if isDryRun(r) {
+		// Key lama tetap berlaku, key baru tidak ditampilkan
+		dryRunResellers(w, resellers, nil, nil)
+		return
+	}
+	if err := saveJSONFile(ResellerFile, resellers); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan reseller", nil)
+		return
+	}
+	recordAudit(r, "reseller.key", map[string]string{"id": res.ID})
+	jsonResponse(w, http.StatusOK, true, "API key reseller diganti", ResellerKey{Reseller: res.public(), APIKey: key})
+}
+
+// resellerLedger mengembalikan ledger terbaru di depan; id kosong = semua
+func resellerLedger(id string, limit int) ([]LedgerEntry, error) {
+	ledger, err := loadLedger()
+	if err != nil {
+		return nil, err
+	}
+	out := []LedgerEntry{}
+	for i := len(ledger) - 1; i >= 0 && (limit <= 0 || len(out) < limit); i-- {
+		if id == "" || ledger[i].Reseller == id {
+			out = append(out, ledger[i])
+		}
+	}
+	return out, nil
+}
+
+// listLedger menangani /api/reseller/ledger?id=&limit=. Reseller hanya
+// bisa melihat ledger miliknya sendiri.
+func listLedger(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if res := resellerFrom(r); res != nil {
+		id = res.ID
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	mutex.Lock()
+	ledger, err := resellerLedger(id, limit)
+	mutex.Unlock()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca ledger", nil)
+		return
+	}
+	jsonResponse(w, http.StatusOK, true, "Ledger reseller", ledger)
+}
+
+func resellerProfile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	res := resellerFrom(r)
+	if res == nil {
+		jsonResponse(w, http.StatusNotFound, false, "Bukan reseller", nil)
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	// Data di context bisa tertinggal jika ada transaksi bersamaan
+	resellers, err := loadResellers()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data reseller", nil)
+		return
+	}
+	current := resellers[res.ID]
+	if owners, err := loadOwners(); err == nil {
+		for _, id := range owners {
+			if id == res.ID {
+				current.Users++
+			}
+		}
+	}
+	ledger, err := resellerLedger(res.ID, 20)
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca ledger", nil)
+		return
+	}
+	jsonResponse(w, http.StatusOK, true, "Profil reseller", ResellerProfile{Reseller: current.public(), Ledger: ledger})
+}
+
+// --- Plans ---
+
+// Visibility plan: public untuk semua (bot publik, order, voucher),
+// reseller untuk reseller dan admin, admin hanya untuk admin.
+const (
+	PlanPublic   = "public"
+	PlanReseller = "reseller"
+	PlanAdmin    = "admin"
+)
+
+// Plan adalah paket bernama yang mengisi days dan limit saat create/renew.
+// Price adalah harga jual; kredit reseller tetap dihitung dari price_per_day.
+type Plan struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Days       int    `json:"days"`
+	LimitIP    int    `json:"limit_ip"`
+	LimitQuota int    `json:"limit_quota"` // GB
+	Price      int64  `json:"price"`
+	Visibility string `json:"visibility"`
+	CreatedAt  string `json:"created_at"`
+}
+
+type PlanRequest struct {
+	ID         string  `json:"id"`
+	Name       *string `json:"name"`
+	Days       *int    `json:"days"`
+	LimitIP    *int    `json:"limit_ip"`
+	LimitQuota *int    `json:"limit_quota"`
+	Price      *int64  `json:"price"`
+	Visibility *string `json:"visibility"`
+}
+
+var planIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+func loadPlans() (map[string]Plan, error) {
+	plans := map[string]Plan{}
+	if err := loadJSONFile(PlanFile, &plans); err != nil {
+		return nil, err
+	}
+	return plans, nil
+}
+
+// visibleTo menentukan apakah plan boleh dipakai pemanggil (nil = admin)
+func (p Plan) visibleTo(res *Reseller) bool {
+	if res == nil {
+		return true
+	}
+	return p.Visibility == PlanPublic || p.Visibility == PlanReseller
+}
+
+// applyPlan mengisi days dan limit dari plan_id. Plan yang tidak terlihat
+// oleh pemanggil dianggap tidak ada.
+func applyPlan(w http.ResponseWriter, r *http.Request, req *UserRequest) bool {
+	if req.PlanID == "" {
+		return true
+	}
+	plans, err := loadPlans()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data plan", nil)
+		return false
+	}
+	plan, ok := plans[req.PlanID]
+	if !ok || !plan.visibleTo(resellerFrom(r)) {
+		jsonResponse(w, http.StatusNotFound, false, "Plan tidak ditemukan", nil)
+		return false
+	}
+	req.Days = plan.Days
+	req.LimitIP = plan.LimitIP
+	req.LimitQuota = plan.LimitQuota
+	return true
+}
+
+func (req PlanRequest) validate() error {
+	if req.Name != nil && strings.TrimSpace(*req.Name) == "" {
+		return errors.New("nama plan tidak boleh kosong")
+	}
+	if req.Days != nil && (*req.Days <= 0 || *req.Days > 3650) {
+		return errors.New("days harus 1-3650")
+	}
+	if (req.LimitIP != nil && *req.LimitIP < 0) || (req.LimitQuota != nil && *req.LimitQuota < 0) {
+		return errors.New("limit tidak boleh negatif")
+	}
+	if req.Price != nil && *req.Price < 0 {
+		return errors.New("price tidak boleh negatif")
+	}
+	if req.Visibility != nil {
+		switch *req.Visibility {
+		case PlanPublic, PlanReseller, PlanAdmin:
+		default:
+			return errors.New("visibility harus public, reseller, atau admin")
+		}
+	}
+	return nil
+}
+
+func listPlans(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	visibility := r.URL.Query().Get("visibility")
+
+	plans, err := loadPlans()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data plan", nil)
+		return
+	}
+	res := resellerFrom(r)
+	list := []Plan{}
+	for _, p := range plans {
+		if !p.visibleTo(res) || (visibility != "" && p.Visibility != visibility) {
+			continue
+		}
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Price != list[j].Price {
+			return list[i].Price < list[j].Price
+		}
+		if list[i].Days != list[j].Days {
+			return list[i].Days < list[j].Days
+		}
+		return list[i].ID < list[j].ID
+	})
+	jsonResponse(w, http.StatusOK, true, "Daftar plan", list)
+}
+
+func createPlan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	var req PlanRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Name == nil || req.Days == nil {
+		jsonResponse(w, http.StatusBadRequest, false, "name dan days wajib diisi", nil)
+		return
+	}
+	if req.ID != "" && !planIDPattern.MatchString(req.ID) {
+		jsonResponse(w, http.StatusBadRequest, false, "id hanya boleh huruf kecil, angka, '-' dan '_' (maks 32)", nil)
+		return
+	}
+	if err := req.validate(); err != nil {
+		jsonResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	plans, err := loadPlans()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data plan", nil)
+		return
+	}
+	plan := Plan{
+		ID:         req.ID,
+		Name:       strings.TrimSpace(*req.Name),
+		Days:       *req.Days,
+		Visibility: PlanPublic,
+		CreatedAt:  time.Now().Format(time.RFC3339),
+	}
+	if plan.ID == "" {
+		plan.ID = "p" + randomHex(4)
+	}
+	if _, exists := plans[plan.ID]; exists {
+		jsonResponse(w, http.StatusConflict, false, "Plan sudah ada", nil)
+		return
+	}
+	if req.LimitIP != nil {
+		plan.LimitIP = *req.LimitIP
+	}
+	if req.LimitQuota != nil {
+		plan.LimitQuota = *req.LimitQuota
+	}
+	if req.Price != nil {
+		plan.Price = *req.Price
+	}
+	if req.Visibility != nil {
+		plan.Visibility = *req.Visibility
+	}
+	plans[plan.ID] = plan
+	if isDryRun(r) {
+		dryRunState(w, false, nil, nil, map[string]interface{}{PlanFile: plans})
+		return
+	}
+	if err := saveJSONFile(PlanFile, plans); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan plan", nil)
+		return
+	}
+	recordAudit(r, "plan.create", plan)
+	jsonResponse(w, http.StatusOK, true, "Plan berhasil dibuat", plan)
+}
+
+func updatePlan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	var req PlanRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if err := req.validate(); err != nil {
+		jsonResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	plans, err := loadPlans()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data plan", nil)
+		return
+	}
+	plan, ok := plans[req.ID]
+	if !ok {
+		jsonResponse(w, http.StatusNotFound, false, "Plan tidak ditemukan", nil)
+		return
+	}
+	before := plan
+	if req.Name != nil {
+		plan.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Days != nil {
+		plan.Days = *req.Days
+	}
+	if req.LimitIP != nil {
+		plan.LimitIP = *req.LimitIP
+	}
+	if req.LimitQuota != nil {
+		plan.LimitQuota = *req.LimitQuota
+	}
+	if req.Price != nil {
+		plan.Price = *req.Price
+	}
+	if req.Visibility != nil {
+		plan.Visibility = *req.Visibility
+	}
+	plans[plan.ID] = plan
+	if isDryRun(r) {
+		dryRunState(w, false, nil, nil, map[string]interface{}{PlanFile: plans})
+		return
+	}
+	if err := saveJSONFile(PlanFile, plans); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan plan", nil)
+		return
+	}
+	recordAudit(r, "plan.update", settingChange{before, plan})
+	jsonResponse(w, http.StatusOK, true, "Plan diperbarui", plan)
+}
+
+// deletePlan tidak mengubah akun yang sudah dibuat dari plan tersebut
+func deletePlan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	var req PlanRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	plans, err := loadPlans()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data plan", nil)
+		return
+	}
+	plan, ok := plans[req.ID]
+	if !ok {
+		jsonResponse(w, http.StatusNotFound, false, "Plan tidak ditemukan", nil)
+		return
+	}
+	delete(plans, req.ID)
+	if isDryRun(r) {
+		dryRunState(w, false, nil, nil, map[string]interface{}{PlanFile: plans})
+		return
+	}
+	if err := saveJSONFile(PlanFile, plans); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan plan", nil)
+		return
+	}
+	recordAudit(r, "plan.delete", plan)
+	jsonResponse(w, http.StatusOK, true, "Plan dihapus", nil)
+}
+
+// --- Akun dari Plan ---
+
+var (
+	errUserExists   = errors.New("user sudah ada")
+	errUserNotFound = errors.New("user tidak ditemukan")
+	errNotOwner     = errors.New("akun bukan milik Telegram user ini")
+)
+
+// accountChange adalah create/renew akun dari plan yang belum ditulis.
+// Dipakai bersama oleh voucher dan order.
+type accountChange struct {
+	Action string // create, renew
+	Record UserRecord
+	config *Config // nil jika config.json tidak berubah
+	users  []string
+}
+
+// planAccount membuat akun baru, atau jika renew memperpanjang akun yang
+// sudah ada di users.db tanpa mengubah limitnya. Password yang sudah ada
+// ditolak kecuali renew; kepemilikan dicek pemanggil lewat checkTelegramOwner.
+// Harus dipanggil dengan mutex terkunci.
+func planAccount(password string, days, limitIP, limitQuota int, renew bool) (*accountChange, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	users, err := loadUsers()
+	if err != nil {
+		return nil, err
+	}
+	for i, line := range users {
+		if rec, ok := parseUserLine(line); ok && rec.Password == password {
+			if !renew {
+				return nil, errUserExists
+			}
+			rec.Expired = extendExpiry(rec.Expired, days)
+			users[i] = rec.String()
+			return &accountChange{Action: "renew", Record: rec, users: users}, nil
+		}
+	}
+	if renew {
+		return nil, errUserNotFound
+	}
+	for _, p := range config.Auth.Config {
+		if p == password {
+			return nil, errUserExists
+		}
+	}
+	rec := UserRecord{
+		Password:   password,
+		Expired:    time.Now().Add(time.Duration(days) * 24 * time.Hour).Format("2006-01-02"),
+		LimitIP:    limitIP,
+		LimitQuota: limitQuota,
+	}
+	config.Auth.Config = append(config.Auth.Config, password)
+	return &accountChange{Action: "create", Record: rec, config: &config, users: append(users, rec.String())}, nil
+}
+
+// checkTelegramOwner memastikan akun tercatat milik telegramID di
+// TelegramOwnerFile (ditulis bot saat akun dibuat atau disetujui).
+func checkTelegramOwner(password string, telegramID int64) error {
+	owners := map[string]int64{}
+	if err := loadJSONFile(TelegramOwnerFile, &owners); err != nil {
+		return err
+	}
+	if telegramID == 0 || owners[password] != telegramID {
+		return errNotOwner
+	}
+	return nil
+}
+
+func (c *accountChange) save() error {
+	if c.config != nil {
+		if err := saveConfig(*c.config); err != nil {
+			return err
+		}
+	}
+	if err := saveUsers(c.users); err != nil {
+		return err
+	}
+	snapshotChange("user." + c.Action)
+	return nil
+}
+
+// --- Voucher ---
+
+// Voucher adalah kode prabayar yang terikat ke plan. Redeem membuat akun
+// baru, atau dengan renew memperpanjang akun milik telegram_id pemanggil.
+type Voucher struct {
+	Code        string              `json:"code"`
+	Batch       string              `json:"batch"`
+	Plan        string              `json:"plan"`
+	MaxUses     int                 `json:"max_uses"`
+	Uses        int                 `json:"uses"`
+	ExpiresAt   string              `json:"expires_at,omitempty"` // YYYY-MM-DD, kosong = tanpa batas
+	Revoked     bool                `json:"revoked,omitempty"`
+	Note        string              `json:"note,omitempty"`
+	CreatedAt   string              `json:"created_at"`
+	Redemptions []VoucherRedemption `json:"redemptions,omitempty"`
+}
+
+type VoucherRedemption struct {
+	Time       string `json:"time"`
+	Password   string `json:"password"`
+	Action     string `json:"action"` // create, renew
+	TelegramID int64  `json:"telegram_id,omitempty"`
+}
+
+type VoucherBatch struct {
+	ID        string `json:"id"`
+	Plan      string `json:"plan"`
+	Count     int    `json:"count"`
+	Used      int    `json:"used"`      // kode yang sudah dipakai minimal sekali
+	Exhausted int    `json:"exhausted"` // kode yang sudah habis atau dicabut
+	MaxUses   int    `json:"max_uses"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+	Note      string `json:"note,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+type VoucherGenerateRequest struct {
+	PlanID    string `json:"plan_id"`
+	Count     int    `json:"count"`
+	MaxUses   int    `json:"max_uses"`
+	ExpiresAt string `json:"expires_at"`
+	Prefix    string `json:"prefix"`
+	Note      string `json:"note"`
+}
+
+type VoucherGenerated struct {
+	Batch VoucherBatch `json:"batch"`
+	Codes []string     `json:"codes"`
+}
+
+type VoucherRevokeRequest struct {
+	Code  string `json:"code"`
+	Batch string `json:"batch"`
+}
+
+type VoucherRedeemRequest struct {
+	Code       string `json:"code"`
+	Password   string `json:"password"`
+	TelegramID int64  `json:"telegram_id"`
+	Renew      bool   `json:"renew"`
+}
+
+type VoucherRedeemResult struct {
+	Action     string `json:"action"`
+	Password   string `json:"password"`
+	Expired    string `json:"expired"`
+	Domain     string `json:"domain"`
+	LimitIP    int    `json:"limit_ip"`
+	LimitQuota int    `json:"limit_quota"`
+	Plan       string `json:"plan"`
+	Code       string `json:"code"`
+	UsesLeft   int    `json:"uses_left"`
+}
+
+// Tanpa huruf/angka yang mirip (0/O, 1/I/L) agar mudah diketik ulang
+const voucherAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+var voucherPrefixPattern = regexp.MustCompile(`^[A-Z0-9]{1,8}$`)
+
+func loadVouchers() (map[string]Voucher, error) {
+	vouchers := map[string]Voucher{}
+	if err := loadJSONFile(VoucherFile, &vouchers); err != nil {
+		return nil, err
+	}
+	return vouchers, nil
+}
+
+func newVoucherCode(prefix string) string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	code := make([]byte, 0, 9)
+	for i, c := range b {
+		if i == 4 {
+			code = append(code, '-')
+		}
+		code = append(code, voucherAlphabet[int(c)%len(voucherAlphabet)])
+	}
+	return prefix + "-" + string(code)
+}
+
+func normalizeVoucherCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// usable mengembalikan alasan voucher tidak bisa dipakai, kosong jika bisa
+func (v Voucher) usable(now time.Time) string {
+	switch {
+	case v.Revoked:
+		return "Voucher sudah dicabut"
+	case v.Uses >= v.MaxUses:
+		return "Voucher sudah habis dipakai"
+	case v.ExpiresAt != "" && now.Format("2006-01-02") > v.ExpiresAt:
+		return "Voucher sudah kadaluarsa"
+	}
+	return ""
+}
+
+func voucherBatches(vouchers map[string]Voucher) []VoucherBatch {
+	batches := map[string]*VoucherBatch{}
+	for _, v := range vouchers {
+		b, ok := batches[v.Batch]
+		if !ok {
+			b = &VoucherBatch{ID: v.Batch, Plan: v.Plan, MaxUses: v.MaxUses, ExpiresAt: v.ExpiresAt, Note: v.Note, CreatedAt: v.CreatedAt}
+			batches[v.Batch] = b
+		}
+		b.Count++
+		if v.Uses > 0 {
+			b.Used++
+		}
+		if v.Revoked || v.Uses >= v.MaxUses {
+			b.Exhausted++
+		}
+	}
+	list := []VoucherBatch{}
+	for _, b := range batches {
+		list = append(list, *b)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].CreatedAt != list[j].CreatedAt {
+			return list[i].CreatedAt > list[j].CreatedAt
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// listVouchers mendukung ?batch= dan ?format=csv untuk export
+func listVouchers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	batch := r.URL.Query().Get("batch")
+
+	mutex.Lock()
+	vouchers, err := loadVouchers()
+	mutex.Unlock()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data voucher", nil)
+		return
+	}
+
+	list := []Voucher{}
+	for _, v := range vouchers {
+		if batch == "" || v.Batch == batch {
+			list = append(list, v)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].CreatedAt != list[j].CreatedAt {
+			return list[i].CreatedAt > list[j].CreatedAt
+		}
+		return list[i].Code < list[j].Code
+	})
+
+	if r.URL.Query().Get("format") == "csv" {
+		name := "vouchers.csv"
+		if batch != "" {
+			name = "vouchers-" + batch + ".csv"
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"code", "plan", "batch", "max_uses", "uses", "expires_at", "status"})
+		now := time.Now()
+		for _, v := range list {
+			status := "active"
+			if reason := v.usable(now); reason != "" {
+				status = "inactive"
+			}
+			cw.Write([]string{v.Code, v.Plan, v.Batch, strconv.Itoa(v.MaxUses), strconv.Itoa(v.Uses), v.ExpiresAt, status})
+		}
+		cw.Flush()
+		return
+	}
+	jsonResponse(w, http.StatusOK, true, "Daftar voucher", list)
+}
+
+func listVoucherBatches(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	mutex.Lock()
+	vouchers, err := loadVouchers()
+	mutex.Unlock()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data voucher", nil)
+		return
+	}
+	jsonResponse(w, http.StatusOK, true, "Daftar batch voucher", voucherBatches(vouchers))
+}
+
+func generateVouchers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	var req VoucherGenerateRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.MaxUses == 0 {
+		req.MaxUses = 1
+	}
+	req.Prefix = strings.ToUpper(strings.TrimSpace(req.Prefix))
+	if req.Prefix == "" {
+		req.Prefix = "ZV"
+	}
+	switch {
+	case req.PlanID == "":
+		jsonResponse(w, http.StatusBadRequest, false, "plan_id wajib diisi", nil)
+		return
+	case req.Count <= 0 || req.Count > MaxVoucherBatch:
+		jsonResponse(w, http.StatusBadRequest, false, fmt.Sprintf("count harus 1-%d", MaxVoucherBatch), nil)
+		return
+	case req.MaxUses < 0:
+		jsonResponse(w, http.StatusBadRequest, false, "max_uses harus lebih dari 0", nil)
+		return
+	case !voucherPrefixPattern.MatchString(req.Prefix):
+		jsonResponse(w, http.StatusBadRequest, false, "prefix hanya boleh huruf dan angka (maks 8)", nil)
+		return
+	}
+	if req.ExpiresAt != "" {
+		if _, err := time.Parse("2006-01-02", req.ExpiresAt); err != nil {
+			jsonResponse(w, http.StatusBadRequest, false, "expires_at harus berformat YYYY-MM-DD", nil)
+			return
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	plans, err := loadPlans()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data plan", nil)
+		return
+	}
+	if _, ok := plans[req.PlanID]; !ok {
+		jsonResponse(w, http.StatusNotFound, false, "Plan tidak ditemukan", nil)
+		return
+	}
+	vouchers, err := loadVouchers()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data voucher", nil)
+		return
+	}
+
+	now := time.Now()
+	batch := "b" + now.Format("060102") + randomHex(2)
+	codes := make([]string, 0, req.Count)
+	for len(codes) < req.Count {
+		code := newVoucherCode(req.Prefix)
+		if _, exists := vouchers[code]; exists {
+			continue
+		}
+		vouchers[code] = Voucher{
+			Code:      code,
+			Batch:     batch,
+			Plan:      req.PlanID,
+			MaxUses:   req.MaxUses,
+			ExpiresAt: req.ExpiresAt,
+			Note:      req.Note,
+			CreatedAt: now.Format(time.RFC3339),
+		}
+		codes = append(codes, code)
+	}
+	// Kode di dry run hanya contoh; generate sungguhan membuat kode baru
+	if isDryRun(r) {
+		dryRunState(w, false, nil, nil, map[string]interface{}{VoucherFile: vouchers})
+		return
+	}
+	if err := saveJSONFile(VoucherFile, vouchers); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan voucher", nil)
+		return
+	}
+
+	info := VoucherBatch{
+		ID: batch, Plan: req.PlanID, Count: len(codes), MaxUses: req.MaxUses,
+		ExpiresAt: req.ExpiresAt, Note: req.Note, CreatedAt: now.Format(time.RFC3339),
+	}
+	recordAudit(r, "voucher.generate", info)
+	jsonResponse(w, http.StatusOK, true, "Voucher berhasil dibuat", VoucherGenerated{Batch: info, Codes: codes})
+}
+
+// revokeVouchers mencabut satu kode atau seluruh batch. Akun yang sudah
+// dibuat dari voucher tidak terpengaruh.
+func revokeVouchers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	var req VoucherRevokeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.Code = normalizeVoucherCode(req.Code)
+	if (req.Code == "") == (req.Batch == "") {
+		jsonResponse(w, http.StatusBadRequest, false, "Isi salah satu: code atau batch", nil)
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	vouchers, err := loadVouchers()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data voucher", nil)
+		return
+	}
+	revoked := 0
+	matched := false
+	for code, v := range vouchers {
+		if code != req.Code && (req.Batch == "" || v.Batch != req.Batch) {
+			continue
+		}
+		matched = true
+		if !v.Revoked {
+			v.Revoked = true
+			vouchers[code] = v
+			revoked++
+		}
+	}
+	if !matched {
+		jsonResponse(w, http.StatusNotFound, false, "Voucher tidak ditemukan", nil)
+		return
+	}
+	if isDryRun(r) {
+		dryRunState(w, false, nil, nil, map[string]interface{}{VoucherFile: vouchers})
+		return
+	}
+	if err := saveJSONFile(VoucherFile, vouchers); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan voucher", nil)
+		return
+	}
+	recordAudit(r, "voucher.revoke", map[string]interface{}{"code": req.Code, "batch": req.Batch, "revoked": revoked})
+	jsonResponse(w, http.StatusOK, true, fmt.Sprintf("%d voucher dicabut", revoked), map[string]int{"revoked": revoked})
+}
+
+// redeemVoucher membuat akun baru dari plan voucher, atau jika renew
+// memperpanjang akun milik telegram_id pemanggil tanpa mengubah limitnya.
+func redeemVoucher(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	var req VoucherRedeemRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.Code = normalizeVoucherCode(req.Code)
+	if req.Code == "" || req.Password == "" {
+		jsonResponse(w, http.StatusBadRequest, false, "code dan password wajib diisi", nil)
+		return
+	}
+	if strings.Contains(req.Password, "|") {
+		jsonResponse(w, http.StatusBadRequest, false, "Password tidak boleh mengandung karakter '|'", nil)
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	vouchers, err := loadVouchers()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data voucher", nil)
+		return
+	}
+	voucher, ok := vouchers[req.Code]
+	if !ok {
+		jsonResponse(w, http.StatusNotFound, false, "Voucher tidak ditemukan", nil)
+		return
+	}
+	now := time.Now()
+	if reason := voucher.usable(now); reason != "" {
+		jsonResponse(w, http.StatusConflict, false, reason, nil)
+		return
+	}
+	plans, err := loadPlans()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data plan", nil)
+		return
+	}
+	plan, ok := plans[voucher.Plan]
+	if !ok {
+		jsonResponse(w, http.StatusConflict, false, "Plan voucher sudah dihapus", nil)
+		return
+	}
+
+	if req.Renew {
+		err := checkTelegramOwner(req.Password, req.TelegramID)
+		if errors.Is(err, errNotOwner) {
+			jsonResponse(w, http.StatusForbidden, false, "Akun bukan milik telegram_id ini", nil)
+			return
+		}
+		if err != nil {
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data pemilik akun", nil)
+			return
+		}
+	}
+	change, err := planAccount(req.Password, plan.Days, plan.LimitIP, plan.LimitQuota, req.Renew)
+	if errors.Is(err, errUserExists) {
+		jsonResponse(w, http.StatusConflict, false, "User sudah ada", nil)
+		return
+	}
+	if errors.Is(err, errUserNotFound) {
+		jsonResponse(w, http.StatusNotFound, false, "User tidak ditemukan", nil)
+		return
+	}
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca database user", nil)
+		return
+	}
+	result := VoucherRedeemResult{
+		Action:     change.Action,
+		Password:   req.Password,
+		Expired:    change.Record.Expired,
+		LimitIP:    change.Record.LimitIP,
+		LimitQuota: change.Record.LimitQuota,
+		Plan:       plan.ID,
+		Code:       voucher.Code,
+		UsesLeft:   voucher.MaxUses - voucher.Uses - 1,
+	}
+
+	// Voucher dipakai lebih dulu dan dikembalikan jika penulisan akun gagal
+	unused := voucher
+	voucher.Uses++
+	voucher.Redemptions = append(voucher.Redemptions, VoucherRedemption{
+		Time: now.Format(time.RFC3339), Password: req.Password, Action: result.Action, TelegramID: req.TelegramID,
+	})
+	vouchers[voucher.Code] = voucher
+	if isDryRun(r) {
+		dryRunState(w, true, change.config, change.users, map[string]interface{}{VoucherFile: vouchers})
+		return
+	}
+	if err := saveJSONFile(VoucherFile, vouchers); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan voucher", nil)
+		return
+	}
+	undo := func() {
+		vouchers[unused.Code] = unused
+		if err := saveJSONFile(VoucherFile, vouchers); err != nil {
+			log.Printf("Gagal mengembalikan voucher %s: %v", unused.Code, err)
+		}
+	}
+	if err := change.save(); err != nil {
+		undo()
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan akun", nil)
+		return
+	}
+
+	if err := restartService(); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal merestart service", nil)
+		return
+	}
+
+	result.Domain = readDomain()
+	eventType := "user.created"
+	if result.Action == "renew" {
+		eventType = "user.renewed"
+	}
+	events.publish(eventType, map[string]string{
+		"password": req.Password,
+		"expired":  result.Expired,
+		"plan":     plan.ID,
+		"voucher":  voucher.Code,
+	})
+	events.publish("voucher.redeemed", map[string]interface{}{
+		"code":        voucher.Code,
+		"batch":       voucher.Batch,
+		"plan":        plan.ID,
+		"password":    req.Password,
+		"action":      result.Action,
+		"telegram_id": req.TelegramID,
+	})
+
+	message := "Voucher berhasil dipakai, akun dibuat"
+	if result.Action == "renew" {
+		message = "Voucher berhasil dipakai, akun diperpanjang"
+	}
+	jsonResponse(w, http.StatusOK, true, message, result)
+}
+
+// --- Order & Pembayaran ---
+
+// Status order. Failed berarti sudah dibayar tetapi akun gagal dibuat dan
+// perlu ditangani admin.
+const (
+	OrderPending   = "pending"
+	OrderPaid      = "paid"
+	OrderExpired   = "expired"
+	OrderCancelled = "cancelled"
+	OrderFailed    = "failed"
+)
+
+type PaymentConfig struct {
+	Gateway       string `json:"gateway"`
+	WebhookSecret string `json:"webhook_secret"`
+	OrderTTL      int    `json:"order_ttl_minutes"`
+}
+
+type PaymentRequest struct {
+	Gateway      *string `json:"gateway"`
+	OrderTTL     *int    `json:"order_ttl_minutes"`
+	RotateSecret bool    `json:"rotate_secret"`
+}
+
+// Order menyimpan salinan durasi dan limit plan saat dibuat, sehingga
+// perubahan plan tidak memengaruhi order yang sudah dibayar. Order renew
+// tidak mengubah limit akun; limitnya diganti limit akun saat dibayar.
+type Order struct {
+	ID             string `json:"id"`
+	Plan           string `json:"plan"`
+	Password       string `json:"password"`
+	Days           int    `json:"days"`
+	LimitIP        int    `json:"limit_ip"`
+	LimitQuota     int    `json:"limit_quota"`
+	Amount         int64  `json:"amount"`
+	Status         string `json:"status"`
+	Gateway        string `json:"gateway"`
+	Reference      string `json:"reference"`
+	PayURL         string `json:"pay_url,omitempty"`
+	Instructions   string `json:"instructions,omitempty"`
+	TelegramID     int64  `json:"telegram_id,omitempty"`
+	CreatedAt      string `json:"created_at"`
+	ExpiresAt      string `json:"expires_at"`
+	PaidAt         string `json:"paid_at,omitempty"`
+	PaidBy         string `json:"paid_by,omitempty"` // webhook, admin
+	Action         string `json:"action,omitempty"`  // create, renew; kosong pada order lama = create
+	AccountExpired string `json:"account_expired,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+type OrderRequest struct {
+	ID         string `json:"id"`
+	PlanID     string `json:"plan_id"`
+	Password   string `json:"password"`
+	TelegramID int64  `json:"telegram_id"`
+	Renew      bool   `json:"renew"`
+}
+
+// loadPaymentConfig mengisi default dan membuat webhook secret saat
+// pertama kali dipakai. Harus dipanggil dengan mutex terkunci.
+func loadPaymentConfig() (PaymentConfig, error) {
+	cfg := PaymentConfig{Gateway: "mock", OrderTTL: DefaultOrderTTL}
+	if err := loadJSONFile(PaymentConfigFile, &cfg); err != nil {
+		return cfg, err
+	}
+	if cfg.WebhookSecret == "" {
+		cfg.WebhookSecret = randomHex(24)
+		if err := saveJSONFile(PaymentConfigFile, cfg); err != nil {
+			return cfg, err
+		}
+	}
+	return cfg, nil
+}
+
+func (c PaymentConfig) gateway() (payment.Gateway, error) {
+	switch c.Gateway {
+	case "mock":
+		return payment.NewMock(c.WebhookSecret), nil
+	}
+	return nil, fmt.Errorf("gateway %q tidak dikenal", c.Gateway)
+}
+
+// public menyembunyikan secret untuk audit log
+func (c PaymentConfig) public() PaymentConfig {
+	c.WebhookSecret = ""
+	return c
+}
+
+func loadOrders() (map[string]Order, error) {
+	orders := map[string]Order{}
+	if err := loadJSONFile(OrderFile, &orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// saveOrders membuang order selesai yang paling lama jika melebihi MaxOrders
+func saveOrders(orders map[string]Order) error {
+	if len(orders) > MaxOrders {
+		var done []Order
+		for _, o := range orders {
+			if o.Status != OrderPending {
+				done = append(done, o)
+			}
+		}
+		sort.Slice(done, func(i, j int) bool { return done[i].CreatedAt < done[j].CreatedAt })
+		for i := 0; i < len(done) && len(orders) > MaxOrders; i++ {
+			delete(orders, done[i].ID)
+		}
+	}
+	return saveJSONFile(OrderFile, orders)
+}
+
+func paymentHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		mutex.Lock()
+		cfg, err := loadPaymentConfig()
+		mutex.Unlock()
+		if err != nil {
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca konfigurasi pembayaran", nil)
+			return
+		}
+		jsonResponse(w, http.StatusOK, true, "Konfigurasi pembayaran", cfg)
+	case http.MethodPost:
+		var req PaymentRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		cfg, err := loadPaymentConfig()
+		if err != nil {
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca konfigurasi pembayaran", nil)
+			return
+		}
+		before := cfg.public()
+		if req.Gateway != nil {
+			cfg.Gateway = *req.Gateway
+		}
+		if req.OrderTTL != nil {
+			cfg.OrderTTL = *req.OrderTTL
+		}
+		if req.RotateSecret {
+			cfg.WebhookSecret = randomHex(24)
+		}
+		if _, err := cfg.gateway(); err != nil {
+			jsonResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+			return
+		}
+		if cfg.OrderTTL < 5 || cfg.OrderTTL > 7*24*60 {
+			jsonResponse(w, http.StatusBadRequest, false, "order_ttl_minutes harus 5-10080", nil)
+			return
+		}
+		if isDryRun(r) {
+			dryRunState(w, false, nil, nil, map[string]interface{}{PaymentConfigFile: cfg})
+			return
+		}
+		if err := saveJSONFile(PaymentConfigFile, cfg); err != nil {
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan konfigurasi pembayaran", nil)
+			return
+		}
+		recordAudit(r, "payment.update", map[string]interface{}{
+			"before": before, "after": cfg.public(), "secret_rotated": req.RotateSecret,
+		})
+		jsonResponse(w, http.StatusOK, true, "Konfigurasi pembayaran disimpan", cfg)
+	default:
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+	}
+}
+
+// listOrders mendukung filter ?id=, ?status= dan ?telegram_id=
+func listOrders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	q := r.URL.Query()
+	var telegramID int64
+	if v := q.Get("telegram_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			jsonResponse(w, http.StatusBadRequest, false, "telegram_id tidak valid", nil)
+			return
+		}
+		telegramID = id
+	}
+
+	mutex.Lock()
+	orders, err := loadOrders()
+	mutex.Unlock()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data order", nil)
+		return
+	}
+	list := []Order{}
+	for _, o := range orders {
+		if (q.Get("id") != "" && o.ID != q.Get("id")) ||
+			(q.Get("status") != "" && o.Status != q.Get("status")) ||
+			(telegramID != 0 && o.TelegramID != telegramID) {
+			continue
+		}
+		list = append(list, o)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt > list[j].CreatedAt })
+	jsonResponse(w, http.StatusOK, true, "Daftar order", list)
+}
+
+// createOrder membuat tagihan untuk plan public berbayar. Order create
+// ditolak jika password sudah ada; order renew hanya untuk akun milik
+// telegram_id. Akun dibuat atau diperpanjang setelah order dibayar.
+func createOrder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	var req OrderRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.PlanID == "" || req.Password == "" {
+		jsonResponse(w, http.StatusBadRequest, false, "plan_id dan password wajib diisi", nil)
+		return
+	}
+	if strings.Contains(req.Password, "|") {
+		jsonResponse(w, http.StatusBadRequest, false, "Password tidak boleh mengandung karakter '|'", nil)
+		return
+	}
+
+	mutex.Lock()
+	plans, err := loadPlans()
+	cfg, err2 := loadPaymentConfig()
+	// Akun dicek lagi saat order dibayar; di sini agar order yang pasti
+	// gagal tidak sempat ditagih
+	_, err3 := planOrderAccount(Order{Password: req.Password, TelegramID: req.TelegramID, Action: orderAction(req.Renew)})
+	mutex.Unlock()
+	if err != nil || err2 != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data plan atau konfigurasi pembayaran", nil)
+		return
+	}
+	switch {
+	case errors.Is(err3, errUserExists):
+		jsonResponse(w, http.StatusConflict, false, "User sudah ada; perpanjang lewat order renew", nil)
+		return
+	case errors.Is(err3, errNotOwner):
+		jsonResponse(w, http.StatusForbidden, false, "Akun bukan milik telegram_id ini", nil)
+		return
+	case errors.Is(err3, errUserNotFound):
+		jsonResponse(w, http.StatusNotFound, false, "User tidak ditemukan", nil)
+		return
+	case err3 != nil:
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca database user", nil)
+		return
+	}
+	plan, ok := plans[req.PlanID]
+	if !ok || plan.Visibility != PlanPublic {
+		jsonResponse(w, http.StatusNotFound, false, "Plan tidak ditemukan", nil)
+		return
+	}
+	if plan.Price <= 0 {
+		jsonResponse(w, http.StatusBadRequest, false, "Plan gratis tidak perlu order", nil)
+		return
+	}
+	gw, err := cfg.gateway()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, err.Error(), nil)
+		return
+	}
+
+	now := time.Now()
+	order := Order{
+		ID:         "o" + now.Format("060102") + randomHex(3),
+		Plan:       plan.ID,
+		Password:   req.Password,
+		Days:       plan.Days,
+		LimitIP:    plan.LimitIP,
+		LimitQuota: plan.LimitQuota,
+		Amount:     plan.Price,
+		Status:     OrderPending,
+		Gateway:    gw.Name(),
+		TelegramID: req.TelegramID,
+		CreatedAt:  now.Format(time.RFC3339),
+		ExpiresAt:  now.Add(time.Duration(cfg.OrderTTL) * time.Minute).Format(time.RFC3339),
+		Action:     orderAction(req.Renew),
+	}
+	// Dry run tidak membuat tagihan di gateway
+	if isDryRun(r) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		orders, err := loadOrders()
+		if err != nil {
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data order", nil)
+			return
+		}
+		if hasPendingOrder(orders, req.Password) {
+			jsonResponse(w, http.StatusConflict, false, "Masih ada order pending untuk password ini", nil)
+			return
+		}
+		orders[order.ID] = order
+		dryRunState(w, false, nil, nil, map[string]interface{}{OrderFile: orders})
+		return
+	}
+	// Gateway dipanggil tanpa mengunci mutex karena bisa lambat
+	checkout, err := gw.CreateInvoice(r.Context(), payment.Invoice{
+		OrderID:     order.ID,
+		Amount:      order.Amount,
+		Description: fmt.Sprintf("%s (%s)", plan.Name, req.Password),
+		ExpiresAt:   now.Add(time.Duration(cfg.OrderTTL) * time.Minute),
+	})
+	if err != nil {
+		log.Printf("Gagal membuat tagihan order %s: %v", order.ID, err)
+		jsonResponse(w, http.StatusBadGateway, false, "Gagal membuat tagihan di gateway pembayaran", nil)
+		return
+	}
+	order.Reference = checkout.Reference
+	order.PayURL = checkout.PayURL
+	order.Instructions = checkout.Instructions
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	orders, err := loadOrders()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data order", nil)
+		return
+	}
+	if hasPendingOrder(orders, req.Password) {
+		jsonResponse(w, http.StatusConflict, false, "Masih ada order pending untuk password ini", nil)
+		return
+	}
+	orders[order.ID] = order
+	if err := saveOrders(orders); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan order", nil)
+		return
+	}
+	events.publish("order.created", order)
+	jsonResponse(w, http.StatusOK, true, "Order berhasil dibuat", order)
+}
+
+func orderAction(renew bool) string {
+	if renew {
+		return "renew"
+	}
+	return "create"
+}
+
+func hasPendingOrder(orders map[string]Order, password string) bool {
+	for _, o := range orders {
+		if o.Status == OrderPending && o.Password == password {
+			return true
+		}
+	}
+	return false
+}
+
+// planOrderAccount menyusun akun untuk order. Order create ditolak jika
+// password sudah ada; order renew hanya untuk akun yang masih milik
+// pemesan, dan limit akun tidak diubah. Harus dipanggil dengan mutex terkunci.
+func planOrderAccount(order Order) (*accountChange, error) {
+	renew := order.Action == "renew"
+	if renew {
+		if err := checkTelegramOwner(order.Password, order.TelegramID); err != nil {
+			return nil, err
+		}
+	}
+	return planAccount(order.Password, order.Days, order.LimitIP, order.LimitQuota, renew)
+}
+
+// fulfillOrder membuat/memperpanjang akun untuk order yang sudah dibayar.
+// Kegagalan dicatat di order (status failed), bukan dikembalikan ke gateway.
+// Harus dipanggil dengan mutex terkunci; pemanggil menyimpan order.
+func fulfillOrder(order *Order, paidBy string) {
+	order.PaidAt = time.Now().Format(time.RFC3339)
+	order.PaidBy = paidBy
+	order.Error = ""
+
+	change, err := planOrderAccount(*order)
+	if err == nil {
+		err = change.save()
+	}
+	if err != nil {
+		order.Status = OrderFailed
+		order.Error = err.Error()
+		log.Printf("Order %s sudah dibayar tetapi akun gagal dibuat: %v", order.ID, err)
+		events.publish("order.failed", order)
+		return
+	}
+	order.Status = OrderPaid
+	order.Action = change.Action
+	order.AccountExpired = change.Record.Expired
+	// Renew mempertahankan limit akun, bukan limit plan
+	order.LimitIP = change.Record.LimitIP
+	order.LimitQuota = change.Record.LimitQuota
+
+	if err := restartService(); err != nil {
+		log.Printf("Gagal merestart service setelah order %s: %v", order.ID, err)
+	}
+	eventType := "user.created"
+	if change.Action == "renew" {
+		eventType = "user.renewed"
+	}
+	events.publish(eventType, map[string]string{
+		"password": order.Password,
+		"expired":  order.AccountExpired,
+		"plan":     order.Plan,
+		"order":    order.ID,
+	})
+	events.publish("order.paid", map[string]interface{}{
+		"id":          order.ID,
+		"plan":        order.Plan,
+		"password":    order.Password,
+		"amount":      order.Amount,
+		"action":      order.Action,
+		"expired":     order.AccountExpired,
+		"limit_ip":    order.LimitIP,
+		"limit_quota": order.LimitQuota,
+		"domain":      readDomain(),
+		"telegram_id": order.TelegramID,
+		"paid_by":     paidBy,
+		"status_url":  statusLink(order.Password),
+	})
+}
+
+// paymentWebhook dipanggil gateway tanpa API key; keaslian dicek lewat
+// signature oleh Gateway.ParseWebhook.
+func paymentWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	mutex.Lock()
+	cfg, err := loadPaymentConfig()
+	mutex.Unlock()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca konfigurasi pembayaran", nil)
+		return
+	}
+	gw, err := cfg.gateway()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, err.Error(), nil)
+		return
+	}
+	n, err := gw.ParseWebhook(r)
+	if errors.Is(err, payment.ErrInvalidSignature) {
+		jsonResponse(w, http.StatusUnauthorized, false, "Signature tidak valid", nil)
+		return
+	}
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	orders, err := loadOrders()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data order", nil)
+		return
+	}
+	var order Order
+	found := false
+	for _, o := range orders {
+		if o.Gateway == gw.Name() && o.Reference == n.Reference {
+			order, found = o, true
+			break
+		}
+	}
+	if !found {
+		jsonResponse(w, http.StatusNotFound, false, "Order tidak ditemukan", nil)
+		return
+	}
+	// Webhook bisa dikirim ulang; hanya order yang belum selesai diproses
+	if order.Status != OrderPending && order.Status != OrderExpired {
+		jsonResponse(w, http.StatusOK, true, "Order sudah diproses", order)
+		return
+	}
+
+	switch n.Status {
+	case payment.StatusPaid:
+		if n.Amount != 0 && n.Amount < order.Amount {
+			order.Status = OrderFailed
+			order.Error = fmt.Sprintf("jumlah pembayaran %d kurang dari %d", n.Amount, order.Amount)
+			events.publish("order.failed", order)
+		} else {
+			// Pembayaran setelah order kadaluarsa tetap diproses
+			fulfillOrder(&order, "webhook")
+		}
+	case payment.StatusExpired, payment.StatusFailed:
+		if order.Status == OrderPending {
+			order.Status = OrderExpired
+			events.publish("order.expired", order)
+		}
+	default:
+		jsonResponse(w, http.StatusBadRequest, false, "Status pembayaran tidak dikenal", nil)
+		return
+	}
+	orders[order.ID] = order
+	if err := saveOrders(orders); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan order", nil)
+		return
+	}
+	jsonResponse(w, http.StatusOK, true, "Webhook diproses", order)
+}
+
+func markOrderPaid(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	var req OrderRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	orders, err := loadOrders()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data order", nil)
+		return
+	}
+	order, ok := orders[req.ID]
+	if !ok {
+		jsonResponse(w, http.StatusNotFound, false, "Order tidak ditemukan", nil)
+		return
+	}
+	// Order failed boleh dicoba ulang setelah admin memperbaiki penyebabnya
+	if order.Status != OrderPending && order.Status != OrderExpired && order.Status != OrderFailed {
+		jsonResponse(w, http.StatusConflict, false, "Order sudah "+order.Status, nil)
+		return
+	}
+	if isDryRun(r) {
+		change, err := planOrderAccount(order)
+		if errors.Is(err, errUserExists) || errors.Is(err, errUserNotFound) || errors.Is(err, errNotOwner) {
+			jsonResponse(w, http.StatusConflict, false, "Akun order tidak bisa dibuat: "+err.Error(), nil)
+			return
+		}
+		if err != nil {
+			jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca database user", nil)
+			return
+		}
+		order.Status = OrderPaid
+		order.PaidAt = time.Now().Format(time.RFC3339)
+		order.PaidBy = "admin"
+		order.Error = ""
+		order.AccountExpired = change.Record.Expired
+		order.LimitIP = change.Record.LimitIP
+		order.LimitQuota = change.Record.LimitQuota
+		orders[order.ID] = order
+		dryRunState(w, true, change.config, change.users, map[string]interface{}{OrderFile: orders})
+		return
+	}
+	fulfillOrder(&order, "admin")
+	orders[order.ID] = order
+	if err := saveOrders(orders); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan order", nil)
+		return
+	}
+	recordAudit(r, "order.paid", map[string]string{"id": order.ID, "password": order.Password, "status": order.Status})
+	if order.Status == OrderFailed {
+		jsonResponse(w, http.StatusInternalServerError, false, "Order ditandai lunas tetapi akun gagal dibuat: "+order.Error, order)
+		return
+	}
+	jsonResponse(w, http.StatusOK, true, "Order ditandai lunas", order)
+}
+
+func cancelOrder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	var req OrderRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	orders, err := loadOrders()
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal membaca data order", nil)
+		return
+	}
+	order, ok := orders[req.ID]
+	if !ok {
+		jsonResponse(w, http.StatusNotFound, false, "Order tidak ditemukan", nil)
+		return
+	}
+	if order.Status != OrderPending {
+		jsonResponse(w, http.StatusConflict, false, "Order sudah "+order.Status, nil)
+		return
+	}
+	order.Status = OrderCancelled
+	orders[order.ID] = order
+	if isDryRun(r) {
+		dryRunState(w, false, nil, nil, map[string]interface{}{OrderFile: orders})
+		return
+	}
+	if err := saveOrders(orders); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, false, "Gagal menyimpan order", nil)
+		return
+	}
+	recordAudit(r, "order.cancel", map[string]string{"id": order.ID, "password": order.Password})
+	jsonResponse(w, http.StatusOK, true, "Order dibatalkan", order)
+}
+
+// expireOrders menandai order pending yang lewat batas waktu sebagai expired
+func expireOrders() {
+	ticker := time.NewTicker(OrderCheckInterval)
+	for range ticker.C {
+		now := time.Now()
+		mutex.Lock()
+		orders, err := loadOrders()
+		if err != nil {
+			mutex.Unlock()
+			log.Printf("Gagal membaca data order: %v", err)
+			continue
+		}
+		var expired []Order
+		for id, o := range orders {
+			exp, err := time.Parse(time.RFC3339, o.ExpiresAt)
+			if o.Status != OrderPending || err != nil || now.Before(exp) {
+				continue
+			}
+			o.Status = OrderExpired
+			orders[id] = o
+			expired = append(expired, o)
+		}
+		if len(expired) > 0 {
+			if err := saveOrders(orders); err != nil {
+				log.Printf("Gagal menyimpan data order: %v", err)
+			} else {
+				for _, o := range expired {
+					events.publish("order.expired", o)
+				}
+			}
+		}
+		mutex.Unlock()
+	}
 }
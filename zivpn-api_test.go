@@ -0,0 +1,940 @@
+package main
+
+// zivpn-api.go dan zivpn-bot.go sama-sama package main di direktori yang
+// sama, jadi jalankan test API dengan menyebut file-nya langsung:
+//
+//	go test zivpn-api.go zivpn-api_test.go
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"zivpn/payment"
+)
+
+var routesOnce sync.Once
+
+// setupRoutes mengisi tabel route sekali saja, karena ServeMux menolak
+// pattern yang didaftarkan dua kali.
+func setupRoutes(t *testing.T) {
+	t.Helper()
+	routesOnce.Do(registerRoutes)
+	if len(registeredRoutes) == 0 {
+		t.Fatal("registerRoutes tidak mendaftarkan route apa pun")
+	}
+}
+
+func TestEveryRouteDocumented(t *testing.T) {
+	setupRoutes(t)
+
+	data, err := docsFS.ReadFile("docs/openapi.json")
+	if err != nil {
+		t.Fatalf("gagal membaca spesifikasi: %v", err)
+	}
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatalf("spesifikasi tidak valid: %v", err)
+	}
+
+	for _, route := range registeredRoutes {
+		var ops int
+		for path, methods := range spec.Paths {
+			if path == route || (strings.HasSuffix(route, "/") && strings.HasPrefix(path, route)) {
+				ops += len(methods)
+			}
+		}
+		if ops == 0 {
+			t.Errorf("route %s tidak punya operasi di docs/openapi.json", route)
+		}
+	}
+
+	if err := verifyApiSpec(); err != nil {
+		t.Errorf("verifyApiSpec: %v", err)
+	}
+}
+
+func TestVerifyApiSpecRejectsUndocumentedRoute(t *testing.T) {
+	setupRoutes(t)
+
+	saved := registeredRoutes
+	defer func() { registeredRoutes = saved }()
+	registeredRoutes = append(append([]string(nil), saved...), "/api/tidak-terdokumentasi")
+
+	err := verifyApiSpec()
+	if err == nil {
+		t.Fatal("verifyApiSpec harus gagal untuk route tanpa spesifikasi")
+	}
+	if !strings.Contains(err.Error(), "/api/tidak-terdokumentasi") {
+		t.Errorf("error tidak menyebut route yang hilang: %v", err)
+	}
+}
+
+// useTempState mengarahkan semua file state ke direktori sementara dan
+// mengganti systemctl dengan stub, sehingga handler bisa diuji tanpa
+// menyentuh /etc/zivpn atau service sungguhan.
+func useTempState(t *testing.T) {
+	t.Helper()
+	setupRoutes(t)
+
+	root := t.TempDir()
+	paths := []*string{
+		&StateDir, &ConfigFile, &UserDB, &DomainFile, &ApiKeyFile, &RestoreJournalFile,
+		&IPLimitFile, &SuspendedFile, &ViolationsFile, &UsageFile, &PortHopFile,
+		&CertConfigFile, &ACMEAccountKeyFile, &AuditFile, &HistoryDir, &HistoryFile,
+		&UdpgwConfigFile, &ResellerFile, &LedgerFile, &OwnerFile, &TelegramOwnerFile,
+		&PlanFile, &VoucherFile, &OrderFile, &PaymentConfigFile, &StatusTokenFile,
+	}
+	saved := make([]string, len(paths))
+	for i, p := range paths {
+		saved[i] = *p
+		*p = filepath.Join(root, *p)
+	}
+	t.Cleanup(func() {
+		for i, p := range paths {
+			*p = saved[i]
+		}
+	})
+	if err := os.MkdirAll(StateDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	bin := filepath.Join(root, "bin")
+	if err := os.Mkdir(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(bin, "systemctl"), []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	writeState(t, ConfigFile, `{"listen": ":5667", "auth": {"mode": "passwords", "config": []}}`)
+}
+
+// writeState menulis isi awal file state; selain string, nilai disimpan
+// sebagai JSON
+func writeState(t *testing.T, path string, v interface{}) {
+	t.Helper()
+	data, ok := v.(string)
+	if !ok {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = string(b)
+	}
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readState(t *testing.T, path string, v interface{}) {
+	t.Helper()
+	if err := loadJSONFile(path, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type apiResult struct {
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// call mengirim request lewat router, dengan API key master jika key kosong
+func call(t *testing.T, method, path, key string, body interface{}) (int, apiResult) {
+	t.Helper()
+	var rd *bytes.Reader
+	if s, ok := body.(string); ok {
+		rd = bytes.NewReader([]byte(s))
+	} else {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rd = bytes.NewReader(b)
+	}
+	req := httptest.NewRequest(method, path, rd)
+	if key == "" {
+		key = AuthToken
+	}
+	req.Header.Set("X-API-Key", key)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	var res apiResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("%s %s: response bukan JSON: %s", method, path, rec.Body.String())
+	}
+	return rec.Code, res
+}
+
+func userExists(t *testing.T, password string) bool {
+	t.Helper()
+	_, ok, err := findUser(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ok
+}
+
+// --- Reseller ---
+
+const testResellerKey = "reseller-key"
+
+func seedReseller(t *testing.T, credit int64) {
+	t.Helper()
+	writeState(t, ResellerFile, map[string]Reseller{
+		"r1": {ID: "r1", Name: "Toko", KeyHash: hashAPIKey(testResellerKey), Credit: credit, PricePerDay: 10},
+	})
+}
+
+func resellerCredit(t *testing.T) int64 {
+	t.Helper()
+	resellers := map[string]Reseller{}
+	readState(t, ResellerFile, &resellers)
+	return resellers["r1"].Credit
+}
+
+func TestResellerDebit(t *testing.T) {
+	tests := []struct {
+		name       string
+		credit     int64
+		path       string
+		body       UserRequest
+		failWrite  bool // users.db tidak bisa ditulis
+		wantStatus int
+		wantCredit int64
+		wantLedger []string // tipe entri ledger berurutan
+	}{
+		{
+			name: "create memotong kredit", credit: 100,
+			path: "/api/user/create", body: UserRequest{Password: "baru", Days: 3},
+			wantStatus: http.StatusOK, wantCredit: 70, wantLedger: []string{"create"},
+		},
+		{
+			name: "renew memotong kredit", credit: 100,
+			path: "/api/user/renew", body: UserRequest{Password: "lama", Days: 5},
+			wantStatus: http.StatusOK, wantCredit: 50, wantLedger: []string{"renew"},
+		},
+		{
+			name: "kredit kurang ditolak tanpa potongan", credit: 20,
+			path: "/api/user/create", body: UserRequest{Password: "baru", Days: 3},
+			wantStatus: http.StatusPaymentRequired, wantCredit: 20,
+		},
+		{
+			name: "create gagal ditulis dikembalikan", credit: 100,
+			path: "/api/user/create", body: UserRequest{Password: "baru", Days: 3}, failWrite: true,
+			wantStatus: http.StatusInternalServerError, wantCredit: 100, wantLedger: []string{"create", "refund"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTempState(t)
+			seedReseller(t, tt.credit)
+			writeState(t, UserDB, "lama | 2099-01-01\n")
+			writeState(t, OwnerFile, map[string]string{"lama": "r1"})
+			if tt.failWrite {
+				// Folder users.db tidak ada: dibaca sebagai kosong, gagal saat ditulis
+				UserDB = filepath.Join(StateDir, "hilang", "users.db")
+			}
+
+			status, res := call(t, http.MethodPost, tt.path, testResellerKey, tt.body)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d (%s), ingin %d", status, res.Message, tt.wantStatus)
+			}
+			if got := resellerCredit(t); got != tt.wantCredit {
+				t.Errorf("kredit = %d, ingin %d", got, tt.wantCredit)
+			}
+			var ledger []LedgerEntry
+			readState(t, LedgerFile, &ledger)
+			var types []string
+			for _, e := range ledger {
+				types = append(types, e.Type)
+			}
+			if strings.Join(types, ",") != strings.Join(tt.wantLedger, ",") {
+				t.Errorf("ledger = %v, ingin %v", types, tt.wantLedger)
+			}
+			if len(ledger) > 0 && ledger[len(ledger)-1].Balance != tt.wantCredit {
+				t.Errorf("saldo ledger terakhir = %d, ingin %d", ledger[len(ledger)-1].Balance, tt.wantCredit)
+			}
+		})
+	}
+}
+
+// Kredit untuk tepat dua akun: request paralel tidak boleh membuat saldo
+// minus atau membuat akun tanpa potongan.
+func TestResellerDebitConcurrent(t *testing.T) {
+	useTempState(t)
+	seedReseller(t, 60)
+
+	var wg sync.WaitGroup
+	statuses := make([]int, 6)
+	for i := range statuses {
+		wg.Add(1)
+		body, _ := json.Marshal(UserRequest{Password: "akun" + string(rune('a'+i)), Days: 3})
+		go func(i int) {
+			defer wg.Done()
+			// Tanpa call: t.Fatal tidak boleh dipanggil dari goroutine lain
+			req := httptest.NewRequest(http.MethodPost, "/api/user/create", bytes.NewReader(body))
+			req.Header.Set("X-API-Key", testResellerKey)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			statuses[i] = rec.Code
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for _, s := range statuses {
+		switch s {
+		case http.StatusOK:
+			created++
+		case http.StatusPaymentRequired:
+		default:
+			t.Errorf("status tak terduga %d", s)
+		}
+	}
+	if created != 2 {
+		t.Errorf("akun dibuat = %d, ingin 2", created)
+	}
+	if got := resellerCredit(t); got != 0 {
+		t.Errorf("kredit = %d, ingin 0", got)
+	}
+	users, err := loadUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != created {
+		t.Errorf("users.db berisi %d akun, ingin %d", len(users), created)
+	}
+}
+
+// --- Voucher ---
+
+func seedPlan(t *testing.T) Plan {
+	t.Helper()
+	plan := Plan{ID: "p30", Name: "30 Hari", Days: 30, LimitIP: 2, LimitQuota: 10, Price: 15000, Visibility: "public"}
+	writeState(t, PlanFile, map[string]Plan{plan.ID: plan})
+	return plan
+}
+
+func TestRedeemVoucher(t *testing.T) {
+	const code = "ZV-TEST"
+	tests := []struct {
+		name       string
+		voucher    Voucher
+		revoke     bool // dicabut lewat /api/voucher/revoke sebelum redeem
+		req        VoucherRedeemRequest
+		failWrite  bool
+		wantStatus int
+		wantAction string
+		wantUses   int
+		wantRecord UserRecord // Expired diisi hari dari sekarang, lihat wantDays
+		wantDays   int
+	}{
+		{
+			name:       "create akun baru",
+			voucher:    Voucher{MaxUses: 1},
+			req:        VoucherRedeemRequest{Password: "baru", TelegramID: 7},
+			wantStatus: http.StatusOK, wantAction: "create", wantUses: 1,
+			wantRecord: UserRecord{Password: "baru", LimitIP: 2, LimitQuota: 10}, wantDays: 30,
+		},
+		{
+			name:       "pemakaian kedua voucher multi-use",
+			voucher:    Voucher{MaxUses: 2, Uses: 1},
+			req:        VoucherRedeemRequest{Password: "baru"},
+			wantStatus: http.StatusOK, wantAction: "create", wantUses: 2,
+			wantRecord: UserRecord{Password: "baru", LimitIP: 2, LimitQuota: 10}, wantDays: 30,
+		},
+		{
+			name:       "max uses habis",
+			voucher:    Voucher{MaxUses: 1, Uses: 1},
+			req:        VoucherRedeemRequest{Password: "baru"},
+			wantStatus: http.StatusConflict, wantUses: 1,
+		},
+		{
+			name:       "kadaluarsa",
+			voucher:    Voucher{MaxUses: 1, ExpiresAt: "2000-01-01"},
+			req:        VoucherRedeemRequest{Password: "baru"},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "dicabut",
+			voucher:    Voucher{MaxUses: 5},
+			revoke:     true,
+			req:        VoucherRedeemRequest{Password: "baru"},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "password sudah ada tanpa renew",
+			voucher:    Voucher{MaxUses: 1},
+			req:        VoucherRedeemRequest{Password: "lama", TelegramID: 7},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "renew akun milik telegram_id mempertahankan limit",
+			voucher:    Voucher{MaxUses: 1},
+			req:        VoucherRedeemRequest{Password: "lama", TelegramID: 7, Renew: true},
+			wantStatus: http.StatusOK, wantAction: "renew", wantUses: 1,
+			wantRecord: UserRecord{Password: "lama", LimitIP: 5, LimitQuota: 100}, wantDays: 40,
+		},
+		{
+			name:       "renew akun milik orang lain",
+			voucher:    Voucher{MaxUses: 1},
+			req:        VoucherRedeemRequest{Password: "lama", TelegramID: 8, Renew: true},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "create gagal ditulis voucher dikembalikan",
+			voucher:    Voucher{MaxUses: 1},
+			req:        VoucherRedeemRequest{Password: "baru"},
+			failWrite:  true,
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTempState(t)
+			plan := seedPlan(t)
+			tt.voucher.Code, tt.voucher.Batch, tt.voucher.Plan = code, "b1", plan.ID
+			writeState(t, VoucherFile, map[string]Voucher{code: tt.voucher})
+			lama := UserRecord{Password: "lama", Expired: time.Now().AddDate(0, 0, 10).Format("2006-01-02"), LimitIP: 5, LimitQuota: 100}
+			writeState(t, UserDB, lama.String()+"\n")
+			writeState(t, TelegramOwnerFile, map[string]int64{"lama": 7})
+			if tt.failWrite {
+				UserDB = filepath.Join(StateDir, "hilang", "users.db")
+			}
+			if tt.revoke {
+				if status, res := call(t, http.MethodPost, "/api/voucher/revoke", "", VoucherRevokeRequest{Code: code}); status != http.StatusOK {
+					t.Fatalf("revoke: %d %s", status, res.Message)
+				}
+			}
+
+			tt.req.Code = strings.ToLower(code)
+			status, res := call(t, http.MethodPost, "/api/voucher/redeem", "", tt.req)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d (%s), ingin %d", status, res.Message, tt.wantStatus)
+			}
+
+			vouchers := map[string]Voucher{}
+			readState(t, VoucherFile, &vouchers)
+			v := vouchers[code]
+			if v.Uses != tt.wantUses {
+				t.Errorf("uses = %d, ingin %d", v.Uses, tt.wantUses)
+			}
+			if redeemed := len(v.Redemptions); redeemed != tt.wantUses-tt.voucher.Uses {
+				t.Errorf("redemptions = %d, ingin %d", redeemed, tt.wantUses-tt.voucher.Uses)
+			}
+			if tt.wantAction == "" {
+				if tt.req.Password == "baru" && userExists(t, "baru") {
+					t.Error("akun dibuat padahal redeem ditolak")
+				}
+				return
+			}
+
+			var result VoucherRedeemResult
+			if err := json.Unmarshal(res.Data, &result); err != nil {
+				t.Fatal(err)
+			}
+			if result.Action != tt.wantAction {
+				t.Errorf("action = %q, ingin %q", result.Action, tt.wantAction)
+			}
+			if result.UsesLeft != v.MaxUses-v.Uses {
+				t.Errorf("uses_left = %d, ingin %d", result.UsesLeft, v.MaxUses-v.Uses)
+			}
+			want := tt.wantRecord
+			want.Expired = time.Now().AddDate(0, 0, tt.wantDays).Format("2006-01-02")
+			got, ok, err := findUser(tt.req.Password)
+			if err != nil || !ok {
+				t.Fatalf("akun %s tidak ada di users.db: %v", tt.req.Password, err)
+			}
+			if got != want {
+				t.Errorf("akun = %+v, ingin %+v", got, want)
+			}
+		})
+	}
+}
+
+// --- Order & Pembayaran ---
+
+const testWebhookSecret = "rahasia-webhook"
+
+// sendWebhook mengirim webhook gateway mock; sig kosong berarti body
+// ditandatangani dengan secret yang benar
+func sendWebhook(t *testing.T, n payment.Notification, sig string) (int, apiResult) {
+	t.Helper()
+	body, goodSig, err := payment.NewMock(testWebhookSecret).Notify(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig == "" {
+		sig = goodSig
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/payment/webhook", bytes.NewReader(body))
+	req.Header.Set(payment.MockSignatureHeader, sig)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	var res apiResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("response webhook bukan JSON: %s", rec.Body.String())
+	}
+	return rec.Code, res
+}
+
+func TestPaymentWebhook(t *testing.T) {
+	const ref = "MOCK-TEST"
+	paid := payment.Notification{Reference: ref, Status: payment.StatusPaid, Amount: 15000}
+	tests := []struct {
+		name        string
+		status      string // status order sebelum webhook
+		webhooks    []payment.Notification
+		badSig      bool
+		wantCodes   []int
+		wantStatus  string
+		wantAccount bool
+	}{
+		{
+			name:   "signature salah ditolak",
+			status: OrderPending, webhooks: []payment.Notification{paid}, badSig: true,
+			wantCodes: []int{http.StatusUnauthorized}, wantStatus: OrderPending,
+		},
+		{
+			name:   "paid membuat akun",
+			status: OrderPending, webhooks: []payment.Notification{paid},
+			wantCodes: []int{http.StatusOK}, wantStatus: OrderPaid, wantAccount: true,
+		},
+		{
+			name:   "paid dikirim ulang hanya diproses sekali",
+			status: OrderPending, webhooks: []payment.Notification{paid, paid},
+			wantCodes: []int{http.StatusOK, http.StatusOK}, wantStatus: OrderPaid, wantAccount: true,
+		},
+		{
+			name:   "paid setelah kadaluarsa tetap diproses",
+			status: OrderExpired, webhooks: []payment.Notification{paid},
+			wantCodes: []int{http.StatusOK}, wantStatus: OrderPaid, wantAccount: true,
+		},
+		{
+			name:   "jumlah kurang gagal",
+			status: OrderPending, webhooks: []payment.Notification{{Reference: ref, Status: payment.StatusPaid, Amount: 1000}},
+			wantCodes: []int{http.StatusOK}, wantStatus: OrderFailed,
+		},
+		{
+			name:   "expired",
+			status: OrderPending, webhooks: []payment.Notification{{Reference: ref, Status: payment.StatusExpired}},
+			wantCodes: []int{http.StatusOK}, wantStatus: OrderExpired,
+		},
+		{
+			name:   "failed dianggap expired",
+			status: OrderPending, webhooks: []payment.Notification{{Reference: ref, Status: payment.StatusFailed}},
+			wantCodes: []int{http.StatusOK}, wantStatus: OrderExpired,
+		},
+		{
+			name:   "paid setelah dibatalkan diabaikan",
+			status: OrderCancelled, webhooks: []payment.Notification{paid},
+			wantCodes: []int{http.StatusOK}, wantStatus: OrderCancelled,
+		},
+		{
+			name:   "reference tidak dikenal",
+			status: OrderPending, webhooks: []payment.Notification{{Reference: "MOCK-LAIN", Status: payment.StatusPaid}},
+			wantCodes: []int{http.StatusNotFound}, wantStatus: OrderPending,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTempState(t)
+			writeState(t, PaymentConfigFile, PaymentConfig{Gateway: "mock", WebhookSecret: testWebhookSecret, OrderTTL: DefaultOrderTTL})
+			writeState(t, OrderFile, map[string]Order{"o1": {
+				ID: "o1", Plan: "p30", Password: "pembeli", Days: 30, LimitIP: 2, LimitQuota: 10,
+				Amount: 15000, Status: tt.status, Gateway: "mock", Reference: ref, Action: "create",
+			}})
+
+			for i, n := range tt.webhooks {
+				sig := ""
+				if tt.badSig {
+					sig = payment.NewMock("secret-lain").Sign([]byte("{}"))
+				}
+				if status, res := sendWebhook(t, n, sig); status != tt.wantCodes[i] {
+					t.Fatalf("webhook %d: status = %d (%s), ingin %d", i+1, status, res.Message, tt.wantCodes[i])
+				}
+			}
+
+			orders := map[string]Order{}
+			readState(t, OrderFile, &orders)
+			order := orders["o1"]
+			if order.Status != tt.wantStatus {
+				t.Errorf("status order = %q (%s), ingin %q", order.Status, order.Error, tt.wantStatus)
+			}
+			users, err := loadUsers()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantAccount != (len(users) == 1) || len(users) > 1 {
+				t.Fatalf("users.db = %v, akun dibuat = %v", users, tt.wantAccount)
+			}
+			if !tt.wantAccount {
+				return
+			}
+			want := UserRecord{Password: "pembeli", Expired: time.Now().AddDate(0, 0, 30).Format("2006-01-02"), LimitIP: 2, LimitQuota: 10}
+			if got, _ := parseUserLine(users[0]); got != want {
+				t.Errorf("akun = %+v, ingin %+v", got, want)
+			}
+			if order.PaidBy != "webhook" || order.AccountExpired != want.Expired {
+				t.Errorf("order paid_by = %q, account_expired = %q", order.PaidBy, order.AccountExpired)
+			}
+		})
+	}
+}
+
+// --- Limit IP ---
+
+// seedUsers menulis users.db dan memasukkan semua password ke config.json
+func seedUsers(t *testing.T, recs ...UserRecord) {
+	t.Helper()
+	config := Config{Listen: ":5667"}
+	config.Auth.Mode = "passwords"
+	config.Auth.Config = []string{}
+	var lines []string
+	for _, rec := range recs {
+		config.Auth.Config = append(config.Auth.Config, rec.Password)
+		lines = append(lines, rec.String())
+	}
+	if err := saveConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveUsers(lines); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// inConfig bernilai true jika password masih bisa login (ada di config.json)
+func inConfig(t *testing.T, password string) bool {
+	t.Helper()
+	config, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range config.Auth.Config {
+		if p == password {
+			return true
+		}
+	}
+	return false
+}
+
+func suspension(t *testing.T, password string) (Suspension, bool) {
+	t.Helper()
+	suspended, err := loadSuspensions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, ok := suspended[password]
+	return s, ok
+}
+
+func TestDeviceCountPerPassword(t *testing.T) {
+	tracker := &sessionTracker{
+		live:     make(map[string]map[string]*Session),
+		history:  make(map[string][]Session),
+		addrUser: make(map[string]string),
+	}
+	now := time.Now()
+	logs := []string{
+		`2024-01-01T10:00:00Z INFO client connected {"addr": "10.0.0.1:1000", "id": "alice"}`,
+		// IP sama, port lain: tetap satu device
+		`2024-01-01T10:00:01Z INFO client connected {"addr": "10.0.0.1:1001", "id": "alice"}`,
+		`2024-01-01T10:00:02Z INFO client connected {"addr": "10.0.0.2:2000", "id": "alice"}`,
+		// IP yang sama dipakai user lain tidak dihitung ke alice
+		`2024-01-01T10:00:03Z INFO client connected {"addr": "10.0.0.1:3000", "id": "bob"}`,
+		`2024-01-01T10:00:04Z ERROR TCP error {"addr": "10.0.0.3:4000", "id": "carol", "error": "eof"}`,
+	}
+	for _, line := range logs {
+		tracker.ingest(line, now)
+	}
+	// Kosongkan antrean cek limit yang diisi tracker
+	for len(deviceChecks) > 0 {
+		<-deviceChecks
+	}
+
+	want := map[string][]string{
+		"alice": {"10.0.0.1", "10.0.0.2"},
+		"bob":   {"10.0.0.1"},
+		"carol": {"10.0.0.3"},
+		"dave":  {},
+	}
+	for password, ips := range want {
+		if got := tracker.deviceIPs(password); strings.Join(got, ",") != strings.Join(ips, ",") {
+			t.Errorf("device %s = %v, ingin %v", password, got, ips)
+		}
+	}
+
+	// Disconnect tanpa field id dicocokkan lewat addr; device hilang
+	// setelah masa tenggang reconnect
+	tracker.ingest(`2024-01-01T10:01:00Z INFO client disconnected {"addr": "10.0.0.2:2000"}`, now)
+	tracker.expire(now.Add(SessionGracePeriod / 2))
+	if got := tracker.deviceIPs("alice"); len(got) != 2 {
+		t.Errorf("device alice dalam masa tenggang = %v, ingin tetap 2", got)
+	}
+	tracker.expire(now.Add(SessionGracePeriod + time.Second))
+	if got := tracker.deviceIPs("alice"); strings.Join(got, ",") != "10.0.0.1" {
+		t.Errorf("device alice setelah disconnect = %v, ingin [10.0.0.1]", got)
+	}
+}
+
+func TestCheckDeviceLimit(t *testing.T) {
+	ips := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}
+	tests := []struct {
+		name           string
+		policy         IPLimitPolicy
+		limitIP        int
+		ips            []string
+		checks         int // jumlah pengecekan berturut-turut
+		wantViolations int
+		wantSuspended  bool
+		wantUntil      time.Duration // 0 = terkunci tanpa batas
+	}{
+		{
+			name:   "warn hanya mencatat",
+			policy: IPLimitPolicy{Enabled: true, Action: IPLimitWarn}, limitIP: 2, ips: ips, checks: 1,
+			wantViolations: 1,
+		},
+		{
+			name:   "suspend sementara",
+			policy: IPLimitPolicy{Enabled: true, Action: IPLimitSuspend, SuspendMinutes: 30}, limitIP: 2, ips: ips, checks: 1,
+			wantViolations: 1, wantSuspended: true, wantUntil: 30 * time.Minute,
+		},
+		{
+			name:   "lock sampai dibuka admin",
+			policy: IPLimitPolicy{Enabled: true, Action: IPLimitLock}, limitIP: 2, ips: ips, checks: 1,
+			wantViolations: 1, wantSuspended: true,
+		},
+		{
+			name:   "pelanggaran berulang dalam cooldown dicatat sekali",
+			policy: IPLimitPolicy{Enabled: true, Action: IPLimitWarn}, limitIP: 2, ips: ips, checks: 3,
+			wantViolations: 1,
+		},
+		{
+			name:   "masih dalam limit",
+			policy: IPLimitPolicy{Enabled: true, Action: IPLimitLock}, limitIP: 3, ips: ips, checks: 1,
+		},
+		{
+			name:   "tanpa limit",
+			policy: IPLimitPolicy{Enabled: true, Action: IPLimitLock}, limitIP: 0, ips: ips, checks: 1,
+		},
+		{
+			name:   "kebijakan nonaktif",
+			policy: IPLimitPolicy{Enabled: false, Action: IPLimitLock}, limitIP: 1, ips: ips, checks: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTempState(t)
+			t.Cleanup(func() { delete(lastViolation, "alice") })
+			seedUsers(t, UserRecord{Password: "alice", Expired: "2099-01-01", LimitIP: tt.limitIP})
+			writeState(t, IPLimitFile, tt.policy)
+
+			start := time.Now()
+			for i := 0; i < tt.checks; i++ {
+				checkDeviceLimit("alice", tt.ips)
+			}
+
+			violations, err := loadViolations()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(violations) != tt.wantViolations {
+				t.Fatalf("pelanggaran = %d, ingin %d", len(violations), tt.wantViolations)
+			}
+			if len(violations) > 0 {
+				v := violations[0]
+				if v.Action != tt.policy.Action || v.Devices != len(tt.ips) || v.Limit != tt.limitIP {
+					t.Errorf("pelanggaran = %+v", v)
+				}
+			}
+
+			s, suspended := suspension(t, "alice")
+			if suspended != tt.wantSuspended {
+				t.Fatalf("suspend = %v, ingin %v", suspended, tt.wantSuspended)
+			}
+			if got := inConfig(t, "alice"); got == tt.wantSuspended {
+				t.Errorf("alice di config.json = %v, ingin %v", got, !tt.wantSuspended)
+			}
+			if !suspended {
+				return
+			}
+			if s.Reason != "ip_limit" {
+				t.Errorf("reason = %q, ingin ip_limit", s.Reason)
+			}
+			if tt.wantUntil == 0 {
+				if s.Until != "" {
+					t.Errorf("until = %q, ingin terkunci tanpa batas", s.Until)
+				}
+				return
+			}
+			until, err := time.Parse(time.RFC3339, s.Until)
+			if err != nil {
+				t.Fatalf("until %q: %v", s.Until, err)
+			}
+			if d := until.Sub(start); d < tt.wantUntil-time.Second || d > tt.wantUntil+time.Second {
+				t.Errorf("until = %s dari sekarang, ingin %s", d, tt.wantUntil)
+			}
+		})
+	}
+}
+
+func TestLiftExpiredSuspensions(t *testing.T) {
+	useTempState(t)
+	seedUsers(t,
+		UserRecord{Password: "habis", Expired: "2099-01-01"},
+		UserRecord{Password: "belum", Expired: "2099-01-01"},
+		UserRecord{Password: "kunci", Expired: "2099-01-01"},
+	)
+	now := time.Now()
+	mutex.Lock()
+	for password, until := range map[string]time.Time{
+		"habis": now.Add(-time.Minute),
+		"belum": now.Add(time.Hour),
+		"kunci": {},
+	} {
+		if err := suspendUser(password, "ip_limit", until); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mutex.Unlock()
+
+	liftExpiredSuspensions(now)
+
+	for password, wantSuspended := range map[string]bool{"habis": false, "belum": true, "kunci": true} {
+		if _, got := suspension(t, password); got != wantSuspended {
+			t.Errorf("%s disuspend = %v, ingin %v", password, got, wantSuspended)
+		}
+		if got := inConfig(t, password); got == wantSuspended {
+			t.Errorf("%s di config.json = %v, ingin %v", password, got, !wantSuspended)
+		}
+	}
+}
+
+// --- Kuota ---
+
+func TestEnforceQuotas(t *testing.T) {
+	const gb = int64(1) << 30
+	tests := []struct {
+		name       string
+		limitGB    int
+		used       int64
+		suspended  string // reason suspend sebelumnya, kosong jika aktif
+		wantReason string // kosong jika tetap aktif
+	}{
+		{name: "di bawah limit", limitGB: 1, used: gb - 1},
+		{name: "tepat mencapai limit", limitGB: 1, used: gb, wantReason: "quota"},
+		{name: "melewati limit", limitGB: 1, used: 2 * gb, wantReason: "quota"},
+		{name: "tanpa limit", limitGB: 0, used: 100 * gb},
+		{name: "sudah disuspend limit IP", limitGB: 1, used: 2 * gb, suspended: "ip_limit", wantReason: "ip_limit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTempState(t)
+			seedUsers(t, UserRecord{Password: "alice", Expired: "2099-01-01", LimitQuota: tt.limitGB})
+			usage := map[string]Usage{"alice": {UploadBytes: tt.used / 2, DownloadBytes: tt.used - tt.used/2}}
+			writeState(t, UsageFile, usage)
+
+			mutex.Lock()
+			if tt.suspended != "" {
+				if err := suspendUser("alice", tt.suspended, time.Time{}); err != nil {
+					mutex.Unlock()
+					t.Fatal(err)
+				}
+			}
+			enforceQuotas(usage)
+			mutex.Unlock()
+
+			s, suspended := suspension(t, "alice")
+			if s.Reason != tt.wantReason {
+				t.Errorf("reason suspend = %q, ingin %q", s.Reason, tt.wantReason)
+			}
+			if got := inConfig(t, "alice"); got == suspended {
+				t.Errorf("alice di config.json = %v, ingin %v", got, !suspended)
+			}
+		})
+	}
+}
+
+func TestQuotaResetAndTopUp(t *testing.T) {
+	const gb = int64(1) << 30
+	tests := []struct {
+		name          string
+		reason        string // alasan suspend awal
+		used          int64
+		path          string
+		gb            int
+		wantLimit     int
+		wantUsed      int64
+		wantSuspended bool
+	}{
+		{
+			name: "reset membuka kunci kuota", reason: "quota", used: 2 * gb,
+			path: "/api/user/quota/reset", wantLimit: 1, wantUsed: 0,
+		},
+		{
+			name: "top-up cukup membuka kunci", reason: "quota", used: gb + gb/2,
+			path: "/api/user/quota/topup", gb: 1, wantLimit: 2, wantUsed: gb + gb/2,
+		},
+		{
+			name: "top-up kurang tetap terkunci", reason: "quota", used: 3 * gb,
+			path: "/api/user/quota/topup", gb: 1, wantLimit: 2, wantUsed: 3 * gb, wantSuspended: true,
+		},
+		{
+			name: "reset tidak membuka suspend limit IP", reason: "ip_limit", used: 2 * gb,
+			path: "/api/user/quota/reset", wantLimit: 1, wantUsed: 0, wantSuspended: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTempState(t)
+			seedUsers(t, UserRecord{Password: "alice", Expired: "2099-01-01", LimitQuota: 1})
+			writeState(t, UsageFile, map[string]Usage{"alice": {DownloadBytes: tt.used}})
+			mutex.Lock()
+			err := suspendUser("alice", tt.reason, time.Time{})
+			mutex.Unlock()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			status, res := call(t, http.MethodPost, tt.path, "", QuotaRequest{Password: "alice", GB: tt.gb})
+			if status != http.StatusOK {
+				t.Fatalf("status = %d (%s)", status, res.Message)
+			}
+
+			rec, _, err := findUser("alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rec.LimitQuota != tt.wantLimit {
+				t.Errorf("limit_quota = %d, ingin %d", rec.LimitQuota, tt.wantLimit)
+			}
+			usage, err := loadUsage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := usage["alice"].total(); got != tt.wantUsed {
+				t.Errorf("pemakaian = %d, ingin %d", got, tt.wantUsed)
+			}
+			if _, got := suspension(t, "alice"); got != tt.wantSuspended {
+				t.Errorf("disuspend = %v, ingin %v", got, tt.wantSuspended)
+			}
+			if got := inConfig(t, "alice"); got == tt.wantSuspended {
+				t.Errorf("alice di config.json = %v, ingin %v", got, !tt.wantSuspended)
+			}
+		})
+	}
+}
@@ -1,27 +1,30 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"math/rand"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"zivpn/client"
 )
 
 const (
 	BotConfigFile        = "/etc/zivpn/bot-config.json"
-	ApiUrl               = "http://127.0.0.1:8080/api"
+	ApiUrl               = "http://127.0.0.1:8080"
 	ApiKeyFile           = "/etc/zivpn/apikey"
 	// !!! GANTI INI DENGAN URL GAMBAR MENU ANDA !!!
 	MenuPhotoURL         = "https://drive.google.com/file/d/1wc6UW_NDmNPV2qhpBHyBn_LdwC-0jHb_/view?usp=drivesdk"
@@ -33,17 +36,83 @@ const (
 	BackupDir            = "/etc/zivpn/backups"
 	ServiceName          = "zivpn"
 	TrialTrackerFile     = "/etc/zivpn/trial_tracker.json" // File untuk track akun yang sudah trial
+	TrialPolicyFile      = "/etc/zivpn/trial-policy.json"  // Aturan trial, dibaca ulang setiap permintaan
+	ApprovalFile         = "/etc/zivpn/approvals.json"     // Antrian permintaan create dari user publik
+	TelegramOwnerFile    = "/etc/zivpn/telegram_owners.json" // Pemilik akun: password -> Telegram ID
+	ReminderFile         = "/etc/zivpn/reminders.json"     // Pengingat expired yang sudah terkirim
+	BackupFileName       = "zivpn-backup.tar.gz"
+	BackupTimeout        = 60 * time.Second
+	// Jeda sebelum menyambung ulang ke stream event API
+	EventRetryInterval   = 5 * time.Second
 )
 
 var ApiKey = "AutoFtBot-agskjgdvsbdreiWG1234512SDKrqw"
 
+var api *client.Client // Client ZiVPN API, diinisialisasi di main setelah ApiKey dibaca
+
 var startTime time.Time // Global variable untuk menghitung uptime bot
 
 type BotConfig struct {
 	BotToken       string `json:"bot_token"`
-	AdminID        int64  `json:"admin_id"`
+	AdminID        int64  `json:"admin_id"` // Owner utama, selalu punya semua akses
 	NotifGroupID   int64  `json:"notif_group_id"`
 	VpsExpiredDate string `json:"vps_expired_date"` // Format: 2006-01-02
+	// ReminderHours adalah jarak (jam) sebelum expired untuk mengirim
+	// pengingat ke pemilik akun. Kosong memakai DefaultReminderHours,
+	// [] mematikan pengingat.
+	ReminderHours []int `json:"reminder_hours"`
+	// Admins adalah admin tambahan beserta perannya, dikelola owner dari
+	// menu Admin.
+	Admins []Admin `json:"admins,omitempty"`
+}
+
+// DefaultReminderHours: 3 hari, 1 hari dan 1 jam sebelum expired
+var DefaultReminderHours = []int{72, 24, 1}
+
+// Admin adalah admin tambahan bot dengan satu peran.
+type Admin struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name,omitempty"`
+	Role string `json:"role"`
+}
+
+// Peran admin
+const (
+	RoleOwner    = "owner"    // semua akses, termasuk mengelola admin
+	RoleOperator = "operator" // kelola akun, penjualan dan backup
+	RoleSupport  = "support"  // bantu customer: create, renew, buka kunci
+	RoleReadOnly = "readonly" // hanya melihat
+)
+
+// Izin yang dicek per aksi callback
+const (
+	PermView     = "view"     // melihat daftar dan detail
+	PermCreate   = "create"   // create akun dan menyetujui permintaan
+	PermRenew    = "renew"    // renew akun
+	PermDelete   = "delete"   // hapus akun
+	PermSupport  = "support"  // unlock, reset kuota, reset trial
+	PermSales    = "sales"    // reseller, voucher, order
+	PermBackup   = "backup"   // backup manual
+	PermRestore  = "restore"  // restore dari file
+	PermSettings = "settings" // grup notifikasi, VPS exp, UDPGW, hapus expired & restart
+	PermAdmins   = "admins"   // tambah, ubah dan hapus admin
+)
+
+var rolePermissions = map[string][]string{
+	RoleOwner:    {PermView, PermCreate, PermRenew, PermDelete, PermSupport, PermSales, PermBackup, PermRestore, PermSettings, PermAdmins},
+	RoleOperator: {PermView, PermCreate, PermRenew, PermDelete, PermSupport, PermSales, PermBackup},
+	RoleSupport:  {PermView, PermCreate, PermRenew, PermSupport},
+	RoleReadOnly: {PermView},
+}
+
+// Urutan peran untuk tombol pilihan
+var roleOrder = []string{RoleOwner, RoleOperator, RoleSupport, RoleReadOnly}
+
+var roleLabels = map[string]string{
+	RoleOwner:    "👑 Owner",
+	RoleOperator: "🛠️ Operator",
+	RoleSupport:  "🎧 Support",
+	RoleReadOnly: "👁️ Read-only",
 }
 
 type IpInfo struct {
@@ -52,10 +121,8 @@ type IpInfo struct {
 }
 
 type UserData struct {
-	Host     string `json:"host"` // Host untuk backup
-	Password string `json:"password"`
-	Expired  string `json:"expired"`
-	Status   string `json:"status"`
+	Host string `json:"host"` // Host untuk backup
+	client.User
 }
 
 // Variabel global dengan Mutex untuk keamanan konkurensi (Thread-Safe)
@@ -64,8 +131,13 @@ var (
 	userStates     = make(map[int64]string)
 	tempUserData   = make(map[int64]map[string]string)
 	lastMessageIDs = make(map[int64]int)
-	trialUsers     = make(map[int64]bool) // Track user yang sudah ambil trial
+	trialTracker   = TrialTracker{Users: make(map[int64]*TrialRecord)} // Riwayat trial per user
 	trialMutex     sync.RWMutex
+	approvals      = make(map[string]*Approval) // Permintaan create yang menunggu admin
+	approvalMutex  sync.Mutex
+	owners         = make(map[string]int64)           // Pemilik akun per password
+	reminders      = make(map[string]*ReminderRecord) // Pengingat terkirim per password
+	ownerMutex     sync.Mutex                         // Melindungi owners dan reminders
 )
 
 func main() {
@@ -79,9 +151,12 @@ func main() {
 	if keyBytes, err := os.ReadFile(ApiKeyFile); err == nil {
 		ApiKey = strings.TrimSpace(string(keyBytes))
 	}
+	api = client.New(ApiUrl, ApiKey)
 
 	// Load trial tracker
 	loadTrialTracker()
+	loadApprovals()
+	loadOwners()
 
 	// Load config awal
 	config, err := loadConfig()
@@ -99,10 +174,14 @@ func main() {
 
 	// --- BACKGROUND WORKER (PENGHAPUSAN OTOMATIS) ---
 	go func() {
-		autoDeleteExpiredUsers(bot, config.AdminID, false)
+		autoDeleteExpiredUsers(bot, api, config.AdminID, false)
+		expireTrials(bot)
+		sendExpiryReminders(bot)
 		ticker := time.NewTicker(AutoDeleteInterval)
 		for range ticker.C {
-			autoDeleteExpiredUsers(bot, config.AdminID, false)
+			autoDeleteExpiredUsers(bot, api, config.AdminID, false)
+			expireTrials(bot)
+			sendExpiryReminders(bot)
 		}
 	}()
 
@@ -115,6 +194,9 @@ func main() {
 		}
 	}()
 
+	// --- BACKGROUND WORKER (EVENT API: LIMIT IP & KUOTA) ---
+	go watchApiEvents(bot)
+
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
 
@@ -122,17 +204,18 @@ func main() {
 
 	for update := range updates {
 		if update.Message != nil {
-			handleMessage(bot, update.Message, config.AdminID)
+			handleMessage(bot, update.Message)
 		} else if update.CallbackQuery != nil {
-			handleCallback(bot, update.CallbackQuery, config.AdminID)
+			handleCallback(bot, update.CallbackQuery)
 		}
 	}
 }
 
 // --- HANDLE MESSAGE ---
-func handleMessage(bot *tgbotapi.BotAPI, msg *tgbotapi.Message, adminID int64) {
+func handleMessage(bot *tgbotapi.BotAPI, msg *tgbotapi.Message) {
 	userID := msg.From.ID
-	isAdmin := userID == adminID
+	admin := findAdmin(userID)
+	trackTrialUser(userID)
 
 	stateMutex.RLock()
 	state, exists := userStates[userID]
@@ -140,21 +223,28 @@ func handleMessage(bot *tgbotapi.BotAPI, msg *tgbotapi.Message, adminID int64) {
 
 	// Handle Restore dari Upload File (hanya admin)
 	if exists && state == "wait_restore_file" {
-		if !isAdmin {
-			sendMessage(bot, msg.Chat.ID, "⛔ Akses Ditolak. Anda bukan admin.")
+		if !admin.can(PermRestore) {
+			sendMessage(bot, msg.Chat.ID, "⛔ Akses Ditolak. Peran Anda tidak diizinkan untuk aksi ini.")
 			resetState(userID)
 			return
 		}
 		if msg.Document != nil {
-			handleRestoreFromUpload(bot, msg)
+			var err error
+			name := strings.ToLower(msg.Document.FileName)
+			if strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz") {
+				err = handleFullRestoreFromUpload(bot, apiFor(admin), msg)
+			} else {
+				err = handleRestoreFromUpload(bot, apiFor(admin), msg)
+			}
+			auditAdmin(admin, "restore", map[string]string{"file": msg.Document.FileName}, err)
 		} else {
-			sendMessage(bot, msg.Chat.ID, "❌ Mohon kirimkan file backup (.json).")
+			sendMessage(bot, msg.Chat.ID, "❌ Mohon kirimkan file backup (.tar.gz atau .json).")
 		}
 		return
 	}
 
 	if exists {
-		handleState(bot, msg, state, isAdmin)
+		handleState(bot, msg, state, admin)
 		return
 	}
 
@@ -162,14 +252,10 @@ func handleMessage(bot *tgbotapi.BotAPI, msg *tgbotapi.Message, adminID int64) {
 	if msg.IsCommand() {
 		switch msg.Command() {
 		case "start", "panel", "menu":
-			if isAdmin {
-				showMainMenu(bot, msg.Chat.ID, true)
-			} else {
-				showPublicMenu(bot, msg.Chat.ID)
-			}
+			showHome(bot, msg.Chat.ID)
 		case "setgroup":
-			if !isAdmin {
-				sendMessage(bot, msg.Chat.ID, "⛔ Akses Ditolak. Anda bukan admin.")
+			if !admin.can(PermSettings) {
+				sendMessage(bot, msg.Chat.ID, "⛔ Akses Ditolak. Peran Anda tidak diizinkan untuk aksi ini.")
 				return
 			}
 			args := msg.CommandArguments()
@@ -188,15 +274,17 @@ func handleMessage(bot *tgbotapi.BotAPI, msg *tgbotapi.Message, adminID int64) {
 				return
 			}
 			currentCfg.NotifGroupID = groupID
-			if err := saveConfig(currentCfg); err != nil {
+			err = saveConfig(currentCfg)
+			auditAdmin(admin, "setgroup", map[string]string{"group_id": args}, err)
+			if err != nil {
 				sendMessage(bot, msg.Chat.ID, "❌ Gagal menyimpan konfigurasi.")
 				return
 			}
 			sendMessage(bot, msg.Chat.ID, fmt.Sprintf("✅ Notifikasi Grup di set ke ID: `%d`", groupID))
 		// Legacy command untuk set tanggal VPS (sekarang lebih enak pakai tombol)
 		case "setvpsdate":
-			if !isAdmin {
-				sendMessage(bot, msg.Chat.ID, "⛔ Akses Ditolak. Anda bukan admin.")
+			if !admin.can(PermSettings) {
+				sendMessage(bot, msg.Chat.ID, "⛔ Akses Ditolak. Peran Anda tidak diizinkan untuk aksi ini.")
 				return
 			}
 			setState(msg.From.ID, "set_vps_date")
@@ -207,11 +295,7 @@ func handleMessage(bot *tgbotapi.BotAPI, msg *tgbotapi.Message, adminID int64) {
 		}
 	} else {
 		if text == "panel" || text == "menu" || text == "pull panel" {
-			if isAdmin {
-				showMainMenu(bot, msg.Chat.ID, true)
-			} else {
-				showPublicMenu(bot, msg.Chat.ID)
-			}
+			showHome(bot, msg.Chat.ID)
 		} else {
 			reply := tgbotapi.NewMessage(msg.Chat.ID, "⚠️ Sistem Siaga.\nKetik /start.")
 			sendAndTrack(bot, reply)
@@ -220,121 +304,467 @@ func handleMessage(bot *tgbotapi.BotAPI, msg *tgbotapi.Message, adminID int64) {
 }
 
 // --- HANDLE CALLBACK ---
-func handleCallback(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, adminID int64) {
+func handleCallback(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery) {
 	userID := query.From.ID
-	isAdmin := userID == adminID
+	admin := findAdmin(userID)
+	isAdmin := admin != nil
+
+	// Panggilan API admin membawa X-Actor. Reseller bisa create/renew/list
+	// akun miliknya sendiri lewat client miliknya.
+	adminAPI := apiFor(admin)
+	userAPI := adminAPI
+	var reseller *client.Reseller
+	if !isAdmin {
+		reseller, userAPI = resellerFor(userID)
+	}
+	canCreate := admin.can(PermCreate) || reseller != nil
+	canRenew := admin.can(PermRenew) || reseller != nil
 
 	callbackData := query.Data
+	// allow mengecek izin peran admin untuk aksi ini. Aksi yang mengubah
+	// data dicatat lewat auditAdmin setelah selesai, lengkap dengan hasilnya.
+	allow := func(perm string) bool {
+		if !admin.can(perm) {
+			sendMessage(bot, query.Message.Chat.ID, "⛔ Akses Ditolak. Peran Anda tidak diizinkan untuk aksi ini.")
+			return false
+		}
+		return true
+	}
 	switch {
 	case callbackData == "menu_trial":
-		trialMutex.RLock()
-		hasTrial := trialUsers[userID]
-		trialMutex.RUnlock()
-		if hasTrial {
-			sendMessage(bot, query.Message.Chat.ID, "❌ Anda sudah pernah membuat akun trial. Hanya sekali per akun.")
+		createTrial(bot, query.Message.Chat.ID, userID)
+	case callbackData == "menu_admins":
+		// Hanya melihat, tidak dicatat di audit log
+		if !admin.can(PermAdmins) {
+			sendMessage(bot, query.Message.Chat.ID, "⛔ Akses Ditolak. Peran Anda tidak diizinkan untuk aksi ini.")
 			return
 		}
-		randomPass := generateRandomPassword(4)
-		sendMessage(bot, query.Message.Chat.ID, "⏳ Sedang membuat akun trial...")
-		// Reload config untuk ensure NotifGroupID terbaru
-		cfg, _ := loadConfig()
-		createUser(bot, query.Message.Chat.ID, randomPass, 1, 1, 1, cfg)
-		trialMutex.Lock()
-		trialUsers[userID] = true
-		trialMutex.Unlock()
-		saveTrialTracker()
+		showAdmins(bot, query.Message.Chat.ID)
+	case callbackData == "admin_add":
+		if !allow(PermAdmins) {
+			return
+		}
+		setState(userID, "admin_add_id")
+		sendMessage(bot, query.Message.Chat.ID, "👮 *TAMBAH ADMIN*\nMasukkan **Telegram ID** admin baru:")
+	case strings.HasPrefix(callbackData, "admin_view:"):
+		// Hanya melihat, tidak dicatat di audit log
+		if !admin.can(PermAdmins) {
+			sendMessage(bot, query.Message.Chat.ID, "⛔ Akses Ditolak. Peran Anda tidak diizinkan untuk aksi ini.")
+			return
+		}
+		id, err := strconv.ParseInt(strings.TrimPrefix(callbackData, "admin_view:"), 10, 64)
+		if err != nil {
+			return
+		}
+		showAdminDetail(bot, query.Message.Chat.ID, id)
+	case strings.HasPrefix(callbackData, "admin_role:"):
+		if !allow(PermAdmins) {
+			return
+		}
+		parts := strings.Split(strings.TrimPrefix(callbackData, "admin_role:"), ":")
+		if len(parts) != 2 {
+			return
+		}
+		id, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return
+		}
+		err = setAdminRole(bot, query.Message.Chat.ID, id, parts[1])
+		auditAdmin(admin, "admin_role", map[string]string{"admin": parts[0], "new_role": parts[1]}, err)
+	case strings.HasPrefix(callbackData, "admin_remove:"):
+		if !allow(PermAdmins) {
+			return
+		}
+		id, err := strconv.ParseInt(strings.TrimPrefix(callbackData, "admin_remove:"), 10, 64)
+		if err != nil {
+			return
+		}
+		err = removeAdmin(bot, query.Message.Chat.ID, id)
+		auditAdmin(admin, "admin_remove", map[string]string{"admin": strconv.FormatInt(id, 10)}, err)
+	case callbackData == "menu_trial_policy":
+		if !allow(PermView) {
+			return
+		}
+		showTrialPolicy(bot, query.Message.Chat.ID)
+	case callbackData == "trial_check":
+		if !allow(PermView) {
+			return
+		}
+		setState(userID, "trial_check")
+		sendMessage(bot, query.Message.Chat.ID, "🎁 *CEK TRIAL*\nMasukkan **Telegram ID** user:")
+	case strings.HasPrefix(callbackData, "trial_reset:"):
+		if !allow(PermSupport) {
+			return
+		}
+		target, err := strconv.ParseInt(strings.TrimPrefix(callbackData, "trial_reset:"), 10, 64)
+		if err != nil {
+			return
+		}
+		err = resetTrial(target)
+		auditAdmin(admin, "trial_reset", map[string]string{"telegram_id": strconv.FormatInt(target, 10)}, err)
+		if err != nil {
+			sendMessage(bot, query.Message.Chat.ID, "❌ Gagal menyimpan status trial.")
+			return
+		}
+		sendMessage(bot, query.Message.Chat.ID, fmt.Sprintf("♻️ Status trial `%d` direset.", target))
+		showTrialStatus(bot, query.Message.Chat.ID, target)
 	case callbackData == "menu_create":
 		setState(userID, "create_username")
 		setTempData(userID, make(map[string]string))
 		sendMessage(bot, query.Message.Chat.ID, "🔑 *MENU CREATE*\nSilakan masukkan **PASSWORD**:")
 	case callbackData == "menu_info":
-		systemInfo(bot, query.Message.Chat.ID)
+		systemInfo(bot, adminAPI, query.Message.Chat.ID)
+	case callbackData == "menu_my_accounts":
+		showMyAccounts(bot, query.Message.Chat.ID, userID)
+	case strings.HasPrefix(callbackData, "my_account:"):
+		showMyAccount(bot, query.Message.Chat.ID, userID, strings.TrimPrefix(callbackData, "my_account:"))
+	case strings.HasPrefix(callbackData, "my_profile:"):
+		sendMyProfile(bot, query.Message.Chat.ID, userID, strings.TrimPrefix(callbackData, "my_profile:"))
+	case strings.HasPrefix(callbackData, "my_rotate:"):
+		password := strings.TrimPrefix(callbackData, "my_rotate:")
+		if accountOwner(password) != userID {
+			sendMessage(bot, query.Message.Chat.ID, "⛔ Akun ini bukan milik Anda.")
+			return
+		}
+		setTempData(userID, map[string]string{"username": password})
+		setState(userID, "my_rotate_password")
+		msg := tgbotapi.NewMessage(query.Message.Chat.ID, fmt.Sprintf("🔁 *GANTI PASSWORD*\nAkun: `%s`\n\nKetik **Password Baru**, atau pilih password acak. Koneksi yang memakai password lama akan terputus.", password))
+		msg.ParseMode = "Markdown"
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("🎲 Password Acak", "my_rotate_random")),
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("❌ Batal", "cancel")),
+		)
+		sendAndTrack(bot, msg)
+	case callbackData == "my_rotate_random":
+		data, ok := getTempData(userID)
+		if !ok || data["username"] == "" {
+			sendMessage(bot, query.Message.Chat.ID, "⚠️ Sesi habis. Silakan ulangi dari menu.")
+			return
+		}
+		resetState(userID)
+		rotateMyPassword(bot, query.Message.Chat.ID, userID, data["username"], generateRandomPassword(8))
+	case callbackData == "menu_redeem":
+		setState(userID, "redeem_code")
+		setTempData(userID, make(map[string]string))
+		sendMessage(bot, query.Message.Chat.ID, "🎟️ *REDEEM VOUCHER*\nMasukkan **Kode Voucher**:")
+	case callbackData == "menu_vouchers":
+		if !allow(PermView) {
+			return
+		}
+		showVoucherBatches(bot, adminAPI, query.Message.Chat.ID)
+	case callbackData == "voucher_new":
+		if !allow(PermSales) {
+			return
+		}
+		showVoucherPlans(bot, adminAPI, query.Message.Chat.ID)
+	case strings.HasPrefix(callbackData, "voucher_plan:"):
+		if !allow(PermSales) {
+			return
+		}
+		setTempData(userID, map[string]string{"plan": strings.TrimPrefix(callbackData, "voucher_plan:")})
+		setState(userID, "voucher_count")
+		sendMessage(bot, query.Message.Chat.ID, "🎟️ *GENERATE VOUCHER*\nMasukkan **Jumlah Voucher** (1-500):")
+	case strings.HasPrefix(callbackData, "voucher_batch:"):
+		if !allow(PermView) {
+			return
+		}
+		showVoucherBatch(bot, adminAPI, query.Message.Chat.ID, strings.TrimPrefix(callbackData, "voucher_batch:"))
+	case strings.HasPrefix(callbackData, "voucher_export:"):
+		if !allow(PermSales) {
+			return
+		}
+		batch := strings.TrimPrefix(callbackData, "voucher_export:")
+		err := exportVouchers(bot, adminAPI, query.Message.Chat.ID, batch)
+		auditAdmin(admin, "voucher_export", map[string]string{"batch": batch}, err)
+	case strings.HasPrefix(callbackData, "voucher_revoke:"):
+		if !allow(PermSales) {
+			return
+		}
+		batch := strings.TrimPrefix(callbackData, "voucher_revoke:")
+		err := revokeVoucherBatch(bot, adminAPI, query.Message.Chat.ID, batch)
+		auditAdmin(admin, "voucher_revoke", map[string]string{"batch": batch}, err)
+	case callbackData == "menu_orders":
+		if !allow(PermView) {
+			return
+		}
+		showOrders(bot, adminAPI, query.Message.Chat.ID)
+	case strings.HasPrefix(callbackData, "order_view:"):
+		if !allow(PermView) {
+			return
+		}
+		showOrderDetail(bot, adminAPI, query.Message.Chat.ID, strings.TrimPrefix(callbackData, "order_view:"))
+	case strings.HasPrefix(callbackData, "order_paid:"):
+		if !allow(PermSales) {
+			return
+		}
+		id := strings.TrimPrefix(callbackData, "order_paid:")
+		err := markOrderPaid(bot, adminAPI, query.Message.Chat.ID, id)
+		auditAdmin(admin, "order_paid", map[string]string{"order": id}, err)
+	case strings.HasPrefix(callbackData, "order_cancel:"):
+		// Pembeli boleh membatalkan order miliknya sendiri; hanya pembatalan
+		// oleh admin yang dicatat di audit log
+		id := strings.TrimPrefix(callbackData, "order_cancel:")
+		isSales := admin.can(PermSales)
+		err := cancelOrder(bot, adminAPI, query.Message.Chat.ID, userID, isSales, id)
+		if isSales {
+			auditAdmin(admin, "order_cancel", map[string]string{"order": id}, err)
+		}
+	case callbackData == "menu_approvals":
+		if !allow(PermView) {
+			return
+		}
+		showApprovals(bot, query.Message.Chat.ID)
+	case strings.HasPrefix(callbackData, "approve:"):
+		if !allow(PermCreate) {
+			return
+		}
+		id := strings.TrimPrefix(callbackData, "approve:")
+		err := approveRequest(bot, adminAPI, query.Message.Chat.ID, id)
+		auditAdmin(admin, "approve", map[string]string{"request": id}, err)
+	case strings.HasPrefix(callbackData, "reject:"):
+		if !allow(PermCreate) {
+			return
+		}
+		id := strings.TrimPrefix(callbackData, "reject:")
+		err := rejectRequest(bot, query.Message.Chat.ID, id)
+		auditAdmin(admin, "reject", map[string]string{"request": id}, err)
 	case callbackData == "menu_delete":
-		if !isAdmin {
-			sendMessage(bot, query.Message.Chat.ID, "⛔ Akses Ditolak. Anda bukan admin.")
+		if !allow(PermDelete) {
 			return
 		}
-		showUserSelection(bot, query.Message.Chat.ID, 1, "delete")
+		showUserSelection(bot, adminAPI, query.Message.Chat.ID, 1, "delete")
 	case callbackData == "menu_renew":
-		if !isAdmin {
+		if !canRenew {
 			sendMessage(bot, query.Message.Chat.ID, "⛔ Akses Ditolak. Anda bukan admin.")
 			return
 		}
-		showUserSelection(bot, query.Message.Chat.ID, 1, "renew")
+		showUserSelection(bot, userAPI, query.Message.Chat.ID, 1, "renew")
 	case callbackData == "menu_list":
-		if !isAdmin {
+		if !admin.can(PermView) && reseller == nil {
 			sendMessage(bot, query.Message.Chat.ID, "⛔ Akses Ditolak. Anda bukan admin.")
 			return
 		}
-		listUsers(bot, query.Message.Chat.ID)
+		listUsers(bot, userAPI, query.Message.Chat.ID)
 	case callbackData == "menu_backup":
-		if !isAdmin {
-			sendMessage(bot, query.Message.Chat.ID, "⛔ Akses Ditolak. Anda bukan admin.")
+		if !allow(PermBackup) {
 			return
 		}
-		performManualBackup(bot, query.Message.Chat.ID)
+		err := performManualBackup(bot, adminAPI, query.Message.Chat.ID)
+		auditAdmin(admin, "backup", map[string]string{}, err)
 	case callbackData == "menu_restore":
-		if !isAdmin {
-			sendMessage(bot, query.Message.Chat.ID, "⛔ Akses Ditolak. Anda bukan admin.")
+		if !allow(PermRestore) {
 			return
 		}
 		setState(userID, "wait_restore_file")
-		msg := tgbotapi.NewMessage(query.Message.Chat.ID, "📥 *RESTORE DATA*\nSilakan kirimkan file backup `.json`.")
+		msg := tgbotapi.NewMessage(query.Message.Chat.ID, "📥 *RESTORE DATA*\nSilakan kirimkan file backup `.tar.gz` (full state) atau `.json` (daftar user lama).")
 		msg.ParseMode = "Markdown"
 		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
 			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("❌ Batal", "cancel")),
 		)
 		sendAndTrack(bot, msg)
 	case callbackData == "menu_set_vps_date":
-		if !isAdmin {
-			sendMessage(bot, query.Message.Chat.ID, "⛔ Akses Ditolak. Anda bukan admin.")
+		if !allow(PermSettings) {
 			return
 		}
 		setState(userID, "set_vps_date")
 		sendMessage(bot, query.Message.Chat.ID, "📅 *SET VPS EXPIRED*\n\nSilakan masukkan tanggal expired VPS.\n\nFormat: `YYYY-MM-DD`\nContoh: `2024-12-31`")
 	case callbackData == "menu_set_group":
-		if !isAdmin {
-			sendMessage(bot, query.Message.Chat.ID, "⛔ Akses Ditolak. Anda bukan admin.")
+		if !allow(PermSettings) {
 			return
 		}
 		setState(userID, "set_group_id")
 		sendMessage(bot, query.Message.Chat.ID, "🔔 *SET NOTIFIKASI GRUP*\n\nSilakan masukkan ID Grup Telegram.\n\nContoh: `-1001234567890`")
 	case callbackData == "menu_clean_restart":
-		if !isAdmin {
-			sendMessage(bot, query.Message.Chat.ID, "⛔ Akses Ditolak. Anda bukan admin.")
+		if !allow(PermSettings) {
+			return
+		}
+		cleanAndRestartService(bot, admin, query.Message.Chat.ID)
+	case callbackData == "menu_udpgw":
+		if !allow(PermView) {
+			return
+		}
+		showUdpgwPanel(bot, adminAPI, query.Message.Chat.ID)
+	case callbackData == "udpgw_restart":
+		if !allow(PermSettings) {
+			return
+		}
+		err := restartUdpgw(bot, adminAPI, query.Message.Chat.ID)
+		auditAdmin(admin, "udpgw_restart", map[string]string{}, err)
+	case callbackData == "udpgw_port":
+		if !allow(PermSettings) {
+			return
+		}
+		setState(userID, "udpgw_port")
+		sendMessage(bot, query.Message.Chat.ID, "🔌 *UBAH PORT UDPGW*\n\nMasukkan port baru (1-65535).\n\nContoh: `7300`")
+	case callbackData == "udpgw_dns":
+		if !allow(PermSettings) {
+			return
+		}
+		setState(userID, "udpgw_dns")
+		sendMessage(bot, query.Message.Chat.ID, "🌐 *UBAH DNS UDPGW*\n\nMasukkan IP DNS resolver.\n\nContoh: `1.1.1.1`")
+	case strings.HasPrefix(callbackData, "udpgw_log:"):
+		if !allow(PermSettings) {
+			return
+		}
+		level := strings.TrimPrefix(callbackData, "udpgw_log:")
+		err := updateUdpgw(bot, adminAPI, query.Message.Chat.ID, client.UdpgwUpdate{LogLevel: &level})
+		auditAdmin(admin, "udpgw_update", map[string]string{"log_level": level}, err)
+	case callbackData == "menu_resellers":
+		if !allow(PermView) {
+			return
+		}
+		showResellers(bot, adminAPI, query.Message.Chat.ID)
+	case callbackData == "reseller_add":
+		if !allow(PermSales) {
+			return
+		}
+		setState(userID, "reseller_add_name")
+		setTempData(userID, make(map[string]string))
+		sendMessage(bot, query.Message.Chat.ID, "🤝 *TAMBAH RESELLER*\nMasukkan **Nama** reseller:")
+	case strings.HasPrefix(callbackData, "reseller_view:"):
+		if !allow(PermView) {
+			return
+		}
+		showResellerDetail(bot, adminAPI, query.Message.Chat.ID, strings.TrimPrefix(callbackData, "reseller_view:"))
+	case strings.HasPrefix(callbackData, "reseller_topup:"):
+		if !allow(PermSales) {
+			return
+		}
+		setTempData(userID, map[string]string{"reseller": strings.TrimPrefix(callbackData, "reseller_topup:")})
+		setState(userID, "reseller_topup")
+		sendMessage(bot, query.Message.Chat.ID, "💰 *TOP UP RESELLER*\nMasukkan **jumlah kredit**:")
+	case strings.HasPrefix(callbackData, "reseller_toggle:"):
+		if !allow(PermSales) {
+			return
+		}
+		id := strings.TrimPrefix(callbackData, "reseller_toggle:")
+		err := toggleReseller(bot, adminAPI, query.Message.Chat.ID, id)
+		auditAdmin(admin, "reseller_toggle", map[string]string{"reseller": id}, err)
+	case strings.HasPrefix(callbackData, "reseller_key:"):
+		if !allow(PermSales) {
+			return
+		}
+		id := strings.TrimPrefix(callbackData, "reseller_key:")
+		err := rotateResellerKey(bot, adminAPI, query.Message.Chat.ID, id)
+		auditAdmin(admin, "reseller_key", map[string]string{"reseller": id}, err)
+	case strings.HasPrefix(callbackData, "reseller_ledger:"):
+		if !allow(PermView) {
+			return
+		}
+		showResellerLedger(bot, adminAPI, query.Message.Chat.ID, strings.TrimPrefix(callbackData, "reseller_ledger:"))
+	case callbackData == "reseller_ledger":
+		if reseller == nil {
+			sendMessage(bot, query.Message.Chat.ID, "⛔ Menu ini khusus reseller.")
 			return
 		}
-		cleanAndRestartService(bot, query.Message.Chat.ID)
+		showResellerLedger(bot, userAPI, query.Message.Chat.ID, "")
 	case callbackData == "cancel":
 		resetState(userID)
-		if isAdmin {
-			showMainMenu(bot, query.Message.Chat.ID, true)
-		} else {
-			showPublicMenu(bot, query.Message.Chat.ID)
-		}
+		showHome(bot, query.Message.Chat.ID)
 	case strings.HasPrefix(callbackData, "page_"):
-		if !isAdmin {
+		parts := strings.Split(callbackData, ":")
+		action := parts[0][5:]
+		if !(action == "renew" && canRenew) && !(action == "delete" && admin.can(PermDelete)) {
 			sendMessage(bot, query.Message.Chat.ID, "⛔ Akses Ditolak. Anda bukan admin.")
 			return
 		}
-		parts := strings.Split(callbackData, ":")
-		action := parts[0][5:]
 		page, _ := strconv.Atoi(parts[1])
-		showUserSelection(bot, query.Message.Chat.ID, page, action)
+		showUserSelection(bot, userAPI, query.Message.Chat.ID, page, action)
 	case strings.HasPrefix(callbackData, "select_renew:"):
-		if !isAdmin {
+		if !canRenew {
 			sendMessage(bot, query.Message.Chat.ID, "⛔ Akses Ditolak. Anda bukan admin.")
 			return
 		}
-		username := strings.TrimPrefix(callbackData, "select_renew:")
+		startRenew(bot, userAPI, query.Message.Chat.ID, userID, strings.TrimPrefix(callbackData, "select_renew:"))
+	case strings.HasPrefix(callbackData, "owner_renew:"):
+		// Tombol dari pengingat expired dan Akun Saya, hanya untuk pemilik akun
+		username := strings.TrimPrefix(callbackData, "owner_renew:")
+		if !admin.can(PermRenew) && accountOwner(username) != userID {
+			sendMessage(bot, query.Message.Chat.ID, "⛔ Akun ini bukan milik Anda.")
+			return
+		}
+		if canRenew {
+			startRenew(bot, userAPI, query.Message.Chat.ID, userID, username)
+			break
+		}
+		// User publik memperpanjang lewat order plan public berbayar
 		setTempData(userID, map[string]string{"username": username})
-		setState(userID, "renew_limit_ip")
-		sendMessage(bot, query.Message.Chat.ID, fmt.Sprintf("🔄 *MENU RENEW*\nUser: `%s`\n\nMasukkan **Limit IP**:", username))
-	case strings.HasPrefix(callbackData, "select_delete:"):
-		if !isAdmin {
+		if !showPlanPicker(bot, api, query.Message.Chat.ID, "renew", client.PlanPublic) {
+			sendMessage(bot, query.Message.Chat.ID, "❌ Belum ada plan untuk perpanjangan. Silakan hubungi admin.")
+		}
+	case strings.HasPrefix(callbackData, "plan_create:"):
+		data, ok := getTempData(userID)
+		if !ok || data["username"] == "" {
+			sendMessage(bot, query.Message.Chat.ID, "⚠️ Sesi habis. Silakan ulangi dari menu.")
+			return
+		}
+		planID := strings.TrimPrefix(callbackData, "plan_create:")
+		// User publik hanya boleh memakai plan public
+		if !canCreate {
+			plan := findPlan(api, planID, client.PlanPublic)
+			if plan == nil {
+				sendMessage(bot, query.Message.Chat.ID, "❌ Plan tidak tersedia.")
+				return
+			}
+			// Plan berbayar dibuat lewat order; akun dibuat setelah lunas
+			resetState(userID)
+			if plan.Price > 0 {
+				createOrder(bot, query.Message.Chat.ID, userID, plan, data["username"], false)
+				return
+			}
+			requestApproval(bot, query.From, client.CreateUserRequest{Password: data["username"], PlanID: plan.ID, Days: plan.Days, LimitIP: plan.LimitIP, LimitQuota: plan.LimitQuota})
+			return
+		}
+		resetState(userID)
+		cfg, _ := loadConfig()
+		err := createUser(bot, userAPI, query.Message.Chat.ID, client.CreateUserRequest{Password: data["username"], PlanID: planID}, cfg)
+		auditAdmin(admin, "create", map[string]string{"password": data["username"], "plan": planID}, err)
+	case strings.HasPrefix(callbackData, "plan_renew:"):
+		data, ok := getTempData(userID)
+		if !ok || data["username"] == "" {
+			sendMessage(bot, query.Message.Chat.ID, "⚠️ Sesi habis. Silakan ulangi dari menu.")
+			return
+		}
+		if !canRenew {
+			// User publik hanya bisa memperpanjang akun miliknya lewat order
+			if accountOwner(data["username"]) != userID {
+				sendMessage(bot, query.Message.Chat.ID, "⛔ Akun ini bukan milik Anda.")
+				return
+			}
+			plan := findPlan(api, strings.TrimPrefix(callbackData, "plan_renew:"), client.PlanPublic)
+			if plan == nil {
+				sendMessage(bot, query.Message.Chat.ID, "❌ Plan tidak tersedia.")
+				return
+			}
+			if plan.Price <= 0 {
+				sendMessage(bot, query.Message.Chat.ID, "❌ Plan gratis tidak bisa dipakai untuk perpanjangan.")
+				return
+			}
+			resetState(userID)
+			createOrder(bot, query.Message.Chat.ID, userID, plan, data["username"], true)
+			return
+		}
+		resetState(userID)
+		planID := strings.TrimPrefix(callbackData, "plan_renew:")
+		err := renewUser(bot, userAPI, query.Message.Chat.ID, client.RenewUserRequest{Password: data["username"], PlanID: planID})
+		auditAdmin(admin, "renew", map[string]string{"password": data["username"], "plan": planID}, err)
+	case strings.HasPrefix(callbackData, "plan_manual:"):
+		action := strings.TrimPrefix(callbackData, "plan_manual:")
+		if !(action == "renew" && canRenew) && !(action == "create" && canCreate) {
 			sendMessage(bot, query.Message.Chat.ID, "⛔ Akses Ditolak. Anda bukan admin.")
 			return
 		}
+		if action == "renew" {
+			setState(userID, "renew_limit_ip")
+			sendMessage(bot, query.Message.Chat.ID, "🔄 *MENU RENEW*\n\nMasukkan **Limit IP**:")
+		} else {
+			setState(userID, "create_limit_ip")
+			sendMessage(bot, query.Message.Chat.ID, "🔑 *CREATE USER*\n\nMasukkan **Limit IP**:")
+		}
+	case strings.HasPrefix(callbackData, "select_delete:"):
+		if !allow(PermDelete) {
+			return
+		}
 		username := strings.TrimPrefix(callbackData, "select_delete:")
 		msg := tgbotapi.NewMessage(query.Message.Chat.ID, fmt.Sprintf("❓ *KONFIRMASI HAPUS*\nAnda yakin ingin menghapus user `%s`?", username))
 		msg.ParseMode = "Markdown"
@@ -346,28 +776,60 @@ func handleCallback(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, adminID
 		)
 		sendAndTrack(bot, msg)
 	case strings.HasPrefix(callbackData, "confirm_delete:"):
-		if !isAdmin {
-			sendMessage(bot, query.Message.Chat.ID, "⛔ Akses Ditolak. Anda bukan admin.")
+		if !allow(PermDelete) {
 			return
 		}
 		username := strings.TrimPrefix(callbackData, "confirm_delete:")
-		deleteUser(bot, query.Message.Chat.ID, username)
+		err := deleteUser(bot, adminAPI, query.Message.Chat.ID, username)
+		auditAdmin(admin, "delete", map[string]string{"password": username}, err)
+	case strings.HasPrefix(callbackData, "unlock:"):
+		if !allow(PermSupport) {
+			return
+		}
+		username := strings.TrimPrefix(callbackData, "unlock:")
+		err := unlockUser(bot, adminAPI, query.Message.Chat.ID, username)
+		auditAdmin(admin, "unlock", map[string]string{"password": username}, err)
+	case strings.HasPrefix(callbackData, "quota_reset:"):
+		if !allow(PermSupport) {
+			return
+		}
+		username := strings.TrimPrefix(callbackData, "quota_reset:")
+		err := resetQuota(bot, adminAPI, query.Message.Chat.ID, username)
+		auditAdmin(admin, "quota_reset", map[string]string{"password": username}, err)
 	}
 
 	bot.Request(tgbotapi.NewCallback(query.ID, ""))
 }
 
 // --- HANDLE STATE ---
-func handleState(bot *tgbotapi.BotAPI, msg *tgbotapi.Message, state string, isAdmin bool) {
+func handleState(bot *tgbotapi.BotAPI, msg *tgbotapi.Message, state string, admin *Admin) {
 	userID := msg.From.ID
 	text := strings.TrimSpace(msg.Text)
 
+	// Panggilan API admin membawa X-Actor; reseller memakai client miliknya
+	adminAPI := apiFor(admin)
+	userAPI := adminAPI
+	var reseller *client.Reseller
+	if admin == nil && (strings.HasPrefix(state, "create_") || strings.HasPrefix(state, "renew_")) {
+		reseller, userAPI = resellerFor(userID)
+	}
+	canCreate := admin.can(PermCreate) || reseller != nil
+	canRenew := admin.can(PermRenew) || reseller != nil
+
+	// allow sama dengan di handleCallback, ditambah reset state jika ditolak
+	allow := func(perm string) bool {
+		if !admin.can(perm) {
+			sendMessage(bot, msg.Chat.ID, "⛔ Akses Ditolak. Peran Anda tidak diizinkan untuk aksi ini.")
+			resetState(userID)
+			return false
+		}
+		return true
+	}
+
 	switch state {
 	// --- STATE BARU: SET GROUP ID ---
 	case "set_group_id":
-		if !isAdmin {
-			sendMessage(bot, msg.Chat.ID, "⛔ Akses Ditolak. Anda bukan admin.")
-			resetState(userID)
+		if !allow(PermSettings) {
 			return
 		}
 		groupID, err := strconv.ParseInt(text, 10, 64)
@@ -381,7 +843,9 @@ func handleState(bot *tgbotapi.BotAPI, msg *tgbotapi.Message, state string, isAd
 			return
 		}
 		currentCfg.NotifGroupID = groupID
-		if err := saveConfig(currentCfg); err != nil {
+		err = saveConfig(currentCfg)
+		auditAdmin(admin, "setgroup", map[string]string{"group_id": text}, err)
+		if err != nil {
 			sendMessage(bot, msg.Chat.ID, "❌ Gagal menyimpan konfigurasi.")
 			return
 		}
@@ -390,9 +854,7 @@ func handleState(bot *tgbotapi.BotAPI, msg *tgbotapi.Message, state string, isAd
 		showMainMenu(bot, msg.Chat.ID, true)
 	// --------------------------------
 	case "set_vps_date":
-		if !isAdmin {
-			sendMessage(bot, msg.Chat.ID, "⛔ Akses Ditolak. Anda bukan admin.")
-			resetState(userID)
+		if !allow(PermSettings) {
 			return
 		}
 		_, err := time.Parse("2006-01-02", text)
@@ -406,101 +868,266 @@ func handleState(bot *tgbotapi.BotAPI, msg *tgbotapi.Message, state string, isAd
 			return
 		}
 		currentCfg.VpsExpiredDate = text
-		if err := saveConfig(currentCfg); err != nil {
+		err = saveConfig(currentCfg)
+		auditAdmin(admin, "set_vps_date", map[string]string{"date": text}, err)
+		if err != nil {
 			sendMessage(bot, msg.Chat.ID, "❌ Gagal menyimpan konfigurasi.")
 			return
 		}
 		resetState(userID)
 		sendMessage(bot, msg.Chat.ID, fmt.Sprintf("✅ Tanggal Expired VPS berhasil diupdate ke: `%s`", text))
 		showMainMenu(bot, msg.Chat.ID, true)
-	case "create_username":
-		stateMutex.Lock()
-		tempUserData[userID] = map[string]string{"username": text}
-		stateMutex.Unlock()
-		setState(userID, "create_limit_ip")
-		sendMessage(bot, msg.Chat.ID, fmt.Sprintf("🔑 *CREATE USER*\nPassword: `%s`\n\nMasukkan **Limit IP**:", text))
-	case "create_limit_ip":
-		if _, err := strconv.Atoi(text); err != nil {
-			sendMessage(bot, msg.Chat.ID, "❌ Limit IP harus angka.")
+	case "udpgw_port":
+		if !allow(PermSettings) {
 			return
 		}
-		stateMutex.Lock()
-		if data, ok := tempUserData[userID]; ok {
-			data["limit_ip"] = text
-		}
-		stateMutex.Unlock()
-		setState(userID, "create_limit_quota")
-		sendMessage(bot, msg.Chat.ID, "💾 *CREATE USER*\n\nMasukkan **Limit Kuota** (GB):")
-	case "create_limit_quota":
-		if _, err := strconv.Atoi(text); err != nil {
-			sendMessage(bot, msg.Chat.ID, "❌ Limit Kuota harus angka.")
+		port, err := strconv.Atoi(text)
+		if err != nil || port < 1 || port > 65535 {
+			sendMessage(bot, msg.Chat.ID, "❌ Port harus angka 1-65535.")
 			return
 		}
-		stateMutex.Lock()
-		if data, ok := tempUserData[userID]; ok {
-			data["limit_quota"] = text
-		}
-		stateMutex.Unlock()
-		setState(userID, "create_days")
-		sendMessage(bot, msg.Chat.ID, "📅 *CREATE USER*\n\nMasukkan **Durasi** (*Hari*):")
-	case "create_days":
-		days, err := strconv.Atoi(text)
-		if err != nil {
-			sendMessage(bot, msg.Chat.ID, "❌ Durasi harus angka.")
+		resetState(userID)
+		err = updateUdpgw(bot, adminAPI, msg.Chat.ID, client.UdpgwUpdate{Port: &port})
+		auditAdmin(admin, "udpgw_update", map[string]string{"port": text}, err)
+	case "udpgw_dns":
+		if !allow(PermSettings) {
 			return
 		}
-		stateMutex.Lock()
-		data, ok := tempUserData[userID]
-		stateMutex.Unlock()
-		if ok {
-			limitIP, _ := strconv.Atoi(data["limit_ip"])
-			limitQuota, _ := strconv.Atoi(data["limit_quota"])
-			username := data["username"]
-			currentCfg, _ := loadConfig()
-			createUser(bot, msg.Chat.ID, username, days, limitIP, limitQuota, currentCfg)
-			resetState(userID)
+		resetState(userID)
+		err := updateUdpgw(bot, adminAPI, msg.Chat.ID, client.UdpgwUpdate{DNSResolver: &text})
+		auditAdmin(admin, "udpgw_update", map[string]string{"dns": text}, err)
+	case "reseller_add_name":
+		if !allow(PermSales) {
+			return
 		}
-	case "renew_limit_ip":
-		if !isAdmin {
-			sendMessage(bot, msg.Chat.ID, "⛔ Akses Ditolak. Anda bukan admin.")
-			resetState(userID)
+		setTempData(userID, map[string]string{"name": text})
+		setState(userID, "reseller_add_telegram")
+		sendMessage(bot, msg.Chat.ID, "🤝 *TAMBAH RESELLER*\nMasukkan **Telegram ID** reseller (`0` jika hanya memakai API key):")
+	case "reseller_add_telegram":
+		if !allow(PermSales) {
 			return
 		}
-		if _, err := strconv.Atoi(text); err != nil {
-			sendMessage(bot, msg.Chat.ID, "❌ Limit IP harus angka.")
+		if _, err := strconv.ParseInt(text, 10, 64); err != nil {
+			sendMessage(bot, msg.Chat.ID, "❌ Telegram ID harus angka.")
 			return
 		}
 		stateMutex.Lock()
 		if data, ok := tempUserData[userID]; ok {
-			data["limit_ip"] = text
+			data["telegram_id"] = text
 		}
 		stateMutex.Unlock()
-		setState(userID, "renew_limit_quota")
-		sendMessage(bot, msg.Chat.ID, "💾 *MENU RENEW*\n\nMasukkan **Limit Kuota** (GB):")
-	case "renew_limit_quota":
-		if !isAdmin {
-			sendMessage(bot, msg.Chat.ID, "⛔ Akses Ditolak. Anda bukan admin.")
-			resetState(userID)
+		setState(userID, "reseller_add_price")
+		sendMessage(bot, msg.Chat.ID, "🤝 *TAMBAH RESELLER*\nMasukkan **Harga per Hari** (kredit):")
+	case "reseller_add_price":
+		if !allow(PermSales) {
 			return
 		}
-		if _, err := strconv.Atoi(text); err != nil {
-			sendMessage(bot, msg.Chat.ID, "❌ Limit Kuota harus angka.")
+		price, err := strconv.ParseInt(text, 10, 64)
+		if err != nil || price < 0 {
+			sendMessage(bot, msg.Chat.ID, "❌ Harga harus angka positif.")
 			return
 		}
-		stateMutex.Lock()
-		if data, ok := tempUserData[userID]; ok {
-			data["limit_quota"] = text
+		data, ok := getTempData(userID)
+		resetState(userID)
+		if ok {
+			telegramID, _ := strconv.ParseInt(data["telegram_id"], 10, 64)
+			err := addReseller(bot, adminAPI, msg.Chat.ID, data["name"], telegramID, price)
+			auditAdmin(admin, "reseller_add", map[string]string{"name": data["name"], "telegram_id": data["telegram_id"], "price": text}, err)
 		}
-		stateMutex.Unlock()
-		setState(userID, "renew_days")
-		sendMessage(bot, msg.Chat.ID, "📅 *MENU RENEW*\n\nMasukkan tambahan **Durasi** (*Hari*):")
-	case "renew_days":
-		if !isAdmin {
-			sendMessage(bot, msg.Chat.ID, "⛔ Akses Ditolak. Anda bukan admin.")
-			resetState(userID)
+	case "reseller_topup":
+		if !allow(PermSales) {
 			return
 		}
-		days, err := strconv.Atoi(text)
+		amount, err := strconv.ParseInt(text, 10, 64)
+		if err != nil || amount <= 0 {
+			sendMessage(bot, msg.Chat.ID, "❌ Jumlah kredit harus angka lebih dari 0.")
+			return
+		}
+		data, ok := getTempData(userID)
+		resetState(userID)
+		if ok {
+			err := topUpReseller(bot, adminAPI, msg.Chat.ID, data["reseller"], amount)
+			auditAdmin(admin, "reseller_topup", map[string]string{"reseller": data["reseller"], "amount": text}, err)
+		}
+	case "admin_add_id":
+		if !allow(PermAdmins) {
+			return
+		}
+		id, err := strconv.ParseInt(text, 10, 64)
+		if err != nil || id <= 0 {
+			sendMessage(bot, msg.Chat.ID, "❌ Telegram ID harus angka.")
+			return
+		}
+		resetState(userID)
+		showRolePicker(bot, msg.Chat.ID, id)
+	case "trial_check":
+		if !allow(PermView) {
+			return
+		}
+		target, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			sendMessage(bot, msg.Chat.ID, "❌ Telegram ID harus angka.")
+			return
+		}
+		resetState(userID)
+		showTrialStatus(bot, msg.Chat.ID, target)
+	case "create_username":
+		stateMutex.Lock()
+		tempUserData[userID] = map[string]string{"username": text}
+		stateMutex.Unlock()
+		visibility := ""
+		if !canCreate {
+			visibility = client.PlanPublic
+		}
+		if showPlanPicker(bot, userAPI, msg.Chat.ID, "create", visibility) {
+			setState(userID, "create_plan")
+			return
+		}
+		setState(userID, "create_limit_ip")
+		sendMessage(bot, msg.Chat.ID, fmt.Sprintf("🔑 *CREATE USER*\nPassword: `%s`\n\nMasukkan **Limit IP**:", text))
+	case "my_rotate_password":
+		if text == "" || strings.ContainsAny(text, "| ") {
+			sendMessage(bot, msg.Chat.ID, "❌ Password tidak boleh kosong, mengandung spasi, atau karakter `|`.")
+			return
+		}
+		data, ok := getTempData(userID)
+		resetState(userID)
+		if ok {
+			rotateMyPassword(bot, msg.Chat.ID, userID, data["username"], text)
+		}
+	case "redeem_code":
+		setTempData(userID, map[string]string{"code": text})
+		setState(userID, "redeem_password")
+		sendMessage(bot, msg.Chat.ID, "🎟️ *REDEEM VOUCHER*\nMasukkan **Password** akun baru, atau password akun milik Anda yang ingin diperpanjang:")
+	case "redeem_password":
+		data, ok := getTempData(userID)
+		resetState(userID)
+		if ok {
+			redeemVoucher(bot, msg.Chat.ID, userID, data["code"], text)
+		}
+	case "voucher_count":
+		if !allow(PermSales) {
+			return
+		}
+		count, err := strconv.Atoi(text)
+		if err != nil || count < 1 || count > 500 {
+			sendMessage(bot, msg.Chat.ID, "❌ Jumlah harus angka 1-500.")
+			return
+		}
+		stateMutex.Lock()
+		if data, ok := tempUserData[userID]; ok {
+			data["count"] = text
+		}
+		stateMutex.Unlock()
+		setState(userID, "voucher_days")
+		sendMessage(bot, msg.Chat.ID, "🎟️ *GENERATE VOUCHER*\nMasukkan **Masa Berlaku** voucher (*Hari*, `0` = tanpa batas):")
+	case "voucher_days":
+		if !allow(PermSales) {
+			return
+		}
+		days, err := strconv.Atoi(text)
+		if err != nil || days < 0 {
+			sendMessage(bot, msg.Chat.ID, "❌ Masa berlaku harus angka (0 atau lebih).")
+			return
+		}
+		data, ok := getTempData(userID)
+		resetState(userID)
+		if ok {
+			count, _ := strconv.Atoi(data["count"])
+			err := generateVouchers(bot, adminAPI, msg.Chat.ID, data["plan"], count, days)
+			auditAdmin(admin, "voucher_generate", map[string]string{"plan": data["plan"], "count": data["count"], "days": text}, err)
+		}
+	case "create_plan", "renew_plan":
+		sendMessage(bot, msg.Chat.ID, "👆 Silakan pilih plan dari tombol di atas, atau ketik /start untuk batal.")
+	case "create_limit_ip":
+		if _, err := strconv.Atoi(text); err != nil {
+			sendMessage(bot, msg.Chat.ID, "❌ Limit IP harus angka.")
+			return
+		}
+		stateMutex.Lock()
+		if data, ok := tempUserData[userID]; ok {
+			data["limit_ip"] = text
+		}
+		stateMutex.Unlock()
+		setState(userID, "create_limit_quota")
+		sendMessage(bot, msg.Chat.ID, "💾 *CREATE USER*\n\nMasukkan **Limit Kuota** (GB):")
+	case "create_limit_quota":
+		if _, err := strconv.Atoi(text); err != nil {
+			sendMessage(bot, msg.Chat.ID, "❌ Limit Kuota harus angka.")
+			return
+		}
+		stateMutex.Lock()
+		if data, ok := tempUserData[userID]; ok {
+			data["limit_quota"] = text
+		}
+		stateMutex.Unlock()
+		setState(userID, "create_days")
+		sendMessage(bot, msg.Chat.ID, "📅 *CREATE USER*\n\nMasukkan **Durasi** (*Hari*):")
+	case "create_days":
+		days, err := strconv.Atoi(text)
+		if err != nil {
+			sendMessage(bot, msg.Chat.ID, "❌ Durasi harus angka.")
+			return
+		}
+		stateMutex.Lock()
+		data, ok := tempUserData[userID]
+		stateMutex.Unlock()
+		if ok {
+			limitIP, _ := strconv.Atoi(data["limit_ip"])
+			limitQuota, _ := strconv.Atoi(data["limit_quota"])
+			username := data["username"]
+			resetState(userID)
+			req := client.CreateUserRequest{Password: username, Days: days, LimitIP: limitIP, LimitQuota: limitQuota}
+			// User publik tidak boleh membuat akun langsung; tunggu persetujuan admin
+			if !canCreate {
+				requestApproval(bot, msg.From, req)
+				return
+			}
+			currentCfg, _ := loadConfig()
+			err := createUser(bot, userAPI, msg.Chat.ID, req, currentCfg)
+			auditAdmin(admin, "create", map[string]string{"password": username, "days": text}, err)
+		}
+	case "renew_limit_ip":
+		if !canRenew {
+			sendMessage(bot, msg.Chat.ID, "⛔ Akses Ditolak. Anda bukan admin.")
+			resetState(userID)
+			return
+		}
+		if _, err := strconv.Atoi(text); err != nil {
+			sendMessage(bot, msg.Chat.ID, "❌ Limit IP harus angka.")
+			return
+		}
+		stateMutex.Lock()
+		if data, ok := tempUserData[userID]; ok {
+			data["limit_ip"] = text
+		}
+		stateMutex.Unlock()
+		setState(userID, "renew_limit_quota")
+		sendMessage(bot, msg.Chat.ID, "💾 *MENU RENEW*\n\nMasukkan **Limit Kuota** (GB):")
+	case "renew_limit_quota":
+		if !canRenew {
+			sendMessage(bot, msg.Chat.ID, "⛔ Akses Ditolak. Anda bukan admin.")
+			resetState(userID)
+			return
+		}
+		if _, err := strconv.Atoi(text); err != nil {
+			sendMessage(bot, msg.Chat.ID, "❌ Limit Kuota harus angka.")
+			return
+		}
+		stateMutex.Lock()
+		if data, ok := tempUserData[userID]; ok {
+			data["limit_quota"] = text
+		}
+		stateMutex.Unlock()
+		setState(userID, "renew_days")
+		sendMessage(bot, msg.Chat.ID, "📅 *MENU RENEW*\n\nMasukkan tambahan **Durasi** (*Hari*):")
+	case "renew_days":
+		if !canRenew {
+			sendMessage(bot, msg.Chat.ID, "⛔ Akses Ditolak. Anda bukan admin.")
+			resetState(userID)
+			return
+		}
+		days, err := strconv.Atoi(text)
 		if err != nil {
 			sendMessage(bot, msg.Chat.ID, "❌ Durasi harus angka.")
 			return
@@ -512,8 +1139,9 @@ func handleState(bot *tgbotapi.BotAPI, msg *tgbotapi.Message, state string, isAd
 			limitIP, _ := strconv.Atoi(data["limit_ip"])
 			limitQuota, _ := strconv.Atoi(data["limit_quota"])
 			username := data["username"]
-			renewUser(bot, msg.Chat.ID, username, days, limitIP, limitQuota)
+			err := renewUser(bot, userAPI, msg.Chat.ID, client.RenewUserRequest{Password: username, Days: days, LimitIP: limitIP, LimitQuota: limitQuota})
 			resetState(userID)
+			auditAdmin(admin, "renew", map[string]string{"password": username, "days": text}, err)
 		}
 	}
 }
@@ -526,29 +1154,29 @@ func getTempData(userID int64) (map[string]string, bool) {
 	return data, ok
 }
 
-func handleRestoreFromUpload(bot *tgbotapi.BotAPI, msg *tgbotapi.Message) {
+func handleRestoreFromUpload(bot *tgbotapi.BotAPI, c *client.Client, msg *tgbotapi.Message) error {
 	resetState(msg.From.ID)
 	sendMessage(bot, msg.Chat.ID, "⏳ Sedang mengunduh dan memproses file backup...")
 	url, err := bot.GetFileDirectURL(msg.Document.FileID)
 	if err != nil {
 		sendMessage(bot, msg.Chat.ID, "❌ Gagal mengambil link file dari Telegram.")
-		return
+		return err
 	}
 	resp, err := http.Get(url)
 	if err != nil {
 		sendMessage(bot, msg.Chat.ID, "❌ Gagal mendownload file.")
-		return
+		return err
 	}
 	defer resp.Body.Close()
 	var backupUsers []UserData
 	if err := json.NewDecoder(resp.Body).Decode(&backupUsers); err != nil {
 		sendMessage(bot, msg.Chat.ID, "❌ Format file backup rusak atau bukan JSON yang valid.")
-		return
+		return err
 	}
 	if len(backupUsers) == 0 {
 		sendMessage(bot, msg.Chat.ID, "⚠️ File backup kosong.")
 		showMainMenu(bot, msg.Chat.ID, true)
-		return
+		return errors.New("file backup kosong")
 	}
 	sendMessage(bot, msg.Chat.ID, fmt.Sprintf("⏳ Memproses %d user...", len(backupUsers)))
 	successCount := 0
@@ -566,22 +1194,16 @@ func handleRestoreFromUpload(bot *tgbotapi.BotAPI, msg *tgbotapi.Message) {
 		duration := time.Until(expiredTime)
 		days := int(duration.Hours() / 24)
 		if days > 0 {
-			res, _ := apiCall("POST", "/user/create", map[string]interface{}{
-				"password":     u.Password,
-				"days":         days,
+			_, err := c.CreateUser(context.Background(), client.CreateUserRequest{
+				Password: u.Password,
+				Days:     days,
 			})
-			if res["success"] == true {
+			if err == nil {
 				successCount++
+			} else if errors.Is(err, client.ErrConflict) {
+				skippedCount++
 			} else {
-				if msg, ok := res["message"].(string); ok {
-					if strings.Contains(strings.ToLower(msg), "already exists") {
-						skippedCount++
-					} else {
-						failedCount++
-					}
-				} else {
-					failedCount++
-				}
+				failedCount++
 			}
 		} else {
 			skippedCount++
@@ -590,17 +1212,50 @@ func handleRestoreFromUpload(bot *tgbotapi.BotAPI, msg *tgbotapi.Message) {
 	msgResult := fmt.Sprintf("✅ *Restore Selesai*\nTotal: %d\n✅ Sukses: %d\n⚠️ Lewati: %d\n❌ Gagal: %d", len(backupUsers), successCount, skippedCount, failedCount)
 	sendMessage(bot, msg.Chat.ID, msgResult)
 	showMainMenu(bot, msg.Chat.ID, true)
+	if failedCount > 0 {
+		return fmt.Errorf("%d dari %d user gagal direstore", failedCount, len(backupUsers))
+	}
+	return nil
 }
 
-func showUserSelection(bot *tgbotapi.BotAPI, chatID int64, page int, action string) {
-	users, err := getUsers()
+// handleFullRestoreFromUpload mengirim arsip full state ke /api/restore.
+// Setelah berhasil, API akan merestart bot agar konfigurasi baru terbaca.
+func handleFullRestoreFromUpload(bot *tgbotapi.BotAPI, c *client.Client, msg *tgbotapi.Message) error {
+	resetState(msg.From.ID)
+	sendMessage(bot, msg.Chat.ID, "⏳ Sedang mengunduh dan memvalidasi arsip backup...")
+	url, err := bot.GetFileDirectURL(msg.Document.FileID)
+	if err != nil {
+		sendMessage(bot, msg.Chat.ID, "❌ Gagal mengambil link file dari Telegram.")
+		return err
+	}
+	resp, err := http.Get(url)
+	if err != nil {
+		sendMessage(bot, msg.Chat.ID, "❌ Gagal mendownload file.")
+		return err
+	}
+	defer resp.Body.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), BackupTimeout)
+	defer cancel()
+	result, err := c.Restore(ctx, resp.Body)
+	if err != nil {
+		sendMessage(bot, msg.Chat.ID, fmt.Sprintf("❌ *Restore Gagal*\n`%s`", err.Error()))
+		showMainMenu(bot, msg.Chat.ID, true)
+		return err
+	}
+	sendMessage(bot, msg.Chat.ID, fmt.Sprintf("✅ *Restore Selesai*\n🌐 Domain: `%s`\n📅 Backup: `%s`\n📁 File: %d\n\n🔄 Bot akan restart otomatis.",
+		result.Domain, result.CreatedAt, len(result.Files)))
+	return nil
+}
+
+func showUserSelection(bot *tgbotapi.BotAPI, c *client.Client, chatID int64, page int, action string) {
+	users, err := c.ListUsers(context.Background())
 	if err != nil {
 		sendMessage(bot, chatID, "❌ Gagal mengambil data user.")
 		return
 	}
 	if len(users) == 0 {
 		sendMessage(bot, chatID, "📂 Tidak ada user saat ini.")
-		showMainMenu(bot, chatID, true)
+		showHome(bot, chatID)
 		return
 	}
 	perPage := 10
@@ -650,7 +1305,8 @@ func showUserSelection(bot *tgbotapi.BotAPI, chatID int64, page int, action stri
 
 // showMainMenu untuk admin
 func showMainMenu(bot *tgbotapi.BotAPI, chatID int64, isAdmin bool) {
-	if !isAdmin {
+	admin := findAdmin(chatID)
+	if !isAdmin || admin == nil {
 		showPublicMenu(bot, chatID)
 		return
 	}
@@ -662,13 +1318,9 @@ func showMainMenu(bot *tgbotapi.BotAPI, chatID int64, isAdmin bool) {
 		config = BotConfig{}
 	}
 	ipInfo, _ := getIpInfo()
-	domain := "Unknown"
-	if res, err := apiCall("GET", "/info", nil); err == nil && res["success"] == true {
-		if data, ok := res["data"].(map[string]interface{}); ok {
-			if d, ok := data["domain"].(string); ok {
-				domain = d
-			}
-		}
+	domain, obfs, port := "Unknown", "Unknown", "Unknown"
+	if settings, err := api.Settings(context.Background()); err == nil {
+		domain, obfs, port = settings.Domain, settings.Obfs, strconv.Itoa(settings.ListenPort)
 	}
 	totalUsers := 0
 	if users, err := getUsers(); err == nil {
@@ -707,43 +1359,46 @@ func showMainMenu(bot *tgbotapi.BotAPI, chatID int64, isAdmin bool) {
 	msgText := fmt.Sprintf("✨ *WELCOME TO BOT RAMDAN UDP ZIVPN*\n\n"+
 		"• 🖥️ *Server Info:*\n"+
 		"• 🌐 *Domain*: `%s`\n"+
+		"• 🔐 *Obfs*: `%s`\n"+
+		"• 🔌 *Port*: `%s`\n"+
 		"• 📍 *Lokasi*: `%s`\n"+
 		"• 📡 *ISP*: `%s`\n"+
 		"• 👤 *Total Akun*: `%d`\n"+
 		"• 🔔 *Notif*: %s\n\n"+
 		"• ⏳ *Bot Status:*\n"+
 		"• 🕒 *Uptime*: %s\n"+
-		"• ⚠️ *VPS Exp*: %s\n\n"+
+		"• ⚠️ *VPS Exp*: %s\n"+
+		"• 🛡️ *Peran*: %s\n\n"+
 		"• 🧑‍💻 *Hubungi @Ramadhann121 untuk bantuan*",
-		domain, ipInfo.City, ipInfo.Isp, totalUsers, notifStatus, uptimeStr, vpsInfo)
+		domain, obfs, port, ipInfo.City, ipInfo.Isp, totalUsers, notifStatus, uptimeStr, vpsInfo, roleLabels[admin.Role])
 	deleteLastMessage(bot, chatID)
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🎁 Trial Akun", "menu_trial"),
-			tgbotapi.NewInlineKeyboardButtonData("➕ Create Akun", "menu_create"),
-		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🔄 Renew Akun", "menu_renew"),
-			tgbotapi.NewInlineKeyboardButtonData("🗑️ Delete Akun", "menu_delete"),
-		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("📋 List Akun", "menu_list"),
-			tgbotapi.NewInlineKeyboardButtonData("📊 Info Server", "menu_info"),
-		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("💾 Backup User", "menu_backup"),
-			tgbotapi.NewInlineKeyboardButtonData("♻️ Restore User", "menu_restore"),
-		),
-		tgbotapi.NewInlineKeyboardRow(
-			// Tombol Set VPS Expired
-			tgbotapi.NewInlineKeyboardButtonData("⚠️ Set VPS Exp", "menu_set_vps_date"),
-			// Tombol Baru: Set Grup
-			tgbotapi.NewInlineKeyboardButtonData("🔔 Set Grup", "menu_set_group"),
-		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🗑️ Hapus Expired & Restart", "menu_clean_restart"),
-		),
-	)
+	// Tombol hanya tampil jika peran admin mengizinkan aksinya
+	type button struct{ perm, label, data string }
+	layout := [][]button{
+		{{"", "🎁 Trial Akun", "menu_trial"}, {PermCreate, "➕ Create Akun", "menu_create"}},
+		{{PermRenew, "🔄 Renew Akun", "menu_renew"}, {PermDelete, "🗑️ Delete Akun", "menu_delete"}},
+		{{PermView, "📋 List Akun", "menu_list"}, {"", "📊 Info Server", "menu_info"}},
+		{{PermBackup, "💾 Backup User", "menu_backup"}, {PermRestore, "♻️ Restore User", "menu_restore"}},
+		{{PermSettings, "⚠️ Set VPS Exp", "menu_set_vps_date"}, {PermSettings, "🔔 Set Grup", "menu_set_group"}},
+		{{PermView, "🤝 Reseller", "menu_resellers"}, {PermView, "🛰️ UDPGW", "menu_udpgw"}},
+		{{PermView, "🎟️ Voucher", "menu_vouchers"}, {PermView, "🧾 Order", "menu_orders"}},
+		{{PermView, "📥 Persetujuan", "menu_approvals"}, {PermView, "🎁 Trial", "menu_trial_policy"}},
+		{{PermAdmins, "👮 Admin", "menu_admins"}},
+		{{PermSettings, "🗑️ Hapus Expired & Restart", "menu_clean_restart"}},
+	}
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, line := range layout {
+		var row []tgbotapi.InlineKeyboardButton
+		for _, b := range line {
+			if b.perm == "" || admin.can(b.perm) {
+				row = append(row, tgbotapi.NewInlineKeyboardButtonData(b.label, b.data))
+			}
+		}
+		if len(row) > 0 {
+			rows = append(rows, row)
+		}
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
 	photoMsg := tgbotapi.NewPhoto(chatID, tgbotapi.FileURL(MenuPhotoURL))
 	photoMsg.Caption = msgText
 	photoMsg.ParseMode = "Markdown"
@@ -764,30 +1419,32 @@ func showMainMenu(bot *tgbotapi.BotAPI, chatID int64, isAdmin bool) {
 // showPublicMenu untuk non-admin
 func showPublicMenu(bot *tgbotapi.BotAPI, chatID int64) {
 	ipInfo, _ := getIpInfo()
-	domain := "Unknown"
-	if res, err := apiCall("GET", "/info", nil); err == nil && res["success"] == true {
-		if data, ok := res["data"].(map[string]interface{}); ok {
-			if d, ok := data["domain"].(string); ok {
-				domain = d
-			}
-		}
+	domain, obfs, port := "Unknown", "Unknown", "Unknown"
+	if settings, err := api.Settings(context.Background()); err == nil {
+		domain, obfs, port = settings.Domain, settings.Obfs, strconv.Itoa(settings.ListenPort)
 	}
 	msgText := fmt.Sprintf("✨ *WELCOME TO BOT RAMDAN UDP ZIVPN*\n\n"+
 		"• 🖥️ *Server Info:*\n"+
 		"• 🌐 *Domain*: `%s`\n"+
+		"• 🔐 *Obfs*: `%s`\n"+
+		"• 🔌 *Port*: `%s`\n"+
 		"• 📍 *Lokasi*: `%s`\n"+
 		"• 📡 *ISP*: `%s`\n\n"+
 		"• 🧑‍💻 *Hubungi @Ramadhann121 untuk bantuan*",
-		domain, ipInfo.City, ipInfo.Isp)
+		domain, obfs, port, ipInfo.City, ipInfo.Isp)
 	deleteLastMessage(bot, chatID)
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("🎁 Trial Akun", "menu_trial"),
-			tgbotapi.NewInlineKeyboardButtonData("➕ Create Akun", "menu_create"),
+			tgbotapi.NewInlineKeyboardButtonData("🎟️ Redeem Voucher", "menu_redeem"),
 		),
 		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("➕ Create Akun", "menu_create"),
 			tgbotapi.NewInlineKeyboardButtonData("📊 Info Server", "menu_info"),
 		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("👤 Akun Saya", "menu_my_accounts"),
+		),
 	)
 	photoMsg := tgbotapi.NewPhoto(chatID, tgbotapi.FileURL(MenuPhotoURL))
 	photoMsg.Caption = msgText
@@ -885,86 +1542,211 @@ func loadTrialTracker() {
 		log.Printf("Gagal memuat trial tracker: %v", err)
 		return
 	}
-	err = json.Unmarshal(file, &trialUsers)
-	if err != nil {
+	trialMutex.Lock()
+	defer trialMutex.Unlock()
+	var tracker TrialTracker
+	if err := json.Unmarshal(file, &tracker); err != nil {
 		log.Printf("Gagal unmarshal trial tracker: %v", err)
+		return
+	}
+	if tracker.Users == nil {
+		// Format lama: {"<telegram id>": true}, satu trial seumur hidup
+		var legacy map[int64]bool
+		if err := json.Unmarshal(file, &legacy); err != nil {
+			log.Printf("Gagal unmarshal trial tracker: %v", err)
+			return
+		}
+		tracker.Users = make(map[int64]*TrialRecord)
+		for id, taken := range legacy {
+			if taken {
+				tracker.Users[id] = &TrialRecord{Count: 1}
+			}
+		}
 	}
+	trialTracker = tracker
 }
 
+// saveTrialTracker harus dipanggil dengan trialMutex terkunci.
 func saveTrialTracker() error {
-	file, err := json.MarshalIndent(trialUsers, "", " ")
+	file, err := json.MarshalIndent(trialTracker, "", " ")
 	if err != nil {
 		return err
 	}
 	return os.WriteFile(TrialTrackerFile, file, 0644)
 }
 
-// --- BACKUP FUNCTIONS ---
-// (fungsi backup tetap sama, hanya admin yang bisa akses)
-
-func saveBackupToFile() (string, error) {
-	log.Println("=== [DEBUG 1] Memulai saveBackupToFile ===")
-	if err := os.MkdirAll(BackupDir, 0755); err != nil {
-		log.Printf("❌ [DEBUG 2] Gagal membuat folder %s: %v", BackupDir, err)
-		return "", fmt.Errorf("gagal membuat folder backup: %v", err)
-	}
-	log.Printf("✅ [DEBUG 3] Folder %s siap/ditemukan.", BackupDir)
-	users, err := getUsers()
+// --- ANTRIAN PERSETUJUAN ---
+func loadApprovals() {
+	file, err := os.ReadFile(ApprovalFile)
 	if err != nil {
-		log.Printf("❌ [DEBUG 4] Gagal getUsers: %v", err)
-		return "", fmt.Errorf("gagal ambil data user: %v", err)
+		if !os.IsNotExist(err) {
+			log.Printf("Gagal memuat antrian persetujuan: %v", err)
+		}
+		return
 	}
-	if len(users) == 0 {
-		log.Println("⚠️ [DEBUG 5] Data user kosong.")
-		return "", fmt.Errorf("tidak ada user untuk dibackup")
+	approvalMutex.Lock()
+	defer approvalMutex.Unlock()
+	if err := json.Unmarshal(file, &approvals); err != nil {
+		log.Printf("Gagal unmarshal antrian persetujuan: %v", err)
 	}
-	log.Printf("✅ [DEBUG 6] Berhasil ambil %d user.", len(users))
-	domain := "Unknown"
-	if res, err := apiCall("GET", "/info", nil); err == nil && res["success"] == true {
-		if data, ok := res["data"].(map[string]interface{}); ok {
-			if d, ok := data["domain"].(string); ok {
-				domain = d
+}
+
+// saveApprovals harus dipanggil dengan approvalMutex terkunci.
+func saveApprovals() error {
+	file, err := json.MarshalIndent(approvals, "", " ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(ApprovalFile, file, 0644)
+}
+
+// --- PEMILIK AKUN ---
+func loadOwners() {
+	ownerMutex.Lock()
+	defer ownerMutex.Unlock()
+	for path, target := range map[string]interface{}{TelegramOwnerFile: &owners, ReminderFile: &reminders} {
+		file, err := os.ReadFile(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Printf("Gagal memuat %s: %v", path, err)
 			}
+			continue
+		}
+		if err := json.Unmarshal(file, target); err != nil {
+			log.Printf("Gagal unmarshal %s: %v", path, err)
 		}
 	}
-	for i := range users {
-		users[i].Host = domain
+}
+
+// saveOwners harus dipanggil dengan ownerMutex terkunci.
+func saveOwners() error {
+	file, err := json.MarshalIndent(owners, "", " ")
+	if err != nil {
+		return err
 	}
-	filename := "backup_users.json"
-	fullPath := filepath.Join(BackupDir, filename)
-	log.Printf("✅ [DEBUG 7] Path tujuan file: %s", fullPath)
-	data, err := json.MarshalIndent(users, "", " ")
+	return os.WriteFile(TelegramOwnerFile, file, 0644)
+}
+
+// saveReminders harus dipanggil dengan ownerMutex terkunci.
+func saveReminders() error {
+	file, err := json.MarshalIndent(reminders, "", " ")
 	if err != nil {
-		log.Printf("❌ [DEBUG 8] Gagal marshal JSON: %v", err)
-		return "", fmt.Errorf("gagal marshal data: %v", err)
+		return err
 	}
-	if err := os.WriteFile(fullPath, data, 0644); err != nil {
-		log.Printf("❌ [DEBUG 9] GAGAL WRITE FILE (Permission?): %v", err)
-		return "", fmt.Errorf("GAGAL MENULIS FILE KE DISK: %v\nPastikan bot memiliki akses tulis ke folder: %s", err, BackupDir)
+	return os.WriteFile(ReminderFile, file, 0644)
+}
+
+// setOwner mencatat Telegram user yang membuat akun. Pemilik menerima
+// pengingat expired untuk akun tersebut.
+func setOwner(password string, telegramID int64) {
+	ownerMutex.Lock()
+	defer ownerMutex.Unlock()
+	owners[password] = telegramID
+	if err := saveOwners(); err != nil {
+		log.Printf("Gagal menyimpan pemilik akun: %v", err)
 	}
-	if _, err := os.Stat(fullPath); err != nil {
-		log.Printf("❌ [DEBUG 10] File tidak ditemukan setelah write: %v", err)
-		return "", fmt.Errorf("file tidak ditemukan setelah write: %v", err)
+}
+
+// accountOwner mengembalikan Telegram ID pemilik akun, 0 jika tidak tercatat.
+func accountOwner(password string) int64 {
+	ownerMutex.Lock()
+	defer ownerMutex.Unlock()
+	return owners[password]
+}
+
+// moveOwner memindah pemilik dan catatan pengingat saat password diganti.
+func moveOwner(oldPassword, newPassword string) {
+	ownerMutex.Lock()
+	defer ownerMutex.Unlock()
+	if owner, ok := owners[oldPassword]; ok {
+		owners[newPassword] = owner
+		delete(owners, oldPassword)
+		if err := saveOwners(); err != nil {
+			log.Printf("Gagal menyimpan pemilik akun: %v", err)
+		}
 	}
-	absPath, err := filepath.Abs(fullPath)
-	if err != nil {
-		return fullPath, nil
+	if rec, ok := reminders[oldPassword]; ok {
+		reminders[newPassword] = rec
+		delete(reminders, oldPassword)
+		if err := saveReminders(); err != nil {
+			log.Printf("Gagal menyimpan pengingat: %v", err)
+		}
 	}
-	log.Printf("✅ [DEBUG 11] Berhasil membuat file di: %s", absPath)
-	return absPath, nil
 }
 
-func performAutoBackup(bot *tgbotapi.BotAPI, adminID int64) {
-	log.Println("🔄 [AutoBackup] Memulai proses backup otomatis...")
-	filePath, err := saveBackupToFile()
-	if err != nil {
-		log.Printf("❌ [AutoBackup] Gagal menyimpan file ke disk: %v", err)
-		return
+// ownedPasswords mengembalikan password akun milik satu Telegram user.
+func ownedPasswords(telegramID int64) map[string]bool {
+	ownerMutex.Lock()
+	defer ownerMutex.Unlock()
+	owned := make(map[string]bool)
+	for password, owner := range owners {
+		if owner == telegramID {
+			owned[password] = true
+		}
 	}
-	fileInfo, err := os.Stat(filePath)
-	if err != nil {
-		log.Printf("❌ [AutoBackup] Gagal membaca file info: %v", err)
-		return
+	return owned
+}
+
+// removeOwner dipanggil saat akun dihapus agar password yang dibuat ulang
+// tidak mewarisi pemilik lama.
+func removeOwner(password string) {
+	ownerMutex.Lock()
+	defer ownerMutex.Unlock()
+	if _, ok := owners[password]; ok {
+		delete(owners, password)
+		if err := saveOwners(); err != nil {
+			log.Printf("Gagal menyimpan pemilik akun: %v", err)
+		}
+	}
+	if _, ok := reminders[password]; ok {
+		delete(reminders, password)
+		if err := saveReminders(); err != nil {
+			log.Printf("Gagal menyimpan pengingat: %v", err)
+		}
+	}
+}
+
+// --- BACKUP FUNCTIONS ---
+// (fungsi backup tetap sama, hanya admin yang bisa akses)
+
+// saveBackupToFile menyimpan arsip full state dari API (config.json,
+// users.db, sertifikat, API key, bot-config.json, trial tracker, dll)
+func saveBackupToFile(c *client.Client) (string, error) {
+	if err := os.MkdirAll(BackupDir, 0755); err != nil {
+		log.Printf("❌ [Backup] Gagal membuat folder %s: %v", BackupDir, err)
+		return "", fmt.Errorf("gagal membuat folder backup: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), BackupTimeout)
+	defer cancel()
+	data, err := c.Backup(ctx)
+	if err != nil {
+		log.Printf("❌ [Backup] Gagal mengambil arsip dari API: %v", err)
+		return "", fmt.Errorf("gagal ambil arsip backup: %v", err)
+	}
+	fullPath := filepath.Join(BackupDir, BackupFileName)
+	if err := os.WriteFile(fullPath, data, 0600); err != nil {
+		log.Printf("❌ [Backup] Gagal menulis file (Permission?): %v", err)
+		return "", fmt.Errorf("GAGAL MENULIS FILE KE DISK: %v\nPastikan bot memiliki akses tulis ke folder: %s", err, BackupDir)
+	}
+	absPath, err := filepath.Abs(fullPath)
+	if err != nil {
+		return fullPath, nil
+	}
+	log.Printf("✅ [Backup] Berhasil membuat file di: %s (%d bytes)", absPath, len(data))
+	return absPath, nil
+}
+
+func performAutoBackup(bot *tgbotapi.BotAPI, adminID int64) {
+	log.Println("🔄 [AutoBackup] Memulai proses backup otomatis...")
+	filePath, err := saveBackupToFile(api)
+	if err != nil {
+		log.Printf("❌ [AutoBackup] Gagal menyimpan file ke disk: %v", err)
+		return
+	}
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		log.Printf("❌ [AutoBackup] Gagal membaca file info: %v", err)
+		return
 	}
 	if fileInfo.Size() > (50 * 1024 * 1024) {
 		sizeInMb := fileInfo.Size() / 1024 / 1024
@@ -988,31 +1770,31 @@ func performAutoBackup(bot *tgbotapi.BotAPI, adminID int64) {
 	}
 }
 
-func performManualBackup(bot *tgbotapi.BotAPI, chatID int64) {
+func performManualBackup(bot *tgbotapi.BotAPI, c *client.Client, chatID int64) error {
 	log.Println("=== [DEBUG START] Perintah Backup Manual Diterima ===")
 	sendMessage(bot, chatID, "⏳ Sedang memproses backup...")
-	filePath, err := saveBackupToFile()
+	filePath, err := saveBackupToFile(c)
 	if err != nil {
 		log.Printf("❌ [DEBUG END] Gagal di saveBackupToFile: %v", err)
 		sendMessage(bot, chatID, "❌ **GAGAL MEMBUAT FILE**\n\nServer Error:\n`"+err.Error()+"`\n\n*Cek log terminal bot untuk detail lengkap.*")
-		return
+		return err
 	}
 	fileInfo, err := os.Stat(filePath)
 	if os.IsNotExist(err) {
 		log.Printf("❌ [DEBUG] File hilang setelah dibuat: %s", filePath)
 		sendMessage(bot, chatID, "❌ Error Aneh: File backup hilang setelah dibuat.")
-		return
+		return err
 	}
 	log.Printf("✅ [DEBUG] File Info - Path: %s, Size: %d bytes", filePath, fileInfo.Size())
 	if fileInfo.Size() > (50 * 1024 * 1024) {
 		sizeInMb := fileInfo.Size() / 1024 / 1024
 		sendMessage(bot, chatID, fmt.Sprintf("❌ **GAGAL KIRIM**\n\nFile terlalu besar: **%d MB**.\nLimit Telegram: 50 MB.\n\nAmbil file manual di server:\n`%s`", sizeInMb, filePath))
 		showMainMenu(bot, chatID, true)
-		return
+		return fmt.Errorf("file backup %d MB melebihi limit Telegram", sizeInMb)
 	}
 	log.Println("✅ [DEBUG] Mencoba mengirim file ke Telegram...")
 	doc := tgbotapi.NewDocument(chatID, tgbotapi.FilePath(filePath))
-	doc.Caption = fmt.Sprintf("💾 *Backup Data User*\n📁 Ukuran: %.2f MB\n📂 Lokasi: `%s`",
+	doc.Caption = fmt.Sprintf("💾 *Backup Full State*\n📁 Ukuran: %.2f MB\n📂 Lokasi: `%s`",
 		float64(fileInfo.Size())/1024/1024,
 		filePath)
 	doc.ParseMode = "Markdown"
@@ -1028,17 +1810,21 @@ func performManualBackup(bot *tgbotapi.BotAPI, chatID int64) {
 		}
 		sendMessage(bot, chatID, fmt.Sprintf("❌ **GAGAL MENGIRIM KE TELEGRAM**\n\nError: %s\n\n**File tersimpan di server:**\n`%s`\n\nSilakan ambil via SSH jika perlu.", errorDetail, filePath))
 		showMainMenu(bot, chatID, true)
-		return
+		return err
 	}
 	log.Println("✅ [DEBUG END] Backup sukses terkirim!")
 	showMainMenu(bot, chatID, true)
+	return nil
 }
 
 // --- SYSTEM & USER MANAGEMENT FUNCTIONS ---
-func cleanAndRestartService(bot *tgbotapi.BotAPI, chatID int64) {
+// cleanAndRestartService berjalan di background; hasilnya dicatat di audit
+// log setelah selesai.
+func cleanAndRestartService(bot *tgbotapi.BotAPI, admin *Admin, chatID int64) {
 	sendMessage(bot, chatID, "🧹 Membersihkan akun expired & Restart Service...")
 	go func() {
-		autoDeleteExpiredUsers(bot, chatID, true)
+		err := autoDeleteExpiredUsers(bot, apiFor(admin), chatID, true)
+		auditAdmin(admin, "clean_restart", map[string]string{}, err)
 	}()
 }
 
@@ -1047,50 +1833,39 @@ func restartVpnService() error {
 	return cmd.Run()
 }
 
-func autoDeleteExpiredUsers(bot *tgbotapi.BotAPI, adminID int64, shouldRestart bool) {
+func autoDeleteExpiredUsers(bot *tgbotapi.BotAPI, c *client.Client, adminID int64, shouldRestart bool) error {
 	users, err := getUsers()
 	if err != nil {
 		log.Printf("❌ [AutoDelete] Gagal mengambil data user: %v", err)
-		return
+		return err
 	}
 	deletedCount := 0
 	var deletedUsers []string
 	for _, u := range users {
 		// 1. Parse tanggal expired dari string ke Time object
-		expiredTime, err := time.Parse("2006-01-02", u.Expired)
+		expiredTime, err := parseExpired(u.Expired)
 		if err != nil {
-			// Coba format dengan jam jika format tanggal saja gagal
-			expiredTime, err = time.Parse("2006-01-02 15:04:05", u.Expired)
-			if err != nil {
-				// Jika format tanggal kacau, skip user ini
-				continue
-			}
+			// Jika format tanggal kacau, skip user ini
+			continue
 		}
 		// 2. Logika Utama: Cek apakah waktu SEKARANG sudah melebihi waktu EXPIRED
 		if time.Now().After(expiredTime) {
 
 			// Lakukan penghapusan via API
-			res, err := apiCall("POST", "/user/delete", map[string]interface{}{
-				"password": u.Password,
-			})
-			if err != nil {
-				log.Printf("❌ [AutoDelete] Error API saat menghapus %s: %v", u.Password, err)
+			if err := c.DeleteUser(context.Background(), u.Password); err != nil {
+				log.Printf("❌ [AutoDelete] Gagal menghapus %s: %v", u.Password, err)
 				continue
 			}
-			if res["success"] == true {
-				deletedCount++
-				deletedUsers = append(deletedUsers, u.Password)
-				log.Printf("✅ [AutoDelete] User kadaluwarsa [%s] (Exp: %s) berhasil dihapus.", u.Password, u.Expired)
-			} else {
-				log.Printf("❌ [AutoDelete] Gagal menghapus %s: %s", u.Password, res["message"])
-			}
+			deletedCount++
+			deletedUsers = append(deletedUsers, u.Password)
+			log.Printf("✅ [AutoDelete] User kadaluwarsa [%s] (Exp: %s) berhasil dihapus.", u.Password, u.Expired)
 		}
 	}
 	// --- Logika Restart Service (Opsional, hanya jika diminta via menu manual) ---
 	if shouldRestart {
 		if deletedCount > 0 {
 			log.Printf("🔄 [Restart Service] Melakukan restart service %s...", ServiceName)
-			if err := restartVpnService(); err != nil {
+			if err = restartVpnService(); err != nil {
 				log.Printf("❌ Gagal restart service: %v", err)
 				if bot != nil {
 					bot.Send(tgbotapi.NewMessage(adminID, "❌ Gagal merestart service. Cek log server."))
@@ -1106,7 +1881,7 @@ func autoDeleteExpiredUsers(bot *tgbotapi.BotAPI, adminID int64, shouldRestart b
 				bot.Send(tgbotapi.NewMessage(adminID, "✅ Tidak ada akun kadaluwarsa. Tidak perlu restart service."))
 			}
 		}
-		return
+		return err
 	}
 	// --- Notifikasi Admin (Hanya jika ada yang dihapus pada background loop) ---
 	if deletedCount > 0 {
@@ -1124,38 +1899,18 @@ func autoDeleteExpiredUsers(bot *tgbotapi.BotAPI, adminID int64, shouldRestart b
 			bot.Send(notification)
 		}
 	}
+	return nil
 }
 
-func apiCall(method, endpoint string, payload interface{}) (map[string]interface{}, error) {
-	var reqBody []byte
-	var err error
-	if payload != nil {
-		reqBody, err = json.Marshal(payload)
-		if err != nil {
-			return nil, err
-		}
-	}
-	client := &http.Client{Timeout: 10 * time.Second}
-	req, err := http.NewRequest(method, ApiUrl+endpoint, bytes.NewBuffer(reqBody))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-API-Key", ApiKey)
-	resp, err := client.Do(req)
+// parseExpired membaca tanggal expired user. Akun dihapus dan pengingat
+// dihitung terhadap waktu yang sama.
+func parseExpired(value string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02", value)
 	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API returned status: %d", resp.StatusCode)
-	}
-	body, _ := io.ReadAll(resp.Body)
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("failed to decode API response: %v", err)
+		// Coba format dengan jam jika format tanggal saja gagal
+		t, err = time.Parse("2006-01-02 15:04:05", value)
 	}
-	return result, nil
+	return t, err
 }
 
 func getIpInfo() (IpInfo, error) {
@@ -1172,52 +1927,95 @@ func getIpInfo() (IpInfo, error) {
 }
 
 func getUsers() ([]UserData, error) {
-	res, err := apiCall("GET", "/users", nil)
+	list, err := api.ListUsers(context.Background())
 	if err != nil {
 		return nil, err
 	}
-	if res["success"] != true {
-		return nil, fmt.Errorf("API success is false")
-	}
-	var users []UserData
-	if dataSlice, ok := res["data"].([]interface{}); ok {
-		dataBytes, err := json.Marshal(dataSlice)
-		if err != nil {
-			return nil, fmt.Errorf("gagal marshal data: %v", err)
-		}
-		if err := json.Unmarshal(dataBytes, &users); err != nil {
-			return nil, fmt.Errorf("gagal unmarshal data ke UserData: %v", err)
-		}
-	} else {
-		return []UserData{}, nil
+	users := make([]UserData, 0, len(list))
+	for _, u := range list {
+		users = append(users, UserData{User: u})
 	}
 	return users, nil
 }
 
-func createUser(bot *tgbotapi.BotAPI, chatID int64, username string, days int, limitIP int, limitQuota int, config BotConfig) {
-	res, err := apiCall("POST", "/user/create", map[string]interface{}{
-		"password":     username,
-		"days":         days,
-		"limit_ip":     limitIP,
-		"limit_quota":  limitQuota,
-	})
+// createUser membuat akun dan mengirim detailnya ke chatID. Mengembalikan
+// error jika akun gagal dibuat.
+func createUser(bot *tgbotapi.BotAPI, c *client.Client, chatID int64, req client.CreateUserRequest, config BotConfig) error {
+	data, err := c.CreateUser(context.Background(), req)
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		sendMessage(bot, chatID, fmt.Sprintf("❌ Gagal: %s", apiErr.Message))
+		showHome(bot, chatID)
+		return err
+	}
 	if err != nil {
 		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
-		return
+		return err
 	}
-	if res["success"] == true {
-		data, ok := res["data"].(map[string]interface{})
-		if !ok {
-			sendMessage(bot, chatID, "❌ Gagal: Format data respons dari API tidak valid.")
-			return
+	setOwner(data.Password, chatID)
+	sendAccountCreated(bot, chatID, "🎉 *AKUN BERHASIL DIBUAT*", data, config)
+	showHome(bot, chatID)
+	return nil
+}
+
+// sendAccountCreated mengirim detail akun ke user dan versi tersensor ke
+// grup notifikasi.
+func sendAccountCreated(bot *tgbotapi.BotAPI, chatID int64, title string, data *client.CreatedUser, config BotConfig) {
+	ipInfo, _ := getIpInfo()
+	// Pesan untuk User (Full Detail)
+	msg := fmt.Sprintf("%s\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━\n"+
+		"🔑 *Password*: `%s`\n"+
+		"🌐 *Domain*: `%s`\n"+
+		"🗓️ *Expired*: `%s`\n"+
+		"🔢 *Limit IP*: `%d` Device\n"+
+		"💾 *Limit Kuota*: `%d GB`\n"+
+		"📍 *Lokasi Server*: `%s`\n"+
+		"📡 *ISP Server*: `%s`\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━\n"+
+		"🔒 *Private Tidak Digunakan User Lain*\n"+
+		"⚡ *Full Speed Anti Lemot Stabil 24 Jam*\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━",
+		title, data.Password, data.Domain, data.Expired, data.LimitIP, data.LimitQuota, ipInfo.City, ipInfo.Isp)
+	msg += statusLine(data.StatusURL)
+	// Profil siap-import dan QR code; jika gagal, detail teks tetap dikirim
+	var qr []byte
+	if profile, err := api.UserProfile(context.Background(), data.Password); err == nil {
+		port := strconv.Itoa(profile.Port)
+		if profile.PortRange != "" {
+			port += " / " + profile.PortRange
+		}
+		msg += fmt.Sprintf("\n🔌 *Port*: `%s`\n🛡️ *Obfs*: `%s`\n📲 *Import* (scan QR atau salin):\n`%s`", port, profile.Obfs, profile.URI)
+		if qr, err = api.UserProfileQR(context.Background(), data.Password); err != nil {
+			log.Printf("Gagal membuat QR profil %s: %v", data.Password, err)
 		}
-		ipInfo, _ := getIpInfo()
-		title := "🎉 *AKUN BERHASIL DIBUAT*"
-		if days == 1 {
-			title = "🎁 *AKUN TRIAL 1 HARI*"
+	} else {
+		log.Printf("Gagal mengambil profil %s: %v", data.Password, err)
+	}
+	// Kirim ke User
+	deleteLastMessage(bot, chatID)
+	sent := false
+	if qr != nil {
+		photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileBytes{Name: "zivpn-" + data.Password + ".png", Bytes: qr})
+		photo.Caption = msg
+		photo.ParseMode = "Markdown"
+		if _, err := bot.Send(photo); err == nil {
+			sent = true
+		} else {
+			log.Printf("Gagal kirim QR profil ke %d: %v", chatID, err)
 		}
-		// Pesan untuk User (Full Detail)
-		msg := fmt.Sprintf("%s\n"+
+	}
+	if !sent {
+		reply := tgbotapi.NewMessage(chatID, msg)
+		reply.ParseMode = "Markdown"
+		bot.Send(reply)
+	}
+	// --- KIRIM KE GRUP NOTIFIKASI (DENGAN SENSOR) ---
+	if config.NotifGroupID != 0 {
+		// Fungsi sensor: Ganti karakter dengan bintang
+		maskedPass := strings.Repeat("*", len(data.Password))
+		maskedDomain := strings.Repeat("*", len(data.Domain))
+		groupMsg := fmt.Sprintf("%s\n"+
 			"━━━━━━━━━━━━━━━━━━━━━━━━━\n"+
 			"🔑 *Password*: `%s`\n"+
 			"🌐 *Domain*: `%s`\n"+
@@ -1226,201 +2024,281 @@ func createUser(bot *tgbotapi.BotAPI, chatID int64, username string, days int, l
 			"💾 *Limit Kuota*: `%d GB`\n"+
 			"📍 *Lokasi Server*: `%s`\n"+
 			"📡 *ISP Server*: `%s`\n"+
-			"━━━━━━━━━━━━━━━━━━━━━━━━━\n"+
-			"🔒 *Private Tidak Digunakan User Lain*\n"+
-			"⚡ *Full Speed Anti Lemot Stabil 24 Jam*\n"+
-			"━━━━━━━━━━━━━━━━━━━━━━━━━",
-			title, data["password"], data["domain"], data["expired"], limitIP, limitQuota, ipInfo.City, ipInfo.Isp)
-		// Kirim ke User
-		reply := tgbotapi.NewMessage(chatID, msg)
-		reply.ParseMode = "Markdown"
-		deleteLastMessage(bot, chatID)
-		bot.Send(reply)
-		// --- KIRIM KE GRUP NOTIFIKASI (DENGAN SENSOR) ---
-		if config.NotifGroupID != 0 {
-			// Ambil password dan domain asli untuk disensor
-			passStr, _ := data["password"].(string)
-			domStr, _ := data["domain"].(string)
-			// Fungsi sensor: Ganti karakter dengan bintang
-			maskedPass := strings.Repeat("*", len(passStr))
-			maskedDomain := strings.Repeat("*", len(domStr))
-			groupMsg := fmt.Sprintf("%s\n"+
-				"━━━━━━━━━━━━━━━━━━━━━━━━━\n"+
-				"🔑 *Password*: `%s`\n"+
-				"🌐 *Domain*: `%s`\n"+
-				"🗓️ *Expired*: `%s`\n"+
-				"🔢 *Limit IP*: `%d` Device\n"+
-				"💾 *Limit Kuota*: `%d GB`\n"+
-				"📍 *Lokasi Server*: `%s`\n"+
-				"📡 *ISP Server*: `%s`\n"+
-				"━━━━━━━━━━━━━━━━━━━━━━━━━\n",
-				title, maskedPass, maskedDomain, data["expired"], limitIP, limitQuota, ipInfo.City, ipInfo.Isp)
-			groupMsgObj := tgbotapi.NewMessage(config.NotifGroupID, groupMsg)
-			groupMsgObj.ParseMode = "Markdown"
-			if _, err := bot.Send(groupMsgObj); err != nil {
-				log.Printf("Gagal kirim notif sensor ke grup %d: %v", config.NotifGroupID, err)
-			}
-		}
-		// --------------------------------
-		showPublicMenu(bot, chatID)
-	} else {
-		errMsg, ok := res["message"].(string)
-		if !ok {
-			errMsg = "Pesan error tidak diketahui dari API."
+			"━━━━━━━━━━━━━━━━━━━━━━━━━\n",
+			title, maskedPass, maskedDomain, data.Expired, data.LimitIP, data.LimitQuota, ipInfo.City, ipInfo.Isp)
+		groupMsgObj := tgbotapi.NewMessage(config.NotifGroupID, groupMsg)
+		groupMsgObj.ParseMode = "Markdown"
+		if _, err := bot.Send(groupMsgObj); err != nil {
+			log.Printf("Gagal kirim notif sensor ke grup %d: %v", config.NotifGroupID, err)
 		}
-		sendMessage(bot, chatID, fmt.Sprintf("❌ Gagal: %s", errMsg))
-		showPublicMenu(bot, chatID)
 	}
+	// --------------------------------
 }
 
-func deleteUser(bot *tgbotapi.BotAPI, chatID int64, username string) {
-	res, err := apiCall("POST", "/user/delete", map[string]interface{}{
-		"password": username,
-	})
+// statusLine mengembalikan baris link halaman status akun, kosong jika API
+// tidak mengirim link (misalnya API versi lama).
+func statusLine(url string) string {
+	if url == "" {
+		return ""
+	}
+	return "\n📊 *Cek Status*: " + url
+}
+
+func deleteUser(bot *tgbotapi.BotAPI, c *client.Client, chatID int64, username string) error {
+	err := c.DeleteUser(context.Background(), username)
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		sendMessage(bot, chatID, fmt.Sprintf("❌ Gagal menghapus: %s", apiErr.Message))
+		showMainMenu(bot, chatID, true)
+		return err
+	}
 	if err != nil {
 		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+		return err
+	}
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ Password `%s` berhasil *DIHAPUS*.", username))
+	msg.ParseMode = "Markdown"
+	deleteLastMessage(bot, chatID)
+	bot.Send(msg)
+	showMainMenu(bot, chatID, true)
+	return nil
+}
+
+// startRenew memulai alur renew untuk admin/reseller: pilih plan jika ada,
+// jika tidak langsung input manual.
+func startRenew(bot *tgbotapi.BotAPI, c *client.Client, chatID, userID int64, username string) {
+	setTempData(userID, map[string]string{"username": username})
+	if showPlanPicker(bot, c, chatID, "renew", "") {
+		setState(userID, "renew_plan")
 		return
 	}
-	if res["success"] == true {
-		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ Password `%s` berhasil *DIHAPUS*.", username))
-		msg.ParseMode = "Markdown"
-		deleteLastMessage(bot, chatID)
-		bot.Send(msg)
-		showMainMenu(bot, chatID, true)
-	} else {
-		errMsg, ok := res["message"].(string)
-		if !ok {
-			errMsg = "Pesan error tidak diketahui dari API."
-		}
-		sendMessage(bot, chatID, fmt.Sprintf("❌ Gagal menghapus: %s", errMsg))
-		showMainMenu(bot, chatID, true)
+	setState(userID, "renew_limit_ip")
+	sendMessage(bot, chatID, fmt.Sprintf("🔄 *MENU RENEW*\nUser: `%s`\n\nMasukkan **Limit IP**:", username))
+}
+
+func renewUser(bot *tgbotapi.BotAPI, c *client.Client, chatID int64, req client.RenewUserRequest) error {
+	data, err := c.RenewUser(context.Background(), req)
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		sendMessage(bot, chatID, fmt.Sprintf("❌ Gagal memperpanjang: %s", apiErr.Message))
+		showHome(bot, chatID)
+		return err
+	}
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+		return err
+	}
+	ipInfo, _ := getIpInfo()
+	domain := "Unknown"
+	if data.Domain != "" {
+		domain = data.Domain
+	} else if info, err := api.Info(context.Background()); err == nil {
+		domain = info.Domain
+	}
+	duration := fmt.Sprintf("%d Hari", req.Days)
+	if data.Plan != "" {
+		duration = "Plan " + data.Plan
 	}
+	msg := fmt.Sprintf("✅ *BERHASIL DIPERPANJANG* (%s)\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━\n"+
+		"🔑 *Password*: `%s`\n"+
+		"🌐 *Domain*: `%s`\n"+
+		"🗓️ *Expired Baru*: `%s`\n"+
+		"🔢 *Limit IP*: `%d` Device\n"+
+		"💾 *Limit Kuota*: `%d GB`\n"+
+		"📍 *Lokasi Server*: `%s`\n"+
+		"📡 *ISP Server*: `%s`\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━",
+		duration, data.Password, domain, data.Expired, data.LimitIP, data.LimitQuota, ipInfo.City, ipInfo.Isp)
+	msg += statusLine(data.StatusURL)
+	reply := tgbotapi.NewMessage(chatID, msg)
+	reply.ParseMode = "Markdown"
+	deleteLastMessage(bot, chatID)
+	bot.Send(reply)
+	showHome(bot, chatID)
+	return nil
 }
 
-func renewUser(bot *tgbotapi.BotAPI, chatID int64, username string, days int, limitIP int, limitQuota int) {
-	res, err := apiCall("POST", "/user/renew", map[string]interface{}{
-		"password":     username,
-		"days":         days,
-		"limit_ip":     limitIP,
-		"limit_quota":  limitQuota,
-	})
+func listUsers(bot *tgbotapi.BotAPI, c *client.Client, chatID int64) {
+	users, err := c.ListUsers(context.Background())
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		sendMessage(bot, chatID, "❌ Gagal mengambil data daftar akun.")
+		return
+	}
 	if err != nil {
 		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
 		return
 	}
-	if res["success"] == true {
-		data, ok := res["data"].(map[string]interface{})
-		if !ok {
-			sendMessage(bot, chatID, "❌ Gagal: Format data respons dari API tidak valid.")
-			return
-		}
-		ipInfo, _ := getIpInfo()
-		domain := "Unknown"
-		if d, ok := data["domain"].(string); ok && d != "" {
-			domain = d
-		} else {
-			if infoRes, err := apiCall("GET", "/info", nil); err == nil && infoRes["success"] == true {
-				if infoData, ok := infoRes["data"].(map[string]interface{}); ok {
-					if d, ok := infoData["domain"].(string); ok {
-						domain = d
-					}
-				}
-			}
+	if len(users) == 0 {
+		sendMessage(bot, chatID, "📂 Tidak ada user saat ini.")
+		showHome(bot, chatID)
+		return
+	}
+	msg := fmt.Sprintf("📋 *DAFTAR AKUN ZIVPN* (Total: %d)\n\n", len(users))
+	for i, user := range users {
+		statusIcon := "🟢"
+		switch user.Status {
+		case client.StatusExpired:
+			statusIcon = "🔴"
+		case client.StatusSuspended, client.StatusLocked:
+			statusIcon = "🔒"
 		}
-		msg := fmt.Sprintf("✅ *BERHASIL DIPERPANJANG* (%d Hari)\n"+
-			"━━━━━━━━━━━━━━━━━━━━━━━━━\n"+
-			"🔑 *Password*: `%s`\n"+
-			"🌐 *Domain*: `%s`\n"+
-			"🗓️ *Expired Baru*: `%s`\n"+
-			"🔢 *Limit IP*: `%d` Device\n"+
-			"💾 *Limit Kuota*: `%d GB`\n"+
-			"📍 *Lokasi Server*: `%s`\n"+
-			"📡 *ISP Server*: `%s`\n"+
-			"━━━━━━━━━━━━━━━━━━━━━━━━━",
-			days, data["password"], domain, data["expired"], limitIP, limitQuota, ipInfo.City, ipInfo.Isp)
-		reply := tgbotapi.NewMessage(chatID, msg)
-		reply.ParseMode = "Markdown"
-		deleteLastMessage(bot, chatID)
-		bot.Send(reply)
-		showMainMenu(bot, chatID, true)
-	} else {
-		errMsg, ok := res["message"].(string)
-		if !ok {
-			errMsg = "Pesan error tidak diketahui dari API."
+		msg += fmt.Sprintf("%d. %s `%s`\n _Kadaluarsa: %s_\n", i+1, statusIcon, user.Password, user.Expired)
+		if user.LimitQuota > 0 {
+			msg += fmt.Sprintf(" _Kuota: %.2f / %d GB_\n", float64(user.UsedBytes)/(1<<30), user.LimitQuota)
 		}
-		sendMessage(bot, chatID, fmt.Sprintf("❌ Gagal memperpanjang: %s", errMsg))
-		showMainMenu(bot, chatID, true)
 	}
+	reply := tgbotapi.NewMessage(chatID, msg)
+	reply.ParseMode = "Markdown"
+	sendAndTrack(bot, reply)
 }
 
-func listUsers(bot *tgbotapi.BotAPI, chatID int64) {
-	res, err := apiCall("GET", "/users", nil)
+func unlockUser(bot *tgbotapi.BotAPI, c *client.Client, chatID int64, username string) error {
+	err := c.UnlockUser(context.Background(), username)
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		sendMessage(bot, chatID, fmt.Sprintf("❌ Gagal membuka user: %s", apiErr.Message))
+		return err
+	}
 	if err != nil {
 		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
-		return
+		return err
 	}
-	if res["success"] == true {
-		users, ok := res["data"].([]interface{})
-		if !ok {
-			sendMessage(bot, chatID, "❌ Format data user salah.")
-			return
-		}
-		if len(users) == 0 {
-			sendMessage(bot, chatID, "📂 Tidak ada user saat ini.")
-			showMainMenu(bot, chatID, true)
-			return
-		}
-		msg := fmt.Sprintf("📋 *DAFTAR AKUN ZIVPN* (Total: %d)\n\n", len(users))
-		for i, u := range users {
-			user, ok := u.(map[string]interface{})
-			if !ok {
-				continue
-			}
-			statusIcon := "🟢"
-			if user["status"] == "Expired" {
-				statusIcon = "🔴"
-			}
-			msg += fmt.Sprintf("%d. %s `%s`\n _Kadaluarsa: %s_\n", i+1, statusIcon, user["password"], user["expired"])
-		}
-		reply := tgbotapi.NewMessage(chatID, msg)
-		reply.ParseMode = "Markdown"
-		sendAndTrack(bot, reply)
-	} else {
-		sendMessage(bot, chatID, "❌ Gagal mengambil data daftar akun.")
+	sendMessage(bot, chatID, fmt.Sprintf("🔓 User `%s` berhasil *DIBUKA*.", username))
+	return nil
+}
+
+func resetQuota(bot *tgbotapi.BotAPI, c *client.Client, chatID int64, username string) error {
+	_, err := c.ResetQuota(context.Background(), username)
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		sendMessage(bot, chatID, fmt.Sprintf("❌ Gagal reset kuota: %s", apiErr.Message))
+		return err
+	}
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+		return err
 	}
+	sendMessage(bot, chatID, fmt.Sprintf("♻️ Kuota user `%s` berhasil *DIRESET*.", username))
+	return nil
 }
 
-func systemInfo(bot *tgbotapi.BotAPI, chatID int64) {
-	res, err := apiCall("GET", "/info", nil)
+func showUdpgwPanel(bot *tgbotapi.BotAPI, c *client.Client, chatID int64) {
+	status, err := c.Udpgw(context.Background())
 	if err != nil {
 		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
 		return
 	}
-	if res["success"] == true {
-		data, ok := res["data"].(map[string]interface{})
-		if !ok {
-			sendMessage(bot, chatID, "❌ Format data salah.")
-			return
+	if !status.Installed {
+		sendMessage(bot, chatID, "⚠️ UDPGW belum terpasang.\nJalankan `udpgw-only.sh` di VPS terlebih dahulu.")
+		return
+	}
+	icon := "🔴"
+	if status.Status == "active" {
+		icon = "🟢"
+	}
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("🛰️ *PANEL UDPGW*\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━\n"+
+		"%s *Status*: `%s`\n"+
+		"🔌 *Port*: `%d`\n"+
+		"🌐 *DNS*: `%s`\n"+
+		"📝 *Log Level*: `%s`\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━",
+		icon, status.Status, status.Port, status.DNSResolver, status.LogLevel))
+	msg.ParseMode = "Markdown"
+	var levels []tgbotapi.InlineKeyboardButton
+	for _, level := range []string{"debug", "info", "warn", "error"} {
+		label := level
+		if level == status.LogLevel {
+			label = "✅ " + level
 		}
-		ipInfo, _ := getIpInfo()
-		msg := fmt.Sprintf("⚙️ *INFORMASI DETAIL SERVER*\n"+
-			"━━━━━━━━━━━━━━━━━━━━━━━━━\n"+
-			"🌐 *Domain*: `%s`\n"+
-			"🖥️ *IP Public*: `%s`\n"+
-			"🔌 *Port*: `%s`\n"+
-			"🔧 *Layanan*: `%s`\n"+
-			"📍 *Lokasi Server*: `%s`\n"+
-			"📡 *ISP Server*: `%s`\n"+
-			"━━━━━━━━━━━━━━━━━━━━━━━━━",
-			data["domain"], data["public_ip"], data["port"], data["service"], ipInfo.City, ipInfo.Isp)
-		reply := tgbotapi.NewMessage(chatID, msg)
-		reply.ParseMode = "Markdown"
-		deleteLastMessage(bot, chatID)
-		bot.Send(reply)
-		showPublicMenu(bot, chatID)
-	} else {
+		levels = append(levels, tgbotapi.NewInlineKeyboardButtonData(label, "udpgw_log:"+level))
+	}
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔌 Ubah Port", "udpgw_port"),
+			tgbotapi.NewInlineKeyboardButtonData("🌐 Ubah DNS", "udpgw_dns"),
+		),
+		levels,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔁 Restart UDPGW", "udpgw_restart"),
+			tgbotapi.NewInlineKeyboardButtonData("⬅️ Kembali", "cancel"),
+		),
+	)
+	deleteLastMessage(bot, chatID)
+	sendAndTrack(bot, msg)
+}
+
+func updateUdpgw(bot *tgbotapi.BotAPI, c *client.Client, chatID int64, update client.UdpgwUpdate) error {
+	_, err := c.UpdateUdpgw(context.Background(), update)
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		sendMessage(bot, chatID, fmt.Sprintf("❌ Gagal mengubah UDPGW: %s", apiErr.Message))
+		return err
+	}
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+		return err
+	}
+	sendMessage(bot, chatID, "✅ Config UDPGW diperbarui dan service direstart.")
+	showUdpgwPanel(bot, c, chatID)
+	return nil
+}
+
+func restartUdpgw(bot *tgbotapi.BotAPI, c *client.Client, chatID int64) error {
+	_, err := c.RestartUdpgw(context.Background())
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		sendMessage(bot, chatID, fmt.Sprintf("❌ Gagal restart UDPGW: %s", apiErr.Message))
+		return err
+	}
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+		return err
+	}
+	sendMessage(bot, chatID, "🔁 UDPGW berhasil direstart.")
+	showUdpgwPanel(bot, c, chatID)
+	return nil
+}
+
+func systemInfo(bot *tgbotapi.BotAPI, c *client.Client, chatID int64) {
+	data, err := c.Info(context.Background())
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
 		sendMessage(bot, chatID, "❌ Gagal mengambil info sistem.")
+		return
+	}
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+		return
+	}
+	obfs := "Unknown"
+	if settings, err := c.Settings(context.Background()); err == nil {
+		obfs = settings.Obfs
 	}
+	udpgw := "Tidak terpasang"
+	if data.UdpgwStatus != "not_installed" {
+		udpgw = fmt.Sprintf("%s (port %s)", data.UdpgwStatus, data.UdpgwPort)
+	}
+	ipInfo, _ := getIpInfo()
+	msg := fmt.Sprintf("⚙️ *INFORMASI DETAIL SERVER*\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━\n"+
+		"🌐 *Domain*: `%s`\n"+
+		"🖥️ *IP Public*: `%s`\n"+
+		"🔌 *Port*: `%s`\n"+
+		"🔐 *Obfs*: `%s`\n"+
+		"🔧 *Layanan*: `%s`\n"+
+		"🛰️ *UDPGW*: `%s`\n"+
+		"📍 *Lokasi Server*: `%s`\n"+
+		"📡 *ISP Server*: `%s`\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━",
+		data.Domain, data.PublicIP, data.Port, obfs, data.Service, udpgw, ipInfo.City, ipInfo.Isp)
+	reply := tgbotapi.NewMessage(chatID, msg)
+	reply.ParseMode = "Markdown"
+	deleteLastMessage(bot, chatID)
+	bot.Send(reply)
+	showPublicMenu(bot, chatID)
 }
 
 func loadConfig() (BotConfig, error) {
@@ -1432,3 +2310,2151 @@ func loadConfig() (BotConfig, error) {
 	err = json.Unmarshal(file, &config)
 	return config, err
 }
+
+// --- EVENT API ---
+
+// watchApiEvents berlangganan /api/events dan menyambung ulang dengan
+// Last-Event-ID jika koneksi putus (misal API direstart).
+func watchApiEvents(bot *tgbotapi.BotAPI) {
+	var lastID int64
+	for {
+		err := api.Events(context.Background(), lastID, func(ev client.Event) error {
+			// Event resync tidak punya id, pertahankan posisi terakhir
+			if ev.ID > 0 {
+				lastID = ev.ID
+			}
+			switch ev.Type {
+			case "iplimit.violation":
+				var v client.Violation
+				if err := json.Unmarshal(ev.Data, &v); err != nil {
+					log.Printf("Event %s tidak valid: %v", ev.Type, err)
+					return nil
+				}
+				notifyViolation(bot, v)
+			case "quota.exceeded":
+				var q struct {
+					Password   string `json:"password"`
+					LimitQuota int    `json:"limit_quota"`
+					UsedBytes  int64  `json:"used_bytes"`
+				}
+				if err := json.Unmarshal(ev.Data, &q); err != nil {
+					log.Printf("Event %s tidak valid: %v", ev.Type, err)
+					return nil
+				}
+				notifyQuotaExceeded(bot, q.Password, q.LimitQuota, q.UsedBytes)
+			case "reseller.topup":
+				var t struct {
+					TelegramID int64 `json:"telegram_id"`
+					Amount     int64 `json:"amount"`
+					Balance    int64 `json:"balance"`
+				}
+				if err := json.Unmarshal(ev.Data, &t); err != nil {
+					log.Printf("Event %s tidak valid: %v", ev.Type, err)
+					return nil
+				}
+				if t.TelegramID != 0 {
+					sendMessage(bot, t.TelegramID, fmt.Sprintf("💰 Saldo Anda bertambah `%d` kredit.\nSaldo sekarang: `%d`", t.Amount, t.Balance))
+				}
+			case "user.deleted":
+				var d struct {
+					Password string `json:"password"`
+				}
+				if err := json.Unmarshal(ev.Data, &d); err != nil {
+					log.Printf("Event %s tidak valid: %v", ev.Type, err)
+					return nil
+				}
+				removeOwner(d.Password)
+			case "user.rotated":
+				var d struct {
+					Password    string `json:"password"`
+					NewPassword string `json:"new_password"`
+				}
+				if err := json.Unmarshal(ev.Data, &d); err != nil {
+					log.Printf("Event %s tidak valid: %v", ev.Type, err)
+					return nil
+				}
+				moveOwner(d.Password, d.NewPassword)
+			case "order.created", "order.expired", "order.failed":
+				var o client.Order
+				if err := json.Unmarshal(ev.Data, &o); err != nil {
+					log.Printf("Event %s tidak valid: %v", ev.Type, err)
+					return nil
+				}
+				notifyOrder(bot, ev.Type, o)
+			case "order.paid":
+				var p struct {
+					ID         string `json:"id"`
+					Plan       string `json:"plan"`
+					Password   string `json:"password"`
+					Amount     int64  `json:"amount"`
+					Action     string `json:"action"`
+					Expired    string `json:"expired"`
+					LimitIP    int    `json:"limit_ip"`
+					LimitQuota int    `json:"limit_quota"`
+					Domain     string `json:"domain"`
+					TelegramID int64  `json:"telegram_id"`
+					PaidBy     string `json:"paid_by"`
+					StatusURL  string `json:"status_url"`
+				}
+				if err := json.Unmarshal(ev.Data, &p); err != nil {
+					log.Printf("Event %s tidak valid: %v", ev.Type, err)
+					return nil
+				}
+				notifyOrderPaid(bot, p.ID, p.Plan, p.Password, p.Amount, p.Action, p.Expired, p.LimitIP, p.LimitQuota, p.Domain, p.TelegramID, p.PaidBy, p.StatusURL)
+			case "voucher.redeemed":
+				var v struct {
+					Code       string `json:"code"`
+					Batch      string `json:"batch"`
+					Plan       string `json:"plan"`
+					Password   string `json:"password"`
+					Action     string `json:"action"`
+					TelegramID int64  `json:"telegram_id"`
+				}
+				if err := json.Unmarshal(ev.Data, &v); err != nil {
+					log.Printf("Event %s tidak valid: %v", ev.Type, err)
+					return nil
+				}
+				notifyVoucherRedeemed(bot, v.Code, v.Batch, v.Plan, v.Password, v.Action, v.TelegramID)
+			}
+			return nil
+		})
+		log.Printf("Stream event API terputus: %v", err)
+		time.Sleep(EventRetryInterval)
+	}
+}
+
+func notifyViolation(bot *tgbotapi.BotAPI, v client.Violation) {
+	config, err := loadConfig()
+	if err != nil {
+		log.Printf("Gagal memuat config untuk notif pelanggaran: %v", err)
+		return
+	}
+
+	action := "⚠️ Peringatan"
+	switch v.Action {
+	case client.IPLimitSuspend:
+		action = "⏸️ Disuspend"
+		if until, err := time.Parse(time.RFC3339, v.Until); err == nil {
+			action += " sampai " + until.Local().Format("02-01-2006 15:04")
+		}
+	case client.IPLimitLock:
+		action = "🔒 Dikunci"
+	}
+
+	msg := fmt.Sprintf("🚨 *PELANGGARAN LIMIT IP*\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━\n"+
+		"🔑 *Password*: `%s`\n"+
+		"🔢 *Limit IP*: `%d` Device\n"+
+		"📱 *Terdeteksi*: `%d` Device\n"+
+		"🌍 *IP*: `%s`\n"+
+		"🛡️ *Tindakan*: %s\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━",
+		v.Password, v.Limit, v.Devices, strings.Join(v.IPs, ", "), action)
+	adminMsg := tgbotapi.NewMessage(0, msg)
+	adminMsg.ParseMode = "Markdown"
+	if v.Action == client.IPLimitSuspend || v.Action == client.IPLimitLock {
+		adminMsg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("🔓 Buka User", "unlock:"+v.Password)),
+		)
+	}
+	notifyAdmins(bot, config, PermSupport, adminMsg)
+
+	// --- KIRIM KE GRUP NOTIFIKASI (DENGAN SENSOR) ---
+	if config.NotifGroupID != 0 {
+		maskedPass := strings.Repeat("*", len(v.Password))
+		groupMsg := fmt.Sprintf("🚨 *PELANGGARAN LIMIT IP*\n"+
+			"━━━━━━━━━━━━━━━━━━━━━━━━━\n"+
+			"🔑 *Password*: `%s`\n"+
+			"🔢 *Limit IP*: `%d` Device\n"+
+			"📱 *Terdeteksi*: `%d` Device\n"+
+			"🛡️ *Tindakan*: %s\n"+
+			"━━━━━━━━━━━━━━━━━━━━━━━━━",
+			maskedPass, v.Limit, v.Devices, action)
+		groupMsgObj := tgbotapi.NewMessage(config.NotifGroupID, groupMsg)
+		groupMsgObj.ParseMode = "Markdown"
+		if _, err := bot.Send(groupMsgObj); err != nil {
+			log.Printf("Gagal kirim notif pelanggaran ke grup %d: %v", config.NotifGroupID, err)
+		}
+	}
+}
+
+func notifyQuotaExceeded(bot *tgbotapi.BotAPI, password string, limitQuota int, usedBytes int64) {
+	config, err := loadConfig()
+	if err != nil {
+		log.Printf("Gagal memuat config untuk notif kuota: %v", err)
+		return
+	}
+	msg := tgbotapi.NewMessage(0, fmt.Sprintf("📵 *KUOTA HABIS*\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━\n"+
+		"🔑 *Password*: `%s`\n"+
+		"💾 *Limit Kuota*: `%d GB`\n"+
+		"📊 *Terpakai*: `%.2f GB`\n"+
+		"🛡️ *Tindakan*: 🔒 Dikunci\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━",
+		password, limitQuota, float64(usedBytes)/(1<<30)))
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("♻️ Reset Kuota", "quota_reset:"+password)),
+	)
+	notifyAdmins(bot, config, PermSupport, msg)
+}
+
+// --- RESELLER ---
+
+// resellerFor mengembalikan data reseller dan client API yang dibatasi ke
+// akun miliknya. Jika user bukan reseller, hasilnya (nil, api).
+func resellerFor(userID int64) (*client.Reseller, *client.Client) {
+	c := api.AsReseller(userID)
+	profile, err := c.ResellerMe(context.Background())
+	if err != nil {
+		return nil, api
+	}
+	return &profile.Reseller, c
+}
+
+// showHome menampilkan menu sesuai peran: admin, reseller, atau publik.
+// Chat bot selalu private, jadi chatID sama dengan user ID.
+func showHome(bot *tgbotapi.BotAPI, chatID int64) {
+	if findAdmin(chatID) != nil {
+		showMainMenu(bot, chatID, true)
+		return
+	}
+	if reseller, _ := resellerFor(chatID); reseller != nil {
+		showResellerMenu(bot, chatID, reseller)
+		return
+	}
+	showPublicMenu(bot, chatID)
+}
+
+func showResellerMenu(bot *tgbotapi.BotAPI, chatID int64, reseller *client.Reseller) {
+	domain := "Unknown"
+	if info, err := api.Info(context.Background()); err == nil {
+		domain = info.Domain
+	}
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("🤝 *PANEL RESELLER*\n\n"+
+		"• 👤 *Nama*: `%s`\n"+
+		"• 💰 *Saldo*: `%d` kredit\n"+
+		"• 🏷️ *Harga*: `%d` kredit / hari\n"+
+		"• 📋 *Akun Anda*: `%d`\n"+
+		"• 🌐 *Domain*: `%s`\n\n"+
+		"• 🧑‍💻 *Hubungi @Ramadhann121 untuk top up saldo*",
+		reseller.Name, reseller.Credit, reseller.PricePerDay, reseller.Users, domain))
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("➕ Create Akun", "menu_create"),
+			tgbotapi.NewInlineKeyboardButtonData("🔄 Renew Akun", "menu_renew"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📋 List Akun", "menu_list"),
+			tgbotapi.NewInlineKeyboardButtonData("📒 Riwayat Saldo", "reseller_ledger"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📊 Info Server", "menu_info"),
+		),
+	)
+	deleteLastMessage(bot, chatID)
+	sendAndTrack(bot, msg)
+}
+
+func showResellers(bot *tgbotapi.BotAPI, c *client.Client, chatID int64) {
+	resellers, err := c.Resellers(context.Background())
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+		return
+	}
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, r := range resellers {
+		icon := "🟢"
+		if r.Disabled {
+			icon = "⛔"
+		}
+		label := fmt.Sprintf("%s %s — %d kredit (%d akun)", icon, r.Name, r.Credit, r.Users)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, "reseller_view:"+r.ID),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("➕ Tambah Reseller", "reseller_add"),
+		tgbotapi.NewInlineKeyboardButtonData("⬅️ Menu", "cancel"),
+	))
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("🤝 *DAFTAR RESELLER* (Total: %d)", len(resellers)))
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	deleteLastMessage(bot, chatID)
+	sendAndTrack(bot, msg)
+}
+
+func findReseller(c *client.Client, id string) (*client.Reseller, error) {
+	resellers, err := c.Resellers(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range resellers {
+		if r.ID == id {
+			return &r, nil
+		}
+	}
+	return nil, client.ErrNotFound
+}
+
+func showResellerDetail(bot *tgbotapi.BotAPI, c *client.Client, chatID int64, id string) {
+	r, err := findReseller(c, id)
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Reseller tidak ditemukan.")
+		return
+	}
+	status := "🟢 Aktif"
+	toggle := "⛔ Nonaktifkan"
+	if r.Disabled {
+		status = "⛔ Nonaktif"
+		toggle = "✅ Aktifkan"
+	}
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("🤝 *RESELLER*\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━\n"+
+		"👤 *Nama*: `%s`\n"+
+		"🆔 *ID*: `%s`\n"+
+		"💬 *Telegram*: `%d`\n"+
+		"💰 *Saldo*: `%d` kredit\n"+
+		"🏷️ *Harga*: `%d` kredit / hari\n"+
+		"📋 *Akun*: `%d`\n"+
+		"📶 *Status*: %s\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━",
+		r.Name, r.ID, r.TelegramID, r.Credit, r.PricePerDay, r.Users, status))
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("💰 Top Up", "reseller_topup:"+r.ID),
+			tgbotapi.NewInlineKeyboardButtonData("📒 Ledger", "reseller_ledger:"+r.ID),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔑 Reset API Key", "reseller_key:"+r.ID),
+			tgbotapi.NewInlineKeyboardButtonData(toggle, "reseller_toggle:"+r.ID),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⬅️ Kembali", "menu_resellers"),
+		),
+	)
+	deleteLastMessage(bot, chatID)
+	sendAndTrack(bot, msg)
+}
+
+// showResellerLedger menampilkan 15 transaksi terakhir. Untuk reseller, c
+// sudah dibatasi ke ledger miliknya sehingga id boleh kosong.
+func showResellerLedger(bot *tgbotapi.BotAPI, c *client.Client, chatID int64, id string) {
+	ledger, err := c.Ledger(context.Background(), id, 15)
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+		return
+	}
+	if len(ledger) == 0 {
+		sendMessage(bot, chatID, "📒 Belum ada transaksi.")
+		return
+	}
+	labels := map[string]string{"topup": "💰 Top up", "create": "➕ Create", "renew": "🔄 Renew", "refund": "↩️ Refund"}
+	text := "📒 *RIWAYAT SALDO*\n\n"
+	for _, e := range ledger {
+		t, _ := time.Parse(time.RFC3339, e.Time)
+		label := labels[e.Type]
+		if label == "" {
+			label = e.Type
+		}
+		text += fmt.Sprintf("%s `%+d` → `%d`\n _%s", label, e.Amount, e.Balance, t.Format("02/01 15:04"))
+		if e.Password != "" {
+			text += fmt.Sprintf(" • %s (%d hari)", e.Password, e.Days)
+		}
+		text += "_\n"
+	}
+	sendMessage(bot, chatID, text)
+}
+
+func addReseller(bot *tgbotapi.BotAPI, c *client.Client, chatID int64, name string, telegramID, price int64) error {
+	res, err := c.CreateReseller(context.Background(), client.NewReseller{
+		Name:        name,
+		TelegramID:  telegramID,
+		PricePerDay: price,
+	})
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		sendMessage(bot, chatID, fmt.Sprintf("❌ Gagal menambah reseller: %s", apiErr.Message))
+		return err
+	}
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+		return err
+	}
+	sendMessage(bot, chatID, fmt.Sprintf("✅ Reseller `%s` ditambahkan.\n\n🔑 *API Key*: `%s`\n_Simpan key ini, hanya ditampilkan sekali._", res.Reseller.Name, res.APIKey))
+	showResellerDetail(bot, c, chatID, res.Reseller.ID)
+	return nil
+}
+
+func topUpReseller(bot *tgbotapi.BotAPI, c *client.Client, chatID int64, id string, amount int64) error {
+	res, err := c.TopUpReseller(context.Background(), id, amount, "top up via bot")
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		sendMessage(bot, chatID, fmt.Sprintf("❌ Gagal top up: %s", apiErr.Message))
+		return err
+	}
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+		return err
+	}
+	sendMessage(bot, chatID, fmt.Sprintf("✅ Saldo `%s` sekarang `%d` kredit.", res.Name, res.Credit))
+	showResellerDetail(bot, c, chatID, id)
+	return nil
+}
+
+func toggleReseller(bot *tgbotapi.BotAPI, c *client.Client, chatID int64, id string) error {
+	r, err := findReseller(c, id)
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Reseller tidak ditemukan.")
+		return err
+	}
+	disabled := !r.Disabled
+	if _, err := c.UpdateReseller(context.Background(), id, client.ResellerUpdate{Disabled: &disabled}); err != nil {
+		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+		return err
+	}
+	showResellerDetail(bot, c, chatID, id)
+	return nil
+}
+
+func rotateResellerKey(bot *tgbotapi.BotAPI, c *client.Client, chatID int64, id string) error {
+	res, err := c.RotateResellerKey(context.Background(), id)
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+		return err
+	}
+	sendMessage(bot, chatID, fmt.Sprintf("🔑 API Key baru untuk `%s`:\n`%s`\n_Key lama sudah tidak berlaku._", res.Reseller.Name, res.APIKey))
+	return nil
+}
+
+// --- PLAN ---
+
+// showPlanPicker menampilkan tombol plan untuk create/renew. Mengembalikan
+// false jika tidak ada plan sehingga pemanggil kembali ke input manual.
+// Tombol manual hanya muncul untuk admin/reseller (visibility kosong).
+func showPlanPicker(bot *tgbotapi.BotAPI, c *client.Client, chatID int64, action, visibility string) bool {
+	plans, err := c.Plans(context.Background(), visibility)
+	if err != nil || len(plans) == 0 {
+		return false
+	}
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, p := range plans {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(planLabel(p), "plan_"+action+":"+p.ID),
+		))
+	}
+	if visibility == "" {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✏️ Manual", "plan_manual:"+action),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("❌ Batal", "cancel"),
+	))
+	title := "🔑 *CREATE USER*"
+	if action == "renew" {
+		title = "🔄 *MENU RENEW*"
+	}
+	msg := tgbotapi.NewMessage(chatID, title+"\n\nPilih **Plan**:")
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	deleteLastMessage(bot, chatID)
+	sendAndTrack(bot, msg)
+	return true
+}
+
+func planLabel(p client.Plan) string {
+	label := fmt.Sprintf("%s • %d hari", p.Name, p.Days)
+	if p.Price > 0 {
+		label += " • " + formatRupiah(p.Price)
+	}
+	return label
+}
+
+// formatRupiah memformat angka dengan pemisah ribuan, contoh Rp15.000
+func formatRupiah(amount int64) string {
+	digits := strconv.FormatInt(amount, 10)
+	var out []byte
+	for i := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			out = append(out, '.')
+		}
+		out = append(out, digits[i])
+	}
+	return "Rp" + string(out)
+}
+
+// findPlan mencari plan yang terlihat dengan visibility tersebut; nil jika
+// tidak ada.
+func findPlan(c *client.Client, id, visibility string) *client.Plan {
+	plans, err := c.Plans(context.Background(), visibility)
+	if err != nil {
+		return nil
+	}
+	for i := range plans {
+		if plans[i].ID == id {
+			return &plans[i]
+		}
+	}
+	return nil
+}
+
+// --- VOUCHER ---
+
+func redeemVoucher(bot *tgbotapi.BotAPI, chatID, userID int64, code, password string) {
+	data, err := api.RedeemVoucher(context.Background(), client.RedeemVoucherRequest{
+		Code:       code,
+		Password:   password,
+		TelegramID: userID,
+		Renew:      accountOwner(password) == userID,
+	})
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		sendMessage(bot, chatID, fmt.Sprintf("❌ Gagal redeem: %s", apiErr.Message))
+		showHome(bot, chatID)
+		return
+	}
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+		return
+	}
+	title := "🎉 *AKUN BERHASIL DIBUAT*"
+	if data.Action == "renew" {
+		title = "✅ *BERHASIL DIPERPANJANG*"
+	} else {
+		setOwner(data.Password, userID)
+	}
+	text := fmt.Sprintf("%s\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━\n"+
+		"🎟️ *Voucher*: `%s`\n"+
+		"🔑 *Password*: `%s`\n"+
+		"🌐 *Domain*: `%s`\n"+
+		"🗓️ *Expired*: `%s`\n"+
+		"🔢 *Limit IP*: `%d` Device\n"+
+		"💾 *Limit Kuota*: `%d GB`\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━",
+		title, data.Code, data.Password, data.Domain, data.Expired, data.LimitIP, data.LimitQuota)
+	// Link status tidak ada di response redeem; pemanggil di sini sudah
+	// pembuat atau pemilik akun
+	if link, err := api.StatusLink(context.Background(), data.Password); err == nil {
+		text += statusLine(link.URL)
+	}
+	reply := tgbotapi.NewMessage(chatID, text)
+	reply.ParseMode = "Markdown"
+	deleteLastMessage(bot, chatID)
+	bot.Send(reply)
+	showHome(bot, chatID)
+}
+
+func showVoucherBatches(bot *tgbotapi.BotAPI, c *client.Client, chatID int64) {
+	batches, err := c.VoucherBatches(context.Background())
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+		return
+	}
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i, b := range batches {
+		// Batch terbaru di depan; batch lama tetap bisa diakses lewat API
+		if i == 10 {
+			break
+		}
+		label := fmt.Sprintf("📦 %s • %s • %d/%d terpakai", b.ID, b.Plan, b.Used, b.Count)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, "voucher_batch:"+b.ID),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("➕ Generate Batch", "voucher_new"),
+		tgbotapi.NewInlineKeyboardButtonData("⬅️ Menu", "cancel"),
+	))
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("🎟️ *VOUCHER* (Total batch: %d)", len(batches)))
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	deleteLastMessage(bot, chatID)
+	sendAndTrack(bot, msg)
+}
+
+func showVoucherPlans(bot *tgbotapi.BotAPI, c *client.Client, chatID int64) {
+	plans, err := c.Plans(context.Background(), "")
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+		return
+	}
+	if len(plans) == 0 {
+		sendMessage(bot, chatID, "⚠️ Belum ada plan. Buat plan dulu lewat `POST /api/plan/create`.")
+		return
+	}
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, p := range plans {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(planLabel(p), "voucher_plan:"+p.ID),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("⬅️ Kembali", "menu_vouchers"),
+	))
+	msg := tgbotapi.NewMessage(chatID, "🎟️ *GENERATE VOUCHER*\n\nPilih **Plan** untuk voucher:")
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	deleteLastMessage(bot, chatID)
+	sendAndTrack(bot, msg)
+}
+
+func generateVouchers(bot *tgbotapi.BotAPI, c *client.Client, chatID int64, planID string, count, validDays int) error {
+	req := client.GenerateVouchers{PlanID: planID, Count: count, Note: "via bot"}
+	if validDays > 0 {
+		req.ExpiresAt = time.Now().AddDate(0, 0, validDays).Format("2006-01-02")
+	}
+	res, err := c.GenerateVouchers(context.Background(), req)
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		sendMessage(bot, chatID, fmt.Sprintf("❌ Gagal membuat voucher: %s", apiErr.Message))
+		return err
+	}
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+		return err
+	}
+	expires := "Tanpa batas"
+	if res.Batch.ExpiresAt != "" {
+		expires = res.Batch.ExpiresAt
+	}
+	sendMessage(bot, chatID, fmt.Sprintf("✅ *%d voucher dibuat*\n📦 Batch: `%s`\n🏷️ Plan: `%s`\n🗓️ Berlaku sampai: `%s`",
+		len(res.Codes), res.Batch.ID, res.Batch.Plan, expires))
+	exportVouchers(bot, c, chatID, res.Batch.ID)
+	showVoucherBatch(bot, c, chatID, res.Batch.ID)
+	return nil
+}
+
+func showVoucherBatch(bot *tgbotapi.BotAPI, c *client.Client, chatID int64, id string) {
+	batches, err := c.VoucherBatches(context.Background())
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+		return
+	}
+	for _, b := range batches {
+		if b.ID != id {
+			continue
+		}
+		expires := "Tanpa batas"
+		if b.ExpiresAt != "" {
+			expires = b.ExpiresAt
+		}
+		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("📦 *BATCH VOUCHER*\n"+
+			"━━━━━━━━━━━━━━━━━━━━━━━━━\n"+
+			"🆔 *Batch*: `%s`\n"+
+			"🏷️ *Plan*: `%s`\n"+
+			"🎟️ *Jumlah*: `%d` (maks `%d`x pakai)\n"+
+			"✅ *Terpakai*: `%d`\n"+
+			"⛔ *Habis/Dicabut*: `%d`\n"+
+			"🗓️ *Berlaku sampai*: `%s`\n"+
+			"━━━━━━━━━━━━━━━━━━━━━━━━━",
+			b.ID, b.Plan, b.Count, b.MaxUses, b.Used, b.Exhausted, expires))
+		msg.ParseMode = "Markdown"
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("📤 Export CSV", "voucher_export:"+b.ID),
+				tgbotapi.NewInlineKeyboardButtonData("⛔ Cabut Batch", "voucher_revoke:"+b.ID),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("⬅️ Kembali", "menu_vouchers"),
+			),
+		)
+		deleteLastMessage(bot, chatID)
+		sendAndTrack(bot, msg)
+		return
+	}
+	sendMessage(bot, chatID, "❌ Batch tidak ditemukan.")
+}
+
+func exportVouchers(bot *tgbotapi.BotAPI, c *client.Client, chatID int64, batch string) error {
+	data, err := c.ExportVouchers(context.Background(), batch)
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Gagal export voucher: "+err.Error())
+		return err
+	}
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: "vouchers-" + batch + ".csv", Bytes: data})
+	doc.Caption = fmt.Sprintf("🎟️ Voucher batch `%s`", batch)
+	doc.ParseMode = "Markdown"
+	if _, err := bot.Send(doc); err != nil {
+		log.Printf("Gagal mengirim export voucher %s: %v", batch, err)
+		sendMessage(bot, chatID, "❌ Gagal mengirim file voucher.")
+		return err
+	}
+	return nil
+}
+
+func revokeVoucherBatch(bot *tgbotapi.BotAPI, c *client.Client, chatID int64, batch string) error {
+	revoked, err := c.RevokeVoucherBatch(context.Background(), batch)
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+		return err
+	}
+	sendMessage(bot, chatID, fmt.Sprintf("⛔ `%d` voucher di batch `%s` dicabut.", revoked, batch))
+	showVoucherBatch(bot, c, chatID, batch)
+	return nil
+}
+
+func notifyVoucherRedeemed(bot *tgbotapi.BotAPI, code, batch, plan, password, action string, telegramID int64) {
+	config, err := loadConfig()
+	if err != nil {
+		log.Printf("Gagal memuat config untuk notif voucher: %v", err)
+		return
+	}
+	label := "akun dibuat"
+	if action == "renew" {
+		label = "akun diperpanjang"
+	}
+	msg := tgbotapi.NewMessage(0, fmt.Sprintf("🎟️ Voucher `%s` (batch `%s`) dipakai oleh `%d`: `%s` • plan `%s` • %s",
+		code, batch, telegramID, password, plan, label))
+	msg.ParseMode = "Markdown"
+	notifyAdmins(bot, config, PermCreate, msg)
+}
+
+// --- ORDER ---
+
+// orderTime memformat waktu RFC3339 dari API ke zona waktu lokal.
+func orderTime(value string) string {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return value
+	}
+	return t.Local().Format("02-01-2006 15:04")
+}
+
+// createOrder membuat order create, atau order renew untuk akun milik userID.
+func createOrder(bot *tgbotapi.BotAPI, chatID, userID int64, plan *client.Plan, password string, renew bool) {
+	order, err := api.CreateOrder(context.Background(), client.NewOrder{
+		PlanID:     plan.ID,
+		Password:   password,
+		TelegramID: userID,
+		Renew:      renew,
+	})
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		sendMessage(bot, chatID, fmt.Sprintf("❌ Gagal membuat order: %s", apiErr.Message))
+		showHome(bot, chatID)
+		return
+	}
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+		return
+	}
+	result := "Akun dibuat otomatis setelah pembayaran diterima."
+	if renew {
+		result = "Akun diperpanjang otomatis setelah pembayaran diterima."
+	}
+	text := fmt.Sprintf("🧾 *ORDER DIBUAT*\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━\n"+
+		"🆔 *Order*: `%s`\n"+
+		"🏷️ *Plan*: `%s` (%d hari)\n"+
+		"🔑 *Password*: `%s`\n"+
+		"💵 *Total*: `%s`\n"+
+		"🔖 *Referensi*: `%s`\n"+
+		"⏳ *Bayar sebelum*: `%s`\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━\n"+
+		"%s",
+		order.ID, plan.Name, order.Days, order.Password, formatRupiah(order.Amount), order.Reference, orderTime(order.ExpiresAt), result)
+	if order.Instructions != "" {
+		text += "\n\n" + order.Instructions
+	}
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if order.PayURL != "" {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonURL("💳 Bayar", order.PayURL)))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("❌ Batalkan Order", "order_cancel:"+order.ID),
+	))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	deleteLastMessage(bot, chatID)
+	bot.Send(msg)
+}
+
+func findOrder(c *client.Client, id string) (*client.Order, error) {
+	orders, err := c.Orders(context.Background(), client.OrderFilter{ID: id})
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, nil
+	}
+	return &orders[0], nil
+}
+
+func showOrders(bot *tgbotapi.BotAPI, c *client.Client, chatID int64) {
+	orders, err := c.Orders(context.Background(), client.OrderFilter{Status: client.OrderPending})
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+		return
+	}
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i, o := range orders {
+		if i == 10 {
+			break
+		}
+		label := fmt.Sprintf("🧾 %s • %s • %s", o.ID, o.Password, formatRupiah(o.Amount))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, "order_view:"+o.ID),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("⬅️ Menu", "cancel"),
+	))
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("🧾 *ORDER PENDING* (Total: %d)", len(orders)))
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	deleteLastMessage(bot, chatID)
+	sendAndTrack(bot, msg)
+}
+
+func orderSummary(title string, o client.Order) string {
+	buyer := "-"
+	if o.TelegramID != 0 {
+		buyer = strconv.FormatInt(o.TelegramID, 10)
+	}
+	text := fmt.Sprintf("%s\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━\n"+
+		"🆔 *Order*: `%s`\n"+
+		"🏷️ *Plan*: `%s` (%d hari)\n"+
+		"🔑 *Password*: `%s`\n"+
+		"💵 *Total*: `%s`\n"+
+		"💳 *Gateway*: `%s` (`%s`)\n"+
+		"👤 *Pembeli*: `%s`\n"+
+		"📌 *Status*: `%s`\n"+
+		"⏳ *Kedaluwarsa*: `%s`\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━",
+		title, o.ID, o.Plan, o.Days, o.Password, formatRupiah(o.Amount), o.Gateway, o.Reference, buyer, o.Status, orderTime(o.ExpiresAt))
+	if o.Error != "" {
+		text += fmt.Sprintf("\n⚠️ *Error*: %s", o.Error)
+	}
+	return text
+}
+
+func showOrderDetail(bot *tgbotapi.BotAPI, c *client.Client, chatID int64, id string) {
+	order, err := findOrder(c, id)
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+		return
+	}
+	if order == nil {
+		sendMessage(bot, chatID, "❌ Order tidak ditemukan.")
+		return
+	}
+	msg := tgbotapi.NewMessage(chatID, orderSummary("🧾 *DETAIL ORDER*", *order))
+	msg.ParseMode = "Markdown"
+	var rows [][]tgbotapi.InlineKeyboardButton
+	switch order.Status {
+	case client.OrderPending:
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ Tandai Lunas", "order_paid:"+order.ID),
+			tgbotapi.NewInlineKeyboardButtonData("❌ Batalkan", "order_cancel:"+order.ID),
+		))
+	case client.OrderExpired, client.OrderFailed:
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ Tandai Lunas", "order_paid:"+order.ID),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("⬅️ Kembali", "menu_orders"),
+	))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	deleteLastMessage(bot, chatID)
+	sendAndTrack(bot, msg)
+}
+
+// markOrderPaid menandai order lunas; detail akun dikirim ke pembeli lewat
+// event order.paid.
+func markOrderPaid(bot *tgbotapi.BotAPI, c *client.Client, chatID int64, id string) error {
+	order, err := c.MarkOrderPaid(context.Background(), id)
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		sendMessage(bot, chatID, fmt.Sprintf("❌ Gagal menandai lunas: %s", apiErr.Message))
+		return err
+	}
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+		return err
+	}
+	if order.Status == client.OrderFailed {
+		sendMessage(bot, chatID, fmt.Sprintf("⚠️ Order `%s` lunas tetapi akun gagal dibuat: %s", order.ID, order.Error))
+		return errors.New(order.Error)
+	}
+	sendMessage(bot, chatID, fmt.Sprintf("✅ Order `%s` lunas. Akun `%s` aktif sampai `%s`.", order.ID, order.Password, order.AccountExpired))
+	showOrders(bot, c, chatID)
+	return nil
+}
+
+func cancelOrder(bot *tgbotapi.BotAPI, c *client.Client, chatID, userID int64, isAdmin bool, id string) error {
+	if !isAdmin {
+		order, err := findOrder(c, id)
+		if err != nil {
+			sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+			return err
+		}
+		if order == nil || order.TelegramID != userID {
+			sendMessage(bot, chatID, "❌ Order tidak ditemukan.")
+			return client.ErrNotFound
+		}
+	}
+	order, err := c.CancelOrder(context.Background(), id)
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		sendMessage(bot, chatID, fmt.Sprintf("❌ Gagal membatalkan order: %s", apiErr.Message))
+		return err
+	}
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+		return err
+	}
+	sendMessage(bot, chatID, fmt.Sprintf("🚫 Order `%s` dibatalkan.", order.ID))
+	if isAdmin {
+		showOrders(bot, c, chatID)
+		return nil
+	}
+	showHome(bot, chatID)
+	return nil
+}
+
+func notifyOrder(bot *tgbotapi.BotAPI, eventType string, o client.Order) {
+	config, err := loadConfig()
+	if err != nil {
+		log.Printf("Gagal memuat config untuk notif order: %v", err)
+		return
+	}
+	switch eventType {
+	case "order.created":
+		msg := tgbotapi.NewMessage(0, orderSummary("🧾 *ORDER BARU*", o))
+		msg.ParseMode = "Markdown"
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("✅ Tandai Lunas", "order_paid:"+o.ID),
+				tgbotapi.NewInlineKeyboardButtonData("❌ Batalkan", "order_cancel:"+o.ID),
+			),
+		)
+		notifyAdmins(bot, config, PermCreate, msg)
+	case "order.expired":
+		if o.TelegramID != 0 {
+			sendMessage(bot, o.TelegramID, fmt.Sprintf("⌛ Order `%s` kedaluwarsa karena belum dibayar. Silakan buat order baru.", o.ID))
+		}
+	case "order.failed":
+		msg := tgbotapi.NewMessage(0, orderSummary("🚨 *ORDER GAGAL DIPROSES*", o))
+		msg.ParseMode = "Markdown"
+		notifyAdmins(bot, config, PermCreate, msg)
+		if o.TelegramID != 0 {
+			sendMessage(bot, o.TelegramID, fmt.Sprintf("⚠️ Order `%s` tidak dapat diproses. Admin sudah diberi tahu.", o.ID))
+		}
+	}
+}
+
+func notifyOrderPaid(bot *tgbotapi.BotAPI, id, plan, password string, amount int64, action, expired string, limitIP, limitQuota int, domain string, telegramID int64, paidBy, statusURL string) {
+	if telegramID != 0 {
+		if action != "renew" {
+			setOwner(password, telegramID)
+		}
+		title := "🎉 *PEMBAYARAN DITERIMA*"
+		if action == "renew" {
+			title = "✅ *PEMBAYARAN DITERIMA • DIPERPANJANG*"
+		}
+		text := fmt.Sprintf("%s\n"+
+			"━━━━━━━━━━━━━━━━━━━━━━━━━\n"+
+			"🆔 *Order*: `%s`\n"+
+			"🔑 *Password*: `%s`\n"+
+			"🌐 *Domain*: `%s`\n"+
+			"🗓️ *Expired*: `%s`\n"+
+			"🔢 *Limit IP*: `%d` Device\n"+
+			"💾 *Limit Kuota*: `%d GB`\n"+
+			"━━━━━━━━━━━━━━━━━━━━━━━━━",
+			title, id, password, domain, expired, limitIP, limitQuota)
+		text += statusLine(statusURL)
+		sendMessage(bot, telegramID, text)
+	}
+	if config, err := loadConfig(); err == nil {
+		msg := tgbotapi.NewMessage(0, fmt.Sprintf("💵 Order `%s` lunas (%s, oleh `%s`): `%s` • plan `%s` • expired `%s`",
+			id, formatRupiah(amount), paidBy, password, plan, expired))
+		msg.ParseMode = "Markdown"
+		notifyAdmins(bot, config, PermCreate, msg)
+	}
+}
+
+// --- PERSETUJUAN ---
+
+// Approval adalah permintaan create akun dari user publik yang menunggu
+// keputusan admin. Disimpan di ApprovalFile agar tetap ada setelah restart.
+type Approval struct {
+	ID         string `json:"id"`
+	UserID     int64  `json:"user_id"`
+	Username   string `json:"username,omitempty"`
+	Name       string `json:"name"`
+	Password   string `json:"password"`
+	PlanID     string `json:"plan_id,omitempty"`
+	Days       int    `json:"days"`
+	LimitIP    int    `json:"limit_ip"`
+	LimitQuota int    `json:"limit_quota"`
+	CreatedAt  string `json:"created_at"`
+	// Sedang diproses admin; tidak disimpan agar klaim hilang saat restart
+	claimed bool
+}
+
+// request menyusun create akun. Jika ada PlanID, API memakai durasi dan
+// limit plan saat ini.
+func (a *Approval) request() client.CreateUserRequest {
+	return client.CreateUserRequest{Password: a.Password, PlanID: a.PlanID, Days: a.Days, LimitIP: a.LimitIP, LimitQuota: a.LimitQuota}
+}
+
+func (a *Approval) summary(title string) string {
+	requester := a.Name
+	if a.Username != "" {
+		requester += " (@" + a.Username + ")"
+	}
+	plan := "Manual"
+	if a.PlanID != "" {
+		plan = a.PlanID
+	}
+	return fmt.Sprintf("%s\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━\n"+
+		"🆔 *Permintaan*: `%s`\n"+
+		"👤 *Pemohon*: %s `%d`\n"+
+		"🔑 *Password*: `%s`\n"+
+		"🏷️ *Plan*: `%s`\n"+
+		"📅 *Durasi*: `%d` Hari\n"+
+		"🔢 *Limit IP*: `%d` Device\n"+
+		"💾 *Limit Kuota*: `%d GB`\n"+
+		"🕒 *Diajukan*: `%s`\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━",
+		title, a.ID, requester, a.UserID, a.Password, plan, a.Days, a.LimitIP, a.LimitQuota, a.CreatedAt)
+}
+
+func approvalKeyboard(id string) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ Setujui", "approve:"+id),
+			tgbotapi.NewInlineKeyboardButtonData("❌ Tolak", "reject:"+id),
+		),
+	)
+}
+
+// requestApproval memasukkan permintaan create ke antrian dan mengirimnya ke
+// semua admin yang boleh create. Setiap user hanya boleh punya satu permintaan yang menunggu.
+func requestApproval(bot *tgbotapi.BotAPI, from *tgbotapi.User, req client.CreateUserRequest) {
+	chatID := from.ID
+	approvalMutex.Lock()
+	for _, a := range approvals {
+		if a.UserID == from.ID {
+			approvalMutex.Unlock()
+			sendMessage(bot, chatID, fmt.Sprintf("⏳ Anda masih punya permintaan `%s` yang menunggu persetujuan admin.", a.ID))
+			showHome(bot, chatID)
+			return
+		}
+	}
+	a := &Approval{
+		ID:         fmt.Sprintf("a%s%06x", time.Now().Format("060102"), rand.Intn(1<<24)),
+		UserID:     from.ID,
+		Username:   from.UserName,
+		Name:       strings.TrimSpace(from.FirstName + " " + from.LastName),
+		Password:   req.Password,
+		PlanID:     req.PlanID,
+		Days:       req.Days,
+		LimitIP:    req.LimitIP,
+		LimitQuota: req.LimitQuota,
+		CreatedAt:  time.Now().Format("2006-01-02 15:04"),
+	}
+	approvals[a.ID] = a
+	err := saveApprovals()
+	if err != nil {
+		delete(approvals, a.ID)
+	}
+	approvalMutex.Unlock()
+	if err != nil {
+		log.Printf("Gagal menyimpan antrian persetujuan: %v", err)
+		sendMessage(bot, chatID, "❌ Gagal mengirim permintaan. Silakan coba lagi nanti.")
+		return
+	}
+
+	if config, err := loadConfig(); err == nil {
+		msg := tgbotapi.NewMessage(0, a.summary("📥 *PERMINTAAN AKUN BARU*"))
+		msg.ParseMode = "Markdown"
+		msg.ReplyMarkup = approvalKeyboard(a.ID)
+		notifyAdmins(bot, config, PermCreate, msg)
+	}
+	sendMessage(bot, chatID, fmt.Sprintf("📨 Permintaan akun `%s` sudah dikirim ke admin.\nAnda akan diberi tahu setelah disetujui atau ditolak.", a.Password))
+	showHome(bot, chatID)
+}
+
+var errApprovalGone = errors.New("permintaan sudah diproses atau tidak ditemukan")
+
+// claimApproval menandai permintaan sedang diproses tanpa mengeluarkannya
+// dari antrian. Tombol yang ditekan dua kali (atau oleh dua pesan admin)
+// hanya diproses sekali; nil jika tidak ada atau sedang diproses.
+func claimApproval(id string) *Approval {
+	approvalMutex.Lock()
+	defer approvalMutex.Unlock()
+	a, ok := approvals[id]
+	if !ok || a.claimed {
+		return nil
+	}
+	a.claimed = true
+	return a
+}
+
+// releaseApproval menyelesaikan klaim. done mengeluarkan permintaan dari
+// antrian; selain itu permintaan kembali menunggu keputusan admin.
+func releaseApproval(id string, done bool) error {
+	approvalMutex.Lock()
+	defer approvalMutex.Unlock()
+	a, ok := approvals[id]
+	if !ok {
+		return nil
+	}
+	if !done {
+		a.claimed = false
+		return nil
+	}
+	delete(approvals, id)
+	if err := saveApprovals(); err != nil {
+		a.claimed = false
+		approvals[id] = a
+		return err
+	}
+	return nil
+}
+
+func showApprovals(bot *tgbotapi.BotAPI, chatID int64) {
+	approvalMutex.Lock()
+	pending := make([]*Approval, 0, len(approvals))
+	for _, a := range approvals {
+		pending = append(pending, a)
+	}
+	approvalMutex.Unlock()
+	sort.Slice(pending, func(i, j int) bool { return pending[i].CreatedAt < pending[j].CreatedAt })
+
+	if len(pending) == 0 {
+		sendMessage(bot, chatID, "✅ Tidak ada permintaan yang menunggu persetujuan.")
+		return
+	}
+	for i, a := range pending {
+		// Permintaan lain tetap bisa diproses setelah yang pertama selesai
+		if i == 10 {
+			sendMessage(bot, chatID, fmt.Sprintf("… dan `%d` permintaan lain.", len(pending)-i))
+			break
+		}
+		msg := tgbotapi.NewMessage(chatID, a.summary("📥 *MENUNGGU PERSETUJUAN*"))
+		msg.ParseMode = "Markdown"
+		msg.ReplyMarkup = approvalKeyboard(a.ID)
+		bot.Send(msg)
+	}
+}
+
+// approveRequest mengeluarkan permintaan dari antrian hanya jika akun
+// berhasil dibuat; jika gagal, permintaan tetap menunggu agar admin bisa
+// mencoba lagi atau menolaknya.
+func approveRequest(bot *tgbotapi.BotAPI, c *client.Client, chatID int64, id string) error {
+	a := claimApproval(id)
+	if a == nil {
+		sendMessage(bot, chatID, "⚠️ Permintaan sudah diproses atau tidak ditemukan.")
+		return errApprovalGone
+	}
+	cfg, _ := loadConfig()
+	// Detail akun (atau alasan gagal) dikirim langsung ke pemohon
+	if err := createUser(bot, c, a.UserID, a.request(), cfg); err != nil {
+		releaseApproval(id, false)
+		sendMessage(bot, chatID, fmt.Sprintf("❌ Akun `%s` untuk permintaan `%s` gagal dibuat. Pemohon sudah diberi tahu; permintaan tetap di antrian untuk dicoba lagi atau ditolak.", a.Password, a.ID))
+		return err
+	}
+	if err := releaseApproval(id, true); err != nil {
+		log.Printf("Gagal menyimpan antrian persetujuan: %v", err)
+	}
+	sendMessage(bot, chatID, fmt.Sprintf("✅ Permintaan `%s` disetujui. Akun `%s` dibuat untuk `%d`.", a.ID, a.Password, a.UserID))
+	return nil
+}
+
+func rejectRequest(bot *tgbotapi.BotAPI, chatID int64, id string) error {
+	a := claimApproval(id)
+	if a == nil {
+		sendMessage(bot, chatID, "⚠️ Permintaan sudah diproses atau tidak ditemukan.")
+		return errApprovalGone
+	}
+	if err := releaseApproval(id, true); err != nil {
+		sendMessage(bot, chatID, "❌ Gagal menyimpan antrian persetujuan: "+err.Error())
+		return err
+	}
+	sendMessage(bot, a.UserID, fmt.Sprintf("🚫 Permintaan akun `%s` ditolak oleh admin.", a.Password))
+	sendMessage(bot, chatID, fmt.Sprintf("🚫 Permintaan `%s` ditolak.", a.ID))
+	return nil
+}
+
+// --- TRIAL ---
+
+// TrialPolicy mengatur akun trial dari tombol publik. Disimpan di
+// TrialPolicyFile dan dibaca ulang setiap ada permintaan, jadi perubahan
+// langsung berlaku tanpa restart bot.
+type TrialPolicy struct {
+	Enabled        bool   `json:"enabled"`
+	Hours          int    `json:"hours"`
+	LimitIP        int    `json:"limit_ip"`
+	LimitQuota     int    `json:"limit_quota"` // GB
+	PasswordLength int    `json:"password_length"`
+	PasswordPrefix string `json:"password_prefix"`
+	// 0 berarti hanya sekali per Telegram ID
+	CooldownHours int `json:"cooldown_hours"`
+	// Batas trial per hari untuk semua user, 0 = tanpa batas
+	DailyCap int `json:"daily_cap"`
+	// Telegram tidak memberi tanggal pembuatan akun, jadi umur dihitung
+	// sejak user pertama kali menghubungi bot. 0 = tidak dicek.
+	MinAccountAgeDays int `json:"min_account_age_days"`
+	// @username atau ID channel yang wajib diikuti; bot harus jadi admin di sana
+	RequiredChannel string `json:"required_channel"`
+}
+
+// TrialRecord adalah riwayat trial satu user. Waktu dalam RFC3339.
+type TrialRecord struct {
+	FirstSeen string `json:"first_seen,omitempty"`
+	LastTrial string `json:"last_trial,omitempty"`
+	Count     int    `json:"count"`
+	// Akun trial yang masih aktif, dihapus bot saat ExpiresAt lewat
+	Password  string `json:"password,omitempty"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+}
+
+type TrialTracker struct {
+	Users    map[int64]*TrialRecord `json:"users"`
+	Day      string                 `json:"day"`
+	DayCount int                    `json:"day_count"`
+}
+
+func defaultTrialPolicy() TrialPolicy {
+	return TrialPolicy{Enabled: true, Hours: 24, LimitIP: 1, LimitQuota: 1, PasswordLength: 4}
+}
+
+func loadTrialPolicy() TrialPolicy {
+	policy := defaultTrialPolicy()
+	file, err := os.ReadFile(TrialPolicyFile)
+	if os.IsNotExist(err) {
+		if data, err := json.MarshalIndent(policy, "", " "); err == nil {
+			os.WriteFile(TrialPolicyFile, data, 0644)
+		}
+		return policy
+	}
+	if err != nil {
+		log.Printf("Gagal memuat trial policy: %v", err)
+		return policy
+	}
+	if err := json.Unmarshal(file, &policy); err != nil {
+		log.Printf("Gagal unmarshal trial policy: %v", err)
+		return defaultTrialPolicy()
+	}
+	if policy.Hours < 1 {
+		policy.Hours = 24
+	}
+	if policy.PasswordLength < 4 {
+		policy.PasswordLength = 4
+	} else if policy.PasswordLength > 32 {
+		policy.PasswordLength = 32
+	}
+	return policy
+}
+
+// trackTrialUser mencatat kapan user pertama kali menghubungi bot, dipakai
+// untuk syarat min_account_age_days.
+func trackTrialUser(userID int64) {
+	trialMutex.Lock()
+	defer trialMutex.Unlock()
+	rec, ok := trialTracker.Users[userID]
+	if ok && rec.FirstSeen != "" {
+		return
+	}
+	if !ok {
+		rec = &TrialRecord{}
+		trialTracker.Users[userID] = rec
+	}
+	rec.FirstSeen = time.Now().Format(time.RFC3339)
+	if err := saveTrialTracker(); err != nil {
+		log.Printf("Gagal menyimpan trial tracker: %v", err)
+	}
+}
+
+func formatHours(hours int) string {
+	if hours%24 == 0 {
+		return fmt.Sprintf("%d Hari", hours/24)
+	}
+	return fmt.Sprintf("%d Jam", hours)
+}
+
+// isChannelMember mengecek keanggotaan user di channel wajib.
+func isChannelMember(bot *tgbotapi.BotAPI, channel string, userID int64) (bool, error) {
+	chat := tgbotapi.ChatConfigWithUser{UserID: userID}
+	if id, err := strconv.ParseInt(channel, 10, 64); err == nil {
+		chat.ChatID = id
+	} else {
+		chat.SuperGroupUsername = channel
+	}
+	member, err := bot.GetChatMember(tgbotapi.GetChatMemberConfig{ChatConfigWithUser: chat})
+	if err != nil {
+		return false, err
+	}
+	switch member.Status {
+	case "creator", "administrator", "member":
+		return true, nil
+	case "restricted":
+		return member.IsMember, nil
+	}
+	return false, nil
+}
+
+// trialBlocked mengembalikan alasan user belum boleh trial, atau string
+// kosong. Harus dipanggil dengan trialMutex terkunci.
+func trialBlocked(rec *TrialRecord, policy TrialPolicy, now time.Time) string {
+	if rec != nil && rec.Count > 0 {
+		if policy.CooldownHours <= 0 {
+			return "Anda sudah pernah membuat akun trial. Hanya sekali per akun."
+		}
+		if last, err := time.Parse(time.RFC3339, rec.LastTrial); err == nil {
+			if next := last.Add(time.Duration(policy.CooldownHours) * time.Hour); now.Before(next) {
+				return fmt.Sprintf("Trial berikutnya bisa diambil setelah %s.", next.Local().Format("02-01-2006 15:04"))
+			}
+		}
+	}
+	if policy.MinAccountAgeDays > 0 {
+		first := now
+		if rec != nil {
+			if t, err := time.Parse(time.RFC3339, rec.FirstSeen); err == nil {
+				first = t
+			}
+		}
+		if now.Sub(first) < time.Duration(policy.MinAccountAgeDays)*24*time.Hour {
+			return fmt.Sprintf("Trial hanya untuk akun yang sudah memakai bot minimal %d hari.", policy.MinAccountAgeDays)
+		}
+	}
+	if policy.DailyCap > 0 && trialTracker.Day == now.Format("2006-01-02") && trialTracker.DayCount >= policy.DailyCap {
+		return "Kuota trial hari ini sudah habis. Silakan coba lagi besok."
+	}
+	return ""
+}
+
+// claimTrial memesan jatah trial agar dua klik bersamaan tidak sama-sama
+// lolos. Fungsi undo mengembalikan jatah jika akun gagal dibuat.
+func claimTrial(userID int64, policy TrialPolicy) (func(), string) {
+	trialMutex.Lock()
+	defer trialMutex.Unlock()
+	now := time.Now()
+	rec := trialTracker.Users[userID]
+	if reason := trialBlocked(rec, policy, now); reason != "" {
+		return nil, reason
+	}
+	if rec == nil {
+		rec = &TrialRecord{FirstSeen: now.Format(time.RFC3339)}
+		trialTracker.Users[userID] = rec
+	}
+	prev := *rec
+	today := now.Format("2006-01-02")
+	if trialTracker.Day != today {
+		trialTracker.Day = today
+		trialTracker.DayCount = 0
+	}
+	trialTracker.DayCount++
+	rec.Count++
+	rec.LastTrial = now.Format(time.RFC3339)
+	if err := saveTrialTracker(); err != nil {
+		log.Printf("Gagal menyimpan trial tracker: %v", err)
+	}
+	return func() {
+		trialMutex.Lock()
+		defer trialMutex.Unlock()
+		restored := prev
+		trialTracker.Users[userID] = &restored
+		if trialTracker.Day == today && trialTracker.DayCount > 0 {
+			trialTracker.DayCount--
+		}
+		if err := saveTrialTracker(); err != nil {
+			log.Printf("Gagal menyimpan trial tracker: %v", err)
+		}
+	}, ""
+}
+
+func createTrial(bot *tgbotapi.BotAPI, chatID, userID int64) {
+	policy := loadTrialPolicy()
+	if !policy.Enabled {
+		sendMessage(bot, chatID, "❌ Trial sedang tidak tersedia.")
+		return
+	}
+	if policy.RequiredChannel != "" {
+		ok, err := isChannelMember(bot, policy.RequiredChannel, userID)
+		if err != nil {
+			log.Printf("Gagal cek keanggotaan %d di %s: %v", userID, policy.RequiredChannel, err)
+		}
+		if !ok {
+			sendMessage(bot, chatID, fmt.Sprintf("❌ Silakan join %s terlebih dahulu, lalu coba lagi.", policy.RequiredChannel))
+			return
+		}
+	}
+	undo, reason := claimTrial(userID, policy)
+	if reason != "" {
+		sendMessage(bot, chatID, "❌ "+reason)
+		return
+	}
+
+	sendMessage(bot, chatID, "⏳ Sedang membuat akun trial...")
+	// Expired di API per tanggal; tambah satu hari agar tidak terhapus
+	// sebelum waktunya. Bot menghapus akun tepat saat jamnya habis.
+	req := client.CreateUserRequest{
+		Password:   policy.PasswordPrefix + generateRandomPassword(policy.PasswordLength),
+		Days:       (policy.Hours+23)/24 + 1,
+		LimitIP:    policy.LimitIP,
+		LimitQuota: policy.LimitQuota,
+	}
+	data, err := api.CreateUser(context.Background(), req)
+	if err != nil {
+		undo()
+		var apiErr *client.APIError
+		if errors.As(err, &apiErr) {
+			sendMessage(bot, chatID, fmt.Sprintf("❌ Gagal: %s", apiErr.Message))
+		} else {
+			sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+		}
+		showHome(bot, chatID)
+		return
+	}
+	expiresAt := time.Now().Add(time.Duration(policy.Hours) * time.Hour)
+	trialMutex.Lock()
+	if rec := trialTracker.Users[userID]; rec != nil {
+		rec.Password = data.Password
+		rec.ExpiresAt = expiresAt.Format(time.RFC3339)
+	}
+	if err := saveTrialTracker(); err != nil {
+		log.Printf("Gagal menyimpan trial tracker: %v", err)
+	}
+	trialMutex.Unlock()
+
+	// Reload config untuk ensure NotifGroupID terbaru
+	cfg, _ := loadConfig()
+	data.Expired = expiresAt.Format("2006-01-02 15:04")
+	sendAccountCreated(bot, chatID, "🎁 *AKUN TRIAL "+strings.ToUpper(formatHours(policy.Hours))+"*", data, cfg)
+	showHome(bot, chatID)
+}
+
+// expireTrials menghapus akun trial yang durasi jamnya sudah habis.
+func expireTrials(bot *tgbotapi.BotAPI) {
+	now := time.Now()
+	type expired struct {
+		userID   int64
+		password string
+	}
+	var due []expired
+	trialMutex.Lock()
+	for id, rec := range trialTracker.Users {
+		if rec.Password == "" {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339, rec.ExpiresAt); err == nil && now.After(t) {
+			due = append(due, expired{id, rec.Password})
+		}
+	}
+	trialMutex.Unlock()
+
+	for _, d := range due {
+		err := api.DeleteUser(context.Background(), d.password)
+		if err != nil && !errors.Is(err, client.ErrNotFound) {
+			log.Printf("❌ [Trial] Gagal menghapus %s: %v", d.password, err)
+			continue
+		}
+		trialMutex.Lock()
+		if rec := trialTracker.Users[d.userID]; rec != nil && rec.Password == d.password {
+			rec.Password = ""
+			rec.ExpiresAt = ""
+		}
+		if err := saveTrialTracker(); err != nil {
+			log.Printf("Gagal menyimpan trial tracker: %v", err)
+		}
+		trialMutex.Unlock()
+		log.Printf("✅ [Trial] Akun trial [%s] berakhir dan dihapus.", d.password)
+		sendMessage(bot, d.userID, fmt.Sprintf("⌛ Akun trial `%s` telah berakhir.", d.password))
+	}
+}
+
+// resetTrial menghapus riwayat trial user agar bisa trial lagi. Waktu
+// pertama kali terlihat dan akun trial yang masih aktif tetap disimpan.
+func resetTrial(userID int64) error {
+	trialMutex.Lock()
+	defer trialMutex.Unlock()
+	rec, ok := trialTracker.Users[userID]
+	if !ok {
+		return nil
+	}
+	rec.Count = 0
+	rec.LastTrial = ""
+	if err := saveTrialTracker(); err != nil {
+		log.Printf("Gagal menyimpan trial tracker: %v", err)
+		return err
+	}
+	return nil
+}
+
+func showTrialPolicy(bot *tgbotapi.BotAPI, chatID int64) {
+	policy := loadTrialPolicy()
+	trialMutex.Lock()
+	today := 0
+	if trialTracker.Day == time.Now().Format("2006-01-02") {
+		today = trialTracker.DayCount
+	}
+	trialMutex.Unlock()
+
+	status := "✅ Aktif"
+	if !policy.Enabled {
+		status = "⛔ Nonaktif"
+	}
+	cooldown := "Sekali per user"
+	if policy.CooldownHours > 0 {
+		cooldown = formatHours(policy.CooldownHours)
+	}
+	dailyCap := "Tanpa batas"
+	if policy.DailyCap > 0 {
+		dailyCap = strconv.Itoa(policy.DailyCap)
+	}
+	minAge := "-"
+	if policy.MinAccountAgeDays > 0 {
+		minAge = fmt.Sprintf("%d Hari", policy.MinAccountAgeDays)
+	}
+	channel := "-"
+	if policy.RequiredChannel != "" {
+		channel = policy.RequiredChannel
+	}
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("🎁 *TRIAL POLICY*\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━\n"+
+		"• *Status*: %s\n"+
+		"• *Durasi*: `%s`\n"+
+		"• *Limit IP*: `%d` Device\n"+
+		"• *Limit Kuota*: `%d GB`\n"+
+		"• *Password*: `%s` + `%d` karakter\n"+
+		"• *Cooldown*: `%s`\n"+
+		"• *Batas Harian*: `%s` (hari ini `%d`)\n"+
+		"• *Umur Akun Min.*: `%s`\n"+
+		"• *Wajib Join*: `%s`\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━\n"+
+		"Ubah di `%s`.",
+		status, formatHours(policy.Hours), policy.LimitIP, policy.LimitQuota, policy.PasswordPrefix, policy.PasswordLength,
+		cooldown, dailyCap, today, minAge, channel, TrialPolicyFile))
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔍 Cek User", "trial_check"),
+			tgbotapi.NewInlineKeyboardButtonData("⬅️ Menu", "cancel"),
+		),
+	)
+	deleteLastMessage(bot, chatID)
+	sendAndTrack(bot, msg)
+}
+
+func showTrialStatus(bot *tgbotapi.BotAPI, chatID, userID int64) {
+	trialMutex.Lock()
+	var rec TrialRecord
+	if r, ok := trialTracker.Users[userID]; ok {
+		rec = *r
+	}
+	trialMutex.Unlock()
+
+	field := func(value string) string {
+		if value == "" {
+			return "-"
+		}
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t.Local().Format("02-01-2006 15:04")
+		}
+		return value
+	}
+	active := "-"
+	if rec.Password != "" {
+		active = fmt.Sprintf("%s (sampai %s)", rec.Password, field(rec.ExpiresAt))
+	}
+	blocked := "✅ Boleh trial"
+	policy := loadTrialPolicy()
+	trialMutex.Lock()
+	if reason := trialBlocked(&rec, policy, time.Now()); reason != "" {
+		blocked = "⛔ " + reason
+	}
+	trialMutex.Unlock()
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("🎁 *STATUS TRIAL*\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━\n"+
+		"👤 *Telegram ID*: `%d`\n"+
+		"👀 *Pertama Terlihat*: `%s`\n"+
+		"🔢 *Jumlah Trial*: `%d`\n"+
+		"🕒 *Trial Terakhir*: `%s`\n"+
+		"🔑 *Akun Aktif*: `%s`\n"+
+		"📌 *Status*: %s\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━",
+		userID, field(rec.FirstSeen), rec.Count, field(rec.LastTrial), active, blocked))
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("♻️ Reset Trial", fmt.Sprintf("trial_reset:%d", userID)),
+			tgbotapi.NewInlineKeyboardButtonData("⬅️ Kembali", "menu_trial_policy"),
+		),
+	)
+	deleteLastMessage(bot, chatID)
+	sendAndTrack(bot, msg)
+}
+
+// --- PENGINGAT EXPIRED ---
+
+// ReminderRecord mencatat pengingat yang sudah dikirim untuk satu masa
+// aktif akun. Sent direset saat tanggal expired berubah (diperpanjang).
+type ReminderRecord struct {
+	Expired string `json:"expired"`
+	Sent    []int  `json:"sent"` // jam sebelum expired yang sudah dikirim
+}
+
+func (r *ReminderRecord) sent(hours int) bool {
+	for _, h := range r.Sent {
+		if h == hours {
+			return true
+		}
+	}
+	return false
+}
+
+// reminderHours mengembalikan jarak pengingat yang valid, terbesar dulu.
+func (c BotConfig) reminderHours() []int {
+	hours := c.ReminderHours
+	if hours == nil {
+		hours = DefaultReminderHours
+	}
+	var out []int
+	for _, h := range hours {
+		if h > 0 {
+			out = append(out, h)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(out)))
+	return out
+}
+
+// formatRemaining menampilkan sisa waktu dalam hari dan jam.
+func formatRemaining(d time.Duration) string {
+	hours := int(d / time.Hour)
+	switch {
+	case hours < 1:
+		return "kurang dari 1 jam"
+	case hours < 24:
+		return fmt.Sprintf("%d jam", hours)
+	case hours%24 == 0:
+		return fmt.Sprintf("%d hari", hours/24)
+	}
+	return fmt.Sprintf("%d hari %d jam", hours/24, hours%24)
+}
+
+// sendExpiryReminders mengirim pengingat ke pemilik akun yang akan expired.
+// Jika beberapa jarak sudah terlewati sekaligus (misal bot baru menyala),
+// hanya satu pengingat yang dikirim dan jarak yang lebih besar ikut
+// ditandai. Pengingat baru dicatat setelah berhasil terkirim, jadi yang
+// gagal dicoba lagi pada putaran berikutnya.
+func sendExpiryReminders(bot *tgbotapi.BotAPI) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return
+	}
+	hours := cfg.reminderHours()
+	if len(hours) == 0 {
+		return
+	}
+	users, err := api.ListUsers(context.Background())
+	if err != nil {
+		log.Printf("❌ [Pengingat] Gagal mengambil data user: %v", err)
+		return
+	}
+	type reminder struct {
+		owner  int64
+		user   client.User
+		left   time.Duration
+		offset int
+	}
+	var due []reminder
+	now := time.Now()
+	exists := make(map[string]bool, len(users))
+	changed := false
+
+	ownerMutex.Lock()
+	for _, u := range users {
+		exists[u.Password] = true
+		owner := owners[u.Password]
+		if owner == 0 {
+			continue
+		}
+		expiredAt, err := parseExpired(u.Expired)
+		if err != nil {
+			continue
+		}
+		left := expiredAt.Sub(now)
+		if left <= 0 {
+			continue
+		}
+		// Jarak terkecil yang sudah terlewati
+		offset := 0
+		for _, h := range hours {
+			if left <= time.Duration(h)*time.Hour {
+				offset = h
+			}
+		}
+		if offset == 0 {
+			continue
+		}
+		rec := reminders[u.Password]
+		if rec == nil || rec.Expired != u.Expired {
+			rec = &ReminderRecord{Expired: u.Expired}
+			reminders[u.Password] = rec
+		}
+		if rec.sent(offset) {
+			continue
+		}
+		due = append(due, reminder{owner, u, left, offset})
+	}
+	for password := range reminders {
+		if !exists[password] {
+			delete(reminders, password)
+			changed = true
+		}
+	}
+	if changed {
+		if err := saveReminders(); err != nil {
+			log.Printf("Gagal menyimpan pengingat: %v", err)
+		}
+	}
+	ownerMutex.Unlock()
+
+	for _, d := range due {
+		text := fmt.Sprintf("⏰ *AKUN SEGERA BERAKHIR*\n"+
+			"━━━━━━━━━━━━━━━━━━━━━━━━━\n"+
+			"🔑 *Password*: `%s`\n"+
+			"🗓️ *Expired*: `%s`\n"+
+			"⏳ *Sisa Waktu*: `%s`\n"+
+			"━━━━━━━━━━━━━━━━━━━━━━━━━\n"+
+			"Perpanjang sekarang agar koneksi tidak terputus.",
+			d.user.Password, d.user.Expired, formatRemaining(d.left))
+		msg := tgbotapi.NewMessage(d.owner, text)
+		msg.ParseMode = "Markdown"
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("🔄 Perpanjang", "owner_renew:"+d.user.Password)),
+		)
+		if _, err := bot.Send(msg); err != nil {
+			log.Printf("❌ [Pengingat] Gagal kirim ke %d untuk %s: %v", d.owner, d.user.Password, err)
+			continue
+		}
+		markReminderSent(d.user.Password, d.user.Expired, d.offset, hours)
+		log.Printf("✅ [Pengingat] %s (Exp: %s) dikirim ke %d.", d.user.Password, d.user.Expired, d.owner)
+	}
+}
+
+// markReminderSent menandai jarak offset dan semua jarak yang lebih besar
+// untuk masa aktif expired.
+func markReminderSent(password, expired string, offset int, hours []int) {
+	ownerMutex.Lock()
+	defer ownerMutex.Unlock()
+	rec := reminders[password]
+	if rec == nil || rec.Expired != expired {
+		rec = &ReminderRecord{Expired: expired}
+		reminders[password] = rec
+	}
+	for _, h := range hours {
+		if h >= offset && !rec.sent(h) {
+			rec.Sent = append(rec.Sent, h)
+		}
+	}
+	if err := saveReminders(); err != nil {
+		log.Printf("Gagal menyimpan pengingat: %v", err)
+	}
+}
+
+// --- AKUN SAYA ---
+
+// myAccount mencari akun milik telegramID. Akun milik orang lain
+// diperlakukan sama dengan akun yang tidak ada.
+func myAccount(bot *tgbotapi.BotAPI, chatID, telegramID int64, password string) (*client.User, bool) {
+	if accountOwner(password) != telegramID {
+		sendMessage(bot, chatID, "⛔ Akun ini bukan milik Anda.")
+		return nil, false
+	}
+	users, err := api.ListUsers(context.Background())
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+		return nil, false
+	}
+	for i := range users {
+		if users[i].Password == password {
+			return &users[i], true
+		}
+	}
+	sendMessage(bot, chatID, "❌ Akun tidak ditemukan.")
+	return nil, false
+}
+
+func showMyAccounts(bot *tgbotapi.BotAPI, chatID, telegramID int64) {
+	owned := ownedPasswords(telegramID)
+	var mine []client.User
+	if len(owned) > 0 {
+		users, err := api.ListUsers(context.Background())
+		if err != nil {
+			sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+			return
+		}
+		for _, u := range users {
+			if owned[u.Password] {
+				mine = append(mine, u)
+			}
+		}
+	}
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, u := range mine {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🔑 %s • %s • %s", u.Password, u.Expired, u.Status), "my_account:"+u.Password),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("⬅️ Kembali", "cancel"),
+	))
+	text := fmt.Sprintf("👤 *AKUN SAYA*\nAnda memiliki `%d` akun. Pilih akun untuk melihat detail:", len(mine))
+	if len(mine) == 0 {
+		text = "👤 *AKUN SAYA*\nBelum ada akun yang terdaftar atas Telegram Anda. Akun dari create, redeem voucher, atau order akan muncul di sini."
+	}
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	deleteLastMessage(bot, chatID)
+	sendAndTrack(bot, msg)
+}
+
+func showMyAccount(bot *tgbotapi.BotAPI, chatID, telegramID int64, password string) {
+	u, ok := myAccount(bot, chatID, telegramID, password)
+	if !ok {
+		return
+	}
+	text := fmt.Sprintf("👤 *DETAIL AKUN*\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━\n"+
+		"🔑 *Password*: `%s`\n"+
+		"📌 *Status*: `%s`\n"+
+		"🗓️ *Expired*: `%s`\n"+
+		"🔢 *Limit IP*: `%d` Device\n"+
+		"💾 *Kuota*: `%.2f / %d GB`\n"+
+		"━━━━━━━━━━━━━━━━━━━━━━━━━",
+		u.Password, u.Status, u.Expired, u.LimitIP, float64(u.UsedBytes)/(1<<30), u.LimitQuota)
+	if link, err := api.StatusLink(context.Background(), u.Password); err == nil {
+		text += statusLine(link.URL)
+	}
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📲 Profil & QR", "my_profile:"+u.Password),
+			tgbotapi.NewInlineKeyboardButtonData("🔄 Perpanjang", "owner_renew:"+u.Password),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔁 Ganti Password", "my_rotate:"+u.Password),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⬅️ Akun Saya", "menu_my_accounts"),
+		),
+	)
+	deleteLastMessage(bot, chatID)
+	sendAndTrack(bot, msg)
+}
+
+// sendMyProfile mengirim URI import dan QR code akun milik telegramID.
+func sendMyProfile(bot *tgbotapi.BotAPI, chatID, telegramID int64, password string) {
+	if _, ok := myAccount(bot, chatID, telegramID, password); !ok {
+		return
+	}
+	profile, err := api.UserProfile(context.Background(), password)
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+		return
+	}
+	port := strconv.Itoa(profile.Port)
+	if profile.PortRange != "" {
+		port += " / " + profile.PortRange
+	}
+	text := fmt.Sprintf("📲 *PROFIL KONEKSI*\n"+
+		"🌐 *Server*: `%s`\n"+
+		"🔌 *Port*: `%s`\n"+
+		"🛡️ *Obfs*: `%s`\n"+
+		"📲 *Import* (scan QR atau salin):\n`%s`",
+		profile.Server, port, profile.Obfs, profile.URI)
+	if qr, err := api.UserProfileQR(context.Background(), password); err == nil {
+		photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileBytes{Name: "zivpn-" + password + ".png", Bytes: qr})
+		photo.Caption = text
+		photo.ParseMode = "Markdown"
+		if _, err := bot.Send(photo); err == nil {
+			return
+		}
+	}
+	sendMessage(bot, chatID, text)
+}
+
+// rotateMyPassword mengganti password akun milik telegramID lalu
+// menampilkan detail akun dengan password baru.
+func rotateMyPassword(bot *tgbotapi.BotAPI, chatID, telegramID int64, password, newPassword string) {
+	if _, ok := myAccount(bot, chatID, telegramID, password); !ok {
+		return
+	}
+	data, err := api.RotatePassword(context.Background(), password, newPassword)
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		sendMessage(bot, chatID, fmt.Sprintf("❌ Gagal mengganti password: %s", apiErr.Message))
+		return
+	}
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Error API: "+err.Error())
+		return
+	}
+	// Event user.rotated juga memindah pemilik; dipanggil di sini agar
+	// detail akun langsung bisa dibuka
+	moveOwner(password, data.Password)
+	sendMessage(bot, chatID, fmt.Sprintf("✅ Password diganti.\n🔑 *Lama*: `%s`\n🔑 *Baru*: `%s`\nGunakan password baru di aplikasi Anda.", data.OldPassword, data.Password)+statusLine(data.StatusURL))
+	showMyAccount(bot, chatID, telegramID, data.Password)
+}
+
+// --- ADMIN & PERAN ---
+
+// adminFor mengembalikan admin dengan Telegram ID userID, nil jika bukan
+// admin. AdminID selalu dianggap owner.
+func (c BotConfig) adminFor(userID int64) *Admin {
+	if userID == 0 {
+		return nil
+	}
+	if userID == c.AdminID {
+		return &Admin{ID: userID, Role: RoleOwner}
+	}
+	for i := range c.Admins {
+		if c.Admins[i].ID == userID {
+			return &c.Admins[i]
+		}
+	}
+	return nil
+}
+
+// findAdmin membaca ulang config agar perubahan admin langsung berlaku.
+func findAdmin(userID int64) *Admin {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil
+	}
+	return cfg.adminFor(userID)
+}
+
+// can aman dipanggil pada admin nil (bukan admin): selalu false.
+func (a *Admin) can(perm string) bool {
+	if a == nil {
+		return false
+	}
+	for _, p := range rolePermissions[a.Role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Admin) actor() string {
+	return fmt.Sprintf("telegram:%d", a.ID)
+}
+
+// apiFor mengembalikan client API yang mengirim X-Actor admin, sehingga
+// audit log API mencatat siapa yang memicu aksi. Untuk non-admin hasilnya api.
+func apiFor(admin *Admin) *client.Client {
+	if admin == nil {
+		return api
+	}
+	return api.AsActor(admin.actor())
+}
+
+// auditAdmin mencatat hasil aksi admin bot di audit log API dengan Telegram
+// ID admin sebagai actor. Dipanggil setelah aksi selesai: result berisi "ok"
+// atau pesan error. Tidak melakukan apa pun untuk non-admin.
+func auditAdmin(admin *Admin, action string, detail map[string]string, result error) {
+	if admin == nil {
+		return
+	}
+	detail["role"] = admin.Role
+	detail["result"] = "ok"
+	if result != nil {
+		detail["result"] = result.Error()
+	}
+	if err := apiFor(admin).RecordAudit(context.Background(), "bot."+action, detail); err != nil {
+		log.Printf("Gagal mencatat audit bot.%s oleh %d: %v", action, admin.ID, err)
+	}
+}
+
+// notifyAdmins mengirim msg ke owner utama dan setiap admin yang punya izin
+// perm, misalnya agar semua admin yang boleh create menerima order baru.
+func notifyAdmins(bot *tgbotapi.BotAPI, cfg BotConfig, perm string, msg tgbotapi.MessageConfig) {
+	ids := []int64{cfg.AdminID}
+	for i := range cfg.Admins {
+		if cfg.Admins[i].ID != cfg.AdminID && cfg.Admins[i].can(perm) {
+			ids = append(ids, cfg.Admins[i].ID)
+		}
+	}
+	for _, id := range ids {
+		msg.ChatID = id
+		if _, err := bot.Send(msg); err != nil {
+			log.Printf("Gagal kirim notifikasi ke admin %d: %v", id, err)
+		}
+	}
+}
+
+func adminLabel(a Admin) string {
+	name := a.Name
+	if name == "" {
+		name = strconv.FormatInt(a.ID, 10)
+	}
+	return fmt.Sprintf("%s • %s", roleLabels[a.Role], name)
+}
+
+func showAdmins(bot *tgbotapi.BotAPI, chatID int64) {
+	cfg, err := loadConfig()
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Gagal membaca konfigurasi.")
+		return
+	}
+	text := fmt.Sprintf("👮 *ADMIN BOT*\nOwner utama: `%d`\nAdmin tambahan: `%d`", cfg.AdminID, len(cfg.Admins))
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, a := range cfg.Admins {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(adminLabel(a), fmt.Sprintf("admin_view:%d", a.ID)),
+		))
+	}
+	rows = append(rows,
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("➕ Tambah Admin", "admin_add")),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("⬅️ Kembali", "cancel")),
+	)
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	deleteLastMessage(bot, chatID)
+	sendAndTrack(bot, msg)
+}
+
+func showAdminDetail(bot *tgbotapi.BotAPI, chatID, id int64) {
+	cfg, err := loadConfig()
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Gagal membaca konfigurasi.")
+		return
+	}
+	a := cfg.adminFor(id)
+	if a == nil || id == cfg.AdminID {
+		sendMessage(bot, chatID, "❌ Admin tidak ditemukan.")
+		return
+	}
+	text := fmt.Sprintf("👮 *DETAIL ADMIN*\n🆔 *Telegram ID*: `%d`\n👤 *Nama*: `%s`\n🛡️ *Peran*: %s\n\nPilih peran baru atau hapus admin:", a.ID, a.Name, roleLabels[a.Role])
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	rows := roleRows(id)
+	rows = append(rows,
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("🗑️ Hapus Admin", fmt.Sprintf("admin_remove:%d", id))),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("⬅️ Kembali", "menu_admins")),
+	)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	deleteLastMessage(bot, chatID)
+	sendAndTrack(bot, msg)
+}
+
+func roleRows(id int64) [][]tgbotapi.InlineKeyboardButton {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, role := range roleOrder {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(roleLabels[role], fmt.Sprintf("admin_role:%d:%s", id, role)),
+		))
+	}
+	return rows
+}
+
+func showRolePicker(bot *tgbotapi.BotAPI, chatID, id int64) {
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("👮 *TAMBAH ADMIN*\nTelegram ID: `%d`\n\nPilih **Peran**:", id))
+	msg.ParseMode = "Markdown"
+	rows := roleRows(id)
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("❌ Batal", "menu_admins")))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	deleteLastMessage(bot, chatID)
+	sendAndTrack(bot, msg)
+}
+
+// setAdminRole menambah admin baru atau mengubah perannya. Owner utama
+// (AdminID) tidak bisa diubah dari bot.
+func setAdminRole(bot *tgbotapi.BotAPI, chatID, id int64, role string) error {
+	if _, ok := rolePermissions[role]; !ok {
+		sendMessage(bot, chatID, "❌ Peran tidak dikenal.")
+		return fmt.Errorf("peran %q tidak dikenal", role)
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Gagal membaca konfigurasi.")
+		return err
+	}
+	if id == cfg.AdminID {
+		sendMessage(bot, chatID, "❌ Peran owner utama tidak bisa diubah.")
+		return errors.New("peran owner utama tidak bisa diubah")
+	}
+	added := true
+	for i := range cfg.Admins {
+		if cfg.Admins[i].ID == id {
+			cfg.Admins[i].Role = role
+			added = false
+		}
+	}
+	if added {
+		// Nama hanya bisa dibaca jika user pernah memulai chat dengan bot
+		name := ""
+		if chat, err := bot.GetChat(tgbotapi.ChatInfoConfig{ChatConfig: tgbotapi.ChatConfig{ChatID: id}}); err == nil {
+			name = chat.UserName
+			if name == "" {
+				name = strings.TrimSpace(chat.FirstName + " " + chat.LastName)
+			}
+		}
+		cfg.Admins = append(cfg.Admins, Admin{ID: id, Name: name, Role: role})
+	}
+	if err := saveConfig(cfg); err != nil {
+		sendMessage(bot, chatID, "❌ Gagal menyimpan konfigurasi.")
+		return err
+	}
+	if added {
+		sendMessage(bot, chatID, fmt.Sprintf("✅ Admin `%d` ditambahkan sebagai %s.", id, roleLabels[role]))
+		sendMessage(bot, id, fmt.Sprintf("👮 Anda ditambahkan sebagai admin bot dengan peran %s. Ketik /start untuk membuka panel.", roleLabels[role]))
+	} else {
+		sendMessage(bot, chatID, fmt.Sprintf("✅ Peran admin `%d` diubah menjadi %s.", id, roleLabels[role]))
+		sendMessage(bot, id, fmt.Sprintf("👮 Peran admin Anda diubah menjadi %s.", roleLabels[role]))
+	}
+	showAdmins(bot, chatID)
+	return nil
+}
+
+func removeAdmin(bot *tgbotapi.BotAPI, chatID, id int64) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		sendMessage(bot, chatID, "❌ Gagal membaca konfigurasi.")
+		return err
+	}
+	if id == cfg.AdminID {
+		sendMessage(bot, chatID, "❌ Owner utama tidak bisa dihapus.")
+		return errors.New("owner utama tidak bisa dihapus")
+	}
+	admins := cfg.Admins[:0]
+	removed := false
+	for _, a := range cfg.Admins {
+		if a.ID == id {
+			removed = true
+			continue
+		}
+		admins = append(admins, a)
+	}
+	if !removed {
+		sendMessage(bot, chatID, "❌ Admin tidak ditemukan.")
+		return errors.New("admin tidak ditemukan")
+	}
+	cfg.Admins = admins
+	if err := saveConfig(cfg); err != nil {
+		sendMessage(bot, chatID, "❌ Gagal menyimpan konfigurasi.")
+		return err
+	}
+	resetState(id)
+	sendMessage(bot, chatID, fmt.Sprintf("🗑️ Admin `%d` dihapus.", id))
+	showAdmins(bot, chatID)
+	return nil
+}
@@ -35,20 +35,12 @@ echo -e "${BOLD}ZiVPN IPtables Fixer${RESET}"
 echo -e "${GRAY}AutoFTbot Edition${RESET}"
 echo ""
 
-iface=$(ip -4 route ls | grep default | grep -Po '(?<=dev )(\S+)' | head -1)
-run_silent "Cleaning old rules" "iptables -t nat -D PREROUTING -i $iface -p udp --dport 6000:19999 -j DNAT --to-destination :5667 &>/dev/null"
-
-run_silent "Applying new rules" "iptables -t nat -A PREROUTING -i $iface -p udp --dport 6000:19999 -j DNAT --to-destination :5667"
-
-if [ -f /etc/iptables/rules.v4 ]; then
-    run_silent "Saving to rules.v4" "iptables-save > /etc/iptables/rules.v4"
-elif [ -f /etc/iptables.up.rules ]; then
-    run_silent "Saving to iptables.up.rules" "iptables-save > /etc/iptables.up.rules"
-else
-    run_silent "Saving configuration" "netfilter-persistent save &>/dev/null || service iptables save &>/dev/null"
-fi
+# Rule port hopping sekarang dikelola zivpn-api (lihat /api/network/porthop).
+# Restart API akan mendeteksi rule yang hilang/berbeda lalu memasangnya ulang,
+# termasuk membersihkan rule lama yang dibuat installer versi sebelumnya.
+run_silent "Reapplying port hopping rules" "systemctl restart zivpn-api"
 
 echo ""
 echo -e "${BOLD}Fix Complete${RESET}"
-echo -e "${GRAY}IPtables rules have been refreshed.${RESET}"
+echo -e "${GRAY}Port hopping rules have been refreshed by zivpn-api.${RESET}"
 echo ""